@@ -0,0 +1,329 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/ngicks/musicbox/compose/service"
+)
+
+// Operations recorded in State by BlueGreen.
+const (
+	OperationBlueGreenSwitch = "blue_green_switch"
+	OperationSwitchBack      = "switch_back"
+)
+
+// ErrNoPreviousProject is returned from BlueGreen.SwitchBack if no project has been replaced yet.
+var ErrNoPreviousProject = errors.New("no previous project")
+
+// BlueGreenState is the durable record of BlueGreen, stored in State.
+// The project of Active is State.Applied.
+type BlueGreenState struct {
+	// Active is the name of the project serving on the fronting network.
+	Active           string
+	ActiveWorkingDir string
+	// Previous is the name of the project Active has replaced, which is already torn down.
+	Previous           string
+	PreviousWorkingDir string
+	// PreviousProject is the project of Previous rendered as JSON, which SwitchBack creates again.
+	PreviousProject json.RawMessage `json:",omitempty"`
+	Switched        time.Time
+}
+
+// BlueGreenConfig configures BlueGreen.
+type BlueGreenConfig struct {
+	// BaseName names projects. They are alternately named BaseName-blue and BaseName-green.
+	BaseName string
+	// Network is the name of the fronting network, e.g. one which a reverse proxy is attached to.
+	// It is created as a bridge network if missing. It must not be declared by projects.
+	Network string
+	// Alias is the network alias by which containers of Services are reachable on Network.
+	Alias string
+	// Services are services which serve on Network.
+	Services []string
+	// Environment is used to load the previous project in SwitchBack,
+	// which restores sensitive values replaced in State, e.g. ones given by service.EnvInjector.
+	// It is typically the environment which the projects passed to Switch are loaded with.
+	Environment types.Mapping
+	// HealthTimeout limits waiting for the new project to be healthy. Zero means no limit other than ctx.
+	HealthTimeout time.Duration
+	// Logger defaults to a logger discarding everything.
+	Logger *slog.Logger
+}
+
+// BlueGreen switches a compose project to a new one without downtime.
+//
+// Switch creates the new project under the name not in use, either BaseName-blue or BaseName-green,
+// and waits for it to be healthy while the active project keeps serving.
+// Then it connects containers of Services of the new project to Network with Alias,
+// disconnects ones of the active project, and finally brings the active project down.
+// Since the engine has no atomic swap of aliases, both projects answer for Alias for a moment.
+//
+// Projects are registered to the ProjectManager, and BlueGreenState is recorded to the StateStore
+// along with the journal, so that a restarted process knows which project is active.
+// Methods of BlueGreen are goroutine safe; switches are serialized.
+type BlueGreen struct {
+	mu      sync.Mutex
+	manager *service.ProjectManager
+	store   StateStore
+	config  BlueGreenConfig
+	logger  *slog.Logger
+}
+
+// NewBlueGreen returns a new BlueGreen.
+func NewBlueGreen(manager *service.ProjectManager, store StateStore, config BlueGreenConfig) *BlueGreen {
+	logger := config.Logger
+	if logger == nil {
+		logger = nopLogger()
+	}
+	return &BlueGreen{
+		manager: manager,
+		store:   store,
+		config:  config,
+		logger:  logger,
+	}
+}
+
+// Active returns the recorded state, whose Active is empty if nothing has been switched to yet.
+func (b *BlueGreen) Active() (BlueGreenState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.load()
+}
+
+func (b *BlueGreen) load() (BlueGreenState, error) {
+	state, err := b.store.Load()
+	if err != nil {
+		return BlueGreenState{}, err
+	}
+	if state.BlueGreen == nil {
+		return BlueGreenState{}, nil
+	}
+	return *state.BlueGreen, nil
+}
+
+// nextName returns the project name not used by active.
+func (b *BlueGreen) nextName(active string) string {
+	if active == b.config.BaseName+"-blue" {
+		return b.config.BaseName + "-green"
+	}
+	return b.config.BaseName + "-blue"
+}
+
+// Switch makes project active as described in BlueGreen.
+// project is renamed, and mutated as NewService does.
+//
+// If the new project fails to become healthy or to be connected to Network,
+// it is brought down and the active project keeps serving.
+// Once the new project is connected, the switch has succeeded:
+// failures of disconnecting and bringing down the replaced project are only logged.
+// Named volumes of the replaced project are kept.
+func (b *BlueGreen) Switch(ctx context.Context, project *types.Project) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.switchTo(ctx, OperationBlueGreenSwitch, project)
+}
+
+// SwitchBack switches to the project which the active project has replaced, created again from the state.
+// It fails with ErrNoPreviousProject if there is no such project.
+func (b *BlueGreen) SwitchBack(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bg, err := b.load()
+	if err != nil {
+		return err
+	}
+	if len(bg.PreviousProject) == 0 {
+		return ErrNoPreviousProject
+	}
+	previous, err := loadAppliedProject(
+		ctx,
+		&types.Project{Name: bg.Previous, WorkingDir: bg.PreviousWorkingDir, Environment: b.config.Environment},
+		bg.PreviousProject,
+	)
+	if err != nil {
+		return fmt.Errorf("loading previous project: %w", err)
+	}
+	return b.switchTo(ctx, OperationSwitchBack, previous)
+}
+
+func (b *BlueGreen) switchTo(ctx context.Context, op string, project *types.Project) (err error) {
+	state, err := b.store.Load()
+	if err != nil {
+		return err
+	}
+	var bg BlueGreenState
+	if state.BlueGreen != nil {
+		bg = *state.BlueGreen
+	}
+	name := b.nextName(bg.Active)
+	project.Name = name
+
+	if err := beginOperation(b.store, op, project); err != nil {
+		return err
+	}
+	var next *service.Service
+	defer func() {
+		var redactor *service.Redactor
+		if next != nil {
+			redactor = next.Redactor()
+		}
+		if saveErr := recordEnd(b.store, project, redactor, err, func(state *State) {
+			state.BlueGreen = &BlueGreenState{
+				Active:             name,
+				ActiveWorkingDir:   project.WorkingDir,
+				Previous:           bg.Active,
+				PreviousWorkingDir: bg.ActiveWorkingDir,
+				PreviousProject:    state.Applied,
+				Switched:           time.Now(),
+			}
+		}); saveErr != nil {
+			b.logger.ErrorContext(ctx, "saving state failed", slog.Any("err", saveErr))
+		}
+	}()
+
+	// a project left by a failed switch is replaced.
+	b.manager.Remove(name)
+	next, err = b.manager.Add(name, project)
+	if err != nil {
+		return err
+	}
+	b.logger.InfoContext(ctx, "creating new project", slog.String("project", name))
+	if err := b.up(ctx, next); err != nil {
+		return b.abort(ctx, name, next, err)
+	}
+
+	cli := next.Client()
+	if err := b.connect(ctx, cli, name); err != nil {
+		return b.abort(ctx, name, next, err)
+	}
+	b.logger.InfoContext(ctx, "switched", slog.String("project", name), slog.String("replaced", bg.Active))
+
+	if bg.Active == "" {
+		return nil
+	}
+	if err := b.disconnect(ctx, cli, bg.Active); err != nil {
+		b.logger.WarnContext(ctx, "disconnecting replaced project failed", slog.Any("err", err))
+	}
+	if err := b.teardown(ctx, bg); err != nil {
+		b.logger.ErrorContext(ctx, "tearing down replaced project failed", slog.String("project", bg.Active), slog.Any("err", err))
+	}
+	return nil
+}
+
+func (b *BlueGreen) up(ctx context.Context, s *service.Service) error {
+	if _, err := s.Up(ctx, api.UpOptions{
+		Create: api.CreateOptions{RemoveOrphans: true, Recreate: api.RecreateDiverged, RecreateDependencies: api.RecreateDiverged},
+	}); err != nil {
+		return err
+	}
+	report, err := s.WaitHealthy(ctx, nil, b.config.HealthTimeout)
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, report)
+	}
+	return nil
+}
+
+// abort brings down the new project which has failed to be switched to, and returns cause.
+func (b *BlueGreen) abort(ctx context.Context, name string, s *service.Service, cause error) error {
+	b.logger.ErrorContext(ctx, "switch failed, bringing new project down", slog.String("project", name), slog.Any("err", cause))
+	if _, err := s.Down(ctx, api.DownOptions{RemoveOrphans: true}); err != nil {
+		cause = errors.Join(cause, fmt.Errorf("bringing %s down: %w", name, err))
+	}
+	b.manager.Remove(name)
+	return cause
+}
+
+// teardown brings the replaced project down, loading it from the state if this process has not registered it.
+func (b *BlueGreen) teardown(ctx context.Context, bg BlueGreenState) error {
+	old, ok := b.manager.Get(bg.Active)
+	if !ok {
+		state, err := b.store.Load()
+		if err != nil {
+			return err
+		}
+		project, err := loadAppliedProject(
+			ctx,
+			&types.Project{Name: bg.Active, WorkingDir: bg.ActiveWorkingDir, Environment: b.config.Environment},
+			state.Applied,
+		)
+		if err != nil {
+			return fmt.Errorf("loading replaced project: %w", err)
+		}
+		if old, err = b.manager.Add(bg.Active, project); err != nil {
+			return err
+		}
+	}
+	defer b.manager.Remove(bg.Active)
+	// the state is updated after teardown, thus Applied is still the replaced project.
+	_, err := old.Down(ctx, api.DownOptions{RemoveOrphans: true})
+	return err
+}
+
+func (b *BlueGreen) frontContainers(ctx context.Context, cli client.APIClient, projectName string) ([]dockertypes.Container, error) {
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", api.ProjectLabel+"="+projectName)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(containers, func(c dockertypes.Container) bool {
+		return !slices.Contains(b.config.Services, c.Labels[api.ServiceLabel])
+	}), nil
+}
+
+// connect connects containers of Services of projectName to Network with Alias, creating Network if missing.
+func (b *BlueGreen) connect(ctx context.Context, cli client.APIClient, projectName string) error {
+	if _, err := cli.NetworkInspect(ctx, b.config.Network, dockertypes.NetworkInspectOptions{}); err != nil {
+		if !client.IsErrNotFound(err) {
+			return err
+		}
+		if _, err := cli.NetworkCreate(ctx, b.config.Network, dockertypes.NetworkCreate{Driver: "bridge"}); err != nil {
+			return fmt.Errorf("creating network %s: %w", b.config.Network, err)
+		}
+	}
+
+	containers, err := b.frontContainers(ctx, cli, projectName)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("project %s has no running container of %s", projectName, strings.Join(b.config.Services, ", "))
+	}
+	for _, c := range containers {
+		err := cli.NetworkConnect(ctx, b.config.Network, c.ID, &network.EndpointSettings{Aliases: []string{b.config.Alias}})
+		if err != nil {
+			return fmt.Errorf("connecting %s to %s: %w", c.Names, b.config.Network, err)
+		}
+	}
+	return nil
+}
+
+func (b *BlueGreen) disconnect(ctx context.Context, cli client.APIClient, projectName string) error {
+	containers, err := b.frontContainers(ctx, cli, projectName)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range containers {
+		if err := cli.NetworkDisconnect(ctx, b.config.Network, c.ID, false); err != nil && !client.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("disconnecting %s from %s: %w", c.Names, b.config.Network, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/ngicks/musicbox/compose/service"
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestBlueGreen_nextName(t *testing.T) {
+	b := NewBlueGreen(nil, nil, BlueGreenConfig{BaseName: "app"})
+	assert.Equal(t, "app-blue", b.nextName(""))
+	assert.Equal(t, "app-green", b.nextName("app-blue"))
+	assert.Equal(t, "app-blue", b.nextName("app-green"))
+}
+
+func TestBlueGreen_failedSwitch(t *testing.T) {
+	// nothing listens on the port, so that every request to the daemon fails.
+	dockerCli, err := service.InitializeDockerCliWithEndpoint(service.DockerEndpointConfig{Host: "tcp://127.0.0.1:1"})
+	assert.NilError(t, err)
+	manager := service.NewProjectManager(dockerCli)
+
+	active := &types.Project{Name: "app-green", Services: types.Services{"web": {Name: "web", Image: "nginx"}}}
+	applied, err := active.MarshalJSON()
+	assert.NilError(t, err)
+	store := NewFileStateStore(afero.NewMemMapFs(), "/state.json")
+	assert.NilError(t, store.Save(State{
+		Applied:   applied,
+		BlueGreen: &BlueGreenState{Active: "app-green"},
+	}))
+
+	b := NewBlueGreen(manager, store, BlueGreenConfig{BaseName: "app", Network: "front", Alias: "web", Services: []string{"web"}})
+	ctx := context.Background()
+
+	err = b.SwitchBack(ctx)
+	assert.ErrorIs(t, err, ErrNoPreviousProject)
+
+	next := &types.Project{Services: types.Services{"web": {Name: "web", Image: "httpd"}}}
+	err = b.Switch(ctx, next)
+	assert.Assert(t, err != nil)
+	assert.Equal(t, "app-blue", next.Name)
+	// the failed project is not left registered.
+	assert.DeepEqual(t, []string{}, manager.Names())
+
+	state, err := store.Load()
+	assert.NilError(t, err)
+	assert.Assert(t, state.InFlight == nil)
+	assert.Equal(t, 1, len(state.Journal))
+	assert.Equal(t, OperationBlueGreenSwitch, state.Journal[0].Operation)
+	assert.Assert(t, state.Journal[0].Err != "")
+	// the active project keeps serving.
+	assert.Equal(t, "app-green", state.BlueGreen.Active)
+	var stored struct{ Name string }
+	assert.NilError(t, json.Unmarshal(state.Applied, &stored))
+	assert.Equal(t, "app-green", stored.Name)
+
+	bg, err := b.Active()
+	assert.NilError(t, err)
+	assert.Equal(t, "app-green", bg.Active)
+}
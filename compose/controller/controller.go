@@ -3,7 +3,6 @@ package controller
 import (
 	"io"
 	"log/slog"
-	"slices"
 	"sync"
 
 	"github.com/compose-spec/compose-go/v2/types"
@@ -15,6 +14,16 @@ type Controller struct {
 	logger      *slog.Logger
 	service     *service.Service
 	removalHook RemovalHook
+	// reconcileHook is optional.
+	reconcileHook ReconcileHook
+	// stateStore is optional.
+	stateStore StateStore
+	hooks      []registeredHook
+	// maintenance is loaded from stateStore on first use when maintenanceLoaded is false.
+	maintenance       *Maintenance
+	maintenanceLoaded bool
+	// restartPolicies are keyed by service names.
+	restartPolicies map[string]RestartPolicy
 }
 
 func nopLogger() *slog.Logger {
@@ -36,6 +45,10 @@ func New(service *service.Service, removalHook RemovalHook, opts ...Option) *Con
 }
 
 func enableAllService(p *types.Project) *types.Project {
-	p, _ = p.WithServicesEnabled(slices.Concat(p.ServiceNames(), p.DisabledServiceNames())...)
-	return p
+	enabled, err := service.Enable(p, p.DisabledServiceNames()...)
+	if err != nil {
+		// env_file of a disabled service is unreadable.
+		return p
+	}
+	return enabled
 }
@@ -8,10 +8,25 @@ import (
 	"github.com/ngicks/musicbox/compose/service"
 )
 
-func (c *Controller) Create(ctx context.Context) (service.Output, error) {
+func (c *Controller) Create(ctx context.Context) (output service.Output, err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	if err := c.checkMaintenance(); err != nil {
+		return service.Output{}, err
+	}
+	defer func() { err = c.handleError(ctx, OperationCreate, err) }()
+
+	target := c.service.Project()
+	if err := c.beginOperation(OperationCreate, target); err != nil {
+		return service.Output{}, err
+	}
+	defer func() { c.endOperation(ctx, target, err) }()
+
+	return c.create(ctx)
+}
 
+// create is Create without locking and journaling. c.mu must be held.
+func (c *Controller) create(ctx context.Context) (service.Output, error) {
 	dryRunService, dryRunCtx, err := c.service.DryRunMode(ctx)
 	if err != nil {
 		return service.Output{}, err
@@ -37,8 +52,19 @@ func (c *Controller) Create(ctx context.Context) (service.Output, error) {
 	if err != nil {
 		return service.Output{}, err
 	}
+	err = c.fireHooks(ctx, HookEvent{
+		Phase:     PhaseBeforeCreate,
+		Operation: OperationCreate,
+		Services:  beingRecreated,
+		Output:    output,
+	})
+	if err != nil {
+		return service.Output{}, err
+	}
 
-	c.service.UpdateProject(enableAllService)
+	if plan := c.service.UpdateProject(enableAllService); !plan.Empty() {
+		c.logger.DebugContext(ctx, "project updated", slog.Any("plan", plan))
+	}
 	return c.service.Create(ctx, api.CreateOptions{
 		RemoveOrphans: true,
 		Recreate:      api.RecreateDiverged,
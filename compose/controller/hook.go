@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/ngicks/musicbox/compose/service"
+)
+
+// ErrHookAborted is wrapped by errors returned from operations aborted by a hook registered with HookAbort.
+var ErrHookAborted = errors.New("aborted by hook")
+
+// Phase is a point in operations of Controller where hooks are called.
+type Phase string
+
+const (
+	// PhaseBeforeCreate is before containers are created or recreated.
+	// HookEvent.Output is the result of the dry run, if the operation does one.
+	PhaseBeforeCreate Phase = "before_create"
+	// PhaseAfterStart is after containers are started or restarted. HookEvent.Output is the result.
+	PhaseAfterStart Phase = "after_start"
+	// PhaseOnHealthChange is when health of services is observed:
+	// after waiting for services to become healthy, with HookEvent.Health,
+	// or when unhealthy containers are found, with HookEvent.Containers.
+	PhaseOnHealthChange Phase = "on_health_change"
+	// PhaseOnError is when an operation fails. HookEvent.Err is the error.
+	PhaseOnError Phase = "on_error"
+	// PhaseOnRemoveReplacer is before intermediate replacer containers are removed.
+	// HookEvent.Containers are their IDs.
+	PhaseOnRemoveReplacer Phase = "on_remove_replacer"
+	// PhaseDrain is when entering maintenance mode, before services are stopped.
+	// An aborting hook keeps Controller out of maintenance mode.
+	PhaseDrain Phase = "drain"
+	// PhaseUndrain is when exiting maintenance mode, after services are started again.
+	PhaseUndrain Phase = "undrain"
+)
+
+// HookEvent is passed to Hook.
+// Fields not relevant to Phase are left zero.
+type HookEvent struct {
+	Phase Phase
+	// Operation is one of Operation* constants.
+	Operation string
+	Services  []string
+	// Containers are names, or IDs, of containers.
+	Containers []string
+	Output     service.Output
+	Health     []service.HealthStatus
+	Err        error
+}
+
+// Hook is called at phases of operations of Controller, e.g. to notify, audit or gate them.
+type Hook interface {
+	OnEvent(ctx context.Context, event HookEvent) error
+}
+
+var _ Hook = HookFn(nil)
+
+type HookFn func(ctx context.Context, event HookEvent) error
+
+func (fn HookFn) OnEvent(ctx context.Context, event HookEvent) error {
+	return fn(ctx, event)
+}
+
+// HookErrorPolicy decides how Controller handles an error returned from Hook.
+type HookErrorPolicy int
+
+const (
+	// HookAbort makes the error abort the operation, skipping hooks registered after.
+	// For PhaseOnError, the operation has already failed and the error is joined to the returned one.
+	HookAbort HookErrorPolicy = iota
+	// HookContinue makes the error only logged.
+	HookContinue
+)
+
+type registeredHook struct {
+	hook   Hook
+	policy HookErrorPolicy
+	// phases is empty for all phases.
+	phases []Phase
+}
+
+func (h registeredHook) handles(phase Phase) bool {
+	if len(h.phases) == 0 {
+		return true
+	}
+	for _, p := range h.phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// fireHooks calls hooks handling event.Phase in order of registration.
+// It returns an error wrapping ErrHookAborted for the first error of a hook registered with HookAbort.
+func (c *Controller) fireHooks(ctx context.Context, event HookEvent) error {
+	for i, h := range c.hooks {
+		if !h.handles(event.Phase) {
+			continue
+		}
+		err := h.hook.OnEvent(ctx, event)
+		if err == nil {
+			continue
+		}
+		if h.policy == HookAbort {
+			return fmt.Errorf("%w: hook %d at %s: %w", ErrHookAborted, i, event.Phase, err)
+		}
+		c.logger.WarnContext(
+			ctx, "hook failed",
+			slog.Int("hook", i), slog.String("phase", string(event.Phase)), slog.Any("err", err),
+		)
+	}
+	return nil
+}
+
+// handleError fires PhaseOnError for op if err is non nil and returns err joined with an error of an aborting hook.
+func (c *Controller) handleError(ctx context.Context, op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if hookErr := c.fireHooks(ctx, HookEvent{Phase: PhaseOnError, Operation: op, Err: err}); hookErr != nil {
+		return errors.Join(err, hookErr)
+	}
+	return err
+}
@@ -0,0 +1,52 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestController_fireHooks(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	var called []string
+	record := func(name string, err error) Hook {
+		return HookFn(func(ctx context.Context, event HookEvent) error {
+			called = append(called, name+":"+string(event.Phase))
+			return err
+		})
+	}
+	recorder := &RecorderHook{}
+
+	c := New(nil, recorder,
+		WithHook(record("continue", sentinel), HookContinue),
+		WithHook(record("health", nil), HookAbort, PhaseOnHealthChange),
+		WithHook(record("abort", sentinel), HookAbort, PhaseBeforeCreate, PhaseOnError),
+		WithHook(recorder, HookContinue),
+	)
+	ctx := context.Background()
+
+	err := c.fireHooks(ctx, HookEvent{Phase: PhaseBeforeCreate, Operation: OperationCreate})
+	assert.ErrorIs(t, err, ErrHookAborted)
+	assert.ErrorIs(t, err, sentinel)
+	// hooks after the aborting one are skipped.
+	assert.DeepEqual(t, []string{"continue:before_create", "abort:before_create"}, called)
+	assert.Equal(t, 0, len(recorder.events))
+
+	called = nil
+	assert.NilError(t, c.fireHooks(ctx, HookEvent{Phase: PhaseAfterStart, Operation: OperationCreate}))
+	assert.DeepEqual(t, []string{"continue:after_start"}, called)
+	assert.Equal(t, 1, len(recorder.events))
+	assert.Equal(t, PhaseAfterStart, recorder.events[0].Phase)
+
+	called = nil
+	assert.NilError(t, c.fireHooks(ctx, HookEvent{Phase: PhaseOnHealthChange}))
+	assert.DeepEqual(t, []string{"continue:on_health_change", "health:on_health_change"}, called)
+
+	assert.NilError(t, c.handleError(ctx, OperationCreate, nil))
+	opErr := errors.New("op")
+	err = c.handleError(ctx, OperationCreate, opErr)
+	assert.ErrorIs(t, err, opErr)
+	assert.ErrorIs(t, err, ErrHookAborted)
+}
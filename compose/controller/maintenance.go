@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/ngicks/musicbox/compose/service"
+)
+
+// ErrMaintenance is wrapped by errors returned from operations rejected since Controller is in maintenance mode.
+var ErrMaintenance = errors.New("in maintenance mode")
+
+// Maintenance describes the maintenance mode, recorded in State.
+type Maintenance struct {
+	Since time.Time
+	// Services are services stopped by EnterMaintenance, which ExitMaintenance starts again.
+	Services []string
+}
+
+// InMaintenance reports whether c is in maintenance mode.
+func (c *Controller) InMaintenance() (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m, err := c.loadMaintenance()
+	return m != nil, err
+}
+
+// EnterMaintenance puts c into maintenance mode, draining services.
+// services are services to stop, or all services of the project if none is given.
+//
+// It calls hooks for PhaseDrain, then records the mode to the state store, if any,
+// so that a restarted process stays in maintenance mode, and finally stops services.
+// Services are stopped gracefully: containers are sent the stop signal and
+// killed after their stop_grace_period.
+//
+// While in maintenance mode, Create, RollingUpdate, Reconcile and Recover fail with ErrMaintenance.
+// If stopping fails, c stays in maintenance mode; ExitMaintenance starts services again.
+// EnterMaintenance does nothing if c is already in maintenance mode.
+func (c *Controller) EnterMaintenance(ctx context.Context, services ...string) (output service.Output, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if m, err := c.loadMaintenance(); err != nil || m != nil {
+		return service.Output{}, err
+	}
+	defer func() { err = c.handleError(ctx, OperationMaintenance, err) }()
+
+	if len(services) == 0 {
+		services = c.service.Project().ServiceNames()
+	}
+	err = c.fireHooks(ctx, HookEvent{Phase: PhaseDrain, Operation: OperationMaintenance, Services: services})
+	if err != nil {
+		return service.Output{}, err
+	}
+
+	if err := c.saveMaintenance(&Maintenance{Since: time.Now(), Services: services}); err != nil {
+		return service.Output{}, err
+	}
+	c.logger.InfoContext(ctx, "entered maintenance mode", slog.Any("services", services))
+
+	// nil Timeout lets the engine wait for the stop timeout of each container, set from stop_grace_period.
+	return c.service.Stop(ctx, api.StopOptions{Services: services})
+}
+
+// ExitMaintenance starts services stopped by EnterMaintenance, calls hooks for PhaseUndrain
+// and then leaves maintenance mode.
+// If starting fails or a hook aborts, c stays in maintenance mode.
+// ExitMaintenance does nothing if c is not in maintenance mode.
+func (c *Controller) ExitMaintenance(ctx context.Context) (output service.Output, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, err := c.loadMaintenance()
+	if err != nil || m == nil {
+		return service.Output{}, err
+	}
+	defer func() { err = c.handleError(ctx, OperationMaintenance, err) }()
+
+	output, err = c.service.Start(ctx, api.StartOptions{Services: m.Services})
+	if err != nil {
+		return output, err
+	}
+	err = c.fireHooks(ctx, HookEvent{Phase: PhaseUndrain, Operation: OperationMaintenance, Services: m.Services, Output: output})
+	if err != nil {
+		return output, err
+	}
+
+	if err := c.saveMaintenance(nil); err != nil {
+		return output, err
+	}
+	c.logger.InfoContext(ctx, "exited maintenance mode", slog.Any("services", m.Services))
+	return output, nil
+}
+
+// checkMaintenance returns an error wrapping ErrMaintenance if c is in maintenance mode. c.mu must be held.
+func (c *Controller) checkMaintenance() error {
+	m, err := c.loadMaintenance()
+	if err != nil {
+		return err
+	}
+	if m != nil {
+		return fmt.Errorf("%w: since %s", ErrMaintenance, m.Since.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// loadMaintenance returns the maintenance mode, loading it from the state store on first call.
+// c.mu must be held.
+func (c *Controller) loadMaintenance() (*Maintenance, error) {
+	if c.maintenanceLoaded || c.stateStore == nil {
+		return c.maintenance, nil
+	}
+	state, err := c.stateStore.Load()
+	if err != nil {
+		return nil, err
+	}
+	c.maintenance, c.maintenanceLoaded = state.Maintenance, true
+	return c.maintenance, nil
+}
+
+// saveMaintenance sets the maintenance mode, nil for leaving it, and records it to the state store if any.
+// c.mu must be held.
+func (c *Controller) saveMaintenance(m *Maintenance) error {
+	if c.stateStore != nil {
+		state, err := c.stateStore.Load()
+		if err != nil {
+			return err
+		}
+		state.Maintenance = m
+		if err := c.stateStore.Save(state); err != nil {
+			return err
+		}
+	}
+	c.maintenance, c.maintenanceLoaded = m, true
+	return nil
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestController_maintenance(t *testing.T) {
+	store := NewFileStateStore(afero.NewMemMapFs(), "/state.json")
+	c := New(nil, &RecorderHook{}, WithStateStore(store))
+	ctx := context.Background()
+
+	in, err := c.InMaintenance()
+	assert.NilError(t, err)
+	assert.Assert(t, !in)
+
+	assert.NilError(t, c.saveMaintenance(&Maintenance{Since: time.Now(), Services: []string{"web"}}))
+
+	// a restarted process stays in maintenance mode.
+	restarted := New(nil, &RecorderHook{}, WithStateStore(store))
+	in, err = restarted.InMaintenance()
+	assert.NilError(t, err)
+	assert.Assert(t, in)
+
+	_, err = restarted.Create(ctx)
+	assert.ErrorIs(t, err, ErrMaintenance)
+	_, err = restarted.RollingUpdate(ctx, RollingUpdateOptions{Project: &types.Project{Name: "sample"}})
+	assert.ErrorIs(t, err, ErrMaintenance)
+	_, err = restarted.Reconcile(ctx)
+	assert.ErrorIs(t, err, ErrMaintenance)
+	_, err = restarted.Recover(ctx)
+	assert.ErrorIs(t, err, ErrMaintenance)
+
+	// already in maintenance mode.
+	_, err = restarted.EnterMaintenance(ctx)
+	assert.NilError(t, err)
+
+	assert.NilError(t, c.saveMaintenance(nil))
+	state, err := store.Load()
+	assert.NilError(t, err)
+	assert.Assert(t, state.Maintenance == nil)
+	in, err = New(nil, &RecorderHook{}, WithStateStore(store)).InMaintenance()
+	assert.NilError(t, err)
+	assert.Assert(t, !in)
+}
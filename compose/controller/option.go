@@ -9,3 +9,35 @@ func WithLogger(logger *slog.Logger) Option {
 		c.logger = logger
 	}
 }
+
+// WithReconcileHook sets the hook receiving reports of Reconcile.
+func WithReconcileHook(hook ReconcileHook) Option {
+	return func(c *Controller) {
+		c.reconcileHook = hook
+	}
+}
+
+// WithStateStore makes Controller record its state to store, which Recover uses after a crash.
+func WithStateStore(store StateStore) Option {
+	return func(c *Controller) {
+		c.stateStore = store
+	}
+}
+
+// WithHook appends hook, called at phases, or all phases if none is given.
+// Hooks are called in order of options and policy decides how their errors are handled.
+func WithHook(hook Hook, policy HookErrorPolicy, phases ...Phase) Option {
+	return func(c *Controller) {
+		c.hooks = append(c.hooks, registeredHook{hook: hook, policy: policy, phases: phases})
+	}
+}
+
+// WithRestartPolicy registers policy for automatic restarts of service performed by WatchRestarts.
+func WithRestartPolicy(service string, policy RestartPolicy) Option {
+	return func(c *Controller) {
+		if c.restartPolicies == nil {
+			c.restartPolicies = map[string]RestartPolicy{}
+		}
+		c.restartPolicies[service] = policy
+	}
+}
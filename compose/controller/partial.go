@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/ngicks/musicbox/compose/service"
+)
+
+// ErrNoSuchService is wrapped by errors returned from StartServices and StopServices
+// when a name is not a service of the project. It is service.ErrNoSuchService.
+var ErrNoSuchService = service.ErrNoSuchService
+
+// StartServices starts names and services they depend on through depends_on, transitively,
+// leaving other services untouched.
+// Containers are started in dependency order; they must have been created, e.g. by Create.
+// Hooks for PhaseAfterStart are called with the started services.
+func (c *Controller) StartServices(ctx context.Context, names []string) (output service.Output, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkMaintenance(); err != nil {
+		return service.Output{}, err
+	}
+	defer func() { err = c.handleError(ctx, OperationStartServices, err) }()
+
+	c.service.UpdateProject(enableAllService)
+	project := c.service.Project()
+	closure, err := dependencyClosure(project, names)
+	if err != nil {
+		return service.Output{}, err
+	}
+	// compose starts all services of StartOptions.Project, ignoring StartOptions.Services.
+	subset, err := project.WithSelectedServices(closure, types.IgnoreDependencies)
+	if err != nil {
+		return service.Output{}, err
+	}
+
+	output, err = c.service.Start(ctx, api.StartOptions{Project: subset, Services: closure})
+	if err != nil {
+		return output, err
+	}
+	err = c.fireHooks(ctx, HookEvent{Phase: PhaseAfterStart, Operation: OperationStartServices, Services: closure, Output: output})
+	return output, err
+}
+
+// StopServices stops names and services depending on them through depends_on, transitively,
+// leaving other services untouched.
+// Containers are stopped in reverse dependency order, so that dependents stop before their dependencies.
+func (c *Controller) StopServices(ctx context.Context, names []string) (output service.Output, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkMaintenance(); err != nil {
+		return service.Output{}, err
+	}
+	defer func() { err = c.handleError(ctx, OperationStopServices, err) }()
+
+	c.service.UpdateProject(enableAllService)
+	closure, err := dependentClosure(c.service.Project(), names)
+	if err != nil {
+		return service.Output{}, err
+	}
+	return c.service.Stop(ctx, api.StopOptions{Services: closure})
+}
+
+// dependencyClosure returns names and services they depend on transitively,
+// ordered so that each service comes after its dependencies. Ties are broken by the name.
+// Dependencies absent from project are skipped unless required.
+func dependencyClosure(project *types.Project, names []string) ([]string, error) {
+	if err := checkServiceNames(project, names); err != nil {
+		return nil, err
+	}
+	var order []string
+	state := map[string]int{} // 1: visiting, 2: visited
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("dependency cycle found at service %s", name)
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		serviceCfg := project.Services[name]
+		for _, dep := range sortedDependencies(serviceCfg) {
+			if _, ok := project.Services[dep]; !ok {
+				if serviceCfg.DependsOn[dep].Required {
+					return fmt.Errorf("%w: %s, required by %s", ErrNoSuchService, dep, name)
+				}
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[name] = 2
+		order = append(order, name)
+		return nil
+	}
+
+	sorted := slices.Clone(names)
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// dependentClosure returns names and services depending on them transitively,
+// ordered so that each service comes before its dependencies.
+func dependentClosure(project *types.Project, names []string) ([]string, error) {
+	if err := checkServiceNames(project, names); err != nil {
+		return nil, err
+	}
+	dependents := map[string][]string{}
+	for _, name := range project.ServiceNames() {
+		for dep := range project.Services[name].DependsOn {
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+
+	set := map[string]bool{}
+	queue := slices.Clone(names)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if set[name] {
+			continue
+		}
+		set[name] = true
+		queue = append(queue, dependents[name]...)
+	}
+
+	all := make([]string, 0, len(set))
+	for name := range set {
+		all = append(all, name)
+	}
+	order, err := dependencyClosure(project, all)
+	if err != nil {
+		return nil, err
+	}
+	// dependencyClosure may add dependencies of dependents, which are not to be stopped.
+	order = slices.DeleteFunc(order, func(name string) bool { return !set[name] })
+	slices.Reverse(order)
+	return order, nil
+}
+
+func checkServiceNames(project *types.Project, names []string) error {
+	for _, name := range names {
+		if _, ok := project.Services[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrNoSuchService, name)
+		}
+	}
+	return nil
+}
+
+func sortedDependencies(serviceCfg types.ServiceConfig) []string {
+	deps := make([]string, 0, len(serviceCfg.DependsOn))
+	for dep := range serviceCfg.DependsOn {
+		deps = append(deps, dep)
+	}
+	sort.Strings(deps)
+	return deps
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"gotest.tools/v3/assert"
+)
+
+func TestDependencyClosure(t *testing.T) {
+	dependsOn := func(names ...string) types.DependsOnConfig {
+		d := types.DependsOnConfig{}
+		for _, name := range names {
+			d[name] = types.ServiceDependency{Condition: types.ServiceConditionStarted, Required: true}
+		}
+		return d
+	}
+	project := &types.Project{
+		Name: "sample",
+		Services: types.Services{
+			"db":     {Name: "db"},
+			"cache":  {Name: "cache"},
+			"api":    {Name: "api", DependsOn: dependsOn("db", "cache")},
+			"web":    {Name: "web", DependsOn: dependsOn("api")},
+			"worker": {Name: "worker", DependsOn: dependsOn("db")},
+			"other":  {Name: "other", DependsOn: types.DependsOnConfig{"absent": {Required: false}}},
+		},
+	}
+
+	closure, err := dependencyClosure(project, []string{"web"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"cache", "db", "api", "web"}, closure)
+
+	closure, err = dependencyClosure(project, []string{"worker", "cache"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"cache", "db", "worker"}, closure)
+
+	closure, err = dependencyClosure(project, []string{"other"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"other"}, closure)
+
+	closure, err = dependentClosure(project, []string{"db"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"worker", "web", "api", "db"}, closure)
+
+	closure, err = dependentClosure(project, []string{"api"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"web", "api"}, closure)
+
+	_, err = dependencyClosure(project, []string{"unknown"})
+	assert.ErrorIs(t, err, ErrNoSuchService)
+	_, err = dependentClosure(project, []string{"unknown"})
+	assert.ErrorIs(t, err, ErrNoSuchService)
+
+	project.Services["db"] = types.ServiceConfig{Name: "db", DependsOn: dependsOn("web")}
+	_, err = dependencyClosure(project, []string{"web"})
+	assert.ErrorContains(t, err, "cycle")
+}
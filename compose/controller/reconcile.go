@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types/container"
+	"github.com/ngicks/musicbox/compose/service"
+)
+
+// ReconcileHook receives reports of every Reconcile.
+type ReconcileHook interface {
+	OnReconcile(report ReconcileReport)
+}
+
+var _ ReconcileHook = ReconcileHookFn(nil)
+
+type ReconcileHookFn func(report ReconcileReport)
+
+func (fn ReconcileHookFn) OnReconcile(report ReconcileReport) {
+	fn(report)
+}
+
+// ReconcileReport describes what Reconcile has done.
+type ReconcileReport struct {
+	// Time is when Reconcile started.
+	Time time.Time
+	// Missing are services which had fewer containers than its scale,
+	// or which had stopped containers while the restart policy says they should be running.
+	// They are created and started.
+	Missing []string
+	// Restarted are names of unhealthy containers which are restarted.
+	Restarted []string
+	// Pruned are names of containers labeled with the project but not belonging to any service of it.
+	// They are removed.
+	Pruned []string
+	// Output is Output of creating and starting Missing services.
+	Output service.Output
+	// Err is the error returned from Reconcile.
+	Err error
+}
+
+// Converged reports whether Reconcile found nothing to do.
+func (r ReconcileReport) Converged() bool {
+	return len(r.Missing) == 0 && len(r.Restarted) == 0 && len(r.Pruned) == 0
+}
+
+// Reconcile compares the project of the service, the desired state, against containers actually present,
+// and converges the latter to the former:
+// it creates and starts missing containers, restarts unhealthy ones and removes strays labeled with the project.
+//
+// The removal hook is called with stray containers' services before they are removed.
+// The report is passed to the reconcile hook if any, as well as returned.
+// In maintenance mode, Reconcile does nothing and returns an error wrapping ErrMaintenance.
+func (c *Controller) Reconcile(ctx context.Context) (report ReconcileReport, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkMaintenance(); err != nil {
+		return ReconcileReport{}, err
+	}
+
+	report.Time = time.Now()
+	defer func() {
+		err = c.handleError(ctx, OperationReconcile, err)
+		report.Err = err
+		if c.reconcileHook != nil {
+			c.reconcileHook.OnReconcile(report)
+		}
+	}()
+
+	c.service.UpdateProject(enableAllService)
+	containers, err := c.service.Ps(ctx, api.PsOptions{All: true})
+	if err != nil {
+		return report, err
+	}
+
+	missing, unhealthy, strays := planReconcile(c.service.Project(), containers)
+	report.Missing = missing
+
+	var errs []error
+	if len(strays) > 0 {
+		var services []string
+		for _, cont := range strays {
+			services = append(services, cont.Service)
+		}
+		if err := c.removalHook.OnRemove(services); err != nil {
+			return report, err
+		}
+		for _, cont := range strays {
+			if err := c.service.Client().ContainerRemove(ctx, cont.ID, container.RemoveOptions{Force: true}); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			report.Pruned = append(report.Pruned, cont.Name)
+		}
+	}
+
+	if len(unhealthy) > 0 {
+		var services, names []string
+		for _, cont := range unhealthy {
+			services = append(services, cont.Service)
+			names = append(names, cont.Name)
+		}
+		err := c.fireHooks(ctx, HookEvent{
+			Phase:      PhaseOnHealthChange,
+			Operation:  OperationReconcile,
+			Services:   services,
+			Containers: names,
+		})
+		if err != nil {
+			return report, errors.Join(append(errs, err)...)
+		}
+	}
+	for _, cont := range unhealthy {
+		if err := c.service.Client().ContainerRestart(ctx, cont.ID, container.StopOptions{}); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		report.Restarted = append(report.Restarted, cont.Name)
+	}
+
+	if len(missing) > 0 {
+		err := c.fireHooks(ctx, HookEvent{Phase: PhaseBeforeCreate, Operation: OperationReconcile, Services: missing})
+		if err != nil {
+			return report, errors.Join(append(errs, err)...)
+		}
+		report.Output, err = c.service.Up(ctx, api.UpOptions{
+			Create: api.CreateOptions{Services: missing, Recreate: api.RecreateDiverged},
+			Start:  api.StartOptions{Services: missing},
+		})
+		if err != nil {
+			errs = append(errs, err)
+		} else if err := c.fireHooks(ctx, HookEvent{
+			Phase:     PhaseAfterStart,
+			Operation: OperationReconcile,
+			Services:  missing,
+			Output:    report.Output,
+		}); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if !report.Converged() {
+		c.logger.InfoContext(
+			ctx, "reconciled",
+			slog.Any("missing", report.Missing), slog.Any("restarted", report.Restarted), slog.Any("pruned", report.Pruned),
+		)
+	}
+	return report, errors.Join(errs...)
+}
+
+// RunLoop calls Reconcile every interval until ctx is done.
+// Errors from Reconcile are logged and reported through the reconcile hook but do not stop the loop.
+// Reconcile is skipped silently while c is in maintenance mode.
+// RunLoop returns ctx.Err().
+func (c *Controller) RunLoop(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := c.Reconcile(ctx); err != nil && ctx.Err() == nil && !errors.Is(err, ErrMaintenance) {
+			c.logger.ErrorContext(ctx, "reconcile failed", slog.Any("err", err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// planReconcile decides what to do to converge containers to project.
+// missing are sorted by the name, unhealthy and strays are sorted by the container name.
+// One-off containers, e.g. created by compose run, are ignored.
+func planReconcile(project *types.Project, containers []api.ContainerSummary) (missing []string, unhealthy, strays []api.ContainerSummary) {
+	byService := map[string][]api.ContainerSummary{}
+	for _, cont := range containers {
+		if cont.Labels[api.OneoffLabel] == "True" {
+			continue
+		}
+		if _, ok := project.Services[cont.Service]; !ok {
+			strays = append(strays, cont)
+			continue
+		}
+		byService[cont.Service] = append(byService[cont.Service], cont)
+	}
+
+	for _, name := range project.ServiceNames() {
+		serviceCfg := project.Services[name]
+		conts := byService[name]
+		if len(conts) < serviceCfg.GetScale() {
+			missing = append(missing, name)
+		} else if serviceCfg.Restart == types.RestartPolicyAlways || serviceCfg.Restart == types.RestartPolicyUnlessStopped {
+			for _, cont := range conts {
+				if cont.State != "running" && cont.State != "restarting" {
+					missing = append(missing, name)
+					break
+				}
+			}
+		}
+		for _, cont := range conts {
+			if cont.State == "running" && cont.Health == "unhealthy" {
+				unhealthy = append(unhealthy, cont)
+			}
+		}
+	}
+
+	sort.Slice(unhealthy, func(i, j int) bool { return unhealthy[i].Name < unhealthy[j].Name })
+	sort.Slice(strays, func(i, j int) bool { return strays[i].Name < strays[j].Name })
+	return missing, unhealthy, strays
+}
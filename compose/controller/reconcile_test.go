@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestPlanReconcile(t *testing.T) {
+	scale := 2
+	project := &types.Project{
+		Name: "sample",
+		Services: types.Services{
+			"web":     {Name: "web", Scale: &scale},
+			"db":      {Name: "db", Restart: types.RestartPolicyAlways},
+			"oneshot": {Name: "oneshot"},
+			"cache":   {Name: "cache"},
+		},
+	}
+	containers := []api.ContainerSummary{
+		{ID: "1", Name: "sample-web-1", Service: "web", State: "running", Health: "unhealthy"},
+		{ID: "2", Name: "sample-db-1", Service: "db", State: "exited"},
+		{ID: "3", Name: "sample-oneshot-1", Service: "oneshot", State: "exited"},
+		{ID: "4", Name: "sample-removed-1", Service: "removed", State: "running"},
+		// one-off containers neither satisfy the scale nor are pruned.
+		{ID: "5", Name: "sample-cache-run-1", Service: "cache", State: "running", Labels: map[string]string{api.OneoffLabel: "True"}},
+		{ID: "6", Name: "sample-removed-run-1", Service: "removed", State: "running", Labels: map[string]string{api.OneoffLabel: "True"}},
+	}
+
+	missing, unhealthy, strays := planReconcile(project, containers)
+	assert.DeepEqual(t, []string{"cache", "db", "web"}, missing)
+	assert.Equal(t, 1, len(unhealthy))
+	assert.Equal(t, "1", unhealthy[0].ID)
+	assert.Equal(t, 1, len(strays))
+	assert.Equal(t, "4", strays[0].ID)
+
+	assert.Assert(t, ReconcileReport{}.Converged())
+	assert.Assert(t, !ReconcileReport{Pruned: []string{"sample-removed-1"}}.Converged())
+}
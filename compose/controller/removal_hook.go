@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"strings"
 )
 
@@ -52,13 +53,23 @@ func (h CombinedRemovalHook) OnRemove(serviceName []string) error {
 	return nil
 }
 
-var _ RemovalHook = (*RecorderHook)(nil)
+var (
+	_ RemovalHook = (*RecorderHook)(nil)
+	_ Hook        = (*RecorderHook)(nil)
+)
 
+// RecorderHook records calls as both of RemovalHook and Hook.
 type RecorderHook struct {
 	history [][]string
+	events  []HookEvent
 }
 
 func (h *RecorderHook) OnRemove(serviceName []string) error {
 	h.history = append(h.history, serviceName)
 	return nil
 }
+
+func (h *RecorderHook) OnEvent(ctx context.Context, event HookEvent) error {
+	h.events = append(h.events, event)
+	return nil
+}
@@ -12,7 +12,11 @@ import (
 func (c *Controller) RemoveReplacer(ctx context.Context) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	return c.handleError(ctx, OperationRemoveReplacer, c.removeReplacer(ctx))
+}
 
+// removeReplacer is RemoveReplacer without locking. c.mu must be held.
+func (c *Controller) removeReplacer(ctx context.Context) error {
 	c.service.UpdateProject(enableAllService)
 
 	containers, err := c.service.Ps(ctx, api.PsOptions{All: true})
@@ -43,6 +47,14 @@ func (c *Controller) RemoveReplacer(ctx context.Context) error {
 		}
 	}
 
+	if len(ids) == 0 {
+		return nil
+	}
+	err = c.fireHooks(ctx, HookEvent{Phase: PhaseOnRemoveReplacer, Operation: OperationRemoveReplacer, Containers: ids})
+	if err != nil {
+		return err
+	}
+
 	for _, id := range ids {
 		err = c.service.Client().ContainerRemove(ctx, id, container.RemoveOptions{})
 		if err != nil {
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
-	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -34,6 +33,7 @@ func TestRemoveReplacer_dind(t *testing.T) {
 
 	testFn := func(fn func(t *testing.T, oldController, newController *Controller) error) {
 		testhelper.RunComposeTest(
+			t,
 			projectName,
 			[]string{"./testdata/compose.yml"},
 			func(loader *compose.LoaderProxy) {
@@ -41,13 +41,8 @@ func TestRemoveReplacer_dind(t *testing.T) {
 					err error
 				)
 
-				oldService, _ := loader.LoadComposeService(
-					context.Background(),
-					func(p *composeV2Types.Project) error {
-						p, _ = p.WithServicesEnabled(slices.Concat(p.ServiceNames(), p.DisabledServiceNames())...)
-						return nil
-					},
-				)
+				// Controller enables all services by itself.
+				oldService, _ := loader.LoadComposeService(context.Background())
 				newLoader, _ := compose.NewLoaderProxy(
 					loader.ProjectName(),
 					func() composeV2Types.ConfigDetails {
@@ -60,13 +55,7 @@ func TestRemoveReplacer_dind(t *testing.T) {
 					loader.Options(),
 					nil,
 				)
-				newService, _ := newLoader.LoadComposeService(
-					context.Background(),
-					func(p *composeV2Types.Project) error {
-						p, _ = p.WithServicesEnabled(slices.Concat(p.ServiceNames(), p.DisabledServiceNames())...)
-						return nil
-					},
-				)
+				newService, _ := newLoader.LoadComposeService(context.Background())
 
 				logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
 
@@ -81,7 +70,7 @@ func TestRemoveReplacer_dind(t *testing.T) {
 					containers, err := client.ContainerList(context.Background(), types.ContainerListOptions{
 						All: true,
 						Filters: filters.NewArgs(
-							filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, projectName)),
+							filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, loader.ProjectName())),
 							filters.Arg("label", fmt.Sprintf("%s=%s", api.ServiceLabel, "fake_pre")),
 						),
 					})
@@ -122,7 +111,10 @@ func TestRemoveReplacer_dind(t *testing.T) {
 				assert.NilError(t, err)
 
 				assert.NilError(t, fn(t, oldController, newController))
-			})
+			},
+			testhelper.WithImages("busybox:1.36"),
+			testhelper.WithFixtureVolume("fixture", os.DirFS("./testdata/fixture")),
+		)
 	}
 
 	testFn(func(t *testing.T, oldController, newController *Controller) error {
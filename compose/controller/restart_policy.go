@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrRestartThrottled is passed to hooks for PhaseOnError when WatchRestarts gives up
+// restarting a crashed container since RestartPolicy.MaxPerHour is exceeded.
+var ErrRestartThrottled = errors.New("restart throttled")
+
+// RestartPolicy constrains automatic restarts of crashed containers of a service performed by WatchRestarts.
+type RestartPolicy struct {
+	// Windows are times of day in which restarts are allowed.
+	// A crash outside them is restarted when the next window opens. Empty means any time.
+	Windows []RestartWindow
+	// MaxPerHour is the maximum number of restarts of the service in the last hour.
+	// Crashes exceeding it are not restarted. Zero means unlimited.
+	MaxPerHour int
+	// MinBackoff and MaxBackoff bound the delay before each restart, which doubles on consecutive crashes.
+	// If zero, 1s and 5m are used respectively.
+	MinBackoff, MaxBackoff time.Duration
+	// ResetAfter is the duration since the last restart after which a crash is no longer considered consecutive.
+	// If zero, 1h is used.
+	ResetAfter time.Duration
+}
+
+// RestartWindow is a time of day from Start to End, both offsets since midnight in the local time.
+// End less than Start means the window spans midnight.
+type RestartWindow struct {
+	Start, End time.Duration
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second +
+		time.Duration(t.Nanosecond())
+}
+
+// Contains reports whether t is in w.
+func (w RestartWindow) Contains(t time.Time) bool {
+	off := sinceMidnight(t)
+	if w.Start <= w.End {
+		return w.Start <= off && off < w.End
+	}
+	return off >= w.Start || off < w.End
+}
+
+// untilOpen returns the duration from t until w opens, zero if t is in w.
+func (w RestartWindow) untilOpen(t time.Time) time.Duration {
+	if w.Contains(t) {
+		return 0
+	}
+	d := w.Start - sinceMidnight(t)
+	if d < 0 {
+		d += 24 * time.Hour
+	}
+	return d
+}
+
+// restartTracker keeps restarts of a service to apply RestartPolicy.
+type restartTracker struct {
+	policy   RestartPolicy
+	restarts []time.Time
+	// consecutive is the number of consecutive restarts, determining the backoff.
+	consecutive int
+}
+
+// schedule decides the delay before restarting a container crashed at now and reserves the restart,
+// or returns an error wrapping ErrRestartThrottled.
+func (t *restartTracker) schedule(now time.Time) (time.Duration, error) {
+	hourAgo := now.Add(-time.Hour)
+	t.restarts = slices.DeleteFunc(t.restarts, func(r time.Time) bool { return !r.After(hourAgo) })
+	if t.policy.MaxPerHour > 0 && len(t.restarts) >= t.policy.MaxPerHour {
+		return 0, fmt.Errorf("%w: %d restarts in the last hour", ErrRestartThrottled, len(t.restarts))
+	}
+
+	resetAfter := t.policy.ResetAfter
+	if resetAfter <= 0 {
+		resetAfter = time.Hour
+	}
+	if len(t.restarts) == 0 || now.Sub(slices.MaxFunc(t.restarts, time.Time.Compare)) > resetAfter {
+		t.consecutive = 0
+	}
+
+	delay := t.backoff()
+	if len(t.policy.Windows) > 0 {
+		until := 24 * time.Hour
+		for _, w := range t.policy.Windows {
+			if d := w.untilOpen(now.Add(delay)); d < until {
+				until = d
+			}
+		}
+		delay += until
+	}
+
+	t.consecutive++
+	t.restarts = append(t.restarts, now.Add(delay))
+	return delay, nil
+}
+
+func (t *restartTracker) backoff() time.Duration {
+	minBackoff, maxBackoff := t.policy.MinBackoff, t.policy.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = time.Second
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 5 * time.Minute
+	}
+	d := minBackoff
+	for i := 0; i < t.consecutive && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d
+}
+
+// WatchRestarts restarts crashed containers of services which have RestartPolicy registered by WithRestartPolicy,
+// until ctx is done. It returns ctx.Err(), or an error if no policy is registered or events cannot be subscribed.
+//
+// A container is considered crashed when it dies with a non zero exit code without being stopped or killed,
+// e.g. by `docker stop` or by operations of Controller. Restarts are skipped in maintenance mode.
+// Services should have no restart policy of the engine, i.e. `restart: "no"`, otherwise both restart them.
+//
+// Each restart is reported to hooks for PhaseAfterStart with OperationAutoRestart,
+// and throttled or failed restarts are reported to hooks for PhaseOnError.
+func (c *Controller) WatchRestarts(ctx context.Context) error {
+	if len(c.restartPolicies) == 0 {
+		return errors.New("controller.WatchRestarts: no restart policy registered")
+	}
+	trackers := map[string]*restartTracker{}
+	services := make([]string, 0, len(c.restartPolicies))
+	for name, policy := range c.restartPolicies {
+		trackers[name] = &restartTracker{policy: policy}
+		services = append(services, name)
+	}
+
+	events, err := c.service.Events(ctx, api.EventsOptions{Services: services})
+	if err != nil {
+		return err
+	}
+
+	// killed are containers being stopped or killed, whose next die event is not a crash.
+	killed := map[string]bool{}
+	pending := map[string]*time.Timer{}
+	defer func() {
+		for _, timer := range pending {
+			timer.Stop()
+		}
+	}()
+	due := make(chan api.Event)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event := <-due:
+			delete(pending, event.Container)
+			c.autoRestart(ctx, event)
+		case event, ok := <-events:
+			if !ok {
+				return ctx.Err()
+			}
+			switch event.Status {
+			case "kill":
+				killed[event.Container] = true
+			case "start":
+				delete(killed, event.Container)
+			case "destroy":
+				delete(killed, event.Container)
+				if timer, ok := pending[event.Container]; ok {
+					timer.Stop()
+					delete(pending, event.Container)
+				}
+			case "die":
+				if killed[event.Container] {
+					delete(killed, event.Container)
+					continue
+				}
+				if event.Attributes["exitCode"] == "0" {
+					continue
+				}
+				if _, ok := pending[event.Container]; ok {
+					continue
+				}
+				delay, err := trackers[event.Service].schedule(time.Now())
+				if err != nil {
+					c.logger.WarnContext(ctx, "restart skipped", slog.String("service", event.Service), slog.Any("err", err))
+					_ = c.fireHooks(ctx, HookEvent{
+						Phase:      PhaseOnError,
+						Operation:  OperationAutoRestart,
+						Services:   []string{event.Service},
+						Containers: []string{event.Attributes["name"]},
+						Err:        err,
+					})
+					continue
+				}
+				c.logger.InfoContext(
+					ctx, "container crashed, scheduling restart",
+					slog.String("service", event.Service), slog.String("container", event.Attributes["name"]),
+					slog.Duration("delay", delay),
+				)
+				event := event
+				pending[event.Container] = time.AfterFunc(delay, func() {
+					select {
+					case <-ctx.Done():
+					case due <- event:
+					}
+				})
+			}
+		}
+	}
+}
+
+// autoRestart restarts the container of event unless it is already running or c is in maintenance mode.
+func (c *Controller) autoRestart(ctx context.Context, event api.Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.checkMaintenance(); err != nil {
+		c.logger.InfoContext(ctx, "restart skipped", slog.String("service", event.Service), slog.Any("err", err))
+		return
+	}
+
+	hookEvent := HookEvent{
+		Operation:  OperationAutoRestart,
+		Services:   []string{event.Service},
+		Containers: []string{event.Attributes["name"]},
+	}
+	err := func() error {
+		inspected, err := c.service.Client().ContainerInspect(ctx, event.Container)
+		if err != nil {
+			return err
+		}
+		if inspected.State != nil && inspected.State.Running {
+			return nil
+		}
+		if err := c.service.Client().ContainerRestart(ctx, event.Container, container.StopOptions{}); err != nil {
+			return err
+		}
+		hookEvent.Phase = PhaseAfterStart
+		return c.fireHooks(ctx, hookEvent)
+	}()
+	if err != nil {
+		c.logger.ErrorContext(ctx, "restart failed", slog.String("service", event.Service), slog.Any("err", err))
+		hookEvent.Phase, hookEvent.Err = PhaseOnError, err
+		_ = c.fireHooks(ctx, hookEvent)
+	}
+}
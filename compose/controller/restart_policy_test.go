@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRestartWindow(t *testing.T) {
+	at := func(h, m int) time.Time { return time.Date(2024, 3, 1, h, m, 0, 0, time.Local) }
+
+	w := RestartWindow{Start: 2 * time.Hour, End: 4 * time.Hour}
+	assert.Assert(t, w.Contains(at(2, 0)))
+	assert.Assert(t, w.Contains(at(3, 59)))
+	assert.Assert(t, !w.Contains(at(4, 0)))
+	assert.Equal(t, time.Duration(0), w.untilOpen(at(3, 0)))
+	assert.Equal(t, time.Hour, w.untilOpen(at(1, 0)))
+	assert.Equal(t, 22*time.Hour, w.untilOpen(at(4, 0)))
+
+	overnight := RestartWindow{Start: 22 * time.Hour, End: 2 * time.Hour}
+	assert.Assert(t, overnight.Contains(at(23, 0)))
+	assert.Assert(t, overnight.Contains(at(1, 0)))
+	assert.Assert(t, !overnight.Contains(at(12, 0)))
+}
+
+func TestRestartTracker(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local)
+	tracker := &restartTracker{policy: RestartPolicy{
+		MaxPerHour: 3,
+		MinBackoff: time.Second,
+		MaxBackoff: 3 * time.Second,
+		ResetAfter: 10 * time.Minute,
+	}}
+
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		delay, err := tracker.schedule(now)
+		assert.NilError(t, err)
+		assert.Equal(t, expected, delay)
+		now = now.Add(time.Minute)
+	}
+	_, err := tracker.schedule(now)
+	assert.ErrorIs(t, err, ErrRestartThrottled)
+
+	// an hour later, old restarts are forgotten and the backoff is reset.
+	now = now.Add(time.Hour)
+	delay, err := tracker.schedule(now)
+	assert.NilError(t, err)
+	assert.Equal(t, time.Second, delay)
+
+	windowed := &restartTracker{policy: RestartPolicy{
+		Windows: []RestartWindow{{Start: 13 * time.Hour, End: 14 * time.Hour}, {Start: 20 * time.Hour, End: 21 * time.Hour}},
+	}}
+	delay, err = windowed.schedule(time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local))
+	assert.NilError(t, err)
+	assert.Equal(t, time.Hour, delay)
+}
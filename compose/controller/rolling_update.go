@@ -0,0 +1,275 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/ngicks/musicbox/compose/service"
+)
+
+// ErrRolledBack is wrapped by errors returned from RollingUpdate when it has rolled back to the previous project.
+var ErrRolledBack = errors.New("rolled back")
+
+// RollingUpdateOptions configures RollingUpdate.
+type RollingUpdateOptions struct {
+	// Project is the new project to roll out. It is required.
+	Project *types.Project
+	// BatchSize is the number of services updated at once. Values less than 1 mean 1.
+	BatchSize int
+	// HealthTimeout bounds waiting for each batch to become healthy. Zero means waiting until ctx is done.
+	HealthTimeout time.Duration
+}
+
+// RollingUpdateResult is the result of RollingUpdate.
+type RollingUpdateResult struct {
+	Plan service.ProjectPlan
+	// Updated are batches of services updated successfully, in order.
+	Updated [][]string
+	// Removed are services removed after all batches, i.e. RemovedServices of Plan, if they have been removed successfully.
+	Removed []string
+	// Outputs are outputs of operations in order, including ones for rolling back.
+	Outputs    []service.Output
+	RolledBack bool
+}
+
+// RollingUpdate updates services to options.Project a batch at a time.
+//
+// Services to update are ones added or changed in service.CompareProject,
+// except ones marked service.ActionNone. Services marked service.ActionRestart are restarted,
+// others are created, or recreated, and started,
+// where compose creates a replacement container and then removes the old one.
+// After each batch, RollingUpdate waits until services of the batch become healthy
+// and moves on to the next batch only if they do.
+//
+// Once all batches have succeeded, services removed in service.CompareProject are stopped and removed.
+//
+// Before updating, intermediate replacer containers left behind are removed as RemoveReplacer does,
+// and the removal hook is called with services being recreated in each batch and with services being removed.
+//
+// If any batch or the removal fails, RollingUpdate brings all services touched so far,
+// including ones being removed, back to the previous project
+// and returns an error wrapping ErrRolledBack and the cause.
+func (c *Controller) RollingUpdate(ctx context.Context, options RollingUpdateOptions) (result RollingUpdateResult, err error) {
+	if options.Project == nil {
+		return RollingUpdateResult{}, errors.New("controller.RollingUpdate: options.Project is nil")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkMaintenance(); err != nil {
+		return RollingUpdateResult{}, err
+	}
+	defer func() { err = c.handleError(ctx, OperationRollingUpdate, err) }()
+
+	if err := c.removeReplacer(ctx); err != nil {
+		return RollingUpdateResult{}, err
+	}
+
+	previous := c.service.Project()
+	next := enableAllService(options.Project)
+	service.AddDockerComposeLabel(next)
+
+	if err := c.beginOperation(OperationRollingUpdate, next); err != nil {
+		return RollingUpdateResult{}, err
+	}
+	defer func() { c.endOperation(ctx, next, err) }()
+
+	result.Plan = service.CompareProject(previous, next)
+	recreate, restart := rollingTargets(result.Plan)
+	removed := result.Plan.RemovedServices
+	c.logger.DebugContext(ctx, "rolling update", slog.Any("plan", result.Plan))
+	c.service.UpdateProject(func(*types.Project) *types.Project { return next })
+	if len(recreate) == 0 && len(restart) == 0 && len(removed) == 0 {
+		return result, nil
+	}
+
+	var touched []string
+	for _, batch := range batches(append(recreate, restart...), options.BatchSize) {
+		touched = append(touched, batch...)
+		err := c.updateBatch(ctx, batch, restart, options.HealthTimeout, &result)
+		if err == nil {
+			result.Updated = append(result.Updated, batch)
+			continue
+		}
+
+		c.logger.ErrorContext(ctx, "rolling update failed, rolling back", slog.Any("batch", batch), slog.Any("err", err))
+		return result, c.rollbackOnFailure(ctx, previous, next, touched, fmt.Errorf("batch %v: %w", batch, err), &result)
+	}
+
+	if len(removed) > 0 {
+		err := c.removeServices(ctx, previous, removed, &result)
+		if err != nil {
+			c.logger.ErrorContext(ctx, "removing services failed, rolling back", slog.Any("services", removed), slog.Any("err", err))
+			touched = append(touched, removed...)
+			return result, c.rollbackOnFailure(ctx, previous, next, touched, fmt.Errorf("removing %v: %w", removed, err), &result)
+		}
+		result.Removed = removed
+	}
+	return result, nil
+}
+
+// removeServices stops and removes services of previous which the new project no longer has.
+func (c *Controller) removeServices(ctx context.Context, previous *types.Project, services []string, result *RollingUpdateResult) error {
+	if err := c.removalHook.OnRemove(services); err != nil {
+		return err
+	}
+	// services are looked up in previous, since the current project does not have them.
+	out, err := c.service.Remove(ctx, api.RemoveOptions{Project: previous, Services: services, Stop: true, Force: true})
+	result.Outputs = append(result.Outputs, out)
+	return err
+}
+
+// rollbackOnFailure rolls services back by rollback and returns an error wrapping ErrRolledBack and cause.
+func (c *Controller) rollbackOnFailure(
+	ctx context.Context,
+	previous, failed *types.Project,
+	services []string,
+	cause error,
+	result *RollingUpdateResult,
+) error {
+	rollbackErr := c.rollback(ctx, previous, failed, services, result)
+	err := fmt.Errorf("%w: %w", ErrRolledBack, cause)
+	if rollbackErr != nil {
+		return errors.Join(err, fmt.Errorf("rollback: %w", rollbackErr))
+	}
+	return err
+}
+
+func (c *Controller) updateBatch(
+	ctx context.Context,
+	batch []string,
+	restart []string,
+	healthTimeout time.Duration,
+	result *RollingUpdateResult,
+) error {
+	var toRestart, toUp []string
+	for _, name := range batch {
+		if slices.Contains(restart, name) {
+			toRestart = append(toRestart, name)
+		} else {
+			toUp = append(toUp, name)
+		}
+	}
+
+	if len(toUp) > 0 {
+		if err := c.removalHook.OnRemove(toUp); err != nil {
+			return err
+		}
+		err := c.fireHooks(ctx, HookEvent{Phase: PhaseBeforeCreate, Operation: OperationRollingUpdate, Services: toUp})
+		if err != nil {
+			return err
+		}
+		out, err := c.service.Up(ctx, api.UpOptions{
+			Create: api.CreateOptions{Services: toUp, Recreate: api.RecreateDiverged},
+			Start:  api.StartOptions{Services: toUp},
+		})
+		result.Outputs = append(result.Outputs, out)
+		if err != nil {
+			return err
+		}
+		err = c.fireHooks(ctx, HookEvent{Phase: PhaseAfterStart, Operation: OperationRollingUpdate, Services: toUp, Output: out})
+		if err != nil {
+			return err
+		}
+	}
+	if len(toRestart) > 0 {
+		out, err := c.service.Restart(ctx, api.RestartOptions{Services: toRestart})
+		result.Outputs = append(result.Outputs, out)
+		if err != nil {
+			return err
+		}
+		err = c.fireHooks(ctx, HookEvent{Phase: PhaseAfterStart, Operation: OperationRollingUpdate, Services: toRestart, Output: out})
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := c.service.WaitHealthy(ctx, batch, healthTimeout)
+	hookErr := c.fireHooks(ctx, HookEvent{
+		Phase:     PhaseOnHealthChange,
+		Operation: OperationRollingUpdate,
+		Services:  batch,
+		Health:    report,
+		Err:       err,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", err, report)
+	}
+	// hooks may gate batches by their own criteria.
+	return hookErr
+}
+
+// rollback brings services back to previous.
+// Services in previous, including ones the update has removed, are created if missing, recreated if diverged, and started.
+// Services not in previous, i.e. added by the update, are stopped and removed, being looked up in failed.
+func (c *Controller) rollback(ctx context.Context, previous, failed *types.Project, services []string, result *RollingUpdateResult) error {
+	result.RolledBack = true
+	c.service.UpdateProject(func(*types.Project) *types.Project { return previous })
+
+	var existing, added []string
+	for _, name := range services {
+		if _, ok := previous.Services[name]; ok {
+			existing = append(existing, name)
+		} else {
+			added = append(added, name)
+		}
+	}
+
+	var errs []error
+	if len(existing) > 0 {
+		out, err := c.service.Up(ctx, api.UpOptions{
+			Create: api.CreateOptions{Services: existing, Recreate: api.RecreateDiverged},
+			Start:  api.StartOptions{Services: existing},
+		})
+		result.Outputs = append(result.Outputs, out)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(added) > 0 {
+		out, err := c.service.Remove(ctx, api.RemoveOptions{Project: failed, Services: added, Stop: true, Force: true})
+		result.Outputs = append(result.Outputs, out)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// rollingTargets returns services to be recreated and restarted by applying plan, in ascending order.
+func rollingTargets(plan service.ProjectPlan) (recreate, restart []string) {
+	recreate = append(recreate, plan.AddedServices...)
+	for _, change := range plan.ChangedServices {
+		switch change.Action {
+		case service.ActionRecreate:
+			recreate = append(recreate, change.Name)
+		case service.ActionRestart:
+			restart = append(restart, change.Name)
+		}
+	}
+	slices.Sort(recreate)
+	return recreate, restart
+}
+
+// batches splits names into chunks of size.
+func batches(names []string, size int) [][]string {
+	if size < 1 {
+		size = 1
+	}
+	var out [][]string
+	for len(names) > 0 {
+		n := size
+		if n > len(names) {
+			n = len(names)
+		}
+		out = append(out, names[:n:n])
+		names = names[n:]
+	}
+	return out
+}
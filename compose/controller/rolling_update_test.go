@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/ngicks/musicbox/compose/service"
+	"github.com/ngicks/musicbox/compose/testhelper"
+	"gotest.tools/v3/assert"
+)
+
+func TestRollingTargets(t *testing.T) {
+	recreate, restart := rollingTargets(service.ProjectPlan{
+		AddedServices: []string{"d", "a"},
+		ChangedServices: []service.ServiceChange{
+			{Name: "b", Action: service.ActionRecreate},
+			{Name: "c", Action: service.ActionRestart},
+			{Name: "e", Action: service.ActionNone},
+		},
+	})
+	assert.DeepEqual(t, []string{"a", "b", "d"}, recreate)
+	assert.DeepEqual(t, []string{"c"}, restart)
+}
+
+func TestBatches(t *testing.T) {
+	names := []string{"a", "b", "c", "d", "e"}
+	assert.DeepEqual(t, [][]string{{"a"}, {"b"}, {"c"}, {"d"}, {"e"}}, batches(names, 0))
+	assert.DeepEqual(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, batches(names, 2))
+	assert.DeepEqual(t, [][]string{{"a", "b", "c", "d", "e"}}, batches(names, 10))
+	assert.Equal(t, 0, len(batches(nil, 2)))
+}
+
+func TestRollingUpdate_dind(t *testing.T) {
+	testhelper.RunComposeTest(
+		t,
+		"orchestrator-controller-rolling-update-test",
+		[]string{"./testdata/rolling_update.yml"},
+		func(loader *service.LoaderProxy) {
+			ctx := context.Background()
+			s, err := loader.LoadComposeService(ctx)
+			assert.NilError(t, err)
+			c := New(s, &RecorderHook{})
+			_, err = s.Up(ctx, api.UpOptions{})
+			assert.NilError(t, err)
+
+			containersOf := func(name string) []dockertypes.Container {
+				containers, err := loader.DockerCli().Client().ContainerList(ctx, container.ListOptions{
+					All: true,
+					Filters: filters.NewArgs(
+						filters.Arg("label", api.ProjectLabel+"="+loader.ProjectName()),
+						filters.Arg("label", api.ServiceLabel+"="+name),
+					),
+				})
+				assert.NilError(t, err)
+				return containers
+			}
+
+			// a service added by a failing update is removed by the rollback.
+			failing, err := loader.Load(ctx)
+			assert.NilError(t, err)
+			failing.Services["added"] = types.ServiceConfig{
+				Name:    "added",
+				Image:   "busybox:1.36",
+				Command: types.ShellCommand{"false"},
+			}
+			result, err := c.RollingUpdate(ctx, RollingUpdateOptions{Project: failing, HealthTimeout: 3 * time.Second})
+			assert.ErrorIs(t, err, ErrRolledBack)
+			assert.Assert(t, result.RolledBack)
+			assert.Equal(t, 0, len(containersOf("added")))
+			assert.Equal(t, 1, len(containersOf("keep")))
+
+			// a service dropped by a successful update is removed after all batches.
+			next, err := loader.Load(ctx)
+			assert.NilError(t, err)
+			delete(next.Services, "dropped")
+			result, err = c.RollingUpdate(ctx, RollingUpdateOptions{Project: next, HealthTimeout: 30 * time.Second})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, []string{"dropped"}, result.Removed)
+			assert.Equal(t, 0, len(containersOf("dropped")))
+			assert.Equal(t, 1, len(containersOf("keep")))
+		},
+		testhelper.WithImages("busybox:1.36"),
+	)
+}
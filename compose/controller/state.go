@@ -0,0 +1,291 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/ngicks/musicbox/compose/service"
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/spf13/afero"
+)
+
+// Operations recorded in State and passed to hooks as HookEvent.Operation.
+const (
+	OperationCreate         = "create"
+	OperationRollingUpdate  = "rolling_update"
+	OperationRecover        = "recover"
+	OperationReconcile      = "reconcile"
+	OperationRemoveReplacer = "remove_replacer"
+	OperationMaintenance    = "maintenance"
+	OperationStartServices  = "start_services"
+	OperationStopServices   = "stop_services"
+	OperationAutoRestart    = "auto_restart"
+)
+
+// JournalLimit is the maximum number of entries kept in State.Journal.
+const JournalLimit = 100
+
+// State is the durable record of what Controller has done.
+type State struct {
+	// AppliedHash is ProjectHash of the project applied by the last successful operation.
+	AppliedHash string
+	// Applied is the project applied by the last successful operation, rendered as JSON.
+	// Sensitive values known to the Redactor of the service are replaced as service.Redactor.RedactProjectJSON does,
+	// so that they are restored from the environment of the current project when Applied is loaded again.
+	Applied json.RawMessage `json:",omitempty"`
+	// InFlight is the operation being executed. It is left non nil if the process crashed in the middle of it.
+	InFlight *JournalEntry `json:",omitempty"`
+	// Journal lists finished operations, oldest first, up to JournalLimit.
+	Journal []JournalEntry
+	// Maintenance is non nil while Controller is in maintenance mode.
+	Maintenance *Maintenance `json:",omitempty"`
+	// BlueGreen is recorded by BlueGreen.
+	BlueGreen *BlueGreenState `json:",omitempty"`
+}
+
+// JournalEntry is an operation recorded in State.
+type JournalEntry struct {
+	Operation string
+	// TargetHash is ProjectHash of the project the operation was applying.
+	TargetHash string
+	Started    time.Time
+	Finished   time.Time `json:",omitempty"`
+	// Err is the error message if the operation failed.
+	Err string `json:",omitempty"`
+}
+
+// StateStore persists State.
+type StateStore interface {
+	// Load returns the stored State, or the zero State if nothing is stored yet.
+	Load() (State, error)
+	Save(state State) error
+}
+
+var _ StateStore = (*FileStateStore)(nil)
+
+// FileStateStore stores State as a JSON file, replaced atomically by fsutil.SafeWrite on every Save.
+// The file is readable only by the owner.
+type FileStateStore struct {
+	mu     sync.Mutex
+	fsys   afero.Fs
+	path   string
+	option *fsutil.SafeWriteOption
+}
+
+// NewFileStateStore returns FileStateStore storing State at path in fsys.
+// opts are passed to fsutil.NewSafeWriteOption.
+func NewFileStateStore(fsys afero.Fs, path string, opts ...fsutil.SafeWriteOptionOption) *FileStateStore {
+	return &FileStateStore{
+		fsys:   fsys,
+		path:   filepath.Clean(path),
+		option: fsutil.NewSafeWriteOption(opts...),
+	}
+}
+
+func (s *FileStateStore) Load() (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bin, err := afero.ReadFile(s.fsys, s.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return State{}, nil
+		}
+		return State{}, err
+	}
+	var state State
+	if err := json.Unmarshal(bin, &state); err != nil {
+		return State{}, fmt.Errorf("decoding state %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+func (s *FileStateStore) Save(state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bin, err := json.MarshalIndent(state, "", "    ")
+	if err != nil {
+		return err
+	}
+	return s.option.SafeWrite(s.fsys, s.path, 0o600, bytes.NewReader(bin))
+}
+
+// ProjectHash returns the hex encoded sha256 of the project rendered as JSON.
+func ProjectHash(project *types.Project) (string, error) {
+	bin, err := project.MarshalJSON()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bin)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// beginOperation records op applying target as in flight. It does nothing if c has no state store.
+// c.mu must be held.
+func (c *Controller) beginOperation(op string, target *types.Project) error {
+	if c.stateStore == nil {
+		return nil
+	}
+	return beginOperation(c.stateStore, op, target)
+}
+
+func beginOperation(store StateStore, op string, target *types.Project) error {
+	state, err := store.Load()
+	if err != nil {
+		return err
+	}
+	hash, err := ProjectHash(target)
+	if err != nil {
+		return err
+	}
+	state.InFlight = &JournalEntry{Operation: op, TargetHash: hash, Started: time.Now()}
+	return store.Save(state)
+}
+
+// endOperation moves the in-flight operation to the journal, and records target as applied if opErr is nil.
+// Failures of the store are only logged since the operation itself has already finished.
+// c.mu must be held.
+func (c *Controller) endOperation(ctx context.Context, target *types.Project, opErr error) {
+	if c.stateStore == nil {
+		return
+	}
+	var redactor *service.Redactor
+	if c.service != nil {
+		redactor = c.service.Redactor()
+	}
+	if err := recordEnd(c.stateStore, target, redactor, opErr, nil); err != nil {
+		c.logger.ErrorContext(ctx, "saving state failed", slog.Any("err", err))
+	}
+}
+
+// recordEnd moves the in-flight operation of store to the journal.
+// If opErr is nil, update, if non nil, is called with the state still holding the previously applied project,
+// and then target is recorded as applied, with sensitive values of redactor replaced.
+func recordEnd(store StateStore, target *types.Project, redactor *service.Redactor, opErr error, update func(state *State)) error {
+	state, err := store.Load()
+	if err != nil {
+		return err
+	}
+	if state.InFlight == nil {
+		return nil
+	}
+	entry := *state.InFlight
+	entry.Finished = time.Now()
+	if opErr != nil {
+		entry.Err = opErr.Error()
+	} else {
+		bin, err := target.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		if update != nil {
+			update(&state)
+		}
+		state.Applied = redactor.RedactProjectJSON(bin, target.Environment)
+		state.AppliedHash = entry.TargetHash
+	}
+	state.InFlight = nil
+	state.Journal = append(state.Journal, entry)
+	if len(state.Journal) > JournalLimit {
+		state.Journal = append([]JournalEntry(nil), state.Journal[len(state.Journal)-JournalLimit:]...)
+	}
+	return store.Save(state)
+}
+
+// RecoverResult is the result of Recover.
+type RecoverResult struct {
+	// Interrupted is the operation found in flight, nil if the last run finished cleanly.
+	Interrupted *JournalEntry
+	// Resumed is true if the interrupted operation was applying the current project and Recover applied it again.
+	Resumed bool
+	// RolledBack is true if Recover brought services back to the last applied project.
+	RolledBack bool
+	Output     service.Output
+}
+
+// Recover resumes or rolls back an operation interrupted by a crash of a previous process,
+// by examining the in-flight marker of the state store.
+//
+// If the interrupted operation was applying the current project of the service, Recover applies it again,
+// as Create does. Otherwise it creates services from the last applied project, which becomes the current project.
+// If nothing has been applied yet, the current project is applied.
+// Recover does nothing if c has no state store or no operation was interrupted.
+func (c *Controller) Recover(ctx context.Context) (result RecoverResult, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkMaintenance(); err != nil {
+		return result, err
+	}
+	defer func() { err = c.handleError(ctx, OperationRecover, err) }()
+
+	if c.stateStore == nil {
+		return result, nil
+	}
+	state, err := c.stateStore.Load()
+	if err != nil {
+		return result, err
+	}
+	if state.InFlight == nil {
+		return result, nil
+	}
+	interrupted := *state.InFlight
+	result.Interrupted = &interrupted
+	c.logger.InfoContext(ctx, "recovering interrupted operation", slog.Any("operation", interrupted))
+
+	current := c.service.Project()
+	currentHash, err := ProjectHash(current)
+	if err != nil {
+		return result, err
+	}
+
+	target := current
+	switch {
+	case currentHash == interrupted.TargetHash || len(state.Applied) == 0:
+		result.Resumed = true
+	default:
+		applied, err := loadAppliedProject(ctx, current, state.Applied)
+		if err != nil {
+			return result, fmt.Errorf("loading last applied project: %w", err)
+		}
+		service.AddDockerComposeLabel(applied)
+		c.service.UpdateProject(func(*types.Project) *types.Project { return applied })
+		target = applied
+		result.RolledBack = true
+	}
+
+	if err := c.beginOperation(OperationRecover, target); err != nil {
+		return result, err
+	}
+	defer func() { c.endOperation(ctx, target, err) }()
+
+	result.Output, err = c.create(ctx)
+	return result, err
+}
+
+func loadAppliedProject(ctx context.Context, current *types.Project, applied json.RawMessage) (*types.Project, error) {
+	return loader.LoadWithContext(
+		ctx,
+		types.ConfigDetails{
+			WorkingDir:  current.WorkingDir,
+			ConfigFiles: []types.ConfigFile{{Filename: "applied.json", Content: applied}},
+			Environment: current.Environment,
+		},
+		func(o *loader.Options) {
+			o.SetProjectName(current.Name, true)
+			o.Profiles = []string{"*"}
+		},
+	)
+}
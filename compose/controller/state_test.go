@@ -0,0 +1,109 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/ngicks/musicbox/compose/service"
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestFileStateStore(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	store := NewFileStateStore(fsys, "/state/controller.json")
+
+	state, err := store.Load()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, State{}, state)
+
+	state = State{AppliedHash: "abc", Journal: []JournalEntry{{Operation: OperationCreate, TargetHash: "abc"}}}
+	assert.NilError(t, store.Save(state))
+	loaded, err := store.Load()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, state, loaded)
+}
+
+func TestController_journal(t *testing.T) {
+	store := NewFileStateStore(afero.NewMemMapFs(), "/state.json")
+	c := &Controller{logger: nopLogger(), stateStore: store}
+	ctx := context.Background()
+
+	first := &types.Project{Name: "sample", Services: types.Services{"web": {Name: "web", Image: "nginx"}}}
+	second := &types.Project{Name: "sample", Services: types.Services{"web": {Name: "web", Image: "httpd"}}}
+	firstHash, err := ProjectHash(first)
+	assert.NilError(t, err)
+	secondHash, err := ProjectHash(second)
+	assert.NilError(t, err)
+	assert.Assert(t, firstHash != secondHash)
+
+	assert.NilError(t, c.beginOperation(OperationCreate, first))
+	state, _ := store.Load()
+	assert.Equal(t, OperationCreate, state.InFlight.Operation)
+	assert.Equal(t, firstHash, state.InFlight.TargetHash)
+	c.endOperation(ctx, first, nil)
+
+	assert.NilError(t, c.beginOperation(OperationRollingUpdate, second))
+	c.endOperation(ctx, second, errors.New("failed"))
+
+	state, _ = store.Load()
+	assert.Assert(t, state.InFlight == nil)
+	// failed operations do not change the applied project.
+	assert.Equal(t, firstHash, state.AppliedHash)
+	assert.Equal(t, 2, len(state.Journal))
+	assert.Equal(t, "", state.Journal[0].Err)
+	assert.Equal(t, "failed", state.Journal[1].Err)
+	assert.Equal(t, secondHash, state.Journal[1].TargetHash)
+
+	for i := 0; i < JournalLimit+10; i++ {
+		assert.NilError(t, c.beginOperation(OperationCreate, first))
+		c.endOperation(ctx, first, nil)
+	}
+	state, _ = store.Load()
+	assert.Equal(t, JournalLimit, len(state.Journal))
+
+	applied, err := loadAppliedProject(ctx, &types.Project{Name: "sample", WorkingDir: t.TempDir()}, state.Applied)
+	assert.NilError(t, err)
+	assert.Equal(t, "nginx", applied.Services["web"].Image)
+}
+
+func TestFileStateStore_sensitive(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	store := NewFileStateStore(afero.NewOsFs(), path)
+	ctx := context.Background()
+
+	secret := "s3cr3t"
+	project := &types.Project{
+		Name:        "sample",
+		WorkingDir:  dir,
+		Environment: types.Mapping{"DB_PASSWORD": secret},
+		Services: types.Services{"web": {
+			Name:        "web",
+			Image:       "nginx",
+			Environment: types.MappingWithEquals{"PASSWORD": &secret},
+		}},
+	}
+	assert.NilError(t, beginOperation(store, OperationCreate, project))
+	assert.NilError(t, recordEnd(store, project, service.NewRedactor(secret), nil, nil))
+
+	bin, err := os.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(string(bin), secret), string(bin))
+	info, err := os.Stat(path)
+	assert.NilError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	// restored from the environment of the current project.
+	state, err := store.Load()
+	assert.NilError(t, err)
+	applied, err := loadAppliedProject(ctx, project, state.Applied)
+	assert.NilError(t, err)
+	assert.Equal(t, secret, *applied.Services["web"].Environment["PASSWORD"])
+}
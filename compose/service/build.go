@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+// BuildResult is the result of building an image for a service.
+type BuildResult struct {
+	Service string
+	// Image is the name of the built image.
+	Image string
+	// ImageID is the ID of the image, inspected after the build. It is empty in dry run mode.
+	ImageID string
+}
+
+// BuildOutput is Output of Build with results of each built service, sorted by service name.
+type BuildOutput struct {
+	Output
+	Results []BuildResult
+}
+
+// Build executes the equivalent to a `compose build`.
+//
+// mutators are applied to a clone of the project only for this build, in the same manner as UpdateProject,
+// e.g. to inject build args or secrets by WithBuildArgs or WithBuildSecret. The project itself is not changed.
+//
+// After a successful build, images of built services are inspected to populate BuildOutput.Results.
+func (s *Service) Build(ctx context.Context, options api.BuildOptions, mutators ...func(p *types.Project) *types.Project) (BuildOutput, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+
+	project, _ := s.project.WithServicesEnabled()
+	for _, mut := range mutators {
+		project = mut(project)
+	}
+
+	ctx, end := s.startSpan(ctx, "build", options.Services)
+	err := s.service.Build(ctx, project, options)
+	out := BuildOutput{Output: s.parseOutput()}
+	end(&out.Output, err)
+	if err != nil {
+		return out, err
+	}
+
+	for name, serviceCfg := range project.Services {
+		if serviceCfg.Build == nil || (len(options.Services) > 0 && !contains(options.Services, name)) {
+			continue
+		}
+		result := BuildResult{Service: name, Image: api.GetImageNameOrDefault(serviceCfg, project.Name)}
+		if !s.dryRun {
+			inspected, _, err := s.cli.Client().ImageInspectWithRaw(ctx, result.Image)
+			if err != nil {
+				return out, err
+			}
+			result.ImageID = inspected.ID
+		}
+		out.Results = append(out.Results, result)
+	}
+	sort.Slice(out.Results, func(i, j int) bool { return out.Results[i].Service < out.Results[j].Service })
+	return out, nil
+}
+
+func contains(s []string, v string) bool {
+	for _, ss := range s {
+		if ss == v {
+			return true
+		}
+	}
+	return false
+}
+
+// forEachBuild calls fn with build config of the service named service, or of every service if service is empty.
+// Services without build config are skipped.
+func forEachBuild(p *types.Project, service string, fn func(build *types.BuildConfig)) {
+	for name, serviceCfg := range p.Services {
+		if serviceCfg.Build == nil || (service != "" && name != service) {
+			continue
+		}
+		fn(serviceCfg.Build)
+		p.Services[name] = serviceCfg
+	}
+}
+
+// WithBuildArgs returns a mutator for Build which sets args as build args of service.
+// If service is empty, args are set to all services which have build config.
+func WithBuildArgs(service string, args types.MappingWithEquals) func(p *types.Project) *types.Project {
+	return func(p *types.Project) *types.Project {
+		forEachBuild(p, service, func(build *types.BuildConfig) {
+			if build.Args == nil {
+				build.Args = types.MappingWithEquals{}
+			}
+			for k, v := range args {
+				build.Args[k] = v
+			}
+		})
+		return p
+	}
+}
+
+// WithBuildSecret returns a mutator for Build which adds secret as a project level secret named name,
+// and exposes it to builds of service, where it is available as /run/secrets/<name> by `RUN --mount=type=secret`.
+// If service is empty, the secret is exposed to all services which have build config.
+func WithBuildSecret(service string, name string, secret types.SecretConfig) func(p *types.Project) *types.Project {
+	return func(p *types.Project) *types.Project {
+		if p.Secrets == nil {
+			p.Secrets = types.Secrets{}
+		}
+		p.Secrets[name] = secret
+		forEachBuild(p, service, func(build *types.BuildConfig) {
+			for _, s := range build.Secrets {
+				if s.Source == name {
+					return
+				}
+			}
+			build.Secrets = append(build.Secrets, types.ServiceSecretConfig{Source: name})
+		})
+		return p
+	}
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"gotest.tools/v3/assert"
+)
+
+func TestBuildMutators(t *testing.T) {
+	strPtr := func(s string) *string { return &s }
+	project := &types.Project{
+		Name: "sample",
+		Services: types.Services{
+			"built":       {Name: "built", Build: &types.BuildConfig{Context: ".", Args: types.MappingWithEquals{"FOO": strPtr("foo")}}},
+			"built2":      {Name: "built2", Build: &types.BuildConfig{Context: "."}},
+			"image_based": {Name: "image_based", Image: "alpine"},
+		},
+	}
+
+	project = WithBuildArgs("", types.MappingWithEquals{"BAR": strPtr("bar")})(project)
+	project = WithBuildArgs("built2", types.MappingWithEquals{"BAZ": strPtr("baz")})(project)
+	assert.DeepEqual(t, types.MappingWithEquals{"FOO": strPtr("foo"), "BAR": strPtr("bar")}, project.Services["built"].Build.Args)
+	assert.DeepEqual(t, types.MappingWithEquals{"BAR": strPtr("bar"), "BAZ": strPtr("baz")}, project.Services["built2"].Build.Args)
+	assert.Assert(t, project.Services["image_based"].Build == nil)
+
+	secret := types.SecretConfig{File: "./secret.txt"}
+	project = WithBuildSecret("built", "token", secret)(project)
+	project = WithBuildSecret("built", "token", secret)(project)
+	assert.DeepEqual(t, secret, project.Secrets["token"])
+	assert.DeepEqual(t, []types.ServiceSecretConfig{{Source: "token"}}, project.Services["built"].Build.Secrets)
+	assert.Equal(t, 0, len(project.Services["built2"].Build.Secrets))
+}
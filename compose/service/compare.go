@@ -1,9 +1,12 @@
 package service
 
 import (
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/compose"
 )
 
 // CompareProjectImage compares 2 projects and return image names which only exists in old, new respectively.
@@ -38,3 +41,181 @@ func fallbackLatest(i string) string {
 	}
 	return i + ":latest"
 }
+
+// Action is what applying a ProjectPlan would do to containers of a service.
+type Action string
+
+const (
+	// ActionNone means containers are not affected, e.g. only build config or scale changed.
+	ActionNone Action = "none"
+	// ActionRestart means containers need restarting to pick up changes of secrets or configs they refer to.
+	ActionRestart Action = "restart"
+	// ActionRecreate means containers are recreated,
+	// since the service config or networks or volumes they use are changed.
+	ActionRecreate Action = "recreate"
+)
+
+// ServiceChange describes a service changed between 2 projects.
+type ServiceChange struct {
+	Name string
+	// Fields are yaml keys of the service config which differ, e.g. "image", "environment", "ports", "volumes" or "healthcheck",
+	// sorted in ascending order.
+	Fields []string
+	// Resources are changed top-level networks, volumes, secrets and configs the service refers to,
+	// formatted as "<kind>:<name>", e.g. "network:sample network", sorted in ascending order.
+	Resources []string
+	Action    Action
+}
+
+// ResourceChanges lists names of top-level resources, i.e. networks, volumes, secrets or configs, changed between 2 projects.
+// All of them are sorted in ascending order.
+type ResourceChanges struct {
+	Added, Removed, Changed []string
+}
+
+func (c ResourceChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0
+}
+
+// ProjectPlan is the difference between 2 projects, which is what applying the new project would do.
+type ProjectPlan struct {
+	// AddedServices and RemovedServices are names of services, sorted in ascending order.
+	AddedServices, RemovedServices []string
+	// ChangedServices are services whose config or resources they refer to differ, sorted by the name.
+	ChangedServices []ServiceChange
+
+	Networks, Volumes, Secrets, Configs ResourceChanges
+}
+
+// Empty reports whether p has no changes.
+func (p ProjectPlan) Empty() bool {
+	return len(p.AddedServices) == 0 && len(p.RemovedServices) == 0 && len(p.ChangedServices) == 0 &&
+		p.Networks.empty() && p.Volumes.empty() && p.Secrets.empty() && p.Configs.empty()
+}
+
+// Recreated returns names of services whose containers are recreated by applying p.
+func (p ProjectPlan) Recreated() []string {
+	var names []string
+	for _, c := range p.ChangedServices {
+		if c.Action == ActionRecreate {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// CompareProject compares enabled services and top-level resources of 2 projects and returns the plan
+// to bring a project from old to new.
+//
+// A changed service is marked ActionRecreate if its config hash, which compose uses to decide recreating containers, differs,
+// or networks or volumes it refers to are changed.
+// Otherwise it is marked ActionRestart if secrets or configs it refers to are changed, or ActionNone.
+func CompareProject(old, new *types.Project) ProjectPlan {
+	var plan ProjectPlan
+	plan.AddedServices, plan.RemovedServices, _ = compareMaps(old.Services, new.Services)
+	plan.Networks.Added, plan.Networks.Removed, plan.Networks.Changed = compareMaps(old.Networks, new.Networks)
+	plan.Volumes.Added, plan.Volumes.Removed, plan.Volumes.Changed = compareMaps(old.Volumes, new.Volumes)
+	plan.Secrets.Added, plan.Secrets.Removed, plan.Secrets.Changed = compareMaps(old.Secrets, new.Secrets)
+	plan.Configs.Added, plan.Configs.Removed, plan.Configs.Changed = compareMaps(old.Configs, new.Configs)
+
+	for _, name := range new.ServiceNames() {
+		oldService, ok := old.Services[name]
+		if !ok {
+			continue
+		}
+		newService := new.Services[name]
+
+		change := ServiceChange{
+			Name:      name,
+			Fields:    changedFields(oldService, newService),
+			Resources: changedResources(newService, plan),
+			Action:    ActionNone,
+		}
+		if len(change.Fields) == 0 && len(change.Resources) == 0 {
+			continue
+		}
+
+		oldHash, _ := compose.ServiceHash(oldService)
+		newHash, _ := compose.ServiceHash(newService)
+		switch {
+		case oldHash != newHash:
+			change.Action = ActionRecreate
+		default:
+			for _, r := range change.Resources {
+				kind, _, _ := strings.Cut(r, ":")
+				if kind == "network" || kind == "volume" {
+					change.Action = ActionRecreate
+					break
+				}
+				change.Action = ActionRestart
+			}
+		}
+		plan.ChangedServices = append(plan.ChangedServices, change)
+	}
+	return plan
+}
+
+func compareMaps[M ~map[string]V, V any](old, new M) (added, removed, changed []string) {
+	for name, v := range new {
+		oldV, ok := old[name]
+		switch {
+		case !ok:
+			added = append(added, name)
+		case !reflect.DeepEqual(oldV, v):
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := new[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// changedFields returns yaml keys of fields which differ between old and new.
+// Fields not serialized to yaml, e.g. CustomLabels, are ignored.
+func changedFields(old, new types.ServiceConfig) []string {
+	oldRv, newRv := reflect.ValueOf(old), reflect.ValueOf(new)
+	var fields []string
+	for i := 0; i < oldRv.NumField(); i++ {
+		key, _, _ := strings.Cut(oldRv.Type().Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		if !reflect.DeepEqual(oldRv.Field(i).Interface(), newRv.Field(i).Interface()) {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// changedResources returns changed top-level resources service refers to.
+func changedResources(service types.ServiceConfig, plan ProjectPlan) []string {
+	var resources []string
+	add := func(kind string, name string, changed []string) {
+		if contains(changed, name) && !contains(resources, kind+":"+name) {
+			resources = append(resources, kind+":"+name)
+		}
+	}
+	for name := range service.Networks {
+		add("network", name, plan.Networks.Changed)
+	}
+	for _, v := range service.Volumes {
+		if v.Type == types.VolumeTypeVolume {
+			add("volume", v.Source, plan.Volumes.Changed)
+		}
+	}
+	for _, s := range service.Secrets {
+		add("secret", s.Source, plan.Secrets.Changed)
+	}
+	for _, c := range service.Configs {
+		add("config", c.Source, plan.Configs.Changed)
+	}
+	sort.Strings(resources)
+	return resources
+}
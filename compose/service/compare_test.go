@@ -78,3 +78,47 @@ func TestCompareProjectImage(t *testing.T) {
 	assert.Assert(t, cmp.DeepEqual([]string{"debian:bookworm-20230904"}, onlyInOld))
 	assert.Assert(t, cmp.DeepEqual([]string(nil), addedInNew))
 }
+
+func TestCompareProject(t *testing.T) {
+	ctx := context.Background()
+	old, err := loaderAdditional.Load(ctx)
+	assert.NilError(t, err)
+	newer, err := loaderAdditional2.Load(ctx)
+	assert.NilError(t, err)
+
+	plan := CompareProject(old, newer)
+	assert.Assert(t, cmp.DeepEqual([]string{"additional2", "no_profile"}, plan.AddedServices))
+	assert.Assert(t, cmp.DeepEqual([]string(nil), plan.RemovedServices))
+	assert.Assert(t, cmp.DeepEqual(
+		[]ServiceChange{{Name: "additional", Fields: []string{"image"}, Action: ActionRecreate}},
+		plan.ChangedServices,
+	))
+	assert.Assert(t, cmp.DeepEqual([]string{"additional"}, plan.Recreated()))
+	assert.Assert(t, CompareProject(old, old).Empty())
+
+	modified, err := loaderAdditional.Load(ctx)
+	assert.NilError(t, err)
+	secret := modified.Secrets["sample_secret"]
+	secret.File = "./other.txt"
+	modified.Secrets["sample_secret"] = secret
+	additional := modified.Services["additional"]
+	additional.Scale = new(int)
+	*additional.Scale = 3
+	modified.Services["additional"] = additional
+
+	plan = CompareProject(old, modified)
+	assert.Assert(t, cmp.DeepEqual(ResourceChanges{Changed: []string{"sample_secret"}}, plan.Secrets))
+	assert.Assert(t, cmp.DeepEqual(
+		[]ServiceChange{
+			{Name: "additional", Fields: []string{"scale"}, Action: ActionNone},
+			{Name: "sample_service", Resources: []string{"secret:sample_secret"}, Action: ActionRestart},
+		},
+		plan.ChangedServices,
+	))
+
+	network := modified.Networks["sample network"]
+	network.Internal = true
+	modified.Networks["sample network"] = network
+	plan = CompareProject(old, modified)
+	assert.Assert(t, cmp.DeepEqual([]string{"sample_service"}, plan.Recreated()))
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/compose-spec/compose-go/v2/schema"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/compose-spec/compose-go/v2/validation"
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+// ErrInvalidProject is wrapped by errors returned from Validate.
+var ErrInvalidProject = errors.New("invalid project")
+
+// Config executes the equivalent to a `compose config`, rendering the fully interpolated project.
+// options.Format is either "yaml" or "json", and defaults to "yaml" if empty.
+// options.Output is ignored; callers write the returned bytes where they want.
+func (s *Service) Config(ctx context.Context, options api.ConfigOptions) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if options.Format == "" {
+		options.Format = "yaml"
+	}
+	bin, err := s.service.Config(ctx, s.project, options)
+	if err != nil || s.redactor == nil {
+		return bin, err
+	}
+	return []byte(s.redactor.Redact(string(bin))), nil
+}
+
+// Validate checks the project of s against the compose-spec schema,
+// and that every network, volume, secret, config and service referred to by services is defined.
+// The project is already validated when loaded, but it may be broken later, e.g. by UpdateProject.
+//
+// It reports all problems found, combined by errors.Join, each wrapping ErrInvalidProject.
+func (s *Service) Validate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return validateProject(s.project)
+}
+
+func validateProject(project *types.Project) error {
+	var errs []error
+
+	bin, err := project.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var dict map[string]any
+	if err := json.Unmarshal(bin, &dict); err != nil {
+		return err
+	}
+	networksAsList(dict)
+	if err := schema.Validate(dict); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidProject, err))
+	}
+	if err := validation.Validate(dict); err != nil {
+		errs = append(errs, fmt.Errorf("%w: %w", ErrInvalidProject, err))
+	}
+
+	undefined := func(service, kind, name string) {
+		errs = append(errs, fmt.Errorf("%w: service %q refers to undefined %s %q", ErrInvalidProject, service, kind, name))
+	}
+	for _, name := range project.ServiceNames() {
+		service := project.Services[name]
+		for _, network := range sortedKeys(service.Networks) {
+			if _, ok := project.Networks[network]; !ok {
+				undefined(name, "network", network)
+			}
+		}
+		for _, v := range service.Volumes {
+			if _, ok := project.Volumes[v.Source]; v.Type == types.VolumeTypeVolume && v.Source != "" && !ok {
+				undefined(name, "volume", v.Source)
+			}
+		}
+		for _, secret := range service.Secrets {
+			if _, ok := project.Secrets[secret.Source]; !ok {
+				undefined(name, "secret", secret.Source)
+			}
+		}
+		for _, config := range service.Configs {
+			if _, ok := project.Configs[config.Source]; !ok {
+				undefined(name, "config", config.Source)
+			}
+		}
+		for _, dep := range sortedKeys(service.DependsOn) {
+			_, enabled := project.Services[dep]
+			_, disabled := project.DisabledServices[dep]
+			if !enabled && !disabled {
+				undefined(name, "service", dep)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// networksAsList rewrites networks of services in dict, rendered as maps, into lists if they have no options.
+// The schema allows network names not matching "^[a-zA-Z0-9._-]+$", e.g. containing spaces, only in the list form,
+// thus the rendered form of a valid project could be rejected without it.
+func networksAsList(dict map[string]any) {
+	services, _ := dict["services"].(map[string]any)
+	for _, service := range services {
+		service, _ := service.(map[string]any)
+		networks, ok := service["networks"].(map[string]any)
+		if !ok {
+			continue
+		}
+		list := make([]any, 0, len(networks))
+		for _, name := range sortedKeys(networks) {
+			if networks[name] != nil {
+				list = nil
+				break
+			}
+			list = append(list, name)
+		}
+		if list != nil {
+			service["networks"] = list
+		}
+	}
+}
+
+func sortedKeys[M ~map[string]V, V any](m M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestService_Config(t *testing.T) {
+	s, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+
+	bin, err := s.Config(context.Background(), api.ConfigOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, strings.Contains(string(bin), "image: debian:bookworm-20230904"), string(bin))
+
+	bin, err = s.Config(context.Background(), api.ConfigOptions{Format: "json"})
+	assert.NilError(t, err)
+	var dict map[string]any
+	assert.NilError(t, json.Unmarshal(bin, &dict))
+	assert.Equal(t, "testdata", dict["name"])
+
+	_, err = s.Config(context.Background(), api.ConfigOptions{Format: "toml"})
+	assert.Assert(t, err != nil)
+}
+
+func TestService_Validate(t *testing.T) {
+	s, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+	assert.NilError(t, s.Validate())
+
+	s.UpdateProject(func(p *types.Project) *types.Project {
+		service := p.Services["additional"]
+		service.PullPolicy = "sometimes"
+		service.Networks = map[string]*types.ServiceNetworkConfig{"nonexistent": nil}
+		p.Services["additional"] = service
+		return p
+	})
+	err = s.Validate()
+	assert.ErrorIs(t, err, ErrInvalidProject)
+	assert.ErrorContains(t, err, "pull_policy")
+	assert.ErrorContains(t, err, `service "additional" refers to undefined network "nonexistent"`)
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/cli/cli/connhelper"
+	"github.com/docker/cli/cli/flags"
+	"github.com/docker/docker/client"
+)
+
+// DockerEndpointConfig describes a docker daemon to connect to.
+// Unlike flags.ClientOptions, nothing is taken from DOCKER_HOST, DOCKER_CERT_PATH, DOCKER_API_VERSION, HTTP_PROXY
+// and other environment variables, nor from docker contexts,
+// so that a program can target multiple daemons explicitly.
+type DockerEndpointConfig struct {
+	// Host is an address of the daemon, e.g. "unix:///var/run/docker.sock", "tcp://192.0.2.1:2376" or "ssh://user@host".
+	// For ssh, the docker command on the remote host is used through the ssh command, and TLS and Proxy are ignored.
+	Host string
+	// TLS enables TLS if non nil.
+	TLS *DockerTLSConfig
+	// APIVersion pins the API version, e.g. "1.44". If empty, it is negotiated with the daemon.
+	APIVersion string
+	// Proxy is the HTTP proxy for tcp hosts. If nil, no proxy is used.
+	Proxy *url.URL
+	// DialTimeout defaults to 30 seconds.
+	DialTimeout time.Duration
+}
+
+// DockerTLSConfig is TLS material for DockerEndpointConfig. CA, Cert and Key are PEM encoded.
+type DockerTLSConfig struct {
+	// CA verifies the daemon. If empty, system roots are used.
+	CA []byte
+	// Cert and Key are the client certificate. Both or neither must be given.
+	Cert, Key []byte
+	// ServerName overrides the host name checked against the certificate of the daemon.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// DockerTLSConfigFromFS reads ca.pem, cert.pem and key.pem in fsys,
+// the layout of DOCKER_CERT_PATH and of certificates generated for dockerd --tlsverify.
+// Missing files are left empty.
+func DockerTLSConfigFromFS(fsys fs.FS) (*DockerTLSConfig, error) {
+	var cfg DockerTLSConfig
+	for _, f := range []struct {
+		name string
+		dst  *[]byte
+	}{
+		{"ca.pem", &cfg.CA},
+		{"cert.pem", &cfg.Cert},
+		{"key.pem", &cfg.Key},
+	} {
+		bin, err := fs.ReadFile(fsys, f.name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		*f.dst = bin
+	}
+	return &cfg, nil
+}
+
+func (c *DockerTLSConfig) tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if len(c.CA) > 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(c.CA) {
+			return nil, fmt.Errorf("CA: no certificate found")
+		}
+		cfg.RootCAs = pool
+	}
+	if len(c.Cert) > 0 || len(c.Key) > 0 {
+		cert, err := tls.X509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// NewClient returns a new API client connecting to c.
+func (c DockerEndpointConfig) NewClient() (*client.Client, error) {
+	if c.Host == "" {
+		return nil, fmt.Errorf("DockerEndpointConfig: Host is empty")
+	}
+
+	opts := []client.Opt{client.WithUserAgent(command.UserAgent())}
+	if c.APIVersion != "" {
+		opts = append(opts, client.WithVersion(c.APIVersion))
+	} else {
+		opts = append(opts, client.WithAPIVersionNegotiation())
+	}
+
+	helper, err := connhelper.GetConnectionHelper(c.Host)
+	if err != nil {
+		return nil, err
+	}
+	if helper != nil {
+		opts = append(opts,
+			client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: helper.Dialer}}),
+			client.WithHost(helper.Host),
+			client.WithDialContext(helper.Dialer),
+		)
+		return client.NewClientWithOpts(opts...)
+	}
+
+	transport := &http.Transport{}
+	if c.TLS != nil {
+		tlsConfig, err := c.TLS.tlsConfig()
+		if err != nil {
+			return nil, fmt.Errorf("DockerEndpointConfig: %w", err)
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	dialTimeout := c.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+	opts = append(opts,
+		client.WithHTTPClient(&http.Client{Transport: transport}),
+		client.WithHost(c.Host),
+	)
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// For tcp, WithHost sets a dialer and the proxy taken from the environment. Both are replaced.
+	if hostURL, err := client.ParseHostURL(c.Host); err == nil && hostURL.Scheme == "tcp" {
+		transport.DialContext = (&net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		transport.Proxy = nil
+		if c.Proxy != nil {
+			transport.Proxy = http.ProxyURL(c.Proxy)
+		}
+	}
+	return cli, nil
+}
+
+// InitializeDockerCliWithEndpoint is InitializeDockerCli for endpoint.
+// The returned cli uses the API client created by endpoint.NewClient,
+// and its default context points to endpoint.Host so that DockerEndpoint of cli reports it.
+func InitializeDockerCliWithEndpoint(endpoint DockerEndpointConfig, opts ...command.CLIOption) (*command.DockerCli, error) {
+	apiClient, err := endpoint.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	return InitializeDockerCli(
+		&flags.ClientOptions{Hosts: []string{endpoint.Host}},
+		append([]command.CLIOption{command.WithAPIClient(apiClient)}, opts...)...,
+	)
+}
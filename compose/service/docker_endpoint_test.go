@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func fakeDaemon(t *testing.T) (host string, ca []byte) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.43")
+		w.Header().Set("Ostype", "linux")
+		_, _ = w.Write([]byte("OK"))
+	}))
+	t.Cleanup(srv.Close)
+	ca = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	return "tcp://" + strings.TrimPrefix(srv.URL, "https://"), ca
+}
+
+func TestDockerEndpointConfig(t *testing.T) {
+	host, ca := fakeDaemon(t)
+	// must not be used.
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:1")
+	t.Setenv("DOCKER_API_VERSION", "1.30")
+
+	cli, err := DockerEndpointConfig{Host: host, TLS: &DockerTLSConfig{CA: ca}}.NewClient()
+	assert.NilError(t, err)
+	ping, err := cli.Ping(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, "1.43", ping.APIVersion)
+	cli.NegotiateAPIVersionPing(ping)
+	assert.Equal(t, "1.43", cli.ClientVersion())
+
+	pinned, err := DockerEndpointConfig{Host: host, TLS: &DockerTLSConfig{CA: ca}, APIVersion: "1.41"}.NewClient()
+	assert.NilError(t, err)
+	_, err = pinned.Ping(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, "1.41", pinned.ClientVersion())
+
+	// the daemon is not trusted without CA.
+	untrusted, err := DockerEndpointConfig{Host: host, TLS: &DockerTLSConfig{}}.NewClient()
+	assert.NilError(t, err)
+	_, err = untrusted.Ping(context.Background())
+	assert.ErrorContains(t, err, "certificate")
+
+	_, err = DockerEndpointConfig{Host: host, TLS: &DockerTLSConfig{CA: []byte("garbage")}}.NewClient()
+	assert.ErrorContains(t, err, "CA")
+	_, err = DockerEndpointConfig{Host: host, TLS: &DockerTLSConfig{CA: ca, Cert: ca}}.NewClient()
+	assert.ErrorContains(t, err, "client certificate")
+	_, err = DockerEndpointConfig{}.NewClient()
+	assert.ErrorContains(t, err, "Host is empty")
+}
+
+func TestInitializeDockerCliWithEndpoint(t *testing.T) {
+	host, ca := fakeDaemon(t)
+	t.Setenv("DOCKER_HOST", "tcp://127.0.0.1:1")
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+
+	dockerCli, err := InitializeDockerCliWithEndpoint(DockerEndpointConfig{Host: host, TLS: &DockerTLSConfig{CA: ca}})
+	assert.NilError(t, err)
+	assert.Equal(t, host, dockerCli.DockerEndpoint().Host)
+	_, err = dockerCli.Client().Ping(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, "linux", dockerCli.ServerInfo().OSType)
+}
+
+func TestDockerTLSConfigFromFS(t *testing.T) {
+	cfg, err := DockerTLSConfigFromFS(fstest.MapFS{
+		"ca.pem":   {Data: []byte("ca")},
+		"cert.pem": {Data: []byte("cert")},
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, &DockerTLSConfig{CA: []byte("ca"), Cert: []byte("cert")}, cfg)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+var tcpPollInterval = 200 * time.Millisecond
+
+// Endpoint is how a running container of a service is reachable.
+type Endpoint struct {
+	Service string
+	// Num is the replica number of the container.
+	Num       int
+	Container string
+	// Ports maps container ports, formatted as "<port>/<proto>", e.g. "80/tcp", to host addresses they are published to,
+	// formatted as "<ip>:<port>". Unpublished ports are not included.
+	Ports map[string][]string
+	// Networks maps names of networks the container is connected to, to its IP addresses.
+	Networks map[string]string
+}
+
+// HostAddr returns an address on the host to dial for containerPort, formatted as Ports keys.
+// Unspecified host IPs, e.g. 0.0.0.0, are replaced with loopback addresses.
+func (e Endpoint) HostAddr(containerPort string) (string, bool) {
+	addrs := e.Ports[containerPort]
+	if len(addrs) == 0 {
+		return "", false
+	}
+	host, port, err := net.SplitHostPort(addrs[0])
+	if err != nil {
+		return "", false
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port), true
+}
+
+// Endpoints inspects running containers of the project and returns their endpoints keyed by service names.
+// Endpoints of each service are sorted by the replica number.
+func (s *Service) Endpoints(ctx context.Context) (map[string][]Endpoint, error) {
+	containers, err := s.containers(ctx, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := map[string][]Endpoint{}
+	for _, c := range containers {
+		inspected, err := s.Client().ContainerInspect(ctx, c.ID)
+		if err != nil {
+			return nil, err
+		}
+		num, _ := strconv.Atoi(c.Labels[api.ContainerNumberLabel])
+		endpoint := Endpoint{
+			Service:   c.Labels[api.ServiceLabel],
+			Num:       num,
+			Container: strings.TrimPrefix(inspected.Name, "/"),
+			Ports:     map[string][]string{},
+			Networks:  map[string]string{},
+		}
+		if settings := inspected.NetworkSettings; settings != nil {
+			for port, bindings := range settings.Ports {
+				for _, b := range bindings {
+					endpoint.Ports[string(port)] = append(endpoint.Ports[string(port)], net.JoinHostPort(b.HostIP, b.HostPort))
+				}
+			}
+			for name, network := range settings.Networks {
+				if network != nil {
+					endpoint.Networks[name] = network.IPAddress
+				}
+			}
+		}
+		endpoints[endpoint.Service] = append(endpoints[endpoint.Service], endpoint)
+	}
+	for _, eps := range endpoints {
+		sort.Slice(eps, func(i, j int) bool { return eps[i].Num < eps[j].Num })
+	}
+	return endpoints, nil
+}
+
+// WaitTCP dials addr repeatedly until it accepts a TCP connection or ctx is done.
+// In the latter case it returns an error wrapping ctx.Err() which also describes the last dial error.
+func WaitTCP(ctx context.Context, addr string) error {
+	var dialer net.Dialer
+	ticker := time.NewTicker(tcpPollInterval)
+	defer ticker.Stop()
+	for {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn.Close()
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %s: %w: %v", addr, ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEndpoint_HostAddr(t *testing.T) {
+	e := Endpoint{Ports: map[string][]string{
+		"80/tcp":  {"0.0.0.0:8080", "[::]:8080"},
+		"443/tcp": {"[::]:8443"},
+		"53/udp":  {"192.168.1.2:5353"},
+	}}
+	for port, expected := range map[string]string{
+		"80/tcp":  "127.0.0.1:8080",
+		"443/tcp": "[::1]:8443",
+		"53/udp":  "192.168.1.2:5353",
+	} {
+		addr, ok := e.HostAddr(port)
+		assert.Assert(t, ok)
+		assert.Equal(t, expected, addr)
+	}
+	_, ok := e.HostAddr("22/tcp")
+	assert.Assert(t, !ok)
+}
+
+func TestWaitTCP(t *testing.T) {
+	defer func(d time.Duration) { tcpPollInterval = d }(tcpPollInterval)
+	tcpPollInterval = 10 * time.Millisecond
+
+	// reserve a free port, then release it so that nothing listens on it for a while.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	addr := l.Addr().String()
+	assert.NilError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	err = WaitTCP(ctx, addr)
+	cancel()
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		t.Cleanup(func() { _ = l.Close() })
+	}()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NilError(t, WaitTCP(ctx, addr))
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// Errors returned from operations of Service wrapped in *OperationError.
+var (
+	ErrImagePullFailed   = errors.New("image pull failed")
+	ErrPortConflict      = errors.New("port conflict")
+	ErrNameConflict      = errors.New("name conflict")
+	ErrDaemonUnavailable = errors.New("docker daemon unavailable")
+	ErrDependencyFailed  = errors.New("dependency failed")
+)
+
+// OperationError is an error returned from operations of Service listed as Operation,
+// classified into one of ErrImagePullFailed, ErrPortConflict, ErrNameConflict, ErrDaemonUnavailable or ErrDependencyFailed
+// by inspecting the error and lines printed by compose.
+// Errors which can not be classified are returned as is.
+//
+// Both of Kind and Err can be examined by errors.Is and errors.As.
+type OperationError struct {
+	Kind error
+	// Service is the name of the service which caused the error, or empty if unknown.
+	Service string
+	Err     error
+}
+
+func (e *OperationError) Error() string {
+	if e.Service != "" {
+		return e.Kind.Error() + ": service " + strconv.Quote(e.Service) + ": " + e.Err.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *OperationError) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+type errorPattern struct {
+	kind      error
+	fragments []string
+}
+
+// errorPatterns are matched against lower-cased messages of errors from docker daemon and compose, in order.
+var errorPatterns = []errorPattern{
+	{ErrDaemonUnavailable, []string{"cannot connect to the docker daemon", "is the docker daemon running"}},
+	{ErrPortConflict, []string{"port is already allocated", "address already in use", "ports are not available"}},
+	{ErrNameConflict, []string{"is already in use by container"}},
+	{ErrImagePullFailed, []string{
+		"pull access denied", "manifest unknown", "failed to resolve reference", "error pulling image",
+		"repository does not exist", "no such image",
+	}},
+	{ErrDependencyFailed, []string{"dependency failed to start", "didn't complete successfully"}},
+}
+
+// classifyError wraps err into *OperationError if it is classified.
+// s.mu must be held.
+func (s *Service) classifyError(err error, out Output) error {
+	if err == nil {
+		return nil
+	}
+
+	kind := classifyErrorKind(err, out)
+	if kind == nil {
+		return err
+	}
+	return &OperationError{Kind: kind, Service: s.failedService(err, out), Err: err}
+}
+
+func classifyErrorKind(err error, out Output) error {
+	if client.IsErrConnectionFailed(err) {
+		return ErrDaemonUnavailable
+	}
+
+	messages := strings.ToLower(strings.Join(append([]string{err.Error()}, out.Errors...), "\n"))
+	for _, p := range errorPatterns {
+		for _, f := range p.fragments {
+			if strings.Contains(messages, f) {
+				return p.kind
+			}
+		}
+	}
+
+	if errdefs.IsConflict(err) {
+		return ErrNameConflict
+	}
+	return nil
+}
+
+// failedService guesses the service which caused err.
+// It prefers containers reported in StateError, then service or container names found in the message.
+func (s *Service) failedService(err error, out Output) string {
+	var failed []string
+	for nr, line := range out.Resource {
+		if nr.Resource == ResourceContainer && line.State == StateError {
+			failed = append(failed, nr.Name)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return failed[0]
+	}
+
+	msg := err.Error()
+	names := s.project.ServiceNames()
+	sort.Strings(names)
+	for _, name := range names {
+		if strings.Contains(msg, strconv.Quote(name)) || strings.Contains(msg, s.projectName+"-"+name+"-") {
+			return name
+		}
+	}
+	return ""
+}
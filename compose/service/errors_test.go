@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/docker/docker/errdefs"
+	"gotest.tools/v3/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+	s := &Service{projectName: "testdata", project: project}
+
+	type testCase struct {
+		err     error
+		out     Output
+		kind    error
+		service string
+	}
+	for _, tc := range []testCase{
+		{
+			err:  errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?"),
+			kind: ErrDaemonUnavailable,
+		},
+		{
+			err: errors.New(
+				"Error response from daemon: driver failed programming external connectivity on endpoint testdata-additional-1: " +
+					"Bind for 0.0.0.0:8080 failed: port is already allocated",
+			),
+			kind:    ErrPortConflict,
+			service: "additional",
+		},
+		{
+			err:  errdefs.Conflict(errors.New("Conflict. The container name \"/foo\" is already in use by container \"0123\"")),
+			kind: ErrNameConflict,
+		},
+		{
+			err: errors.New("failed"),
+			out: Output{
+				Resource: map[NamedResource]OutputLine{
+					{ResourceContainer, "sample_service", 1}: {Resource: ResourceContainer, Name: "sample_service", Num: 1, State: StateError},
+				},
+				Errors: []string{"Error response from daemon: pull access denied for foo, repository does not exist"},
+			},
+			kind:    ErrImagePullFailed,
+			service: "sample_service",
+		},
+		{
+			err:     fmt.Errorf("dependency failed to start: %w", errors.New("container testdata-sample_service-1 is unhealthy")),
+			kind:    ErrDependencyFailed,
+			service: "sample_service",
+		},
+	} {
+		classified := s.classifyError(tc.err, tc.out)
+		assert.ErrorIs(t, classified, tc.kind)
+		assert.ErrorIs(t, classified, tc.err)
+		var opErr *OperationError
+		assert.Assert(t, errors.As(classified, &opErr))
+		assert.Equal(t, tc.service, opErr.Service)
+	}
+
+	unknown := errors.New("unknown")
+	assert.Equal(t, unknown, s.classifyError(unknown, Output{}))
+	assert.NilError(t, s.classifyError(nil, Output{}))
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+var (
+	eventsMinBackoff = time.Second
+	eventsMaxBackoff = 30 * time.Second
+)
+
+// Events subscribes container events of the project, the equivalent to a `compose events`.
+// options.Consumer is ignored; events are sent to the returned channel instead.
+//
+// Events returns an error if the docker daemon is not reachable.
+// After that, the subscription is reconnected with exponential backoff whenever the event stream fails,
+// so that it lasts until ctx is cancelled. Events occurring while reconnecting are lost.
+// The channel is closed once ctx is cancelled. The caller must keep receiving from it until then.
+func (s *Service) Events(ctx context.Context, options api.EventsOptions) (<-chan api.Event, error) {
+	s.mu.Lock()
+	cli, service := s.cli, s.service
+	s.mu.Unlock()
+
+	if _, err := cli.Client().Ping(ctx); err != nil {
+		return nil, err
+	}
+	return subscribeEvents(ctx, service, s.projectName, options), nil
+}
+
+func subscribeEvents(ctx context.Context, service api.Service, projectName string, options api.EventsOptions) <-chan api.Event {
+	ch := make(chan api.Event)
+	options.Consumer = func(event api.Event) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ch <- event:
+			return nil
+		}
+	}
+
+	go func() {
+		defer close(ch)
+		backoff := eventsMinBackoff
+		for {
+			started := time.Now()
+			_ = service.Events(ctx, projectName, options)
+			if ctx.Err() != nil {
+				return
+			}
+			// a stream lasted long enough is considered healthy.
+			if time.Since(started) > eventsMaxBackoff {
+				backoff = eventsMinBackoff
+			}
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if backoff *= 2; backoff > eventsMaxBackoff {
+				backoff = eventsMaxBackoff
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"gotest.tools/v3/assert"
+)
+
+// flakyEventsService sends an event and then fails on each call to Events.
+type flakyEventsService struct {
+	api.Service
+	calls atomic.Int32
+}
+
+func (s *flakyEventsService) Events(ctx context.Context, projectName string, options api.EventsOptions) error {
+	n := s.calls.Add(1)
+	if err := options.Consumer(api.Event{Service: projectName, Status: "die", Attributes: map[string]string{"n": strconv.Itoa(int(n))}}); err != nil {
+		return err
+	}
+	return errors.New("connection reset")
+}
+
+func TestSubscribeEvents(t *testing.T) {
+	minBackoff := eventsMinBackoff
+	eventsMinBackoff = time.Millisecond
+	defer func() { eventsMinBackoff = minBackoff }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	service := &flakyEventsService{}
+	ch := subscribeEvents(ctx, service, "sample", api.EventsOptions{})
+	for _, n := range []string{"1", "2", "3"} {
+		ev := <-ch
+		assert.Equal(t, "sample", ev.Service)
+		assert.Equal(t, n, ev.Attributes["n"])
+	}
+
+	cancel()
+	for range ch {
+	}
+	_, ok := <-ch
+	assert.Assert(t, !ok)
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Exec and RunOneOff talk to the docker API directly instead of using compose's Exec and RunOneOffContainer,
+// which call `signal.Reset` and therefore remove signal handlers installed by user code.
+
+// ExecOptions configures Exec.
+type ExecOptions struct {
+	Service string
+	// Index is the container number of the service. Zero means 1.
+	Index      int
+	Command    []string
+	User       string
+	WorkingDir string
+	// Env is a list of "KEY=value" added to the environment of the command.
+	Env        []string
+	Privileged bool
+	Tty        bool
+	// Stdin, if non nil, is copied to the standard input of the command.
+	Stdin io.Reader
+	// Stdout and Stderr receive outputs of the command. Nil discards them.
+	// If Tty is set, both of outputs are written to Stdout.
+	Stdout, Stderr io.Writer
+}
+
+// Exec executes the equivalent to a `compose exec` and returns the exit code of the command.
+// Cancelling ctx stops streaming IO and Exec returns ctx.Err(), but the command keeps running in the container.
+func (s *Service) Exec(ctx context.Context, options ExecOptions) (exitCode int, err error) {
+	s.mu.Lock()
+	client := s.cli.Client()
+	projectName := s.projectName
+	s.mu.Unlock()
+
+	index := options.Index
+	if index == 0 {
+		index = 1
+	}
+	containers, err := client.ContainerList(ctx, container.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("label", fmt.Sprintf("%s=%s", api.ProjectLabel, projectName)),
+			filters.Arg("label", fmt.Sprintf("%s=%s", api.ServiceLabel, options.Service)),
+			filters.Arg("label", fmt.Sprintf("%s=%d", api.ContainerNumberLabel, index)),
+			filters.Arg("label", fmt.Sprintf("%s=%s", api.OneoffLabel, "False")),
+		),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(containers) == 0 {
+		return 0, fmt.Errorf("%w: container of service %s at index %d", api.ErrNotFound, options.Service, index)
+	}
+
+	created, err := client.ContainerExecCreate(ctx, containers[0].ID, dockertypes.ExecConfig{
+		User:         options.User,
+		Privileged:   options.Privileged,
+		Tty:          options.Tty,
+		AttachStdin:  options.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          options.Env,
+		WorkingDir:   options.WorkingDir,
+		Cmd:          options.Command,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.ContainerExecAttach(ctx, created.ID, dockertypes.ExecStartCheck{Tty: options.Tty})
+	if err != nil {
+		return 0, err
+	}
+	if err := streamHijacked(ctx, resp, options.Tty, options.Stdin, options.Stdout, options.Stderr); err != nil {
+		return 0, err
+	}
+
+	inspected, err := client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspected.ExitCode, nil
+}
+
+// RunOptions configures RunOneOff.
+type RunOptions struct {
+	Service string
+	// Command and Entrypoint override ones of the service if non empty.
+	Command    []string
+	Entrypoint []string
+	// User and WorkingDir override ones of the service if non empty.
+	User       string
+	WorkingDir string
+	// Env is a list of "KEY=value" added to the environment of the service.
+	Env []string
+	Tty bool
+	// Remove removes the container after it exits.
+	Remove bool
+	// Stdin, if non nil, is copied to the standard input of the container.
+	Stdin io.Reader
+	// Stdout and Stderr receive outputs of the container. Nil discards them.
+	// If Tty is set, both of outputs are written to Stdout.
+	Stdout, Stderr io.Writer
+}
+
+// RunOneOff executes the equivalent to a `compose run` and returns the exit code of the container.
+//
+// Only a subset of the service config is applied to the container:
+// image, command, entrypoint, environment, working_dir, user, labels and networks.
+// Volumes, ports, dependencies and other settings are not.
+// The image must already exist.
+//
+// Cancelling ctx stops waiting and RunOneOff returns ctx.Err(), but the container keeps running.
+func (s *Service) RunOneOff(ctx context.Context, options RunOptions) (exitCode int, err error) {
+	s.mu.Lock()
+	client := s.cli.Client()
+	project, _ := s.project.WithServicesEnabled()
+	s.mu.Unlock()
+
+	serviceCfg, err := project.GetService(options.Service)
+	if err != nil {
+		return 0, err
+	}
+	config, hostConfig, networkingConfig := oneOffContainerConfig(project, serviceCfg, options)
+
+	var suffix [6]byte
+	_, _ = rand.Read(suffix[:])
+	name := fmt.Sprintf("%s-%s-run-%s", project.Name, serviceCfg.Name, hex.EncodeToString(suffix[:]))
+
+	created, err := client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, name)
+	if err != nil {
+		return 0, err
+	}
+	if options.Remove {
+		defer func() {
+			// removed even if ctx is cancelled.
+			rmErr := client.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true})
+			if err == nil {
+				err = rmErr
+			}
+		}()
+	}
+
+	resp, err := client.ContainerAttach(ctx, created.ID, container.AttachOptions{
+		Stream: true,
+		Stdin:  options.Stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	// waiting first so that the exit is not missed.
+	waitCh, waitErrCh := client.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := client.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		resp.Close()
+		return 0, err
+	}
+	if err := streamHijacked(ctx, resp, options.Tty, options.Stdin, options.Stdout, options.Stderr); err != nil {
+		return 0, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case err := <-waitErrCh:
+		return 0, err
+	case waited := <-waitCh:
+		if waited.Error != nil {
+			return int(waited.StatusCode), fmt.Errorf("waiting for container %s: %s", name, waited.Error.Message)
+		}
+		return int(waited.StatusCode), nil
+	}
+}
+
+func oneOffContainerConfig(project *types.Project, serviceCfg types.ServiceConfig, options RunOptions) (*container.Config, *container.HostConfig, *network.NetworkingConfig) {
+	labels := map[string]string{}
+	for k, v := range serviceCfg.Labels {
+		labels[k] = v
+	}
+	for k, v := range serviceCfg.CustomLabels {
+		labels[k] = v
+	}
+	labels[api.ProjectLabel] = project.Name
+	labels[api.ServiceLabel] = serviceCfg.Name
+	labels[api.OneoffLabel] = "True"
+
+	var env []string
+	for k, v := range serviceCfg.Environment {
+		if v != nil {
+			env = append(env, k+"="+*v)
+		}
+	}
+	sort.Strings(env)
+	env = append(env, options.Env...)
+
+	config := &container.Config{
+		Image:        api.GetImageNameOrDefault(serviceCfg, project.Name),
+		Cmd:          []string(serviceCfg.Command),
+		Entrypoint:   []string(serviceCfg.Entrypoint),
+		Env:          env,
+		WorkingDir:   serviceCfg.WorkingDir,
+		User:         serviceCfg.User,
+		Labels:       labels,
+		Tty:          options.Tty,
+		AttachStdin:  options.Stdin != nil,
+		OpenStdin:    options.Stdin != nil,
+		StdinOnce:    options.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	}
+	if len(options.Command) > 0 {
+		config.Cmd = options.Command
+	}
+	if len(options.Entrypoint) > 0 {
+		config.Entrypoint = options.Entrypoint
+	}
+	if options.User != "" {
+		config.User = options.User
+	}
+	if options.WorkingDir != "" {
+		config.WorkingDir = options.WorkingDir
+	}
+
+	hostConfig := &container.HostConfig{}
+	networkingConfig := &network.NetworkingConfig{EndpointsConfig: map[string]*network.EndpointSettings{}}
+	for i, key := range serviceCfg.NetworksByPriority() {
+		name := key
+		if netCfg, ok := project.Networks[key]; ok && netCfg.Name != "" {
+			name = netCfg.Name
+		}
+		if i == 0 {
+			hostConfig.NetworkMode = container.NetworkMode(name)
+		}
+		endpoint := &network.EndpointSettings{}
+		if cfg := serviceCfg.Networks[key]; cfg != nil {
+			endpoint.Aliases = cfg.Aliases
+		}
+		networkingConfig.EndpointsConfig[name] = endpoint
+	}
+	return config, hostConfig, networkingConfig
+}
+
+// streamHijacked copies stdin to resp and outputs from resp to stdout and stderr
+// until the outputs reach EOF or ctx is cancelled. resp is closed on return.
+func streamHijacked(
+	ctx context.Context,
+	resp dockertypes.HijackedResponse,
+	tty bool,
+	stdin io.Reader,
+	stdout, stderr io.Writer,
+) error {
+	defer resp.Close()
+
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	if stdin != nil {
+		go func() {
+			_, _ = io.Copy(resp.Conn, stdin)
+			_ = resp.CloseWrite()
+		}()
+	}
+
+	outDone := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			_, err = io.Copy(stdout, resp.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(stdout, stderr, resp.Reader)
+		}
+		outDone <- err
+	}()
+
+	select {
+	case err := <-outDone:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types/container"
+	"gotest.tools/v3/assert"
+)
+
+func TestOneOffContainerConfig(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+	AddDockerComposeLabel(project)
+
+	serviceCfg, err := project.GetService("sample_service")
+	assert.NilError(t, err)
+
+	config, hostConfig, networkingConfig := oneOffContainerConfig(project, serviceCfg, RunOptions{
+		Command: []string{"echo", "foo"},
+		Env:     []string{"EXTRA=1"},
+		User:    "1000",
+	})
+
+	assert.Equal(t, "ubuntu:jammy-20230624", config.Image)
+	assert.DeepEqual(t, []string{"echo", "foo"}, []string(config.Cmd))
+	assert.Equal(t, "1000", config.User)
+	assert.Equal(t, "EXTRA=1", config.Env[len(config.Env)-1])
+	assert.Assert(t, len(config.Env) > 1, "environment of the service is not applied")
+	assert.Equal(t, "True", config.Labels[api.OneoffLabel])
+	assert.Equal(t, "sample_service", config.Labels[api.ServiceLabel])
+	assert.Equal(t, project.Name, config.Labels[api.ProjectLabel])
+	assert.Assert(t, !config.OpenStdin)
+
+	networkName := project.Networks["sample network"].Name
+	assert.Equal(t, container.NetworkMode(networkName), hostConfig.NetworkMode)
+	_, ok := networkingConfig.EndpointsConfig[networkName]
+	assert.Assert(t, ok)
+
+	additional, err := project.GetService("additional")
+	assert.NilError(t, err)
+	config, _, _ = oneOffContainerConfig(project, additional, RunOptions{})
+	assert.DeepEqual(t, []string(additional.Entrypoint), []string(config.Entrypoint))
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+var healthPollInterval = time.Second
+
+// HealthStatus is the status of containers of a service observed by WaitHealthy.
+type HealthStatus struct {
+	Service string
+	// Containers is the number of containers of the service.
+	Containers int
+	// Ready is the number of containers which are running and healthy,
+	// or running without health check.
+	Ready int
+	// States lists states of containers which are not ready,
+	// formatted as "<container name>: <state>" or "<container name>: <state> (<health>)".
+	States []string
+}
+
+// Healthy reports whether the service has at least one container and all of them are ready.
+func (h HealthStatus) Healthy() bool {
+	return h.Containers > 0 && h.Containers == h.Ready
+}
+
+// WaitHealthy waits until all containers of services are running and healthy,
+// or running if they have no health check, and returns the last observed status of each service, sorted by the name.
+// If services is empty, all services of the project are waited for.
+//
+// Container states are checked by Ps every second and on each container event of the services.
+// If timeout is positive, WaitHealthy gives up after timeout.
+// When it gives up, it returns the report along with an error wrapping ctx.Err(),
+// i.e. context.DeadlineExceeded for the timeout.
+func (s *Service) WaitHealthy(ctx context.Context, services []string, timeout time.Duration) ([]HealthStatus, error) {
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	if len(services) == 0 {
+		s.mu.Lock()
+		services = s.project.ServiceNames()
+		s.mu.Unlock()
+	}
+
+	// events only wake up the loop. Polling still works if the subscription fails.
+	events, err := s.Events(ctx, api.EventsOptions{Services: services})
+	if err != nil {
+		events = nil
+	}
+	ticker := time.NewTicker(healthPollInterval)
+	defer ticker.Stop()
+
+	var report []HealthStatus
+	for {
+		summary, err := s.Ps(ctx, api.PsOptions{All: true, Services: services})
+		if err != nil && ctx.Err() == nil {
+			return report, err
+		}
+		if err == nil {
+			report = healthReport(services, summary)
+			if allHealthy(report) {
+				return report, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return report, fmt.Errorf("waiting for services to be healthy: %w", ctx.Err())
+		case <-ticker.C:
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+			}
+		}
+	}
+}
+
+func healthReport(services []string, summary []api.ContainerSummary) []HealthStatus {
+	statuses := make(map[string]*HealthStatus, len(services))
+	for _, name := range services {
+		statuses[name] = &HealthStatus{Service: name}
+	}
+	for _, c := range summary {
+		status, ok := statuses[c.Service]
+		if !ok {
+			continue
+		}
+		status.Containers++
+		if c.State == "running" && (c.Health == "" || c.Health == "healthy") {
+			status.Ready++
+			continue
+		}
+		state := c.Name + ": " + c.State
+		if c.Health != "" {
+			state += " (" + c.Health + ")"
+		}
+		status.States = append(status.States, state)
+	}
+
+	report := make([]HealthStatus, 0, len(statuses))
+	for _, status := range statuses {
+		sort.Strings(status.States)
+		report = append(report, *status)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Service < report[j].Service })
+	return report
+}
+
+func allHealthy(report []HealthStatus) bool {
+	for _, status := range report {
+		if !status.Healthy() {
+			return false
+		}
+	}
+	return true
+}
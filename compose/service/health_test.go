@@ -0,0 +1,30 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestHealthReport(t *testing.T) {
+	summary := []api.ContainerSummary{
+		{Name: "sample-db-1", Service: "db", State: "running", Health: "healthy"},
+		{Name: "sample-db-2", Service: "db", State: "running", Health: "starting"},
+		{Name: "sample-web-1", Service: "web", State: "running"},
+		{Name: "sample-worker-1", Service: "worker", State: "exited"},
+		{Name: "sample-other-1", Service: "other", State: "running"},
+	}
+	report := healthReport([]string{"worker", "web", "db", "cache"}, summary)
+	assert.DeepEqual(t, []HealthStatus{
+		{Service: "cache"},
+		{Service: "db", Containers: 2, Ready: 1, States: []string{"sample-db-2: running (starting)"}},
+		{Service: "web", Containers: 1, Ready: 1},
+		{Service: "worker", Containers: 1, States: []string{"sample-worker-1: exited"}},
+	}, report)
+	assert.Assert(t, !allHealthy(report))
+	assert.Assert(t, report[2].Healthy())
+	assert.Assert(t, !report[0].Healthy())
+
+	assert.Assert(t, allHealthy(healthReport([]string{"web"}, summary)))
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+// ImageProgress is a progress event of pulling or pushing images, decoded from a line of compose's progress output.
+type ImageProgress struct {
+	// Service is the name of the service which the event is about, for service level events of Pull.
+	Service string
+	// Image is the image reference being pushed, for events of Push.
+	Image string
+	// Layer is the short ID of the layer which the event is about. It is empty for service level events.
+	//
+	// Compose does not print which image a layer of Pull belongs to,
+	// thus Service is empty for layer events of Pull.
+	Layer string
+	// Status is the status reported by compose or the docker daemon,
+	// e.g. "Pulling", "Downloading", "Pull complete", "Pulled", "Skipped - Image is already present locally".
+	Status string
+	// Current and Total are transferred bytes and total bytes of the layer.
+	// They are parsed from human readable sizes thus approximate. Zero if unknown.
+	Current, Total int64
+	DryRunMode     bool
+}
+
+var (
+	pushLineRe    = regexp.MustCompile(`^Pushing (.+): ([0-9a-f]{12}) (.*)$`)
+	layerLineRe   = regexp.MustCompile(`^([0-9a-f]{12}) (.*)$`)
+	progressBarRe = regexp.MustCompile(`\[[= >]*\]`)
+	sizesRe       = regexp.MustCompile(`(\d+(?:\.\d+)?)([kMGTPEZY]?B)(?:/(\d+(?:\.\d+)?)([kMGTPEZY]?B))?`)
+)
+
+// DecodeImageProgressLine decodes a line printed by compose in plain progress mode while pulling or pushing images.
+func DecodeImageProgressLine(line string, project *types.Project, isDryRunMode bool) (ImageProgress, error) {
+	orgLine := line
+
+	var decoded ImageProgress
+
+	line = strings.TrimLeftFunc(line, unicode.IsSpace)
+	var found bool
+	line, found = strings.CutPrefix(line, DryRunModePrefix)
+	if found || isDryRunMode {
+		decoded.DryRunMode = true
+	}
+	line = strings.TrimSpace(line)
+
+	var rest string
+	if m := pushLineRe.FindStringSubmatch(line); m != nil {
+		decoded.Image, decoded.Layer, rest = m[1], m[2], m[3]
+	} else if m := layerLineRe.FindStringSubmatch(line); m != nil {
+		decoded.Layer, rest = m[1], m[2]
+	} else {
+		name, r, _ := strings.Cut(line, " ")
+		if !hasService(project, name) {
+			return ImageProgress{}, fmt.Errorf("unknown image progress line. input = %s", orgLine)
+		}
+		decoded.Service, decoded.Status = name, strings.TrimSpace(r)
+		return decoded, nil
+	}
+
+	decoded.Status, decoded.Current, decoded.Total = readTransferStatus(rest)
+	return decoded, nil
+}
+
+func hasService(project *types.Project, name string) bool {
+	if project == nil || name == "" {
+		return false
+	}
+	for _, serviceCfg := range project.Services {
+		if serviceCfg.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readTransferStatus splits s, "Status [===>   ] 1.2MB/3.4MB", into the status and sizes.
+func readTransferStatus(s string) (status string, current, total int64) {
+	if loc := progressBarRe.FindStringIndex(s); loc != nil {
+		status, s = strings.TrimSpace(s[:loc[0]]), s[loc[1]:]
+	} else if loc := sizesRe.FindStringIndex(s); loc != nil {
+		status, s = strings.TrimSpace(s[:loc[0]]), s[loc[0]:]
+	} else {
+		return strings.TrimSpace(s), 0, 0
+	}
+	if m := sizesRe.FindStringSubmatch(s); m != nil {
+		current = parseHumanSize(m[1], m[2])
+		if m[3] != "" {
+			total = parseHumanSize(m[3], m[4])
+		}
+	}
+	return status, current, total
+}
+
+// parseHumanSize parses sizes formatted by go-units' HumanSize, which uses decimal units.
+func parseHumanSize(num, unit string) int64 {
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0
+	}
+	mult := 1.
+	if len(unit) == 2 {
+		for _, u := range "kMGTPEZY" {
+			mult *= 1000
+			if rune(unit[0]) == u {
+				break
+			}
+		}
+	}
+	return int64(f * mult)
+}
+
+// progressLineWriter calls fn with each complete line written.
+// Writes are serialized since compose may print progress from multiple goroutines.
+type progressLineWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	fn  func(line string)
+}
+
+func (w *progressLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, _ = w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// incomplete line is kept for the next Write.
+			rest := []byte(line)
+			w.buf.Reset()
+			_, _ = w.buf.Write(rest)
+			return len(p), nil
+		}
+		w.fn(strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// withImageProgress runs fn while lines printed by compose are also decoded and passed to onProgress.
+// s.mu must be held.
+func (s *Service) withImageProgress(onProgress func(p ImageProgress), fn func() error) error {
+	if onProgress == nil {
+		return fn()
+	}
+	decode := &progressLineWriter{fn: func(line string) {
+		if decoded, err := DecodeImageProgressLine(line, s.project, s.dryRun); err == nil {
+			onProgress(decoded)
+		}
+	}}
+	out, errOut := s.outputStreams()
+	_ = s.cli.Apply(
+		command.WithOutputStream(io.MultiWriter(out, decode)),
+		command.WithErrorStream(io.MultiWriter(errOut, decode)),
+	)
+	defer s.overrideOutputStreams()
+	return fn()
+}
+
+// Pull executes the equivalent to a `compose pull`.
+// If onProgress is non nil, it is called with each progress event while pulling.
+// Calls may be made from multiple goroutines but never concurrently.
+func (s *Service) Pull(ctx context.Context, options api.PullOptions, onProgress func(p ImageProgress)) (Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+	ctx, end := s.startSpan(ctx, "pull", nil)
+	err := s.withImageProgress(onProgress, func() error {
+		return s.service.Pull(ctx, s.project, options)
+	})
+	out := s.parseOutput()
+	end(&out, err)
+	return out, err
+}
+
+// Push executes the equivalent to a `compose push`.
+// If onProgress is non nil, it is called with each progress event while pushing.
+// Calls may be made from multiple goroutines but never concurrently.
+func (s *Service) Push(ctx context.Context, options api.PushOptions, onProgress func(p ImageProgress)) (Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+	ctx, end := s.startSpan(ctx, "push", nil)
+	err := s.withImageProgress(onProgress, func() error {
+		return s.service.Push(ctx, s.project, options)
+	})
+	out := s.parseOutput()
+	end(&out, err)
+	return out, err
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDecodeImageProgressLine(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+
+	type testCase struct {
+		line     string
+		dryRun   bool
+		expected ImageProgress
+	}
+	for _, tc := range []testCase{
+		{" sample_service Pulling ", false, ImageProgress{Service: "sample_service", Status: "Pulling"}},
+		{" additional Skipped - Image is already present locally ", false, ImageProgress{Service: "additional", Status: "Skipped - Image is already present locally"}},
+		{" 4abcf2066143 Pulling fs layer ", false, ImageProgress{Layer: "4abcf2066143", Status: "Pulling fs layer"}},
+		{
+			" 4abcf2066143 Downloading [=========>                                         ]  1.234MB/6.5MB",
+			false,
+			ImageProgress{Layer: "4abcf2066143", Status: "Downloading", Current: 1234000, Total: 6500000},
+		},
+		{" 4abcf2066143 Extracting  512kB/6.5MB", false, ImageProgress{Layer: "4abcf2066143", Status: "Extracting", Current: 512000, Total: 6500000}},
+		{" 4abcf2066143 Pull complete ", false, ImageProgress{Layer: "4abcf2066143", Status: "Pull complete"}},
+		{" sample_service Pulled ", true, ImageProgress{Service: "sample_service", Status: "Pulled", DryRunMode: true}},
+		{
+			" Pushing localhost:5000/foo:latest: 4abcf2066143 Pushing [==>      ]     512B/1.5kB",
+			false,
+			ImageProgress{Image: "localhost:5000/foo:latest", Layer: "4abcf2066143", Status: "Pushing", Current: 512, Total: 1500},
+		},
+		{" Pushing localhost:5000/foo:latest: 4abcf2066143 Layer already exists ", false, ImageProgress{Image: "localhost:5000/foo:latest", Layer: "4abcf2066143", Status: "Layer already exists"}},
+	} {
+		decoded, err := DecodeImageProgressLine(tc.line, project, tc.dryRun)
+		assert.NilError(t, err, "line = %q", tc.line)
+		assert.DeepEqual(t, tc.expected, decoded)
+	}
+
+	_, err = DecodeImageProgressLine(" unknown Pulling ", project, false)
+	assert.Assert(t, err != nil)
+}
+
+func TestProgressLineWriter(t *testing.T) {
+	var lines []string
+	w := &progressLineWriter{fn: func(line string) { lines = append(lines, line) }}
+	_, _ = w.Write([]byte("foo\nba"))
+	_, _ = w.Write([]byte("r\n"))
+	_, _ = w.Write([]byte("baz"))
+	assert.DeepEqual(t, []string{"foo", "bar"}, lines)
+}
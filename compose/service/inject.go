@@ -0,0 +1,245 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/spf13/afero"
+)
+
+// ConfigInjector modifies ConfigDetails right before Loader loads the project,
+// e.g. to give credentials which must not be written in compose files on disk.
+// Injectors are set by LoaderProxy.UpdateInjectors and never modify the ConfigDetails stored in Loader.
+type ConfigInjector interface {
+	Inject(conf *types.ConfigDetails) error
+}
+
+// SensitiveInjector is a ConfigInjector which knows values to be redacted from Output and logs.
+type SensitiveInjector interface {
+	ConfigInjector
+	SensitiveValues() ([]string, error)
+}
+
+var _ ConfigInjector = ConfigInjectorFn(nil)
+
+type ConfigInjectorFn func(conf *types.ConfigDetails) error
+
+func (fn ConfigInjectorFn) Inject(conf *types.ConfigDetails) error {
+	return fn(conf)
+}
+
+var _ SensitiveInjector = EnvInjector{}
+
+// EnvInjector sets Env to the environment used for interpolation and for resolving environments of services,
+// overriding existing values.
+type EnvInjector struct {
+	Env map[string]string
+	// Redact marks values of Env as sensitive.
+	Redact bool
+}
+
+func (i EnvInjector) Inject(conf *types.ConfigDetails) error {
+	if conf.Environment == nil {
+		conf.Environment = types.Mapping{}
+	}
+	for k, v := range i.Env {
+		conf.Environment[k] = v
+	}
+	return nil
+}
+
+func (i EnvInjector) SensitiveValues() ([]string, error) {
+	if !i.Redact {
+		return nil, nil
+	}
+	values := make([]string, 0, len(i.Env))
+	for _, v := range i.Env {
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+var _ SensitiveInjector = SecretFileInjector{}
+
+// SecretFileInjector defines file-based secrets, the top-level `secrets` with `file`,
+// pointing to files stored in Fsys.
+//
+// Fsys is typically an afero.Fs field of a handle returned from storage.PrepareHandle.
+// It must be backed by the OS file system, i.e. *afero.OsFs or *afero.BasePathFs over it,
+// since the engine bind mounts secret files by their paths on the host.
+type SecretFileInjector struct {
+	Fsys afero.Fs
+	// Files maps secret names to paths in Fsys.
+	Files map[string]string
+	// Redact marks contents of Files as sensitive.
+	Redact bool
+}
+
+func (i SecretFileInjector) Inject(conf *types.ConfigDetails) error {
+	secrets := make(map[string]any, len(i.Files))
+	for name, path := range i.Files {
+		if _, err := i.Fsys.Stat(path); err != nil {
+			return fmt.Errorf("secret %s: %w", name, err)
+		}
+		realPath, err := realPath(i.Fsys, path)
+		if err != nil {
+			return fmt.Errorf("secret %s: %w", name, err)
+		}
+		secrets[name] = map[string]any{"file": realPath}
+	}
+
+	config := map[string]any{"secrets": secrets}
+	// JSON is YAML. Content is read in case the loader looks for the project name.
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	conf.ConfigFiles = append(conf.ConfigFiles, types.ConfigFile{
+		Filename: "injected-secrets.yml",
+		Content:  content,
+		Config:   config,
+	})
+	return nil
+}
+
+func (i SecretFileInjector) SensitiveValues() ([]string, error) {
+	if !i.Redact {
+		return nil, nil
+	}
+	values := make([]string, 0, len(i.Files))
+	for name, path := range i.Files {
+		bin, err := afero.ReadFile(i.Fsys, path)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", name, err)
+		}
+		if v := strings.TrimSpace(string(bin)); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values, nil
+}
+
+func realPath(fsys afero.Fs, path string) (string, error) {
+	switch x := fsys.(type) {
+	case *afero.BasePathFs:
+		return x.RealPath(path)
+	case *afero.OsFs:
+		return filepath.Abs(path)
+	}
+	return "", fmt.Errorf("%T is not backed by the OS file system", fsys)
+}
+
+// Redactor replaces sensitive values in strings with "***".
+// The zero Redactor and nil *Redactor redact nothing.
+type Redactor struct {
+	replacer *strings.Replacer
+	// values are sensitive values, longest first.
+	values []string
+}
+
+// NewRedactor returns Redactor for values. Empty values are ignored.
+func NewRedactor(values ...string) *Redactor {
+	// longer first so that a value containing another is redacted as a whole.
+	sorted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			sorted = append(sorted, v)
+		}
+	}
+	if len(sorted) == 0 {
+		return &Redactor{}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	oldnew := make([]string, 0, 2*len(sorted))
+	for _, v := range sorted {
+		oldnew = append(oldnew, v, "***")
+	}
+	return &Redactor{replacer: strings.NewReplacer(oldnew...), values: sorted}
+}
+
+func (r *Redactor) Redact(s string) string {
+	if r == nil || r.replacer == nil {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
+
+// RedactProjectJSON replaces sensitive values in bin, a project rendered as JSON, with references to variables of env
+// holding them, e.g. "${DB_PASSWORD}", so that loading the result with env interpolates the values back.
+// That is, the result can be stored without sensitive values and loaded later with the environment of the project.
+// Values held by no variable of env are replaced with "***" and can not be restored.
+func (r *Redactor) RedactProjectJSON(bin []byte, env types.Mapping) []byte {
+	if r == nil || len(r.values) == 0 {
+		return bin
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	oldnew := make([]string, 0, 2*len(r.values))
+	for _, v := range r.values {
+		ref := "***"
+		for _, k := range keys {
+			if env[k] == v {
+				ref = "${" + k + "}"
+				break
+			}
+		}
+		// values appear escaped in JSON strings.
+		escaped, _ := json.Marshal(v)
+		oldnew = append(oldnew, string(escaped[1:len(escaped)-1]), ref)
+	}
+	return []byte(strings.NewReplacer(oldnew...).Replace(string(bin)))
+}
+
+// ReplaceAttr redacts string values of attrs. It can be set to slog.HandlerOptions.ReplaceAttr.
+// Values of other kinds, e.g. ones given by slog.Any, are formatted and redacted if they contain sensitive values.
+func (r *Redactor) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if r == nil || r.replacer == nil {
+		return a
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.Redact(a.Value.String()))
+	case slog.KindAny:
+		formatted := a.Value.String()
+		if redacted := r.Redact(formatted); redacted != formatted {
+			a.Value = slog.StringValue(redacted)
+		}
+	}
+	return a
+}
+
+// redactOutput redacts raw and decoded lines of out.
+func (r *Redactor) redactOutput(out Output) Output {
+	if r == nil || r.replacer == nil {
+		return out
+	}
+	out.Out, out.Err = r.Redact(out.Out), r.Redact(out.Err)
+	for i, line := range out.Errors {
+		out.Errors[i] = r.Redact(line)
+	}
+	for i, line := range out.Warnings {
+		out.Warnings[i] = r.Redact(line)
+	}
+	for k, line := range out.Resource {
+		line.Desc = r.Redact(line.Desc)
+		out.Resource[k] = line
+	}
+	return out
+}
+
+// WithRedactor makes s redact Output of operations and the result of Config.
+// LoadComposeService of Loader sets it if any SensitiveInjector is given.
+func WithRedactor(r *Redactor) ServiceOption {
+	return func(s *Service) {
+		s.redactor = r
+	}
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+const injectComposeYaml = `services:
+  app:
+    image: ubuntu:jammy-20230624
+    environment:
+      PASSWORD: ${PASSWORD:-unset}
+    secrets:
+      - token
+`
+
+func TestLoaderProxy_Injectors(t *testing.T) {
+	dir := t.TempDir()
+	secrets := afero.NewBasePathFs(afero.NewOsFs(), dir)
+	assert.NilError(t, afero.WriteFile(secrets, "token", []byte("s3cr3t-token\n"), 0o600))
+
+	proxy, err := NewLoaderProxy(
+		"inject",
+		types.ConfigDetails{
+			WorkingDir:  "./testdata",
+			ConfigFiles: []types.ConfigFile{{Filename: "./testdata/inject.yml", Content: []byte(injectComposeYaml)}},
+			Environment: types.Mapping{},
+		},
+		[]func(*loader.Options){},
+		nil,
+	)
+	assert.NilError(t, err)
+	proxy.UpdateInjectors(
+		EnvInjector{Env: map[string]string{"PASSWORD": "hunter2"}, Redact: true},
+		SecretFileInjector{Fsys: secrets, Files: map[string]string{"token": "token"}, Redact: true},
+	)
+
+	ctx := context.Background()
+	project, err := proxy.Load(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, "hunter2", *project.Services["app"].Environment["PASSWORD"])
+	assert.Equal(t, filepath.Join(dir, "token"), project.Secrets["token"].File)
+	// stored config details are untouched.
+	assert.Equal(t, 1, len(proxy.ConfigDetails().ConfigFiles))
+	assert.Equal(t, 0, len(proxy.ConfigDetails().Environment))
+
+	svc, err := proxy.LoadComposeService(ctx)
+	assert.NilError(t, err)
+	bin, err := svc.Config(ctx, api.ConfigOptions{})
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(string(bin), "hunter2"), string(bin))
+	assert.Assert(t, strings.Contains(string(bin), "PASSWORD: '***'") || strings.Contains(string(bin), "PASSWORD: ***"), string(bin))
+
+	mem := afero.NewMemMapFs()
+	assert.NilError(t, afero.WriteFile(mem, "token", []byte("x"), 0o600))
+	err = SecretFileInjector{Fsys: mem, Files: map[string]string{"token": "token"}}.Inject(&types.ConfigDetails{})
+	assert.ErrorContains(t, err, "not backed by the OS file system")
+}
+
+func TestRedactor(t *testing.T) {
+	r := NewRedactor("pass", "password", "")
+	assert.Equal(t, "user=*** ***", r.Redact("user=password pass"))
+
+	var nilRedactor *Redactor
+	assert.Equal(t, "password", nilRedactor.Redact("password"))
+	assert.Equal(t, "password", NewRedactor().Redact("password"))
+
+	out := r.redactOutput(Output{
+		Out:      "password",
+		Errors:   []string{"Error response from daemon: pass"},
+		Resource: map[NamedResource]OutputLine{{ResourceContainer, "app", 1}: {Desc: "pass"}},
+	})
+	assert.Equal(t, "***", out.Out)
+	assert.Equal(t, "Error response from daemon: ***", out.Errors[0])
+	assert.Equal(t, "***", out.Resource[NamedResource{ResourceContainer, "app", 1}].Desc)
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{ReplaceAttr: r.ReplaceAttr}))
+	logger.Info("msg", slog.String("env", "PASSWORD=password"), slog.Any("list", []string{"pass"}), slog.Int("n", 1))
+	assert.Assert(t, !strings.Contains(buf.String(), "pass"), buf.String())
+	assert.Assert(t, strings.Contains(buf.String(), "n=1"), buf.String())
+
+	bin := []byte(`{"environment":{"URL":"postgres://u:password@db","Q":"a\"pass"}}`)
+	assert.Equal(
+		t,
+		`{"environment":{"URL":"postgres://u:${DB_PASSWORD}@db","Q":"***"}}`,
+		string(NewRedactor("password", `a"pass`).RedactProjectJSON(bin, types.Mapping{"DB_PASSWORD": "password"})),
+	)
+	assert.Equal(t, string(bin), string(nilRedactor.RedactProjectJSON(bin, nil)))
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// ErrContainerNotFound is wrapped by errors returned from Inspect when the container does not exist.
+var ErrContainerNotFound = errors.New("container not found")
+
+// containers lists containers of services of the project, excluding one-off ones.
+// Stopped containers are included if all is true.
+func (s *Service) containers(ctx context.Context, all bool, services []string, extraFilters ...filters.KeyValuePair) ([]types.Container, error) {
+	args := filters.NewArgs(
+		filters.Arg("label", api.ProjectLabel+"="+s.projectName),
+		filters.Arg("label", api.OneoffLabel+"=False"),
+	)
+	for _, kv := range extraFilters {
+		args.Add(kv.Key, kv.Value)
+	}
+	containers, err := s.Client().ContainerList(ctx, container.ListOptions{All: all, Filters: args})
+	if err != nil {
+		return nil, err
+	}
+	if len(services) == 0 {
+		return containers, nil
+	}
+	filtered := containers[:0]
+	for _, c := range containers {
+		if contains(services, c.Labels[api.ServiceLabel]) {
+			filtered = append(filtered, c)
+		}
+	}
+	return filtered, nil
+}
+
+// Inspect returns the detail of the container of service numbered index, starting from 1 as in container names,
+// including stopped ones.
+// It returns an error wrapping ErrContainerNotFound if the container does not exist.
+func (s *Service) Inspect(ctx context.Context, service string, index int) (types.ContainerJSON, error) {
+	containers, err := s.containers(
+		ctx, true, nil,
+		filters.Arg("label", api.ServiceLabel+"="+service),
+		filters.Arg("label", api.ContainerNumberLabel+"="+strconv.Itoa(index)),
+	)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	if len(containers) == 0 {
+		return types.ContainerJSON{}, fmt.Errorf("%w: service %s, index %d", ErrContainerNotFound, service, index)
+	}
+	return s.Client().ContainerInspect(ctx, containers[0].ID)
+}
+
+// ContainerStats is resource usage of a container sampled by Stats.
+type ContainerStats struct {
+	Service string
+	// Num is the replica number of the container.
+	Num  int
+	ID   string
+	Time time.Time
+	// CPUPercent is the CPU usage since the previous sample, where 100 means one fully used CPU.
+	CPUPercent float64
+	// MemoryUsage excludes the page cache, as `docker stats` does.
+	MemoryUsage, MemoryLimit uint64
+	// NetworkRx and NetworkTx are total bytes received and sent through all networks.
+	NetworkRx, NetworkTx uint64
+}
+
+// Stats streams resource usage of running containers of services, or all services if empty,
+// until ctx is cancelled. Each container reports roughly every second.
+//
+// Containers are enumerated once when Stats is called; streams of containers which stop end silently.
+// The channel is closed once all streams end. The caller must keep receiving from it until then.
+func (s *Service) Stats(ctx context.Context, services []string) (<-chan ContainerStats, error) {
+	containers, err := s.containers(ctx, false, services)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan ContainerStats)
+	var wg sync.WaitGroup
+	for _, c := range containers {
+		resp, err := s.Client().ContainerStats(ctx, c.ID, true)
+		if err != nil {
+			continue
+		}
+		num, _ := strconv.Atoi(c.Labels[api.ContainerNumberLabel])
+		wg.Add(1)
+		go func(body io.ReadCloser, service string, num int) {
+			defer wg.Done()
+			defer body.Close()
+			dec := json.NewDecoder(body)
+			for {
+				var raw types.StatsJSON
+				if err := dec.Decode(&raw); err != nil {
+					return
+				}
+				stats := decodeStats(&raw)
+				stats.Service, stats.Num = service, num
+				select {
+				case <-ctx.Done():
+					return
+				case ch <- stats:
+				}
+			}
+		}(resp.Body, c.Labels[api.ServiceLabel], num)
+	}
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// decodeStats computes ContainerStats from raw in the same way as `docker stats`.
+func decodeStats(raw *types.StatsJSON) ContainerStats {
+	stats := ContainerStats{
+		ID:          raw.ID,
+		Time:        raw.Read,
+		MemoryUsage: raw.MemoryStats.Usage,
+		MemoryLimit: raw.MemoryStats.Limit,
+	}
+
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	onlineCPUs := float64(raw.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * onlineCPUs * 100
+	}
+
+	// cgroup v1 reports the cache as total_inactive_file, v2 as inactive_file.
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if v, ok := raw.MemoryStats.Stats[key]; ok && v < stats.MemoryUsage {
+			stats.MemoryUsage -= v
+			break
+		}
+	}
+
+	for _, n := range raw.Networks {
+		stats.NetworkRx += n.RxBytes
+		stats.NetworkTx += n.TxBytes
+	}
+	return stats
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"gotest.tools/v3/assert"
+)
+
+func TestDecodeStats(t *testing.T) {
+	raw := &types.StatsJSON{
+		Stats: types.Stats{
+			CPUStats: types.CPUStats{
+				CPUUsage:    types.CPUUsage{TotalUsage: 3000, PercpuUsage: []uint64{1500, 1500}},
+				SystemUsage: 20000,
+			},
+			PreCPUStats: types.CPUStats{
+				CPUUsage:    types.CPUUsage{TotalUsage: 1000},
+				SystemUsage: 10000,
+			},
+			MemoryStats: types.MemoryStats{
+				Usage: 1000,
+				Limit: 4000,
+				Stats: map[string]uint64{"inactive_file": 200},
+			},
+		},
+		ID: "id",
+		Networks: map[string]types.NetworkStats{
+			"eth0": {RxBytes: 10, TxBytes: 20},
+			"eth1": {RxBytes: 1, TxBytes: 2},
+		},
+	}
+
+	stats := decodeStats(raw)
+	assert.Equal(t, "id", stats.ID)
+	// 2000 / 10000 * 2 CPUs.
+	assert.Equal(t, 40.0, stats.CPUPercent)
+	assert.Equal(t, uint64(800), stats.MemoryUsage)
+	assert.Equal(t, uint64(4000), stats.MemoryLimit)
+	assert.Equal(t, uint64(11), stats.NetworkRx)
+	assert.Equal(t, uint64(22), stats.NetworkTx)
+
+	// the first sample has no previous one.
+	raw.PreCPUStats = types.CPUStats{}
+	raw.CPUStats.SystemUsage = 0
+	assert.Equal(t, 0.0, decodeStats(raw).CPUPercent)
+}
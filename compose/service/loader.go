@@ -15,6 +15,7 @@ import (
 )
 
 // InitializeDockerCli initializes DockerCli.
+// Use InitializeDockerCliWithEndpoint to connect to a daemon described explicitly rather than by the environment.
 //
 // If clientOpt is nil, cli will be initialized with &flags.ClientOptions{Context: "default"}.
 //
@@ -122,6 +123,8 @@ type Loader struct {
 	ProjectName   string
 	ConfigDetails types.ConfigDetails
 	Options       []func(*loader.Options)
+	// Injectors are applied to a copy of ConfigDetails in order, on every Load.
+	Injectors []ConfigInjector
 }
 
 func NewLoader(
@@ -145,9 +148,18 @@ func NewLoader(
 }
 
 func (l *Loader) Load(ctx context.Context) (*types.Project, error) {
+	configDetails := l.ConfigDetails
+	if len(l.Injectors) > 0 {
+		configDetails = cloneConfigDetails(configDetails)
+		for _, injector := range l.Injectors {
+			if err := injector.Inject(&configDetails); err != nil {
+				return nil, fmt.Errorf("injecting config: %w", err)
+			}
+		}
+	}
 	return loader.LoadWithContext(
 		ctx,
-		l.ConfigDetails,
+		configDetails,
 		append(
 			l.Options,
 			func(o *loader.Options) {
@@ -169,9 +181,25 @@ func (l *Loader) LoadComposeService(ctx context.Context, ops ...func(p *types.Pr
 		}
 	}
 
+	var sensitive []string
+	for _, injector := range l.Injectors {
+		if si, ok := injector.(SensitiveInjector); ok {
+			values, err := si.SensitiveValues()
+			if err != nil {
+				return nil, err
+			}
+			sensitive = append(sensitive, values...)
+		}
+	}
+	var opts []ServiceOption
+	if len(sensitive) > 0 {
+		opts = append(opts, WithRedactor(NewRedactor(sensitive...)))
+	}
+
 	return NewService(
 		l.ProjectName,
 		project,
 		l.DockerCli,
+		opts...,
 	), nil
 }
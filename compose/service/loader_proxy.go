@@ -111,3 +111,16 @@ func (p *LoaderProxy) UpdateOptions(options []func(*loader.Options)) {
 	defer p.mu.Unlock()
 	p.loader.Options = options
 }
+
+// UpdateInjectors replaces injectors applied on every Load.
+func (p *LoaderProxy) UpdateInjectors(injectors ...ConfigInjector) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loader.Injectors = injectors
+}
+
+func (p *LoaderProxy) Injectors() []ConfigInjector {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.loader.Injectors)
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+)
+
+// LogEntry is a line of container logs.
+type LogEntry struct {
+	// Service is the name of the service which the container belongs to.
+	// It is empty if the container does not match any of services in the project.
+	Service string
+	// Container is the container name without the project name prefix, e.g. "service-1".
+	Container string
+	Timestamp time.Time
+	Line      string
+	// Stderr is true if the line is reported as an error by compose.
+	// Note that compose reports both of stdout and stderr of containers as normal logs.
+	Stderr bool
+}
+
+// Logs executes the equivalent to a `compose logs`, sending each line to consumer.
+//
+// Timestamps are always requested so that LogEntry.Timestamp is populated;
+// options.Timestamps only affects whether Line keeps the timestamp prefix.
+// If options.Follow is set, Logs keeps streaming until ctx is cancelled, and then returns nil.
+//
+// Logs blocks while consumer is full. consumer is not closed by Logs.
+// Unlike other methods, Logs does not block others while streaming.
+func (s *Service) Logs(ctx context.Context, options api.LogOptions, consumer chan<- LogEntry) error {
+	s.mu.Lock()
+	if options.Project == nil {
+		options.Project = s.project
+	}
+	project := s.project
+	service := s.service
+	s.mu.Unlock()
+
+	keepTimestamps := options.Timestamps
+	options.Timestamps = true
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	err := service.Logs(ctx, s.projectName, &logConsumer{
+		ctx:            ctx,
+		project:        project,
+		keepTimestamps: keepTimestamps,
+		ch:             consumer,
+	}, options)
+	if options.Follow && ctx.Err() != nil && (err == nil || errors.Is(err, context.Canceled)) {
+		return nil
+	}
+	return err
+}
+
+type logConsumer struct {
+	ctx            context.Context
+	project        *types.Project
+	keepTimestamps bool
+	ch             chan<- LogEntry
+}
+
+func (c *logConsumer) Log(containerName, message string) {
+	c.send(containerName, message, false)
+}
+
+func (c *logConsumer) Err(containerName, message string) {
+	c.send(containerName, message, true)
+}
+
+func (c *logConsumer) Status(container, msg string) {}
+
+func (c *logConsumer) Register(container string) {}
+
+func (c *logConsumer) send(containerName, message string, stderr bool) {
+	entry := c.entry(containerName, message, stderr)
+	select {
+	case <-c.ctx.Done():
+	case c.ch <- entry:
+	}
+}
+
+func (c *logConsumer) entry(containerName, message string, stderr bool) LogEntry {
+	entry := LogEntry{
+		Service:   serviceOfContainer(c.project, containerName),
+		Container: containerName,
+		Line:      message,
+		Stderr:    stderr,
+	}
+	if ts, rest, ok := strings.Cut(message, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			entry.Timestamp = t
+			if !c.keepTimestamps {
+				entry.Line = rest
+			}
+		}
+	}
+	return entry
+}
+
+// serviceOfContainer finds a service in project whose container is named containerName,
+// either by container_name or by the default naming "service-index".
+func serviceOfContainer(project *types.Project, containerName string) string {
+	if project == nil {
+		return ""
+	}
+	for _, serviceCfg := range project.Services {
+		if serviceCfg.ContainerName != "" {
+			if serviceCfg.ContainerName == containerName {
+				return serviceCfg.Name
+			}
+			continue
+		}
+		rest, found := strings.CutPrefix(containerName, serviceCfg.Name+"-")
+		if !found {
+			continue
+		}
+		if _, err := strconv.ParseUint(rest, 10, 64); err == nil {
+			return serviceCfg.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLogConsumer(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+
+	ch := make(chan LogEntry, 3)
+	consumer := &logConsumer{ctx: context.Background(), project: project, ch: ch}
+	consumer.Log("sample_service-1", "2024-03-10T12:34:56.789Z hello world")
+	consumer.Err("additional-12", "2024-03-10T12:34:57Z oops")
+	consumer.Log("unknown-1", "no timestamp")
+
+	ts := time.Date(2024, 3, 10, 12, 34, 56, 789000000, time.UTC)
+	assert.DeepEqual(t, LogEntry{Service: "sample_service", Container: "sample_service-1", Timestamp: ts, Line: "hello world"}, <-ch)
+	assert.DeepEqual(t, LogEntry{Service: "additional", Container: "additional-12", Timestamp: ts.Add(211 * time.Millisecond), Line: "oops", Stderr: true}, <-ch)
+	assert.DeepEqual(t, LogEntry{Container: "unknown-1", Line: "no timestamp"}, <-ch)
+
+	consumer.keepTimestamps = true
+	consumer.Log("sample_service-1", "2024-03-10T12:34:56.789Z hello world")
+	assert.Equal(t, "2024-03-10T12:34:56.789Z hello world", (<-ch).Line)
+
+	// send does not block after ctx is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	consumer = &logConsumer{ctx: ctx, project: project, ch: make(chan LogEntry)}
+	consumer.Log("sample_service-1", "dropped")
+}
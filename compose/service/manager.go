@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/cli/cli/command"
+	"github.com/docker/cli/cli/flags"
+	"github.com/docker/compose/v2/pkg/api"
+	"github.com/docker/docker/client"
+)
+
+// ErrProjectExists is returned from ProjectManager.Add if a project with the same name is already managed.
+var ErrProjectExists = errors.New("project already exists")
+
+// ProjectManager is a registry of Service for multiple projects, keyed by the project name.
+// It is useful for hosts running several compose projects, e.g. a stack per tenant.
+//
+// All services share the docker API client of the DockerCli passed to NewProjectManager.
+// Each of them still has its own command.Cli since Service redirects output streams of its cli.
+// Operations of a project are serialized by its Service, while different projects are operated concurrently.
+//
+// Methods of ProjectManager are goroutine safe.
+type ProjectManager struct {
+	cli  command.Cli
+	opts []ServiceOption
+
+	mu       sync.RWMutex
+	services map[string]*Service
+}
+
+// NewProjectManager returns a new ProjectManager.
+// opts are applied to every Service created by Add.
+func NewProjectManager(dockerCli command.Cli, opts ...ServiceOption) *ProjectManager {
+	return &ProjectManager{
+		cli:      dockerCli,
+		opts:     opts,
+		services: map[string]*Service{},
+	}
+}
+
+// Add creates Service for project and registers it by projectName.
+// As NewService does, it mutates project.
+// Add returns an error wrapping ErrProjectExists if projectName is already registered.
+func (m *ProjectManager) Add(projectName string, project *types.Project) (*Service, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.services[projectName]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrProjectExists, projectName)
+	}
+
+	cli, err := command.NewDockerCli()
+	if err != nil {
+		return nil, err
+	}
+	options := flags.NewClientOptions()
+	options.Context = m.cli.CurrentContext()
+	err = cli.Initialize(
+		options,
+		command.WithInitializeClient(func(*command.DockerCli) (client.APIClient, error) {
+			return m.cli.Client(), nil
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewService(projectName, project, cli, m.opts...)
+	m.services[projectName] = s
+	return s, nil
+}
+
+// Get returns Service registered by projectName.
+func (m *ProjectManager) Get(projectName string) (*Service, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.services[projectName]
+	return s, ok
+}
+
+// Remove unregisters Service for projectName and reports whether it was registered.
+// Containers of the project are left as they are.
+func (m *ProjectManager) Remove(projectName string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.services[projectName]
+	delete(m.services, projectName)
+	return ok
+}
+
+// Names returns names of registered projects in ascending order.
+func (m *ProjectManager) Names() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.services))
+	for name := range m.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StopAll stops containers of all registered projects concurrently.
+// options.Project is ignored; each Service uses its own project.
+// It returns Output of each project and errors of all projects combined by errors.Join.
+func (m *ProjectManager) StopAll(ctx context.Context, options api.StopOptions) (map[string]Output, error) {
+	options.Project = nil
+	return forEachProject(m, func(s *Service) (Output, error) {
+		return s.Stop(ctx, options)
+	})
+}
+
+// PsAll lists containers of all registered projects concurrently.
+// options.Project is ignored; each Service uses its own project.
+// It returns summaries of each project and errors of all projects combined by errors.Join.
+func (m *ProjectManager) PsAll(ctx context.Context, options api.PsOptions) (map[string][]api.ContainerSummary, error) {
+	options.Project = nil
+	return forEachProject(m, func(s *Service) ([]api.ContainerSummary, error) {
+		return s.Ps(ctx, options)
+	})
+}
+
+func forEachProject[T any](m *ProjectManager, fn func(s *Service) (T, error)) (map[string]T, error) {
+	m.mu.RLock()
+	services := make(map[string]*Service, len(m.services))
+	for name, s := range m.services {
+		services[name] = s
+	}
+	m.mu.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results = make(map[string]T, len(services))
+		errs    []error
+	)
+	for name, s := range services {
+		wg.Add(1)
+		go func(name string, s *Service) {
+			defer wg.Done()
+			result, err := fn(s)
+			mu.Lock()
+			defer mu.Unlock()
+			results[name] = result
+			if err != nil {
+				errs = append(errs, fmt.Errorf("project %s: %w", name, err))
+			}
+		}(name, s)
+	}
+	wg.Wait()
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestProjectManager(t *testing.T) {
+	ctx := context.Background()
+	m := NewProjectManager(loaderAdditional.loader.DockerCli)
+
+	for _, name := range []string{"tenant-b", "tenant-a"} {
+		project, err := loaderAdditional.Load(ctx)
+		assert.NilError(t, err)
+		s, err := m.Add(name, project)
+		assert.NilError(t, err)
+		assert.Assert(t, s.cli != m.cli)
+	}
+
+	project, err := loaderAdditional.Load(ctx)
+	assert.NilError(t, err)
+	_, err = m.Add("tenant-a", project)
+	assert.ErrorIs(t, err, ErrProjectExists)
+
+	assert.DeepEqual(t, []string{"tenant-a", "tenant-b"}, m.Names())
+	a, ok := m.Get("tenant-a")
+	assert.Assert(t, ok)
+	b, _ := m.Get("tenant-b")
+	assert.Assert(t, a != b && a.cli != b.cli)
+	assert.Assert(t, a.Client() == b.Client())
+
+	var calls atomic.Int32
+	results, err := forEachProject(m, func(s *Service) (string, error) {
+		calls.Add(1)
+		return s.projectName, nil
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, int32(2), calls.Load())
+	assert.DeepEqual(t, map[string]string{"tenant-a": "tenant-a", "tenant-b": "tenant-b"}, results)
+
+	assert.Assert(t, m.Remove("tenant-a"))
+	assert.Assert(t, !m.Remove("tenant-a"))
+	_, ok = m.Get("tenant-a")
+	assert.Assert(t, !ok)
+}
@@ -72,20 +72,38 @@ var states = []State{
 	StateError,
 }
 
+// NamedResource identifies a resource in Output.
 type NamedResource struct {
 	Resource Resource
 	Name     string
+	// Num is the replica number of a container, starting from 1. It is 0 for volumes and networks.
+	Num int
 }
 
 func (nr NamedResource) String() string {
+	if nr.Num > 0 {
+		return string(nr.Resource) + ":" + nr.Name + ":" + strconv.Itoa(nr.Num)
+	}
 	return string(nr.Resource) + ":" + nr.Name
 }
 
 type Output struct {
 	Resource map[NamedResource]OutputLine
-	Out, Err string
+	// Errors are raw lines reporting errors, including lines of resources in StateError.
+	// Warnings are raw lines reporting warnings, e.g. printed by logrus as "WARN[0000] ...".
+	// Both are trimmed and in order of appearance, stdout first.
+	Errors, Warnings []string
+	Out, Err         string
 }
 
+// ParseOutput decodes progress lines written by compose to stdout and stderr into o.Resource.
+//
+// Lines are printed by the plain progress writer of compose as "[DRY-RUN MODE - ] <ID> <Text> <StatusText>",
+// since Service always redirects streams to buffers, which are not terminals.
+// Capturing progress.Event directly would be preferable but compose v2.24 does not allow it:
+// it has no JSON progress mode and progress.Run always replaces the progress.Writer stored in the context
+// with one created by progress.NewWriter.
+// Setting progress.Mode to progress.ModeQuiet suppresses those lines and leaves o.Resource empty.
 func (o *Output) ParseOutput(stdout, stderr string, projectName string, project *types.Project, isDryRunMode bool) {
 	if o.Resource == nil {
 		o.Resource = make(map[NamedResource]OutputLine)
@@ -102,13 +120,34 @@ func (o *Output) ParseOutput(stdout, stderr string, projectName string, project
 			}
 			decoded, err := DecodeComposeOutputLine(line, projectName, project, isDryRunMode)
 			if err != nil {
+				switch classifyDiagnostic(line) {
+				case diagnosticError:
+					o.Errors = append(o.Errors, strings.TrimSpace(line))
+				case diagnosticWarning:
+					o.Warnings = append(o.Warnings, strings.TrimSpace(line))
+				}
 				continue
 			}
-			o.Resource[NamedResource{decoded.Resource, decoded.Name}] = decoded
+			if decoded.State == StateError {
+				o.Errors = append(o.Errors, strings.TrimSpace(line))
+			}
+			o.Resource[decoded.NamedResource()] = decoded
 		}
 	}
 }
 
+// Containers returns the last lines of all replicas of service, sorted by the replica number.
+func (o Output) Containers(service string) []OutputLine {
+	var lines []OutputLine
+	for nr, line := range o.Resource {
+		if nr.Resource == ResourceContainer && nr.Name == service {
+			lines = append(lines, line)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Num < lines[j].Num })
+	return lines
+}
+
 type OutputLine struct {
 	Name       string
 	Num        int
@@ -118,6 +157,11 @@ type OutputLine struct {
 	DryRunMode bool
 }
 
+// NamedResource returns the key of l in Output.Resource.
+func (l OutputLine) NamedResource() NamedResource {
+	return NamedResource{Resource: l.Resource, Name: l.Name, Num: l.Num}
+}
+
 func DecodeComposeOutputLine(line string, projectName string, project *types.Project, isDryRunMode bool) (OutputLine, error) {
 	orgLine := line
 
@@ -143,6 +187,8 @@ func DecodeComposeOutputLine(line string, projectName string, project *types.Pro
 	if decoded.State == "" {
 		return OutputLine{}, fmt.Errorf("unknown state. input = %s", orgLine)
 	}
+	// For StateError, Desc is the error message.
+	decoded.Desc = strings.TrimSpace(decoded.Desc)
 
 	return decoded, nil
 }
@@ -236,3 +282,28 @@ func readState(s string) (state State, rest string) {
 	}
 	return "", s
 }
+
+type diagnostic int
+
+const (
+	diagnosticNone diagnostic = iota
+	diagnosticError
+	diagnosticWarning
+)
+
+// classifyDiagnostic tells whether line, which is not decoded as OutputLine, reports an error or a warning.
+// Lines are printed by compose, and by logrus in its text format, i.e. "WARN[0000] msg" or `time="..." level=warning msg="msg"`.
+func classifyDiagnostic(line string) diagnostic {
+	line = strings.TrimLeftFunc(line, unicode.IsSpace)
+	line, _ = strings.CutPrefix(line, DryRunModePrefix)
+	lower := strings.ToLower(line)
+	switch {
+	case strings.HasPrefix(lower, "warn"), strings.Contains(lower, "level=warn"):
+		return diagnosticWarning
+	case strings.HasPrefix(lower, "erro"), strings.HasPrefix(lower, "fata"),
+		strings.Contains(lower, "level=error"), strings.Contains(lower, "level=fatal"),
+		strings.Contains(lower, "error response from daemon"):
+		return diagnosticError
+	}
+	return diagnosticNone
+}
@@ -69,10 +69,10 @@ var (
 	}
 
 	createDryRunOutputResourceMap = map[NamedResource]OutputLine{
-		{"Network", "sample network"}:   {DryRunMode: true, Resource: ResourceNetwork, Name: "sample network", State: StateCreated},
-		{"Volume", "sample-volume"}:     {DryRunMode: true, Resource: ResourceVolume, Name: "sample-volume", State: StateCreated},
-		{"Container", "sample_service"}: {DryRunMode: true, Resource: ResourceContainer, Name: "sample_service", Num: 1, State: StateCreated},
-		{"Container", "additional"}:     {DryRunMode: true, Resource: ResourceContainer, Name: "additional", Num: 1, State: StateCreated},
+		{"Network", "sample network", 0}:   {DryRunMode: true, Resource: ResourceNetwork, Name: "sample network", State: StateCreated},
+		{"Volume", "sample-volume", 0}:     {DryRunMode: true, Resource: ResourceVolume, Name: "sample-volume", State: StateCreated},
+		{"Container", "sample_service", 1}: {DryRunMode: true, Resource: ResourceContainer, Name: "sample_service", Num: 1, State: StateCreated},
+		{"Container", "additional", 1}:     {DryRunMode: true, Resource: ResourceContainer, Name: "additional", Num: 1, State: StateCreated},
 	}
 )
 
@@ -154,6 +154,48 @@ func TestOutput(t *testing.T) {
 	assert.Assert(t, out.Err == createDryRunTxt)
 
 	assert.Assert(t, cmp.Equal(out.Resource, createDryRunOutputResourceMap))
+	assert.Assert(t, out.Errors == nil)
+	assert.Assert(t, out.Warnings == nil)
+}
+
+func TestOutput_diagnostics(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	stderr := strings.Join([]string{
+		`WARN[0000] /testdata/compose.yml: version is obsolete`,
+		` Container testdata-sample_service-1  Creating`,
+		` Container testdata-sample_service-1  Error  Error response from daemon: Conflict. The container name is already in use`,
+		`time="2024-01-01T00:00:00Z" level=warning msg="network default: not found"`,
+		`Error response from daemon: driver failed programming external connectivity`,
+		` Container testdata-additional-1  Created`,
+		`some random line`,
+	}, "\n")
+
+	var out Output
+	out.ParseOutput("", stderr, "testdata", project, false)
+
+	assert.DeepEqual(t, []string{
+		`Container testdata-sample_service-1  Error  Error response from daemon: Conflict. The container name is already in use`,
+		`Error response from daemon: driver failed programming external connectivity`,
+	}, out.Errors)
+	assert.DeepEqual(t, []string{
+		`WARN[0000] /testdata/compose.yml: version is obsolete`,
+		`time="2024-01-01T00:00:00Z" level=warning msg="network default: not found"`,
+	}, out.Warnings)
+	assert.DeepEqual(
+		t,
+		OutputLine{
+			Resource: ResourceContainer,
+			Name:     "sample_service",
+			Num:      1,
+			State:    StateError,
+			Desc:     "Error response from daemon: Conflict. The container name is already in use",
+		},
+		out.Resource[NamedResource{ResourceContainer, "sample_service", 1}],
+	)
 }
 
 //go:embed  testdata/00_create-dryrun.txt
@@ -182,3 +224,31 @@ var down string
 
 //go:embed  testdata/08_nonexistent_compose_yml.txt
 var nonexistentComposeYml string
+
+func TestOutput_replicas(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	stderr := strings.Join([]string{
+		` Container testdata-sample_service-1  Running`,
+		` Container testdata-sample_service-2  Creating`,
+		` Container testdata-sample_service-3  Creating`,
+		` Container testdata-sample_service-3  Created`,
+		` Container testdata-sample_service-2  Created`,
+		` Container testdata-additional-1  Running`,
+	}, "\n")
+
+	var out Output
+	out.ParseOutput("", stderr, "testdata", project, false)
+
+	assert.DeepEqual(t, []OutputLine{
+		{Resource: ResourceContainer, Name: "sample_service", Num: 1, State: StateRunning},
+		{Resource: ResourceContainer, Name: "sample_service", Num: 2, State: StateCreated},
+		{Resource: ResourceContainer, Name: "sample_service", Num: 3, State: StateCreated},
+	}, out.Containers("sample_service"))
+	assert.Equal(t, 1, len(out.Containers("additional")))
+	assert.Equal(t, 0, len(out.Containers("nonexistent")))
+	assert.Equal(t, "Container:sample_service:2", NamedResource{ResourceContainer, "sample_service", 2}.String())
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// WithOverride returns a new Loader whose ConfigDetails has configFile appended,
+// just like passing another -f to docker compose. l is left unchanged.
+//
+// configFile is read from Filename and parsed unless Content or Config is given.
+// Services which configFile defines must already be defined by files of l:
+// an override may change services but must not add new ones,
+// otherwise an error wrapping ErrNoSuchService is returned.
+func (l *Loader) WithOverride(configFile types.ConfigFile) (*Loader, error) {
+	override, err := preloadConfigFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading override %s: %w", configFile.Filename, err)
+	}
+
+	base, err := PreloadConfigDetails(l.ConfigDetails)
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, f := range base.ConfigFiles {
+		for _, name := range configServiceNames(f.Config) {
+			known[name] = true
+		}
+	}
+	for _, name := range configServiceNames(override.Config) {
+		if !known[name] {
+			return nil, fmt.Errorf("%w: %s is defined by override %s", ErrNoSuchService, name, configFile.Filename)
+		}
+	}
+
+	conf := cloneConfigDetails(l.ConfigDetails)
+	conf.ConfigFiles = append(conf.ConfigFiles, override)
+	return &Loader{
+		DockerCli:     l.DockerCli,
+		ProjectName:   l.ProjectName,
+		ConfigDetails: conf,
+		Options:       slices.Clone(l.Options),
+		Injectors:     slices.Clone(l.Injectors),
+	}, nil
+}
+
+// WithOverlayYAML is WithOverride for content which is not stored in a file.
+// The overlay is named after its position in ConfigFiles, e.g. "overlay-1.yml",
+// and relative paths in it are resolved against WorkingDir of ConfigDetails.
+func (l *Loader) WithOverlayYAML(content []byte) (*Loader, error) {
+	return l.WithOverride(types.ConfigFile{
+		Filename: fmt.Sprintf("overlay-%d.yml", len(l.ConfigDetails.ConfigFiles)),
+		Content:  slices.Clone(content),
+	})
+}
+
+func preloadConfigFile(f types.ConfigFile) (types.ConfigFile, error) {
+	f = cloneConfigFiles([]types.ConfigFile{f})[0]
+	if len(f.Config) > 0 {
+		return f, nil
+	}
+	if len(f.Content) == 0 {
+		bin, err := os.ReadFile(f.Filename)
+		if err != nil {
+			return types.ConfigFile{}, err
+		}
+		f.Content = bin
+	}
+	parsed, err := loader.ParseYAML(f.Content)
+	if err != nil {
+		return types.ConfigFile{}, err
+	}
+	f.Config = parsed
+	return f, nil
+}
+
+// configServiceNames returns sorted keys of the top-level services in a parsed config.
+func configServiceNames(config map[string]any) []string {
+	services, _ := config["services"].(map[string]any)
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+	"gotest.tools/v3/assert"
+)
+
+func TestLoader_WithOverride(t *testing.T) {
+	base := &Loader{
+		ProjectName: "override",
+		ConfigDetails: types.ConfigDetails{
+			WorkingDir: "./testdata",
+			ConfigFiles: []types.ConfigFile{
+				{Filename: "./testdata/compose.yml"},
+				{Filename: "./testdata/additional.yml"},
+			},
+			Environment: types.Mapping{},
+		},
+	}
+
+	overridden, err := base.WithOverlayYAML([]byte(`services:
+  additional:
+    image: debian:bookworm-20231009
+    entrypoint: echo overridden
+`))
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(base.ConfigDetails.ConfigFiles))
+	assert.Equal(t, 3, len(overridden.ConfigDetails.ConfigFiles))
+	assert.Equal(t, "overlay-2.yml", overridden.ConfigDetails.ConfigFiles[2].Filename)
+
+	overridden.Options = append(overridden.Options, func(o *loader.Options) { o.Profiles = []string{"*"} })
+	project, err := overridden.Load(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, "debian:bookworm-20231009", project.Services["additional"].Image)
+	assert.DeepEqual(t, types.ShellCommand{"echo", "overridden"}, project.Services["additional"].Entrypoint)
+	assert.Equal(t, "ubuntu:jammy-20230624", project.Services["sample_service"].Image)
+
+	// overriding an override works as well.
+	again, err := overridden.WithOverride(types.ConfigFile{
+		Filename: "again.yml",
+		Config: map[string]any{
+			"services": map[string]any{
+				"sample_service": map[string]any{"image": "ubuntu:noble"},
+			},
+		},
+	})
+	assert.NilError(t, err)
+	project, err = again.Load(context.Background())
+	assert.NilError(t, err)
+	assert.Equal(t, "ubuntu:noble", project.Services["sample_service"].Image)
+
+	_, err = base.WithOverlayYAML([]byte(`services:
+  additional:
+    image: debian:bookworm-20231009
+  unknown:
+    image: busybox:1.36
+`))
+	assert.ErrorIs(t, err, ErrNoSuchService)
+	assert.ErrorContains(t, err, "unknown")
+
+	_, err = base.WithOverride(types.ConfigFile{Filename: "./testdata/nonexistent.yml"})
+	assert.ErrorContains(t, err, "nonexistent.yml")
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// OperationPlan is what an operation would do, recorded by Plan.
+type OperationPlan struct {
+	// Resources are resources the operation would touch, in order of their first appearance.
+	Resources []ResourceTransition
+	// Output is the Output of the dry run.
+	Output Output
+
+	projectName string
+	project     *types.Project
+}
+
+// ResourceTransition is states a resource goes through, in order.
+// Consecutive duplicate states are collapsed.
+type ResourceTransition struct {
+	Resource NamedResource
+	States   []State
+}
+
+// Final returns the last state of r.
+func (r ResourceTransition) Final() State {
+	if len(r.States) == 0 {
+		return ""
+	}
+	return r.States[len(r.States)-1]
+}
+
+// PlanDeviation is a resource whose final state in a real run differs from the plan.
+// Planned or Actual is empty if the resource is missing in the plan or the real run, respectively.
+type PlanDeviation struct {
+	Resource        NamedResource
+	Planned, Actual State
+}
+
+// Plan runs op against a dry run clone of s, created by DryRunMode, and returns what op would do.
+// s itself is not affected, and op must not use s but the Service passed to it.
+//
+// Transitions are derived from progress lines of the dry run, decoded in the same way as Output.ParseOutput.
+// Progress events of compose cannot be captured directly; see Output.ParseOutput.
+// The returned error is that of op, in which case the plan is still filled as far as op has gone.
+func (s *Service) Plan(ctx context.Context, op func(ctx context.Context, s *Service) (Output, error)) (OperationPlan, error) {
+	dryRun, dryRunCtx, err := s.DryRunMode(ctx)
+	if err != nil {
+		return OperationPlan{}, err
+	}
+	out, err := op(dryRunCtx, dryRun)
+	plan := OperationPlan{
+		Output:      out,
+		projectName: dryRun.projectName,
+		project:     dryRun.project,
+	}
+	plan.Resources = transitions(out, plan.projectName, plan.project, true)
+	return plan, err
+}
+
+// Compare returns resources whose final state in actual, the Output of the real run, differs from p,
+// sorted by NamedResource.String.
+func (p OperationPlan) Compare(actual Output) []PlanDeviation {
+	planned := map[NamedResource]State{}
+	for _, r := range p.Resources {
+		planned[r.Resource] = r.Final()
+	}
+	actualStates := map[NamedResource]State{}
+	for _, r := range transitions(actual, p.projectName, p.project, false) {
+		actualStates[r.Resource] = r.Final()
+	}
+
+	var deviations []PlanDeviation
+	for nr, state := range planned {
+		if actualStates[nr] != state {
+			deviations = append(deviations, PlanDeviation{Resource: nr, Planned: state, Actual: actualStates[nr]})
+		}
+	}
+	for nr, state := range actualStates {
+		if _, ok := planned[nr]; !ok {
+			deviations = append(deviations, PlanDeviation{Resource: nr, Actual: state})
+		}
+	}
+	sort.Slice(deviations, func(i, j int) bool {
+		return deviations[i].Resource.String() < deviations[j].Resource.String()
+	})
+	return deviations
+}
+
+// transitions decodes raw lines of out, stdout first, into transitions of resources.
+func transitions(out Output, projectName string, project *types.Project, isDryRunMode bool) []ResourceTransition {
+	var result []ResourceTransition
+	index := map[NamedResource]int{}
+	for _, lines := range []string{out.Out, out.Err} {
+		scanner := bufio.NewScanner(strings.NewReader(lines))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+			decoded, err := DecodeComposeOutputLine(line, projectName, project, isDryRunMode)
+			if err != nil {
+				continue
+			}
+			nr := decoded.NamedResource()
+			i, ok := index[nr]
+			if !ok {
+				i = len(result)
+				index[nr] = i
+				result = append(result, ResourceTransition{Resource: nr})
+			}
+			if states := result[i].States; len(states) == 0 || states[len(states)-1] != decoded.State {
+				result[i].States = append(states, decoded.State)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/compose/v2/pkg/api"
+	"gotest.tools/v3/assert"
+)
+
+func TestOperationPlan(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+
+	plan := OperationPlan{
+		Output:      Output{Out: createDryRunTxt},
+		projectName: loaderAdditional.ProjectName(),
+		project:     project,
+	}
+	plan.Resources = transitions(plan.Output, plan.projectName, plan.project, true)
+
+	assert.DeepEqual(t, []ResourceTransition{
+		{NamedResource{ResourceNetwork, "sample network", 0}, []State{StateCreating, StateCreated}},
+		{NamedResource{ResourceVolume, "sample-volume", 0}, []State{StateCreating, StateCreated}},
+		{NamedResource{ResourceContainer, "sample_service", 1}, []State{StateCreating, StateCreated}},
+		{NamedResource{ResourceContainer, "additional", 1}, []State{StateCreating, StateCreated}},
+	}, plan.Resources)
+	assert.Equal(t, StateCreated, plan.Resources[0].Final())
+
+	// the real run did what was planned.
+	assert.Equal(t, 0, len(plan.Compare(Output{Out: create})))
+
+	deviations := plan.Compare(Output{Out: recreate})
+	assert.DeepEqual(t, []PlanDeviation{
+		{Resource: NamedResource{ResourceContainer, "additional", 1}, Planned: StateCreated, Actual: StateRemoved},
+		{Resource: NamedResource{ResourceContainer, "sample_service", 1}, Planned: StateCreated, Actual: StateRecreated},
+		{Resource: NamedResource{ResourceNetwork, "sample network", 0}, Planned: StateCreated},
+		{Resource: NamedResource{ResourceVolume, "sample-volume", 0}, Planned: StateCreated},
+	}, deviations)
+}
+
+func TestComposeService_Plan_dind(t *testing.T) {
+	composeService, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+
+	plan, err := composeService.Plan(context.Background(), func(ctx context.Context, s *Service) (Output, error) {
+		return s.Create(ctx, api.CreateOptions{})
+	})
+	assert.NilError(t, err)
+	for _, r := range plan.Resources {
+		assert.Equal(t, StateCreated, r.Final(), "resource %s", r.Resource)
+	}
+}
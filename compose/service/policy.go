@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// Operation names an operation of Service which returns Output.
+type Operation string
+
+const (
+	OperationCreate  Operation = "create"
+	OperationStart   Operation = "start"
+	OperationUp      Operation = "up"
+	OperationRestart Operation = "restart"
+	OperationStop    Operation = "stop"
+	OperationDown    Operation = "down"
+	OperationKill    Operation = "kill"
+	OperationRemove  Operation = "remove"
+	OperationPause   Operation = "pause"
+	OperationUnpause Operation = "unpause"
+	OperationScale   Operation = "scale"
+)
+
+var allOperations = []Operation{
+	OperationCreate, OperationStart, OperationUp, OperationRestart, OperationStop, OperationDown,
+	OperationKill, OperationRemove, OperationPause, OperationUnpause, OperationScale,
+}
+
+// idempotentOperations are operations which converge to the same state when called again after a failure,
+// thus are safe to be retried.
+var idempotentOperations = map[Operation]bool{
+	OperationCreate: true,
+	OperationStart:  true,
+	OperationStop:   true,
+}
+
+// RetryPolicy configures retries of Create, Start and Stop.
+// Other operations are never retried since retrying them after a partial failure may not be safe,
+// e.g. Restart would restart containers twice.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of calls including the first one. Values less than 2 disable retries.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the delay before each retry, which doubles on every retry
+	// and is randomly jittered to its half at the minimum.
+	// If zero, 500ms and 10s are used respectively.
+	MinBackoff, MaxBackoff time.Duration
+	// Retryable reports whether err should be retried.
+	// If nil, IsTransient is used.
+	Retryable func(err error) bool
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	minBackoff, maxBackoff := p.MinBackoff, p.MaxBackoff
+	if minBackoff <= 0 {
+		minBackoff = 500 * time.Millisecond
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	d := minBackoff
+	for i := 0; i < retry && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsTransient(err)
+}
+
+// IsTransient reports whether err is likely to be resolved by retrying,
+// i.e. the docker daemon was not reachable or reported itself unavailable.
+func IsTransient(err error) bool {
+	return errors.Is(err, ErrDaemonUnavailable) ||
+		client.IsErrConnectionFailed(err) ||
+		errdefs.IsUnavailable(err)
+}
+
+// ServiceOption configures Service created by NewService.
+type ServiceOption func(s *Service)
+
+// WithTimeout sets the default timeout of ops. If no op is given, it is set for all operations.
+// The timeout is applied in addition to the deadline of the context passed to each call; the earlier one wins.
+func WithTimeout(timeout time.Duration, ops ...Operation) ServiceOption {
+	return func(s *Service) {
+		if len(ops) == 0 {
+			ops = allOperations
+		}
+		for _, op := range ops {
+			s.timeouts[op] = timeout
+		}
+	}
+}
+
+// WithRetryPolicy sets the retry policy of Create, Start and Stop.
+func WithRetryPolicy(policy RetryPolicy) ServiceOption {
+	return func(s *Service) {
+		s.retry = policy
+	}
+}
+
+// run calls call under the timeout and the retry policy configured for op,
+// and returns Output of the last attempt and its classified error.
+// s.mu must be held.
+func (s *Service) run(ctx context.Context, op Operation, services []string, call func(ctx context.Context) error) (out Output, err error) {
+	ctx, end := s.startSpan(ctx, string(op), services)
+	defer func() { end(&out, err) }()
+
+	if timeout := s.timeouts[op]; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = call(ctx)
+		out = s.parseOutput()
+		err = s.classifyError(err, out)
+		if err == nil ||
+			!idempotentOperations[op] ||
+			attempt >= s.retry.MaxAttempts ||
+			ctx.Err() != nil ||
+			!s.retry.retryable(err) {
+			return out, err
+		}
+
+		backoff := s.retry.backoff(attempt - 1)
+		addSpanEvent(ctx, "retry", "attempt %d failed, retrying in %s: %s", attempt, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return out, err
+		case <-timer.C:
+		}
+		s.resetBuf()
+	}
+}
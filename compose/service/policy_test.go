@@ -0,0 +1,106 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/errdefs"
+	"gotest.tools/v3/assert"
+)
+
+func TestService_run(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+
+	newService := func(opts ...ServiceOption) *Service {
+		s := &Service{
+			out:         new(bytes.Buffer),
+			err:         new(bytes.Buffer),
+			projectName: "testdata",
+			project:     project,
+			timeouts:    map[Operation]time.Duration{},
+		}
+		for _, opt := range opts {
+			opt(s)
+		}
+		return s
+	}
+	policy := RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+	unavailable := errdefs.Unavailable(errors.New("unavailable"))
+
+	t.Run("retries transient errors of idempotent operations", func(t *testing.T) {
+		s := newService(WithRetryPolicy(policy))
+		var calls int
+		out, err := s.run(context.Background(), OperationCreate, nil, func(ctx context.Context) error {
+			calls++
+			s.err.WriteString(" Container testdata-additional-1  Creating\n")
+			if calls < 3 {
+				return unavailable
+			}
+			return nil
+		})
+		assert.NilError(t, err)
+		assert.Equal(t, 3, calls)
+		// Output is of the last attempt.
+		assert.Equal(t, " Container testdata-additional-1  Creating\n", out.Err)
+	})
+
+	t.Run("gives up after MaxAttempts", func(t *testing.T) {
+		s := newService(WithRetryPolicy(policy))
+		var calls int
+		_, err := s.run(context.Background(), OperationStop, nil, func(ctx context.Context) error {
+			calls++
+			return unavailable
+		})
+		assert.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("does not retry non idempotent operations or permanent errors", func(t *testing.T) {
+		s := newService(WithRetryPolicy(policy))
+		var calls int
+		_, err := s.run(context.Background(), OperationRestart, nil, func(ctx context.Context) error {
+			calls++
+			return unavailable
+		})
+		assert.ErrorIs(t, err, unavailable)
+		assert.Equal(t, 1, calls)
+
+		calls = 0
+		permanent := errors.New("permanent")
+		_, err = s.run(context.Background(), OperationStart, nil, func(ctx context.Context) error {
+			calls++
+			return permanent
+		})
+		assert.ErrorIs(t, err, permanent)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("applies timeouts", func(t *testing.T) {
+		s := newService(WithTimeout(time.Millisecond, OperationDown))
+		_, err := s.run(context.Background(), OperationDown, nil, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		_, err = s.run(context.Background(), OperationStop, nil, func(ctx context.Context) error {
+			_, ok := ctx.Deadline()
+			assert.Assert(t, !ok)
+			return nil
+		})
+		assert.NilError(t, err)
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for retry, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		d := p.backoff(retry)
+		assert.Assert(t, max/2 <= d && d <= max, "retry %d: backoff = %s", retry, d)
+	}
+}
@@ -3,8 +3,12 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/cli/cli/command"
@@ -12,6 +16,7 @@ import (
 	"github.com/docker/compose/v2/pkg/api"
 	"github.com/docker/compose/v2/pkg/compose"
 	"github.com/docker/docker/client"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // AddDockerComposeLabel changes service.CustomLabels so that is can be found by docker compose v2.
@@ -50,6 +55,13 @@ type Service struct {
 	projectName string
 	project     *types.Project
 	service     api.Service
+	// outputEvents, if non nil, receives lines decoded while operations are running.
+	outputEvents chan<- OutputLine
+	timeouts     map[Operation]time.Duration
+	retry        RetryPolicy
+	tracer       trace.Tracer
+	// redactor is nil if nothing is sensitive.
+	redactor *Redactor
 }
 
 // NewService returns a new wrapped compose service proxy.
@@ -58,6 +70,7 @@ func NewService(
 	projectName string,
 	project *types.Project,
 	dockerCli command.Cli,
+	opts ...ServiceOption,
 ) *Service {
 	AddDockerComposeLabel(project)
 
@@ -73,28 +86,101 @@ func NewService(
 		service:     serviceProxy,
 		projectName: projectName,
 		project:     project,
+		timeouts:    map[Operation]time.Duration{},
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.overrideOutputStreams()
 	return s
 }
 
-func (s *Service) UpdateProject(mutators ...func(p *types.Project) *types.Project) {
+// ErrOperationInFlight is returned from TryUpdateProject if an operation of Service is running.
+var ErrOperationInFlight = errors.New("operation in flight")
+
+// UpdateProject applies mutators to a clone of the project and replaces the project with it.
+// It waits for an operation in flight, if any, to finish.
+//
+// UpdateProject returns the difference between the old and new project so that callers can log or audit mutations.
+func (s *Service) UpdateProject(mutators ...func(p *types.Project) *types.Project) ProjectPlan {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.updateProject(mutators)
+}
+
+// TryUpdateProject is like UpdateProject but fails with ErrOperationInFlight instead of waiting
+// if an operation is running.
+func (s *Service) TryUpdateProject(mutators ...func(p *types.Project) *types.Project) (ProjectPlan, error) {
+	if !s.mu.TryLock() {
+		return ProjectPlan{}, ErrOperationInFlight
+	}
+	defer s.mu.Unlock()
+	return s.updateProject(mutators), nil
+}
 
+func (s *Service) updateProject(mutators []func(p *types.Project) *types.Project) ProjectPlan {
 	cloned, _ := s.project.WithServicesEnabled()
 	for _, mut := range mutators {
 		cloned = mut(cloned)
 	}
+	plan := CompareProject(s.project, cloned)
 	s.project = cloned
+	return plan
+}
+
+// Project returns a clone of the project of s.
+func (s *Service) Project() *types.Project {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cloned, _ := s.project.WithServicesEnabled()
+	return cloned
+}
+
+// Redactor returns the Redactor set by WithRedactor, which is nil if nothing is sensitive.
+func (s *Service) Redactor() *Redactor {
+	return s.redactor
 }
 
 func (s *Service) Client() client.APIClient {
 	return s.cli.Client()
 }
 
+// NotifyOutput makes s send OutputLine to ch as soon as compose prints it in the middle of operations,
+// e.g. Create, Start or Down, so that callers can show live status of long operations.
+// Output returned from operations is not affected.
+//
+// Like signal.Notify, s does not block sending to ch: lines are dropped if ch is not ready.
+// Passing nil stops notification. ch is never closed by s.
+func (s *Service) NotifyOutput(ch chan<- OutputLine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outputEvents = ch
+	s.overrideOutputStreams()
+}
+
 func (s *Service) overrideOutputStreams() {
-	_ = s.cli.Apply(command.WithOutputStream(s.out), command.WithErrorStream(s.err))
+	out, err := s.outputStreams()
+	_ = s.cli.Apply(command.WithOutputStream(out), command.WithErrorStream(err))
+}
+
+// outputStreams returns writers to which compose should print.
+func (s *Service) outputStreams() (out, err io.Writer) {
+	ch := s.outputEvents
+	if ch == nil {
+		return s.out, s.err
+	}
+	notify := func(line string) {
+		decoded, err := DecodeComposeOutputLine(line, s.projectName, s.project, s.dryRun)
+		if err != nil {
+			return
+		}
+		select {
+		case ch <- decoded:
+		default:
+		}
+	}
+	return io.MultiWriter(s.out, &progressLineWriter{fn: notify}),
+		io.MultiWriter(s.err, &progressLineWriter{fn: notify})
 }
 
 func (s *Service) resetBuf() {
@@ -105,7 +191,7 @@ func (s *Service) resetBuf() {
 func (s *Service) parseOutput() Output {
 	out := Output{}
 	out.ParseOutput(s.out.String(), s.err.String(), s.projectName, s.project, s.dryRun)
-	return out
+	return s.redactor.redactOutput(out)
 }
 
 // Create executes the equivalent to a `compose create`
@@ -113,8 +199,9 @@ func (s *Service) Create(ctx context.Context, options api.CreateOptions) (Output
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	defer s.resetBuf()
-	err := s.service.Create(ctx, s.project, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationCreate, options.Services, func(ctx context.Context) error {
+		return s.service.Create(ctx, s.project, options)
+	})
 }
 
 // Start executes the equivalent to a `compose start`
@@ -125,8 +212,31 @@ func (s *Service) Start(ctx context.Context, options api.StartOptions) (Output,
 	if options.Project == nil {
 		options.Project = s.project
 	}
-	err := s.service.Start(ctx, s.projectName, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationStart, options.Services, func(ctx context.Context) error {
+		return s.service.Start(ctx, s.projectName, options)
+	})
+}
+
+// Up executes the equivalent to a `compose up --detach`, which creates and then starts containers.
+// options.Start.Wait and options.Start.WaitTimeout are honored.
+//
+// options.Start.Attach is always ignored, and so are AttachTo, CascadeStop and ExitCodeFrom which only make sense with it.
+// Attaching makes compose install its own signal handlers and block until containers exit,
+// which is not what a library wants to do.
+func (s *Service) Up(ctx context.Context, options api.UpOptions) (Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+	if options.Start.Project == nil {
+		options.Start.Project = s.project
+	}
+	options.Start.Attach = nil
+	options.Start.AttachTo = nil
+	options.Start.CascadeStop = false
+	options.Start.ExitCodeFrom = ""
+	return s.run(ctx, OperationUp, options.Create.Services, func(ctx context.Context) error {
+		return s.service.Up(ctx, s.project, options)
+	})
 }
 
 // Restart restarts containers
@@ -137,8 +247,9 @@ func (s *Service) Restart(ctx context.Context, options api.RestartOptions) (Outp
 	if options.Project == nil {
 		options.Project = s.project
 	}
-	err := s.service.Restart(ctx, s.projectName, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationRestart, options.Services, func(ctx context.Context) error {
+		return s.service.Restart(ctx, s.projectName, options)
+	})
 }
 
 // Stop executes the equivalent to a `compose stop`
@@ -149,8 +260,9 @@ func (s *Service) Stop(ctx context.Context, options api.StopOptions) (Output, er
 	if options.Project == nil {
 		options.Project = s.project
 	}
-	err := s.service.Stop(ctx, s.projectName, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationStop, options.Services, func(ctx context.Context) error {
+		return s.service.Stop(ctx, s.projectName, options)
+	})
 }
 
 // Down executes the equivalent to a `compose down`
@@ -161,8 +273,9 @@ func (s *Service) Down(ctx context.Context, options api.DownOptions) (Output, er
 	if options.Project == nil {
 		options.Project = s.project
 	}
-	err := s.service.Down(ctx, s.projectName, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationDown, options.Services, func(ctx context.Context) error {
+		return s.service.Down(ctx, s.projectName, options)
+	})
 }
 
 // Ps executes the equivalent to a `compose ps`
@@ -172,7 +285,9 @@ func (s *Service) Ps(ctx context.Context, options api.PsOptions) ([]api.Containe
 	if options.Project == nil {
 		options.Project = s.project
 	}
+	ctx, end := s.startSpan(ctx, "ps", options.Services)
 	summary, err := s.service.Ps(ctx, s.projectName, options)
+	end(nil, err)
 	if err != nil {
 		return nil, err
 	}
@@ -187,13 +302,73 @@ func (s *Service) Kill(ctx context.Context, options api.KillOptions) (Output, er
 	if options.Project == nil {
 		options.Project = s.project
 	}
-	err := s.service.Kill(ctx, s.projectName, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationKill, options.Services, func(ctx context.Context) error {
+		return s.service.Kill(ctx, s.projectName, options)
+	})
+}
+
+// Pause executes the equivalent to a `compose pause`
+func (s *Service) Pause(ctx context.Context, options api.PauseOptions) (Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+	if options.Project == nil {
+		options.Project = s.project
+	}
+	return s.run(ctx, OperationPause, options.Services, func(ctx context.Context) error {
+		return s.service.Pause(ctx, s.projectName, options)
+	})
+}
+
+// Unpause executes the equivalent to a `compose unpause`
+func (s *Service) Unpause(ctx context.Context, options api.PauseOptions) (Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+	if options.Project == nil {
+		options.Project = s.project
+	}
+	return s.run(ctx, OperationUnpause, options.Services, func(ctx context.Context) error {
+		return s.service.UnPause(ctx, s.projectName, options)
+	})
+}
+
+// Scale executes the equivalent to a `compose scale`, which sets the number of containers of each service to replicas.
+// Services not in replicas are left untouched.
+//
+// On success the new scales are also stored to the project of s,
+// so that later calls, e.g. Up, do not revert them.
+func (s *Service) Scale(ctx context.Context, replicas map[string]int) (Output, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.resetBuf()
+
+	cloned, _ := s.project.WithServicesEnabled()
+	services := make([]string, 0, len(replicas))
+	for name, n := range replicas {
+		service, err := cloned.GetService(name)
+		if err != nil {
+			return Output{}, err
+		}
+		service.SetScale(n)
+		cloned.Services[name] = service
+		services = append(services, name)
+	}
+	sort.Strings(services)
+
+	out, err := s.run(ctx, OperationScale, services, func(ctx context.Context) error {
+		return s.service.Scale(ctx, cloned, api.ScaleOptions{Services: services})
+	})
+	if err == nil {
+		s.project = cloned
+	}
+	return out, err
 }
 
 // RunOneOffContainer is not exposed here since it calls `signal.Reset` on invocation,
 // which removes all signal handlers installed by user code.
 // Since it destroys our signal handling planning, we will not be able to rely on it.
+// Use RunOneOff and Exec instead, which talk to the docker API directly.
 
 // Remove executes the equivalent to a `compose rm`
 func (s *Service) Remove(ctx context.Context, options api.RemoveOptions) (Output, error) {
@@ -203,8 +378,9 @@ func (s *Service) Remove(ctx context.Context, options api.RemoveOptions) (Output
 	if options.Project == nil {
 		options.Project = s.project
 	}
-	err := s.service.Remove(ctx, s.projectName, options)
-	return s.parseOutput(), err
+	return s.run(ctx, OperationRemove, options.Services, func(ctx context.Context) error {
+		return s.service.Remove(ctx, s.projectName, options)
+	})
 }
 
 // DryRunMode switches c to dry run mode if dryRun is true.
@@ -236,6 +412,11 @@ func (s *Service) DryRunMode(ctx context.Context) (*Service, context.Context, er
 
 	newService.dryRun = true
 	newService.cli = cli
+	newService.outputEvents = s.outputEvents
+	newService.timeouts = s.timeouts
+	newService.retry = s.retry
+	newService.tracer = s.tracer
+	newService.redactor = s.redactor
 	newService.overrideOutputStreams()
 	newService.service = compose.NewComposeService(cli)
 
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/compose-spec/compose-go/v2/types"
+)
+
+// ErrNoSuchService is wrapped by errors returned when a name is neither an enabled nor a disabled service of the project.
+var ErrNoSuchService = errors.New("no such service")
+
+// Functions below treat enabled services of a project as a set.
+// Each returns a copy of the project whose services are rearranged between Services and DisabledServices;
+// the argument is never modified, and no service is ever dropped from the project.
+// Unlike WithServicesEnabled of compose-go, which works on profiles, they enable exactly the given services
+// and leave Profiles as is. Like it, environments of enabled services are resolved,
+// which fails if env_file of a service cannot be read.
+
+// Enable returns a copy of p with names enabled in addition to services already enabled.
+func Enable(p *types.Project, names ...string) (*types.Project, error) {
+	enabled, err := serviceSet(p, names)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range p.ServiceNames() {
+		enabled[name] = true
+	}
+	return withEnabled(p, enabled)
+}
+
+// Disable returns a copy of p with names disabled.
+func Disable(p *types.Project, names ...string) (*types.Project, error) {
+	disabled, err := serviceSet(p, names)
+	if err != nil {
+		return nil, err
+	}
+	enabled := map[string]bool{}
+	for _, name := range p.ServiceNames() {
+		if !disabled[name] {
+			enabled[name] = true
+		}
+	}
+	return withEnabled(p, enabled)
+}
+
+// Invert returns a copy of p whose enabled services are ones disabled in p, and vice versa.
+func Invert(p *types.Project) (*types.Project, error) {
+	enabled := map[string]bool{}
+	for _, name := range p.DisabledServiceNames() {
+		enabled[name] = true
+	}
+	return withEnabled(p, enabled)
+}
+
+// Intersect returns a copy of p whose enabled services are ones enabled in both of p and other.
+func Intersect(p, other *types.Project) (*types.Project, error) {
+	enabled := map[string]bool{}
+	for _, name := range p.ServiceNames() {
+		if _, ok := other.Services[name]; ok {
+			enabled[name] = true
+		}
+	}
+	return withEnabled(p, enabled)
+}
+
+// DependencyClosure returns a copy of p with services which enabled services depend on through depends_on,
+// transitively, enabled as well.
+// It returns an error wrapping ErrNoSuchService if a required dependency is not in p.
+func DependencyClosure(p *types.Project) (*types.Project, error) {
+	all := p.AllServices()
+	enabled := map[string]bool{}
+	var visit func(name string) error
+	visit = func(name string) error {
+		if enabled[name] {
+			return nil
+		}
+		enabled[name] = true
+		for dep, cfg := range all[name].DependsOn {
+			if _, ok := all[dep]; !ok {
+				if cfg.Required {
+					return fmt.Errorf("%w: %s, required by %s", ErrNoSuchService, dep, name)
+				}
+				continue
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range p.ServiceNames() {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+	return withEnabled(p, enabled)
+}
+
+func serviceSet(p *types.Project, names []string) (map[string]bool, error) {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		_, enabled := p.Services[name]
+		_, disabled := p.DisabledServices[name]
+		if !enabled && !disabled {
+			return nil, fmt.Errorf("%w: %s", ErrNoSuchService, name)
+		}
+		set[name] = true
+	}
+	return set, nil
+}
+
+// withEnabled returns a copy of p where services in enabled are in Services and others are in DisabledServices.
+func withEnabled(p *types.Project, enabled map[string]bool) (*types.Project, error) {
+	cloned, _ := p.WithServicesEnabled()
+	all := cloned.AllServices()
+	cloned.Services = make(types.Services, len(enabled))
+	cloned.DisabledServices = make(types.Services, len(all)-len(enabled))
+	for name, cfg := range all {
+		if enabled[name] {
+			cloned.Services[name] = cfg
+		} else {
+			cloned.DisabledServices[name] = cfg
+		}
+	}
+	return cloned.WithServicesEnvironmentResolved(true)
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestServiceSet(t *testing.T) {
+	// enabled, dependency and disabled are all in DisabledServices since no profile is activated.
+	src := loadFromString(reverseComposeYaml)
+	assert.Assert(t, cmp.Len(src.Services, 0))
+
+	assertSets := func(t *testing.T, p *types.Project, enabled, disabled []string) {
+		t.Helper()
+		assert.Assert(t, cmp.DeepEqual(enabled, p.ServiceNames()))
+		assert.Assert(t, cmp.DeepEqual(disabled, p.DisabledServiceNames()))
+	}
+
+	enabled, err := Enable(src, "enabled")
+	assert.NilError(t, err)
+	assertSets(t, enabled, []string{"enabled"}, []string{"dependency", "disabled"})
+	// src is untouched.
+	assertSets(t, src, nil, []string{"dependency", "disabled", "enabled"})
+
+	_, err = Enable(src, "unknown")
+	assert.ErrorIs(t, err, ErrNoSuchService)
+
+	closure, err := DependencyClosure(enabled)
+	assert.NilError(t, err)
+	assertSets(t, closure, []string{"dependency", "enabled"}, []string{"disabled"})
+
+	inverted, err := Invert(closure)
+	assert.NilError(t, err)
+	assertSets(t, inverted, []string{"disabled"}, []string{"dependency", "enabled"})
+
+	all, err := Enable(src, "enabled", "disabled", "dependency")
+	assert.NilError(t, err)
+	disabled, err := Disable(all, "disabled")
+	assert.NilError(t, err)
+	assertSets(t, disabled, []string{"dependency", "enabled"}, []string{"disabled"})
+	_, err = Disable(all, "unknown")
+	assert.ErrorIs(t, err, ErrNoSuchService)
+
+	intersected, err := Intersect(disabled, enabled)
+	assert.NilError(t, err)
+	assertSets(t, intersected, []string{"enabled"}, []string{"dependency", "disabled"})
+
+	none, err := Invert(all)
+	assert.NilError(t, err)
+	assertSets(t, none, nil, []string{"dependency", "disabled", "enabled"})
+	closure, err = DependencyClosure(none)
+	assert.NilError(t, err)
+	assertSets(t, closure, nil, []string{"dependency", "disabled", "enabled"})
+
+	broken, err := Enable(src, "enabled")
+	assert.NilError(t, err)
+	delete(broken.DisabledServices, "dependency")
+	_, err = DependencyClosure(broken)
+	assert.ErrorIs(t, err, ErrNoSuchService)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"testing"
 
+	"github.com/compose-spec/compose-go/v2/types"
 	"github.com/docker/compose/v2/pkg/api"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
@@ -19,6 +20,89 @@ func TestComposeService_dind(t *testing.T) {
 	out, err := dryRunService.Create(dryRunCtx, api.CreateOptions{})
 	assert.NilError(t, err)
 
-	delete(out.Resource, NamedResource{"Network", "default"})
+	delete(out.Resource, NamedResource{"Network", "default", 0})
 	assert.Assert(t, cmp.DeepEqual(createDryRunOutputResourceMap, out.Resource))
 }
+
+func TestComposeService_Up_dind(t *testing.T) {
+	composeService, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+
+	dryRunService, dryRunCtx, err := composeService.DryRunMode(context.Background())
+	assert.NilError(t, err)
+
+	out, err := dryRunService.Up(dryRunCtx, api.UpOptions{})
+	assert.NilError(t, err)
+
+	for _, name := range []string{"sample_service", "additional"} {
+		line, ok := out.Resource[NamedResource{ResourceContainer, name, 1}]
+		assert.Assert(t, ok, "container %s is not in output", name)
+		assert.Equal(t, StateStarted, line.State)
+	}
+}
+
+func TestComposeService_Scale_dind(t *testing.T) {
+	composeService, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+
+	dryRunService, dryRunCtx, err := composeService.DryRunMode(context.Background())
+	assert.NilError(t, err)
+
+	_, err = dryRunService.Scale(dryRunCtx, map[string]int{"nonexistent": 2})
+	assert.Assert(t, err != nil)
+
+	_, err = dryRunService.Scale(dryRunCtx, map[string]int{"additional": 3})
+	assert.NilError(t, err)
+	service, err := dryRunService.project.GetService("additional")
+	assert.NilError(t, err)
+	assert.Equal(t, 3, *service.Scale)
+}
+
+func TestComposeService_NotifyOutput_dind(t *testing.T) {
+	composeService, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+
+	events := make(chan OutputLine, 100)
+	composeService.NotifyOutput(events)
+
+	dryRunService, dryRunCtx, err := composeService.DryRunMode(context.Background())
+	assert.NilError(t, err)
+
+	out, err := dryRunService.Create(dryRunCtx, api.CreateOptions{})
+	assert.NilError(t, err)
+	close(events)
+
+	notified := map[NamedResource]OutputLine{}
+	for line := range events {
+		notified[line.NamedResource()] = line
+	}
+	assert.Assert(t, cmp.DeepEqual(out.Resource, notified))
+}
+
+func TestComposeService_UpdateProject(t *testing.T) {
+	composeService, err := loaderAdditional.LoadComposeService(context.Background())
+	assert.NilError(t, err)
+
+	setImage := func(p *types.Project) *types.Project {
+		service := p.Services["additional"]
+		service.Image = "ubuntu:jammy-20230624"
+		p.Services["additional"] = service
+		return p
+	}
+
+	plan := composeService.UpdateProject(setImage)
+	assert.Assert(t, cmp.DeepEqual(
+		[]ServiceChange{{Name: "additional", Fields: []string{"image"}, Action: ActionRecreate}},
+		plan.ChangedServices,
+	))
+	assert.Assert(t, composeService.UpdateProject(setImage).Empty())
+
+	composeService.mu.Lock()
+	_, err = composeService.TryUpdateProject(setImage)
+	assert.ErrorIs(t, err, ErrOperationInFlight)
+	composeService.mu.Unlock()
+
+	plan, err = composeService.TryUpdateProject()
+	assert.NilError(t, err)
+	assert.Assert(t, plan.Empty())
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ngicks/musicbox/compose/service"
+
+// WithTracerProvider makes Service record each operation as a span of a tracer obtained from tp.
+// Spans are named "compose.<operation>", e.g. "compose.create",
+// and carry the project name, services passed to the operation, counts of parsed Output and the error if any.
+func WithTracerProvider(tp trace.TracerProvider) ServiceOption {
+	return func(s *Service) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// startSpan starts a span for the operation op, e.g. OperationCreate or "ps", if s has a tracer.
+// The returned function ends the span. out may be nil for operations not returning Output.
+func (s *Service) startSpan(ctx context.Context, op string, services []string) (context.Context, func(out *Output, err error)) {
+	if s.tracer == nil {
+		return ctx, func(*Output, error) {}
+	}
+	ctx, span := s.tracer.Start(
+		ctx,
+		"compose."+op,
+		trace.WithAttributes(
+			attribute.String("compose.project", s.projectName),
+			attribute.String("compose.operation", op),
+			attribute.StringSlice("compose.services", services),
+			attribute.Bool("compose.dry_run", s.dryRun),
+		),
+	)
+	return ctx, func(out *Output, err error) {
+		if out != nil {
+			span.SetAttributes(
+				attribute.Int("compose.output.resources", len(out.Resource)),
+				attribute.Int("compose.output.errors", len(out.Errors)),
+				attribute.Int("compose.output.warnings", len(out.Warnings)),
+			)
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// addSpanEvent adds an event to the span in ctx, if any.
+func addSpanEvent(ctx context.Context, name string, format string, args ...any) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	span.AddEvent(name, trace.WithAttributes(attribute.String("message", fmt.Sprintf(format, args...))))
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gotest.tools/v3/assert"
+)
+
+func TestService_tracing(t *testing.T) {
+	project, err := loaderAdditional.Load(context.Background())
+	assert.NilError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	s := &Service{
+		out:         new(bytes.Buffer),
+		err:         new(bytes.Buffer),
+		projectName: "testdata",
+		project:     project,
+		timeouts:    map[Operation]time.Duration{},
+	}
+	WithTracerProvider(tp)(s)
+
+	_, err = s.run(context.Background(), OperationCreate, []string{"additional"}, func(ctx context.Context) error {
+		s.err.WriteString(" Container testdata-additional-1  Created\n")
+		return nil
+	})
+	assert.NilError(t, err)
+	failure := errors.New("failure")
+	_, err = s.run(context.Background(), OperationStop, nil, func(ctx context.Context) error {
+		return failure
+	})
+	assert.ErrorIs(t, err, failure)
+
+	spans := recorder.Ended()
+	assert.Equal(t, 2, len(spans))
+
+	assert.Equal(t, "compose.create", spans[0].Name())
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range spans[0].Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "testdata", attrs["compose.project"].AsString())
+	assert.DeepEqual(t, []string{"additional"}, attrs["compose.services"].AsStringSlice())
+	assert.Equal(t, int64(1), attrs["compose.output.resources"].AsInt64())
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+
+	assert.Equal(t, "compose.stop", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "failure", spans[1].Status().Description)
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/spf13/afero"
+)
+
+var reloadDebounce = 100 * time.Millisecond
+
+// ReloadEvent is sent by Watch when config files have changed.
+type ReloadEvent struct {
+	// Project is the project loaded from changed files. It is nil if Err is non nil.
+	Project *types.Project
+	// Err is an error of reading, loading or validating changed files.
+	// ConfigDetails of the LoaderProxy is left unchanged in that case.
+	Err error
+}
+
+// Watch watches files of ConfigDetails on the OS file system and reloads them when they change.
+// Files given only by Content, i.e. not present on disk, are not watched.
+// Directories containing files are watched non-recursively, so subdirectories, e.g. volumes mounted from them, cost nothing.
+//
+// On every change, contents of files are read again and the project is loaded, with injectors applied, and validated.
+// Only if that succeeds, ConfigDetails of p is updated so that later Load and LoadComposeService use the new contents.
+// Either way, the result is sent to the returned channel.
+// Changes which leave contents of all files as they were, e.g. chmod, are not reported.
+// A burst of changes, e.g. an editor writing a file in several steps, is coalesced.
+//
+// The channel is closed once ctx is cancelled. The caller must keep receiving from it until then.
+func (p *LoaderProxy) Watch(ctx context.Context) (<-chan ReloadEvent, error) {
+	conf := p.ConfigDetails()
+
+	watched := map[string]bool{}
+	dirs := map[string]bool{}
+	for _, f := range conf.ConfigFiles {
+		abs, err := filepath.Abs(f.Filename)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			continue
+		}
+		watched[abs] = true
+		dirs[filepath.Dir(abs)] = true
+	}
+	if len(watched) == 0 {
+		return nil, errors.New("service.LoaderProxy.Watch: no config file on disk")
+	}
+
+	changed := make(chan struct{}, 1)
+	var stops []func()
+	var wg sync.WaitGroup
+	for dir := range dirs {
+		// only direct children of dir can be config files.
+		events, stop := fsutil.Watch(afero.NewOsFs(), dir, fsutil.WatchWithRecursive(false))
+		stops = append(stops, stop)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ev := range events {
+				if ev.Op == fsutil.FsEventOpError || watched[filepath.Clean(ev.Path)] {
+					select {
+					case changed <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	ch := make(chan ReloadEvent)
+	go func() {
+		defer close(ch)
+		defer func() {
+			for _, stop := range stops {
+				stop()
+			}
+			wg.Wait()
+		}()
+
+		timer := time.NewTimer(reloadDebounce)
+		timer.Stop()
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-changed:
+				timer.Reset(reloadDebounce)
+				continue
+			case <-timer.C:
+			}
+
+			project, reloaded, err := p.reload(ctx, watched)
+			if !reloaded && err == nil {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case ch <- ReloadEvent{Project: project, Err: err}:
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// reload reads watched files of ConfigDetails again and, if their contents have changed,
+// loads and validates the project and then stores the new ConfigDetails.
+// reloaded is false if nothing has changed.
+func (p *LoaderProxy) reload(ctx context.Context, watched map[string]bool) (project *types.Project, reloaded bool, err error) {
+	p.mu.RLock()
+	current := p.loader.ConfigDetails
+	l := &Loader{
+		DockerCli:   p.loader.DockerCli,
+		ProjectName: p.loader.ProjectName,
+		Options:     p.loader.Options,
+		Injectors:   p.loader.Injectors,
+	}
+	p.mu.RUnlock()
+
+	next := cloneConfigDetails(current)
+	var changed bool
+	for i, f := range next.ConfigFiles {
+		abs, err := filepath.Abs(f.Filename)
+		if err != nil || !watched[abs] {
+			continue
+		}
+		bin, err := os.ReadFile(f.Filename)
+		if err != nil {
+			return nil, true, err
+		}
+		if !bytes.Equal(bin, f.Content) {
+			changed = true
+		}
+		next.ConfigFiles[i].Content, next.ConfigFiles[i].Config = bin, nil
+	}
+	if !changed {
+		return nil, false, nil
+	}
+	next, err = PreloadConfigDetails(next)
+	if err != nil {
+		return nil, true, err
+	}
+
+	l.ConfigDetails = next
+	project, err = l.Load(ctx)
+	if err != nil {
+		return nil, true, err
+	}
+	if err := validateProject(project); err != nil {
+		return nil, true, fmt.Errorf("validating reloaded project: %w", err)
+	}
+
+	p.mu.Lock()
+	p.loader.ConfigDetails = next
+	p.mu.Unlock()
+	return project, true, nil
+}
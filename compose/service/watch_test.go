@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+	"gotest.tools/v3/assert"
+)
+
+func TestLoaderProxy_Watch(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "compose.yml")
+	write := func(image string) {
+		content := "services:\n  app:\n    image: " + image + "\n"
+		if image == "" {
+			content = "services:\n  app:\n    image: [\n"
+		}
+		assert.NilError(t, os.WriteFile(file, []byte(content), 0o644))
+	}
+	write("ubuntu:jammy-20230624")
+
+	proxy, err := NewLoaderProxy(
+		"watch",
+		types.ConfigDetails{
+			WorkingDir:  dir,
+			ConfigFiles: []types.ConfigFile{{Filename: file}},
+			Environment: types.Mapping{},
+		},
+		[]func(*loader.Options){},
+		nil,
+	)
+	assert.NilError(t, err)
+	assert.NilError(t, proxy.PreloadConfigDetails())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := proxy.Watch(ctx)
+	assert.NilError(t, err)
+
+	// the watcher may not have started yet, so write again until the change is seen.
+	next := func(image string) ReloadEvent {
+		t.Helper()
+		timeout := time.After(10 * time.Second)
+		for {
+			write(image)
+			select {
+			case ev := <-events:
+				return ev
+			case <-time.After(500 * time.Millisecond):
+			case <-timeout:
+				t.Fatal("timed out waiting for reload")
+			}
+		}
+	}
+
+	ev := next("debian:bookworm-20230904")
+	assert.NilError(t, ev.Err)
+	assert.Equal(t, "debian:bookworm-20230904", ev.Project.Services["app"].Image)
+	project, err := proxy.Load(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, "debian:bookworm-20230904", project.Services["app"].Image)
+
+	// broken files are reported and leave the loader as it was.
+	ev = next("")
+	assert.Assert(t, ev.Err != nil)
+	assert.Assert(t, ev.Project == nil)
+	project, err = proxy.Load(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, "debian:bookworm-20230904", project.Services["app"].Image)
+
+	cancel()
+	for range events {
+	}
+
+	_, err = (&LoaderProxy{loader: &Loader{ConfigDetails: types.ConfigDetails{
+		ConfigFiles: []types.ConfigFile{{Filename: filepath.Join(dir, "nonexistent.yml"), Content: []byte("services: {}")}},
+	}}}).Watch(context.Background())
+	assert.ErrorContains(t, err, "no config file on disk")
+}
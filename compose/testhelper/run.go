@@ -1,6 +1,263 @@
 package testhelper
 
-import "github.com/ngicks/musicbox/compose/service"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
 
-func RunComposeTest(projectName string, files []string, testFn func(loader *service.LoaderProxy)) {
+	"github.com/compose-spec/compose-go/v2/loader"
+	"github.com/compose-spec/compose-go/v2/types"
+	"github.com/docker/compose/v2/pkg/api"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+	"github.com/ngicks/musicbox/compose/service"
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/spf13/afero"
+)
+
+// DefaultFixtureImage is the image used to populate fixture volumes unless WithFixtureImage is given.
+const DefaultFixtureImage = "busybox:1.36"
+
+type option struct {
+	images       []string
+	fixtures     []fixture
+	fixtureImage string
+	noLeakCheck  bool
+}
+
+type fixture struct {
+	volume string
+	fsys   fs.FS
+}
+
+// Option configures RunComposeTest.
+type Option func(o *option)
+
+// WithImages makes RunComposeTest pull images before the test unless they are already present,
+// so that pulling does not count against timeouts of the test.
+func WithImages(images ...string) Option {
+	return func(o *option) {
+		o.images = append(o.images, images...)
+	}
+}
+
+// WithFixtureVolume makes RunComposeTest create the volume which the project declares as key
+// and populate it with contents of fsys, before the test.
+func WithFixtureVolume(key string, fsys fs.FS) Option {
+	return func(o *option) {
+		o.fixtures = append(o.fixtures, fixture{volume: key, fsys: fsys})
+	}
+}
+
+// WithFixtureImage sets the image of the temporary container used to populate fixture volumes.
+func WithFixtureImage(image string) Option {
+	return func(o *option) {
+		o.fixtureImage = image
+	}
+}
+
+// WithoutLeakCheck disables the assertion that no resource labeled with the project is left after the test.
+func WithoutLeakCheck() Option {
+	return func(o *option) {
+		o.noLeakCheck = true
+	}
+}
+
+// ProjectName returns the project name RunComposeTest uses for projectName in t,
+// which is suffixed by the hash of t.Name() so that tests sharing files can run in parallel.
+func ProjectName(t testing.TB, projectName string) string {
+	sum := sha256.Sum256([]byte(t.Name()))
+	return strings.ToLower(projectName) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// RunComposeTest loads the project from files and calls testFn with its loader.
+// It is meant for tests which need a docker daemon, conventionally suffixed with _dind.
+//
+// The project is named as ProjectName returns and its working directory is the directory of the first file.
+// Before testFn, images and fixture volumes given by opts are prepared.
+// After testFn, even if it fails, the project is brought down with its volumes and orphans removed,
+// and then the test is marked as failed if any container, network or volume labeled with the project is left.
+func RunComposeTest(t testing.TB, projectName string, files []string, testFn func(loader *service.LoaderProxy), opts ...Option) {
+	t.Helper()
+
+	opt := option{fixtureImage: DefaultFixtureImage}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if len(files) == 0 {
+		t.Fatalf("testhelper.RunComposeTest: no files")
+	}
+
+	configFiles := make([]types.ConfigFile, len(files))
+	for i, f := range files {
+		configFiles[i] = types.ConfigFile{Filename: f}
+	}
+	loaderProxy, err := service.NewLoaderProxy(
+		ProjectName(t, projectName),
+		types.ConfigDetails{
+			WorkingDir:  filepath.Dir(files[0]),
+			ConfigFiles: configFiles,
+			Environment: types.NewMapping(os.Environ()),
+		},
+		[]func(*loader.Options){func(o *loader.Options) { o.Profiles = []string{"*"} }},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("testhelper.RunComposeTest: %v", err)
+	}
+	if err := loaderProxy.PreloadConfigDetails(); err != nil {
+		t.Fatalf("testhelper.RunComposeTest: %v", err)
+	}
+
+	ctx := context.Background()
+	cli := loaderProxy.DockerCli().Client()
+	if _, err := cli.Ping(ctx); err != nil {
+		t.Fatalf("testhelper.RunComposeTest: docker daemon is not reachable: %v", err)
+	}
+
+	t.Cleanup(func() { cleanup(t, loaderProxy, opt) })
+
+	images := opt.images
+	if len(opt.fixtures) > 0 {
+		images = append(images, opt.fixtureImage)
+	}
+	for _, image := range images {
+		if err := pullIfMissing(ctx, cli, image); err != nil {
+			t.Fatalf("testhelper.RunComposeTest: pulling %s: %v", image, err)
+		}
+	}
+
+	if len(opt.fixtures) > 0 {
+		project, err := loaderProxy.Load(ctx)
+		if err != nil {
+			t.Fatalf("testhelper.RunComposeTest: %v", err)
+		}
+		for _, f := range opt.fixtures {
+			if err := populateVolume(ctx, t, cli, project, f, opt.fixtureImage); err != nil {
+				t.Fatalf("testhelper.RunComposeTest: fixture volume %s: %v", f.volume, err)
+			}
+		}
+	}
+
+	testFn(loaderProxy)
+}
+
+func pullIfMissing(ctx context.Context, cli client.APIClient, image string) error {
+	if _, _, err := cli.ImageInspectWithRaw(ctx, image); err == nil {
+		return nil
+	} else if !client.IsErrNotFound(err) {
+		return err
+	}
+	r, err := cli.ImagePull(ctx, image, dockertypes.ImagePullOptions{})
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// pulling completes when the progress stream ends.
+	_, err = io.Copy(io.Discard, r)
+	return err
+}
+
+// populateVolume creates the volume for f labeled as compose would do,
+// and copies f.fsys into it through a container which is created but never started.
+func populateVolume(ctx context.Context, t testing.TB, cli client.APIClient, project *types.Project, f fixture, image string) error {
+	volumeCfg, ok := project.Volumes[f.volume]
+	if !ok {
+		return fmt.Errorf("volume is not declared in the project")
+	}
+	name := volumeCfg.Name
+	if name == "" {
+		name = project.Name + "_" + f.volume
+	}
+	_, err := cli.VolumeCreate(ctx, volume.CreateOptions{
+		Name: name,
+		Labels: map[string]string{
+			api.ProjectLabel: project.Name,
+			api.VolumeLabel:  f.volume,
+			api.VersionLabel: api.ComposeVersion,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	dir := t.TempDir()
+	if err := fsutil.CopyFS(afero.NewBasePathFs(afero.NewOsFs(), dir), f.fsys); err != nil {
+		return err
+	}
+	tar, err := archive.Tar(dir, archive.Uncompressed)
+	if err != nil {
+		return err
+	}
+	defer tar.Close()
+
+	const mountPoint = "/fixture"
+	created, err := cli.ContainerCreate(
+		ctx,
+		&container.Config{Image: image, Labels: map[string]string{api.ProjectLabel: project.Name}},
+		&container.HostConfig{Mounts: []mount.Mount{{Type: mount.TypeVolume, Source: name, Target: mountPoint}}},
+		nil,
+		nil,
+		"",
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = cli.ContainerRemove(ctx, created.ID, container.RemoveOptions{Force: true}) }()
+
+	return cli.CopyToContainer(ctx, created.ID, mountPoint, tar, dockertypes.CopyToContainerOptions{})
+}
+
+func cleanup(t testing.TB, loaderProxy *service.LoaderProxy, opt option) {
+	ctx := context.Background()
+	projectName := loaderProxy.ProjectName()
+
+	composeService, err := loaderProxy.LoadComposeService(ctx)
+	if err != nil {
+		t.Errorf("testhelper.RunComposeTest: cleanup: %v", err)
+		return
+	}
+	if _, err := composeService.Down(ctx, api.DownOptions{RemoveOrphans: true, Volumes: true}); err != nil {
+		t.Errorf("testhelper.RunComposeTest: cleanup: %v", err)
+	}
+	if opt.noLeakCheck {
+		return
+	}
+
+	cli := loaderProxy.DockerCli().Client()
+	args := filters.NewArgs(filters.Arg("label", api.ProjectLabel+"="+projectName))
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		t.Errorf("testhelper.RunComposeTest: listing containers: %v", err)
+	}
+	for _, c := range containers {
+		t.Errorf("testhelper.RunComposeTest: container %v is left after the test", c.Names)
+	}
+	networks, err := cli.NetworkList(ctx, dockertypes.NetworkListOptions{Filters: args})
+	if err != nil {
+		t.Errorf("testhelper.RunComposeTest: listing networks: %v", err)
+	}
+	for _, n := range networks {
+		t.Errorf("testhelper.RunComposeTest: network %s is left after the test", n.Name)
+	}
+	volumes, err := cli.VolumeList(ctx, volume.ListOptions{Filters: args})
+	if err != nil {
+		t.Errorf("testhelper.RunComposeTest: listing volumes: %v", err)
+	}
+	for _, v := range volumes.Volumes {
+		t.Errorf("testhelper.RunComposeTest: volume %s is left after the test", v.Name)
+	}
 }
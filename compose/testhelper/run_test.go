@@ -0,0 +1,23 @@
+package testhelper
+
+import (
+	"regexp"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestProjectName(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+	var names []string
+	for _, sub := range []string{"a", "b"} {
+		t.Run(sub, func(t *testing.T) {
+			name := ProjectName(t, "Sample")
+			assert.Assert(t, valid.MatchString(name), name)
+			assert.Equal(t, name, ProjectName(t, "Sample"))
+			names = append(names, name)
+		})
+	}
+	assert.Assert(t, names[0] != names[1])
+}
@@ -0,0 +1,57 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FindCaseCollisions walks src and finds names colliding on case-insensitive filesystems
+// (e.g. "Foo" and "foo" in a same directory).
+// Each returned group lists slash-separated paths of colliding dirents, sorted.
+// Groups are sorted by their first path.
+//
+// Names are compared after strings.ToLower.
+// Note that it does not take Unicode normalization into account,
+// which some filesystems, e.g. APFS, also apply.
+func FindCaseCollisions(src fs.FS) ([][]string, error) {
+	type key struct {
+		dir, folded string
+	}
+	seen := map[key][]string{}
+
+	err := fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		k := key{path.Dir(p), strings.ToLower(path.Base(p))}
+		seen[k] = append(seen[k], p)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fsutil.FindCaseCollisions: %w", err)
+	}
+
+	var collisions [][]string
+	for _, paths := range seen {
+		if len(paths) > 1 {
+			sort.Strings(paths)
+			collisions = append(collisions, paths)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool { return collisions[i][0] < collisions[j][0] })
+	return collisions, nil
+}
+
+func caseCollisionErr(collisions [][]string) error {
+	groups := make([]string, len(collisions))
+	for i, paths := range collisions {
+		groups[i] = "[" + strings.Join(paths, ", ") + "]"
+	}
+	return fmt.Errorf("%w: %s", ErrCaseCollision, strings.Join(groups, ", "))
+}
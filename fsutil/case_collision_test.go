@@ -0,0 +1,53 @@
+package fsutil
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestFindCaseCollisions(t *testing.T) {
+	src := fstest.MapFS{
+		"Foo/a":     &fstest.MapFile{Data: []byte("a")},
+		"foo/a":     &fstest.MapFile{Data: []byte("a")},
+		"bar/Baz":   &fstest.MapFile{Data: []byte("Baz")},
+		"bar/baz":   &fstest.MapFile{Data: []byte("baz")},
+		"bar/BAZ":   &fstest.MapFile{Data: []byte("BAZ")},
+		"bar/qux":   &fstest.MapFile{Data: []byte("qux")},
+		"quux/quux": &fstest.MapFile{Data: []byte("quux")},
+	}
+
+	collisions, err := FindCaseCollisions(src)
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.DeepEqual(
+		[][]string{
+			{"Foo", "foo"},
+			{"bar/BAZ", "bar/Baz", "bar/baz"},
+		},
+		collisions,
+	))
+
+	dst := afero.NewMemMapFs()
+	err = CopyFS(dst, src, CopyFsWithRejectCaseCollision(true))
+	assert.Assert(t, cmp.ErrorIs(err, ErrCaseCollision))
+	assert.ErrorContains(t, err, "[bar/BAZ, bar/Baz, bar/baz]")
+	dirents, err := afero.ReadDir(dst, ".")
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Len(dirents, 0))
+
+	delete(src, "Foo/a")
+	delete(src, "bar/Baz")
+	delete(src, "bar/BAZ")
+
+	collisions, err = FindCaseCollisions(src)
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Len(collisions, 0))
+
+	opt := NewSafeWriteOption(WithCopyFsOptions([]CopyFsOption{CopyFsWithRejectCaseCollision(true)}))
+	err = opt.SafeWriteFs(dst, "dst", fs.ModePerm, src)
+	assert.NilError(t, err)
+}
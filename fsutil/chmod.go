@@ -0,0 +1,119 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// ChmodAll walks root in fsys and changes mode bits of every directory and file under it.
+// Directories are changed to dirPerm and other files are changed to filePerm.
+//
+// ChmodAll interprets CopyFsOption as if fsys was dst of CopyFS:
+//   - An error is returned if root contains non regular files unless CopyFsWithIgnoreNonRegularFile is set.
+//   - If CopyFsWithOverridePermission is set and chmodIf returns true, the returned perm is used instead.
+//     chmodIf receives slash-separated paths relative to root.
+//   - If CopyFsWithNoChmod is true, only paths overridden by chmodIf are changed.
+//   - If CopyFsWithContext is set, cancellation of the context stops the walk.
+//
+// As is the case with CopyFS, mode bits of root itself are left unchanged.
+func ChmodAll(fsys afero.Fs, root string, dirPerm, filePerm fs.FileMode, opts ...CopyFsOption) error {
+	opt := newCopyFsOption(opts...)
+	err := walkAll(fsys, root, opt, func(name, rel string, d fs.DirEntry) error {
+		perm := filePerm
+		if d.IsDir() {
+			perm = dirPerm
+		}
+
+		var ok bool
+		if opt.chmodIf != nil {
+			var overridden fs.FileMode
+			overridden, ok = opt.chmodIf(rel)
+			if ok {
+				perm = overridden
+			}
+		}
+
+		if !ok && opt.noChmod {
+			return nil
+		}
+		return fsys.Chmod(name, perm.Perm())
+	})
+	if err != nil {
+		return fmt.Errorf("fsutil.ChmodAll: %w", err)
+	}
+	return nil
+}
+
+// ChownAll walks root in fsys and changes owner of every directory and file under it to uid and gid.
+// As is the case with os.Chown, a negative uid or gid is passed through to fsys.
+// Paths for which both of resolved uid and gid are negative are skipped.
+//
+// ChownAll interprets CopyFsOption as ChmodAll does,
+// with the exception that CopyFsWithOverrideOwner is used to override owners
+// and permission related options are ignored.
+func ChownAll(fsys afero.Fs, root string, uid, gid int, opts ...CopyFsOption) error {
+	opt := newCopyFsOption(opts...)
+	err := walkAll(fsys, root, opt, func(name, rel string, _ fs.DirEntry) error {
+		uid, gid := uid, gid
+		if opt.chownIf != nil {
+			if u, g, ok := opt.chownIf(rel); ok {
+				uid, gid = u, g
+			}
+		}
+		if uid < 0 && gid < 0 {
+			return nil
+		}
+		return fsys.Chown(name, uid, gid)
+	})
+	if err != nil {
+		return fmt.Errorf("fsutil.ChownAll: %w", err)
+	}
+	return nil
+}
+
+// walkAll calls fn for each dirent under root, excluding root itself.
+// name is a path which can be directly passed to fsys
+// while rel is a slash-separated path relative to root.
+func walkAll(
+	fsys afero.Fs,
+	root string,
+	opt copyFsOption,
+	fn func(name, rel string, d fs.DirEntry) error,
+) error {
+	root = path.Clean(filepath.ToSlash(root))
+	return fs.WalkDir(afero.NewIOFS(fsys), root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if p == root {
+			return nil
+		}
+
+		if err := opt.isCancelled(); err != nil {
+			return err
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			switch opt.nonRegular(d.Type()) {
+			case nonRegularFileHandlingError: // default
+				return fmt.Errorf("%w: non regular file is not supported.", ErrBadInput)
+			default:
+				// Chmod and Chown follow links and are not able to change special files meaningfully.
+				return nil
+			}
+		}
+
+		rel := p
+		if root != "." {
+			rel = strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+		}
+
+		return fn(filepath.FromSlash(p), rel, d)
+	})
+}
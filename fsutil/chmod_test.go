@@ -0,0 +1,101 @@
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestChmodAll(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	assert.NilError(t, CopyFS(mem, os.DirFS("testdata")))
+
+	err := ChmodAll(
+		mem,
+		"fs5",
+		0o750,
+		0o640,
+		CopyFsWithOverridePermission(func(path string) (perm fs.FileMode, ok bool) {
+			if path == "random2.txt" {
+				return 0o600, true
+			}
+			return 0, false
+		}),
+	)
+	assert.NilError(t, err)
+
+	for path, mode := range map[string]fs.FileMode{
+		"fs5/random1.txt":          fs.ModeDir | 0o750,
+		"fs5/random1.txt/.gitkeep": 0o640,
+		"fs5/random2.txt":          0o600,
+	} {
+		s, err := mem.Stat(path)
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Equal(s.Mode(), mode), "path = %s", path)
+	}
+
+	before, err := mem.Stat("fs6/random2.txt")
+	assert.NilError(t, err)
+	err = ChmodAll(
+		mem,
+		"fs6",
+		0o700,
+		0o600,
+		CopyFsWithNoChmod(true),
+		CopyFsWithOverridePermission(func(path string) (perm fs.FileMode, ok bool) {
+			if path == "random1.txt/.gitkeep" {
+				return 0o444, true
+			}
+			return 0, false
+		}),
+	)
+	assert.NilError(t, err)
+	after, err := mem.Stat("fs6/random2.txt")
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Equal(before.Mode(), after.Mode()))
+	s, err := mem.Stat("fs6/random1.txt/.gitkeep")
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Equal(s.Mode(), fs.FileMode(0o444)))
+}
+
+func TestChownAll(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	assert.NilError(t, CopyFS(mem, os.DirFS("testdata")))
+
+	fsys := NewObservableFs(mem)
+	err := ChownAll(
+		fsys,
+		"fs7",
+		1000,
+		1000,
+		CopyFsWithOverrideOwner(func(path string) (uid int, gid int, ok bool) {
+			if path == "additional" {
+				return -1, -1, true
+			}
+			if path == "random2.txt" {
+				return 0, 0, true
+			}
+			return 0, 0, false
+		}),
+	)
+	assert.NilError(t, err)
+
+	chowned := map[string][]any{}
+	for _, op := range fsys.Observer().FsOp() {
+		if op.Op == ObservableFsOpNameChown {
+			chowned[op.Name] = op.Args
+		}
+	}
+	assert.Assert(t, cmp.DeepEqual(
+		chowned,
+		map[string][]any{
+			"/fs7/random1.txt":         {1000, 1000},
+			"/fs7/random2.txt":         {0, 0},
+			"/fs7/additional/.gitkeep": {1000, 1000},
+		},
+	))
+}
@@ -1,33 +1,182 @@
 package fsutil
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"path"
 	"path/filepath"
 
 	"github.com/spf13/afero"
 )
 
-func CleanDir(fsys afero.Fs, path string) error {
-	err := cleanDir(fsys, path)
-	if err != nil {
-		return fmt.Errorf("fsutil.CleanDir: %w", err)
+type cleanDirOption struct {
+	keepPatterns  []string
+	maxDepth      int
+	emptyDirsOnly bool
+}
+
+func newCleanDirOption(opts ...CleanDirOption) (cleanDirOption, error) {
+	opt := cleanDirOption{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	for _, pat := range opt.keepPatterns {
+		if _, err := path.Match(pat, ""); err != nil {
+			return opt, fmt.Errorf("%w: keep pattern %q is malformed", ErrBadPattern, pat)
+		}
+	}
+	return opt, nil
+}
+
+func (o cleanDirOption) keep(p string) bool {
+	for _, pat := range o.keepPatterns {
+		if matched, _ := path.Match(pat, p); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// descend reports whether entries under a directory at depth may be examined.
+func (o cleanDirOption) descend(depth int) bool {
+	return o.maxDepth <= 0 || depth < o.maxDepth
+}
+
+type CleanDirOption func(o *cleanDirOption)
+
+// CleanDirWithKeepPatterns makes CleanDir leave entries matching any of patterns.
+// Patterns are matched by path.Match against slash-separated paths relative to the cleaned directory.
+// A kept directory is left intact along with its contents,
+// and directories having kept entries under them are not removed.
+func CleanDirWithKeepPatterns(patterns ...string) CleanDirOption {
+	return func(o *cleanDirOption) {
+		o.keepPatterns = append(o.keepPatterns, patterns...)
+	}
+}
+
+// CleanDirWithMaxDepth limits depth of entries CleanDir may remove.
+// Direct children of the cleaned directory are depth 1.
+// Directories at maxDepth are only removed if they are empty.
+// Zero or negative maxDepth means no limit, which is the default.
+func CleanDirWithMaxDepth(maxDepth int) CleanDirOption {
+	return func(o *cleanDirOption) {
+		o.maxDepth = maxDepth
 	}
-	return nil
 }
 
-func cleanDir(fsys afero.Fs, path string) error {
-	dir, err := fsys.Open(path)
+// CleanDirWithEmptyDirsOnly makes CleanDir remove only empty directories.
+// Non-directory files are left intact and directories becoming empty after removal of their children are also removed.
+func CleanDirWithEmptyDirsOnly(emptyDirsOnly bool) CleanDirOption {
+	return func(o *cleanDirOption) {
+		o.emptyDirsOnly = emptyDirsOnly
+	}
+}
+
+// CleanDirResult lists entries removed by CleanDirReport in the removal order.
+// Contents of a directory always precede the directory itself.
+type CleanDirResult []CleanDirEntry
+
+type CleanDirEntry struct {
+	// Path is a path for the removed entry. It is joined with path passed to CleanDirReport.
+	Path  string
+	IsDir bool
+}
+
+// CleanDir removes all contents under path while leaving path itself.
+// Without any options, CleanDir removes everything.
+func CleanDir(fsys afero.Fs, path string, opts ...CleanDirOption) error {
+	_, err := CleanDirReport(fsys, path, opts...)
+	return err
+}
+
+// CleanDirReport is same as CleanDir but also returns removed entries.
+// The result is non nil also in case of an error, containing entries removed before the error.
+func CleanDirReport(fsys afero.Fs, path string, opts ...CleanDirOption) (CleanDirResult, error) {
+	opt, err := newCleanDirOption(opts...)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("fsutil.CleanDir: %w", err)
+	}
+	c := &cleaner{fsys: fsys, root: path, opt: opt, result: CleanDirResult{}}
+	if _, err := c.clean(".", 0); err != nil {
+		return c.result, fmt.Errorf("fsutil.CleanDir: %w", err)
 	}
-	dirents, err := dir.Readdir(-1)
+	return c.result, nil
+}
+
+type cleaner struct {
+	fsys   afero.Fs
+	root   string
+	opt    cleanDirOption
+	result CleanDirResult
+}
+
+// clean removes contents of rel, which is a slash-separated path relative to c.root, at depth.
+// It reports whether rel has become empty.
+func (c *cleaner) clean(rel string, depth int) (empty bool, err error) {
+	dirents, err := c.readDir(rel)
 	if err != nil {
-		return err
+		return false, err
 	}
+
+	empty = true
 	for _, dirent := range dirents {
-		if err := fsys.RemoveAll(filepath.Join(path, dirent.Name())); err != nil {
-			return err
+		p := path.Join(rel, dirent.Name())
+		if c.opt.keep(p) {
+			empty = false
+			continue
+		}
+
+		if dirent.IsDir() {
+			var childEmpty bool
+			if c.opt.descend(depth + 1) {
+				childEmpty, err = c.clean(p, depth+1)
+			} else {
+				childEmpty, err = c.isEmpty(p)
+			}
+			if err != nil {
+				return false, err
+			}
+			if !childEmpty {
+				empty = false
+				continue
+			}
+		} else if c.opt.emptyDirsOnly {
+			empty = false
+			continue
+		}
+
+		if err := c.fsys.Remove(c.name(p)); err != nil {
+			return false, err
 		}
+		c.result = append(c.result, CleanDirEntry{Path: c.name(p), IsDir: dirent.IsDir()})
+	}
+	return empty, nil
+}
+
+func (c *cleaner) name(rel string) string {
+	return filepath.Join(c.root, filepath.FromSlash(rel))
+}
+
+func (c *cleaner) readDir(rel string) ([]fs.FileInfo, error) {
+	dir, err := c.fsys.Open(c.name(rel))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = dir.Close() }()
+	return dir.Readdir(-1)
+}
+
+func (c *cleaner) isEmpty(rel string) (bool, error) {
+	dir, err := c.fsys.Open(c.name(rel))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = dir.Close() }()
+	_, err = dir.Readdirnames(1)
+	if errors.Is(err, io.EOF) {
+		return true, nil
 	}
-	return nil
+	return false, err
 }
@@ -3,6 +3,7 @@ package fsutil
 import (
 	"io/fs"
 	"os"
+	"slices"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -70,10 +71,10 @@ func TestCleanDir(t *testing.T) {
 	assertSeen(t, mem, ".", []string{})
 }
 
-func assertSeen(t *testing.T, fsys afero.Fs, root string, paths []string) {
+func collectPathUnder(t *testing.T, fsys afero.Fs, root string) []string {
 	t.Helper()
 
-	seen := map[string]struct{}{}
+	var seen []string
 	err := fs.WalkDir(afero.NewIOFS(fsys), root, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -81,10 +82,20 @@ func assertSeen(t *testing.T, fsys afero.Fs, root string, paths []string) {
 		if path == root {
 			return nil
 		}
-		seen[path] = struct{}{}
+		seen = append(seen, path)
 		return nil
 	})
 	assert.NilError(t, err)
+	return seen
+}
+
+func assertSeen(t *testing.T, fsys afero.Fs, root string, paths []string) {
+	t.Helper()
+
+	seen := map[string]struct{}{}
+	for _, p := range collectPathUnder(t, fsys, root) {
+		seen[p] = struct{}{}
+	}
 
 	pathsMap := map[string]struct{}{}
 	for _, p := range paths {
@@ -93,3 +104,78 @@ func assertSeen(t *testing.T, fsys afero.Fs, root string, paths []string) {
 
 	assert.Assert(t, cmp.DeepEqual(seen, pathsMap))
 }
+
+func TestCleanDir_options(t *testing.T) {
+	prepare := func(t *testing.T) afero.Fs {
+		t.Helper()
+		mem := afero.NewMemMapFs()
+		assert.NilError(t, CopyFS(mem, os.DirFS("testdata")))
+		assert.NilError(t, mem.MkdirAll("fs9/empty/nested_empty", fs.ModePerm))
+		return mem
+	}
+
+	t.Run("keep patterns", func(t *testing.T) {
+		mem := prepare(t)
+		result, err := CleanDirReport(mem, ".", CleanDirWithKeepPatterns("random1.txt", "fs7/*", "fs?/random2.txt"))
+		assert.NilError(t, err)
+		assertSeen(t, mem, ".", []string{
+			"random1.txt",
+			"fs1", "fs1/random2.txt",
+			"fs2", "fs2/random2.txt",
+			"fs4", "fs4/random2.txt",
+			"fs5", "fs5/random2.txt",
+			"fs6", "fs6/random2.txt",
+			"fs7",
+			"fs7/random1.txt",
+			"fs7/random2.txt",
+			"fs7/additional",
+			"fs7/additional/.gitkeep",
+			"fs8", "fs8/random2.txt",
+		})
+		assert.Assert(t, cmp.Contains(result, CleanDirEntry{Path: "fs3", IsDir: true}))
+		assert.Assert(t, cmp.Contains(result, CleanDirEntry{Path: "fs3/random1.txt", IsDir: false}))
+		assert.Assert(t, cmp.Contains(result, CleanDirEntry{Path: "random2.txt", IsDir: false}))
+		assert.Assert(t, !slices.Contains(result, CleanDirEntry{Path: "fs1", IsDir: true}))
+	})
+
+	t.Run("max depth", func(t *testing.T) {
+		mem := prepare(t)
+		_, err := CleanDirReport(mem, ".", CleanDirWithMaxDepth(1))
+		assert.NilError(t, err)
+		seen := collectPathUnder(t, mem, ".")
+		assert.Assert(t, !slices.Contains(seen, "random1.txt"))
+		assert.Assert(t, slices.Contains(seen, "fs1/random1.txt"))
+		assert.Assert(t, slices.Contains(seen, "fs9/empty/nested_empty"))
+
+		mem = prepare(t)
+		_, err = CleanDirReport(mem, ".", CleanDirWithMaxDepth(2))
+		assert.NilError(t, err)
+		assertSeen(t, mem, ".", []string{
+			"fs5", "fs5/random1.txt", "fs5/random1.txt/.gitkeep",
+			"fs6", "fs6/random1.txt", "fs6/random1.txt/.gitkeep",
+			"fs7", "fs7/additional", "fs7/additional/.gitkeep",
+			"fs9", "fs9/empty", "fs9/empty/nested_empty",
+		})
+	})
+
+	t.Run("empty dirs only", func(t *testing.T) {
+		mem := prepare(t)
+		result, err := CleanDirReport(mem, ".", CleanDirWithEmptyDirsOnly(true))
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.DeepEqual(
+			result,
+			CleanDirResult{
+				{Path: "fs9/empty/nested_empty", IsDir: true},
+				{Path: "fs9/empty", IsDir: true},
+				{Path: "fs9", IsDir: true},
+			},
+		))
+		assert.Assert(t, slices.Contains(collectPathUnder(t, mem, "."), "fs7/additional/.gitkeep"))
+	})
+
+	t.Run("bad pattern", func(t *testing.T) {
+		mem := prepare(t)
+		_, err := CleanDirReport(mem, ".", CleanDirWithKeepPatterns("[]a]"))
+		assert.Assert(t, cmp.ErrorIs(err, ErrBadPattern))
+	})
+}
@@ -17,16 +17,27 @@ import (
 type nonRegularFileHandling string
 
 const (
-	nonRegularFileHandlingError  nonRegularFileHandling = "" // default is to return an error.
-	nonRegularFileHandlingIgnore nonRegularFileHandling = "ignore"
-	// nonRegularFileHandlingTrySymlink nonRegularFileHandling = "try_symlink"
+	nonRegularFileHandlingError      nonRegularFileHandling = "" // default is to return an error.
+	nonRegularFileHandlingIgnore     nonRegularFileHandling = "ignore"
+	nonRegularFileHandlingTrySymlink nonRegularFileHandling = "try_symlink"
+	nonRegularFileHandlingModeOnly   nonRegularFileHandling = "mode_only"
 )
 
 type copyFsOption struct {
 	handleNonRegularFile nonRegularFileHandling
 	chmodIf              func(path string) (perm fs.FileMode, ok bool)
 	noChmod              bool
+	chownIf              func(path string) (uid, gid int, ok bool)
+	sparse               bool
+	rejectCaseCollision  bool
+	rejectUnsafePaths    bool
+	symlink              bool
+	specialFilePolicy    SpecialFilePolicy
+	preserveHardlinks    bool
 	ctx                  context.Context
+	progress             func(p stream.Progress)
+	progressOpts         []stream.ProgressOption
+	progressWriter       *stream.ProgressWriter
 }
 
 func newCopyFsOption(opts ...CopyFsOption) copyFsOption {
@@ -64,12 +75,73 @@ func CopyFsWithOverridePermission(chmodIf func(path string) (perm fs.FileMode, o
 	}
 }
 
+// CopyFsWithOverrideOwner sets chownIf.
+// If chownIf returns true, CopyFS changes owner of the copied file to returned uid and gid.
+func CopyFsWithOverrideOwner(chownIf func(path string) (uid, gid int, ok bool)) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.chownIf = chownIf
+	}
+}
+
+// CopyFsWithSparse makes CopyFS preserve holes of sparse files.
+// If the source file is *os.File and the platform supports SEEK_DATA / SEEK_HOLE, only data regions are copied.
+// Otherwise, CopyFS skips writing zero filled blocks by seeking the destination file.
+// In either way, the destination filesystem decides whether unwritten regions actually become holes.
+func CopyFsWithSparse(sparse bool) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.sparse = sparse
+	}
+}
+
+// CopyFsWithRejectCaseCollision makes CopyFS check src for names colliding on case-insensitive filesystems
+// (e.g. "Foo" and "foo") before copying anything.
+// If any is found, CopyFS fails with ErrCaseCollision listing all colliding paths.
+// See FindCaseCollisions for details.
+func CopyFsWithRejectCaseCollision(reject bool) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.rejectCaseCollision = reject
+	}
+}
+
+// CopyFsWithRejectUnsafePaths makes CopyFS validate src by ValidateFsPaths before copying anything.
+// Use this if src is built from untrusted inputs, e.g. archives.
+// CopyFS fails with ErrUnsafePath if src contains "..", absolute or device-reserved names.
+// For CopyFsPath, paths are checked instead.
+func CopyFsWithRejectUnsafePaths(reject bool) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.rejectUnsafePaths = reject
+	}
+}
+
 func CopyFsWithContext(ctx context.Context) CopyFsOption {
 	return func(o *copyFsOption) {
 		o.ctx = ctx
 	}
 }
 
+// CopyFsWithProgress makes CopyFS report total bytes of regular files copied so far by fn,
+// as a stream.ProgressWriter configured by opts does.
+// The last report with stream.Progress.Done set is made when CopyFS returns, whether it succeeds or not.
+//
+// Since the source is read through io.TeeReader,
+// io.WriterTo and io.ReaderFrom implemented by files are no longer used to copy.
+func CopyFsWithProgress(fn func(p stream.Progress), opts ...stream.ProgressOption) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.progress = fn
+		o.progressOpts = opts
+	}
+}
+
+// startProgress prepares the progress writer if the progress is requested.
+// The returned func reports the last progress.
+func (o *copyFsOption) startProgress() (finish func()) {
+	if o.progress == nil {
+		return func() {}
+	}
+	o.progressWriter = stream.NewProgressWriter(io.Discard, o.progress, o.progressOpts...)
+	return o.progressWriter.Finish
+}
+
 // CopyFS copies from fs.FS to afero.FS.
 //
 // The default behavior of CopyFS is:
@@ -84,7 +156,25 @@ func CopyFS(dst afero.Fs, src fs.FS, opts ...CopyFsOption) error {
 	defer putBuf(buf)
 
 	opt := newCopyFsOption(opts...)
+	defer opt.startProgress()()
+
+	if opt.rejectUnsafePaths {
+		if err := ValidateFsPaths(src); err != nil {
+			return fmt.Errorf("fsutil.CopyFS: %w", err)
+		}
+	}
 
+	if opt.rejectCaseCollision {
+		collisions, err := FindCaseCollisions(src)
+		if err != nil {
+			return fmt.Errorf("fsutil.CopyFS: %w", err)
+		}
+		if len(collisions) > 0 {
+			return fmt.Errorf("fsutil.CopyFS: %w", caseCollisionErr(collisions))
+		}
+	}
+
+	links := newHardlinks(opt)
 	err := fs.WalkDir(src, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -98,7 +188,7 @@ func CopyFS(dst afero.Fs, src fs.FS, opts ...CopyFsOption) error {
 			return err
 		}
 
-		return copyPath(dst, src, path, opt, buf)
+		return copyPath(dst, src, path, opt, links, buf)
 	})
 
 	if err != nil {
@@ -108,12 +198,23 @@ func CopyFS(dst afero.Fs, src fs.FS, opts ...CopyFsOption) error {
 }
 
 // CopyFsPath copies contents of src specified by paths into dst.
+// Directories are not copied recursively; use CopyFsGlob to select files by patterns or directories.
 func CopyFsPath(dst afero.Fs, src fs.FS, paths []string, opts ...CopyFsOption) error {
 	buf := getBuf()
 	defer putBuf(buf)
 
 	opt := newCopyFsOption(opts...)
+	defer opt.startProgress()()
+
+	if opt.rejectUnsafePaths {
+		for _, p := range paths {
+			if !isSafePath(filepath.ToSlash(p)) {
+				return fmt.Errorf("fsutil.CopyFsPath: %w: %q", ErrUnsafePath, p)
+			}
+		}
+	}
 
+	links := newHardlinks(opt)
 	for _, p := range paths {
 		if err := opt.isCancelled(); err != nil {
 			return err
@@ -133,7 +234,7 @@ func CopyFsPath(dst afero.Fs, src fs.FS, paths []string, opts ...CopyFsOption) e
 			return fmt.Errorf("fsutil.CopyFsPath: mkdirAll: %w", err)
 		}
 
-		err = copyPath(dst, src, p, opt, buf)
+		err = copyPath(dst, src, p, opt, links, buf)
 		if err != nil {
 			return fmt.Errorf("fsutil.CopyFsPath: %w", err)
 		}
@@ -142,9 +243,28 @@ func CopyFsPath(dst afero.Fs, src fs.FS, paths []string, opts ...CopyFsOption) e
 	return nil
 }
 
-func copyPath(dst afero.Fs, src fs.FS, p string, opt copyFsOption, buf *[]byte) error {
+func copyPath(dst afero.Fs, src fs.FS, p string, opt copyFsOption, links hardlinks, buf *[]byte) error {
 	target := filepath.FromSlash(p)
 
+	// Opening a link follows it and opening a named pipe may block.
+	// Check type beforehand if they are handled specially.
+	if opt.needsLstat() {
+		info, err := lstat(src, p)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			switch opt.nonRegular(info.Mode()) {
+			case nonRegularFileHandlingIgnore:
+				return nil
+			case nonRegularFileHandlingTrySymlink:
+				return copySymlink(dst, src, p)
+			default:
+				return fmt.Errorf("%w: non regular file is not supported.", ErrBadInput)
+			}
+		}
+	}
+
 	r, err := src.Open(p)
 	if err != nil {
 		return err
@@ -175,6 +295,15 @@ func copyPath(dst afero.Fs, src fs.FS, p string, opt copyFsOption, buf *[]byte)
 				return fmt.Errorf("failed to chmod created dir, target = %s, err = %w", target, err)
 			}
 		}
+
+		if opt.chownIf != nil {
+			if uid, gid, ok := opt.chownIf(p); ok {
+				err = dst.Chown(target, uid, gid)
+				if err != nil {
+					return fmt.Errorf("failed to chown, target = %s, err = %w", target, err)
+				}
+			}
+		}
 		return nil
 	}
 
@@ -189,15 +318,20 @@ func copyPath(dst afero.Fs, src fs.FS, p string, opt copyFsOption, buf *[]byte)
 	}
 
 	if !rInfo.Mode().IsRegular() {
-		switch opt.handleNonRegularFile {
-		case nonRegularFileHandlingError: // default
-			return fmt.Errorf("%w: non regular file is not supported.", ErrBadInput)
+		switch opt.nonRegular(rInfo.Mode()) {
 		case nonRegularFileHandlingIgnore:
 			return nil
-			// case nonRegularFileHandlingTrySymlink:
+		default:
+			return fmt.Errorf("%w: non regular file is not supported.", ErrBadInput)
 		}
 	}
 
+	if linked, err := links.tryLink(dst, p, rInfo); err != nil {
+		return fmt.Errorf("linking %s, %w", p, err)
+	} else if linked {
+		return nil
+	}
+
 	w, err := dst.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, fs.ModePerm)
 	if err != nil {
 		return err
@@ -210,11 +344,20 @@ func copyPath(dst afero.Fs, src fs.FS, p string, opt copyFsOption, buf *[]byte)
 		return err
 	}
 
-	var rr io.Reader = r
-	if opt.ctx != nil {
-		rr = stream.NewCancellable(opt.ctx, r)
+	wrap := func(r io.Reader) io.Reader {
+		if opt.ctx != nil {
+			r = stream.NewCancellable(opt.ctx, r)
+		}
+		if opt.progressWriter != nil {
+			r = io.TeeReader(r, opt.progressWriter)
+		}
+		return r
 	}
-	if n, err := io.CopyBuffer(w, rr, *buf); err != nil {
+	if opt.sparse {
+		if err := copySparse(w, r, wrap, *buf); err != nil {
+			return fmt.Errorf("copying %s, %w", p, err)
+		}
+	} else if n, err := io.CopyBuffer(w, wrap(r), *buf); err != nil {
 		return fmt.Errorf("copying %s, %w at %d", p, err, n)
 	}
 
@@ -5,7 +5,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/ngicks/musicbox/stream"
 	"github.com/spf13/afero"
 	"gotest.tools/v3/assert"
 )
@@ -61,3 +63,26 @@ func TestCopy(t *testing.T) {
 		})
 	}
 }
+
+func TestCopy_progress(t *testing.T) {
+	src := fstest.MapFS{
+		"a":     {Data: []byte("foo")},
+		"dir/b": {Data: []byte("barbaz")},
+	}
+	var reports []stream.Progress
+	progress := CopyFsWithProgress(func(p stream.Progress) { reports = append(reports, p) }, stream.ProgressWithInterval(0))
+
+	err := CopyFS(afero.NewMemMapFs(), src, progress)
+	assert.NilError(t, err)
+	assert.Assert(t, len(reports) > 0)
+	last := reports[len(reports)-1]
+	assert.Equal(t, int64(9), last.N)
+	assert.Assert(t, last.Done)
+
+	reports = nil
+	err = CopyFsPath(afero.NewMemMapFs(), src, []string{"dir/b", "nonexistent"}, progress)
+	assert.Assert(t, err != nil)
+	last = reports[len(reports)-1]
+	assert.Equal(t, int64(6), last.N)
+	assert.Assert(t, last.Done)
+}
@@ -14,6 +14,7 @@ const (
 	EqualReasonModeMismatch             = "mode mismatch"
 	EqualReasonFileContentMismatch      = "file content mismatch"
 	EqualReasonDirectoryContentMismatch = "directory content mismatch"
+	EqualReasonLinkTargetMismatch       = "link target mismatch"
 )
 
 type EqualResult []EqualReport
@@ -40,8 +41,9 @@ type EqualReport struct {
 	Path string
 	// Values for Reason of Path.
 	// fs.FileMode for EqualReasonModeMismatch,
-	// nil for EqualReasonFileContentMismatch
-	// and []string describing names of dirents for EqualReasonDirectoryContentMismatch.
+	// nil for EqualReasonFileContentMismatch,
+	// []string describing names of dirents for EqualReasonDirectoryContentMismatch
+	// and string of link targets for EqualReasonLinkTargetMismatch.
 	DstVal, SrcVal any
 }
 
@@ -51,11 +53,16 @@ type EqualReport struct {
 //   - mode bits of dirents
 //   - content of directory
 //   - content of regular files
+//   - targets of symbolic links, if CopyFsWithSymlink is set
 //
 // Equal takes also CopyFsOption. Options work as if dst was dst of CopyFs.
 // That is, for example, if CopyFsWithOverridePermission is set,
 // Equal compares dst's file mode against returned value of chmodIf instead of src's.
 //
+// Non regular files are handled as specified by CopyFsWithSymlink, CopyFsWithSpecialFilePolicy
+// and CopyFsWithIgnoreNonRegularFile.
+// By default Equal returns an error for them.
+//
 // Note that mode bits of the root directory is ignored since often it is not controlled.
 //
 // Performance:
@@ -73,12 +80,18 @@ func Equal(dst, src fs.FS, opts ...CopyFsOption) (EqualResult, error) {
 		}
 
 		if !d.IsDir() && d.Type().Type() != 0 {
-			switch opt.handleNonRegularFile {
+			switch opt.nonRegular(d.Type()) {
 			default: // nonRegularFileHandlingError
 				return fmt.Errorf("%w: only directories and regular files are supported", ErrBadInput)
 			case nonRegularFileHandlingIgnore:
 				return nil
-				// case nonRegularFileHandlingTrySymlink:
+			case nonRegularFileHandlingTrySymlink, nonRegularFileHandlingModeOnly:
+				report, err := equalNonRegular(dst, src, path, d.Type(), opt)
+				if err != nil || report == nil {
+					return err
+				}
+				result = append(result, *report)
+				return nil
 			}
 		}
 
@@ -93,6 +106,23 @@ func Equal(dst, src fs.FS, opts ...CopyFsOption) (EqualResult, error) {
 			return err
 		}
 
+		if opt.needsLstat() && path != "." {
+			// src could be a link or a special file while dst is not.
+			// Do not open it since that follows the link or may block.
+			srcInfo, err := lstat(src, path)
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil
+				}
+				return err
+			}
+			if !srcInfo.IsDir() && !srcInfo.Mode().IsRegular() {
+				report, _ := sameMode(dstInfo.Mode(), srcInfo.Mode(), path, opt)
+				result = append(result, report)
+				return nil
+			}
+		}
+
 		srcFile, err := src.Open(path)
 		if err != nil {
 			// number of dirents are already checked. See below.
@@ -163,6 +193,56 @@ func Equal(dst, src fs.FS, opts ...CopyFsOption) (EqualResult, error) {
 	return result, err
 }
 
+// equalNonRegular compares a link or a special file at path.
+// It returns nil report if they are same.
+func equalNonRegular(dst, src fs.FS, path string, typ fs.FileMode, opt copyFsOption) (*EqualReport, error) {
+	dstInfo, err := lstat(dst, path)
+	if err != nil {
+		return nil, err
+	}
+	srcInfo, err := lstat(src, path)
+	if err != nil {
+		// reported as directory content mismatch.
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if typ&fs.ModeSymlink == 0 {
+		if report, eq := sameMode(dstInfo.Mode(), srcInfo.Mode(), path, opt); !eq {
+			return &report, nil
+		}
+		return nil, nil
+	}
+
+	if dstInfo.Mode().Type() != srcInfo.Mode().Type() {
+		return &EqualReport{
+			Reason: EqualReasonModeMismatch,
+			Path:   path,
+			DstVal: dstInfo.Mode(),
+			SrcVal: srcInfo.Mode(),
+		}, nil
+	}
+	dstTarget, err := readLink(dst, path)
+	if err != nil {
+		return nil, err
+	}
+	srcTarget, err := readLink(src, path)
+	if err != nil {
+		return nil, err
+	}
+	if dstTarget != srcTarget {
+		return &EqualReport{
+			Reason: EqualReasonLinkTargetMismatch,
+			Path:   path,
+			DstVal: dstTarget,
+			SrcVal: srcTarget,
+		}, nil
+	}
+	return nil, nil
+}
+
 func sameMode(dst, src fs.FileMode, path string, opt copyFsOption) (EqualReport, bool) {
 	report := EqualReport{
 		Reason: EqualReasonModeMismatch,
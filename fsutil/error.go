@@ -1,13 +1,21 @@
 package fsutil
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/ngicks/musicbox/stream"
+)
 
 var (
-	ErrBadInput        = errors.New("bad input")
-	ErrBadName         = errors.New("bad name")
-	ErrBadPattern      = errors.New("bad pattern")
-	ErrMaxRetry        = errors.New("max retry")
-	ErrHashSumMismatch = errors.New("hash sum mismatch")
+	ErrBadInput          = errors.New("bad input")
+	ErrBadName           = errors.New("bad name")
+	ErrBadPattern        = errors.New("bad pattern")
+	ErrMaxRetry          = errors.New("max retry")
+	ErrHashSumMismatch   = stream.ErrHashSumMismatch
+	ErrMergeConflict     = errors.New("merge conflict")
+	ErrInsufficientSpace = errors.New("insufficient space")
+	ErrCaseCollision     = errors.New("case-insensitive name collision")
+	ErrUnsafePath        = errors.New("unsafe path")
 )
 
 func IsPackageErr(err error) bool {
@@ -17,6 +25,10 @@ func IsPackageErr(err error) bool {
 		ErrBadPattern,
 		ErrMaxRetry,
 		ErrHashSumMismatch,
+		ErrMergeConflict,
+		ErrInsufficientSpace,
+		ErrCaseCollision,
+		ErrUnsafePath,
 	} {
 		if errors.Is(err, e) {
 			return true
@@ -24,3 +36,43 @@ func IsPackageErr(err error) bool {
 	}
 	return false
 }
+
+// SafeWriteStage is a step of SafeWrite family at which an error has occurred.
+type SafeWriteStage string
+
+const (
+	SafeWriteStageMkdir       SafeWriteStage = "mkdirAll"
+	SafeWriteStagePreflight   SafeWriteStage = "preflight"
+	SafeWriteStageOpen        SafeWriteStage = "open"
+	SafeWriteStagePreProcess  SafeWriteStage = "preprocess"
+	SafeWriteStageCopy        SafeWriteStage = "copy"
+	SafeWriteStageChmod       SafeWriteStage = "chmod"
+	SafeWriteStageChown       SafeWriteStage = "chown"
+	SafeWriteStagePostProcess SafeWriteStage = "postprocess"
+	SafeWriteStageSync        SafeWriteStage = "sync"
+	SafeWriteStageClose       SafeWriteStage = "close"
+	// SafeWriteStageCommit is renaming, or merging, the temporary file to the destination.
+	SafeWriteStageCommit SafeWriteStage = "commit"
+)
+
+// SafeWriteError is returned from SafeWrite family.
+// Use errors.As to retrieve it.
+//
+// The temporary file is already removed unless WithDisableRemoveOnErr or WithIgnoreMatchedErr is set.
+type SafeWriteError struct {
+	Stage SafeWriteStage
+	// TmpPath is the path of the temporary file or directory.
+	// It is empty if the error occurred before the temporary file is created.
+	TmpPath string
+	// DstPath is the destination path.
+	DstPath string
+	Err     error
+}
+
+func (e *SafeWriteError) Error() string {
+	return "SafeWrite, " + string(e.Stage) + ": " + e.Err.Error()
+}
+
+func (e *SafeWriteError) Unwrap() error {
+	return e.Err
+}
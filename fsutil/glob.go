@@ -0,0 +1,149 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Glob returns names of all files in fsys matching pattern, in lexical order.
+//
+// In addition to the syntax of path.Match, a path element "**" matches zero or more path elements,
+// e.g. "a/**/*.go" matches "a/b.go" and "a/b/c/d.go".
+// "**" is only special when it is a whole element; "a**" is same as "a*".
+//
+// The returned error wraps ErrBadPattern if pattern is malformed.
+// As is the case with fs.Glob, I/O errors while reading directories are ignored.
+func Glob(fsys fs.FS, pattern string) ([]string, error) {
+	segments, err := splitGlobPattern(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("fsutil.Glob: %w", err)
+	}
+
+	// Walk only the static prefix of the pattern.
+	root := "."
+	var i int
+	for i = 0; i < len(segments)-1 && !hasGlobMeta(segments[i]); i++ {
+	}
+	if i > 0 {
+		root = path.Join(segments[:i]...)
+	}
+
+	var matches []string
+	_ = fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// skip unreadable directories.
+			return nil
+		}
+		if p == "." {
+			return nil
+		}
+		if matchGlobSegments(segments, strings.Split(p, "/")) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	sort.Strings(matches)
+	return matches, nil
+}
+
+func splitGlobPattern(pattern string) ([]string, error) {
+	pattern = path.Clean(pattern)
+	if pattern == "." || strings.HasPrefix(pattern, "/") || pattern == ".." || strings.HasPrefix(pattern, "../") {
+		return nil, fmt.Errorf("%w: %q", ErrBadPattern, pattern)
+	}
+	segments := strings.Split(pattern, "/")
+	for _, s := range segments {
+		if _, err := path.Match(s, ""); err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrBadPattern, pattern)
+		}
+	}
+	return segments, nil
+}
+
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+func matchGlobSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchGlobSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// CopyFsGlob copies files in src matched by patterns into dst and returns copied paths in lexical order.
+//
+// Each pattern is either a path or a pattern accepted by Glob.
+// Directories specified by paths or matched by patterns are copied recursively.
+// A path without any meta characters must exist in src, while a pattern matching nothing is not an error.
+//
+// Paths are copied as if passed to CopyFsPath; opts are interpreted likewise.
+func CopyFsGlob(dst afero.Fs, src fs.FS, patterns []string, opts ...CopyFsOption) ([]string, error) {
+	seen := map[string]bool{}
+	for _, pattern := range patterns {
+		var matched []string
+		if hasGlobMeta(pattern) {
+			var err error
+			matched, err = Glob(src, pattern)
+			if err != nil {
+				return nil, fmt.Errorf("fsutil.CopyFsGlob: %w", err)
+			}
+		} else {
+			p := path.Clean(filepath.ToSlash(pattern))
+			if strings.HasPrefix(p, "..") {
+				return nil, fmt.Errorf("fsutil.CopyFsGlob: path is out of src, path = %s: %w", p, fs.ErrNotExist)
+			}
+			matched = []string{p}
+		}
+
+		for _, m := range matched {
+			err := fs.WalkDir(src, m, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if seen[p] {
+					if d.IsDir() {
+						return fs.SkipDir
+					}
+					return nil
+				}
+				seen[p] = true
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("fsutil.CopyFsGlob: %w", err)
+			}
+		}
+	}
+
+	paths := make([]string, 0, len(seen))
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if err := CopyFsPath(dst, src, paths, opts...); err != nil {
+		return nil, fmt.Errorf("fsutil.CopyFsGlob: %w", err)
+	}
+	return paths, nil
+}
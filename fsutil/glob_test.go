@@ -0,0 +1,68 @@
+package fsutil
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+var globTestFs = fstest.MapFS{
+	"a.go":          {Data: []byte("a")},
+	"a.txt":         {Data: []byte("a")},
+	"dir/b.go":      {Data: []byte("b")},
+	"dir/sub/c.go":  {Data: []byte("c")},
+	"dir/sub/c.txt": {Data: []byte("c")},
+	"other/d.go":    {Data: []byte("d")},
+}
+
+func TestGlob(t *testing.T) {
+	for _, tc := range []struct {
+		pattern  string
+		expected []string
+	}{
+		{"*.go", []string{"a.go"}},
+		{"**/*.go", []string{"a.go", "dir/b.go", "dir/sub/c.go", "other/d.go"}},
+		{"dir/**/*.go", []string{"dir/b.go", "dir/sub/c.go"}},
+		{"dir/**", []string{"dir", "dir/b.go", "dir/sub", "dir/sub/c.go", "dir/sub/c.txt"}},
+		{"*/sub/*.txt", []string{"dir/sub/c.txt"}},
+		{"dir/sub/c.go", []string{"dir/sub/c.go"}},
+		{"nonexistent/**", nil},
+	} {
+		matches, err := Glob(globTestFs, tc.pattern)
+		assert.NilError(t, err)
+		assert.DeepEqual(t, tc.expected, matches)
+	}
+
+	for _, pattern := range []string{"[", "dir/[a", "/abs", "../a", "."} {
+		_, err := Glob(globTestFs, pattern)
+		assert.ErrorIs(t, err, ErrBadPattern, "pattern = %q", pattern)
+	}
+}
+
+func TestCopyFsGlob(t *testing.T) {
+	dst := afero.NewMemMapFs()
+	copied, err := CopyFsGlob(dst, globTestFs, []string{"*.txt", "dir/sub", "**/b.go"})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"a.txt", "dir/b.go", "dir/sub", "dir/sub/c.go", "dir/sub/c.txt"}, copied)
+
+	var files []string
+	err = afero.Walk(dst, "", func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"a.txt", "dir/b.go", "dir/sub/c.go", "dir/sub/c.txt"}, files)
+
+	_, err = CopyFsGlob(afero.NewMemMapFs(), globTestFs, []string{"nonexistent"})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = CopyFsGlob(afero.NewMemMapFs(), globTestFs, []string{"../a"})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
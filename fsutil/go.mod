@@ -3,6 +3,7 @@ module github.com/ngicks/musicbox/fsutil
 go 1.20.0
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/ngicks/musicbox/stream v0.0.0-20240310233034-2cafc1fbba1d
 	github.com/spf13/afero v1.11.0
 	gotest.tools/v3 v3.5.1
@@ -10,5 +11,6 @@ require (
 
 require (
 	github.com/google/go-cmp v0.5.9 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
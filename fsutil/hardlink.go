@@ -0,0 +1,95 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// CopyFsWithPreserveHardlinks makes CopyFS and CopyFsPath recreate files sharing a same inode in src as hard links in dst,
+// instead of copying content of those files for each.
+//
+// Files are identified by device and inode numbers reported by fs.FileInfo.Sys,
+// so only sources backed by the os, e.g. os.DirFS or afero.NewIOFS(afero.NewOsFs()), on unix platforms are detected.
+// The link is created by os.Link, which requires dst to be backed by the os as well;
+// *afero.OsFs, *afero.BasePathFs and wrappers of this package are unwrapped.
+// If either is not the case, files are copied as usual.
+//
+// Permission and owner of linked files are those of the first copied one since they are shared.
+func CopyFsWithPreserveHardlinks(preserve bool) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.preserveHardlinks = preserve
+	}
+}
+
+type fileID struct {
+	dev, ino uint64
+}
+
+// hardlinks records the first path copied for each multiply linked file.
+type hardlinks map[fileID]string
+
+func newHardlinks(opt copyFsOption) hardlinks {
+	if !opt.preserveHardlinks {
+		return nil
+	}
+	return hardlinks{}
+}
+
+// tryLink links p in dst to the file previously copied from a same inode as info.
+// It returns false if info is not a multiply linked file seen before,
+// or dst is not able to create hard links.
+// Otherwise, p is recorded so that later paths are linked to it.
+func (h hardlinks) tryLink(dst afero.Fs, p string, info fs.FileInfo) (linked bool, err error) {
+	if h == nil {
+		return false, nil
+	}
+	id, ok := osFileID(info)
+	if !ok {
+		return false, nil
+	}
+	first, ok := h[id]
+	if !ok {
+		h[id] = p
+		return false, nil
+	}
+	if first == p {
+		return false, nil
+	}
+
+	oldname, ok := realPath(dst, first)
+	if !ok {
+		return false, nil
+	}
+	newDir, ok := realPath(dst, path.Dir(p))
+	if !ok {
+		return false, nil
+	}
+	newname := filepath.Join(newDir, path.Base(p))
+
+	if err := os.Remove(newname); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return false, err
+	}
+	if err := os.Link(oldname, newname); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// realPath returns the path on the os for name in fsys.
+func realPath(fsys afero.Fs, name string) (string, bool) {
+	f, err := fsys.Open(filepath.FromSlash(name))
+	if err != nil {
+		return "", false
+	}
+	defer func() { _ = f.Close() }()
+	osFile, ok := unwrapOsFile(f)
+	if !ok {
+		return "", false
+	}
+	return osFile.Name(), true
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package fsutil
+
+import "io/fs"
+
+func osFileID(info fs.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
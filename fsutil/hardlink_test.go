@@ -0,0 +1,57 @@
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFS_PreserveHardlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard links are not detected on windows")
+	}
+
+	src := t.TempDir()
+	assert.NilError(t, os.WriteFile(filepath.Join(src, "foo"), []byte("foo"), 0o644))
+	assert.NilError(t, os.Mkdir(filepath.Join(src, "dir"), 0o755))
+	assert.NilError(t, os.Link(filepath.Join(src, "foo"), filepath.Join(src, "dir", "bar")))
+	assert.NilError(t, os.WriteFile(filepath.Join(src, "baz"), []byte("foo"), 0o644))
+
+	dst := t.TempDir()
+	err := CopyFS(
+		afero.NewBasePathFs(afero.NewOsFs(), dst),
+		os.DirFS(src),
+		CopyFsWithPreserveHardlinks(true),
+	)
+	assert.NilError(t, err)
+
+	stat := func(name string) os.FileInfo {
+		t.Helper()
+		s, err := os.Stat(filepath.Join(dst, name))
+		assert.NilError(t, err)
+		return s
+	}
+	assert.Assert(t, os.SameFile(stat("foo"), stat("dir/bar")))
+	assert.Assert(t, !os.SameFile(stat("foo"), stat("baz")))
+	bin, err := os.ReadFile(filepath.Join(dst, "dir", "bar"))
+	assert.NilError(t, err)
+	assert.Equal(t, "foo", string(bin))
+
+	// dst unable to link falls back to copying.
+	mem := afero.NewMemMapFs()
+	err = CopyFS(mem, os.DirFS(src), CopyFsWithPreserveHardlinks(true))
+	assert.NilError(t, err)
+	bin, err = afero.ReadFile(mem, filepath.Join("dir", "bar"))
+	assert.NilError(t, err)
+	assert.Equal(t, "foo", string(bin))
+
+	// without the option, content is duplicated.
+	dst = t.TempDir()
+	err = CopyFS(afero.NewBasePathFs(afero.NewOsFs(), dst), os.DirFS(src))
+	assert.NilError(t, err)
+	assert.Assert(t, !os.SameFile(stat("foo"), stat("dir/bar")))
+}
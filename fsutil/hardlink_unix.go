@@ -0,0 +1,16 @@
+//go:build unix
+
+package fsutil
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+func osFileID(info fs.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,340 @@
+package fsutil
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+var _ afero.Fs = (*LoggingFs)(nil)
+
+type loggingFsOption struct {
+	errLevel     *slog.Level
+	redactPath   func(path string) string
+	omitArgs     bool
+	throttle     time.Duration
+	throttleKeep int
+}
+
+type LoggingFsOption func(o *loggingFsOption)
+
+// LoggingFsWithErrorLevel sets level used for ops returning an error.
+// By default, the level passed to NewLoggingFs is used for all ops.
+func LoggingFsWithErrorLevel(level slog.Level) LoggingFsOption {
+	return func(o *loggingFsOption) {
+		o.errLevel = &level
+	}
+}
+
+// LoggingFsWithRedactPath makes LoggingFs log paths converted by redact instead of raw paths.
+// Paths in args, e.g. newname of Rename, are also converted.
+func LoggingFsWithRedactPath(redact func(path string) string) LoggingFsOption {
+	return func(o *loggingFsOption) {
+		o.redactPath = redact
+	}
+}
+
+// LoggingFsWithOmitArgs makes LoggingFs omit args of ops,
+// e.g. (atime, mtime) for Chtimes or s for WriteString, since they may contain sensitive data.
+func LoggingFsWithOmitArgs(omit bool) LoggingFsOption {
+	return func(o *loggingFsOption) {
+		o.omitArgs = omit
+	}
+}
+
+// LoggingFsWithThrottle limits number of logs per op to keep in every interval.
+// Logs exceeding the limit are dropped and
+// the number of dropped logs is reported as the "dropped" attribute of the next log for the op.
+// Ops returning an error are never dropped.
+// Zero or negative interval or keep disables throttling, which is the default.
+func LoggingFsWithThrottle(interval time.Duration, keep int) LoggingFsOption {
+	return func(o *loggingFsOption) {
+		o.throttle = interval
+		o.throttleKeep = keep
+	}
+}
+
+// LoggingFs is an afero.Fs which logs every operation on the Fs and opened files with slog.
+// Each log has attributes for op, path, args (if any), n (bytes transferred, only for read and write ops),
+// duration and err (only if any).
+type LoggingFs struct {
+	base   afero.Fs
+	logger *slog.Logger
+	level  slog.Level
+	opt    loggingFsOption
+
+	mu     sync.Mutex
+	window map[string]*throttleWindow
+}
+
+type throttleWindow struct {
+	start   time.Time
+	count   int
+	dropped int
+}
+
+func NewLoggingFs(base afero.Fs, logger *slog.Logger, level slog.Level, opts ...LoggingFsOption) *LoggingFs {
+	opt := loggingFsOption{}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return &LoggingFs{
+		base:   base,
+		logger: logger,
+		level:  level,
+		opt:    opt,
+		window: make(map[string]*throttleWindow),
+	}
+}
+
+// admit reports whether a log for op should be emitted and how many logs for op were dropped since the last one.
+func (fsys *LoggingFs) admit(op string, now time.Time) (ok bool, dropped int) {
+	if fsys.opt.throttle <= 0 || fsys.opt.throttleKeep <= 0 {
+		return true, 0
+	}
+
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	w := fsys.window[op]
+	if w == nil {
+		w = &throttleWindow{start: now}
+		fsys.window[op] = w
+	}
+	if now.Sub(w.start) >= fsys.opt.throttle {
+		w.start = now
+		w.count = 0
+	}
+	if w.count >= fsys.opt.throttleKeep {
+		w.dropped++
+		return false, 0
+	}
+	w.count++
+	dropped, w.dropped = w.dropped, 0
+	return true, dropped
+}
+
+func (fsys *LoggingFs) log(op, path string, args []any, n int, start time.Time, err error) {
+	end := time.Now()
+
+	level := fsys.level
+	if err != nil && fsys.opt.errLevel != nil {
+		level = *fsys.opt.errLevel
+	}
+	ctx := context.Background()
+	if !fsys.logger.Enabled(ctx, level) {
+		return
+	}
+
+	dropped := 0
+	if err == nil {
+		var ok bool
+		ok, dropped = fsys.admit(op, end)
+		if !ok {
+			return
+		}
+	}
+
+	attrs := make([]slog.Attr, 0, 7)
+	attrs = append(attrs, slog.String("op", op), slog.String("path", fsys.redact(path)))
+	if len(args) > 0 && !fsys.opt.omitArgs {
+		attrs = append(attrs, slog.Any("args", args))
+	}
+	if n > 0 {
+		attrs = append(attrs, slog.Int("n", n))
+	}
+	attrs = append(attrs, slog.Duration("duration", end.Sub(start)))
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+	}
+	if dropped > 0 {
+		attrs = append(attrs, slog.Int("dropped", dropped))
+	}
+	fsys.logger.LogAttrs(ctx, level, "fs op", attrs...)
+}
+
+func (fsys *LoggingFs) redact(path string) string {
+	if fsys.opt.redactPath == nil {
+		return path
+	}
+	return fsys.opt.redactPath(path)
+}
+
+func (fsys *LoggingFs) Create(name string) (afero.File, error) {
+	start := time.Now()
+	f, err := fsys.base.Create(name)
+	fsys.log(ObservableFsOpNameCreate, name, nil, 0, start, err)
+	return newLoggingFile(fsys, name, f, err)
+}
+func (fsys *LoggingFs) Mkdir(name string, perm os.FileMode) error {
+	start := time.Now()
+	err := fsys.base.Mkdir(name, perm)
+	fsys.log(ObservableFsOpNameMkdir, name, []any{perm}, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) MkdirAll(path string, perm os.FileMode) error {
+	start := time.Now()
+	err := fsys.base.MkdirAll(path, perm)
+	fsys.log(ObservableFsOpNameMkdirAll, path, []any{perm}, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) Open(name string) (afero.File, error) {
+	start := time.Now()
+	f, err := fsys.base.Open(name)
+	fsys.log(ObservableFsOpNameOpen, name, nil, 0, start, err)
+	return newLoggingFile(fsys, name, f, err)
+}
+func (fsys *LoggingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	start := time.Now()
+	f, err := fsys.base.OpenFile(name, flag, perm)
+	fsys.log(ObservableFsOpNameOpenFile, name, []any{flag, perm}, 0, start, err)
+	return newLoggingFile(fsys, name, f, err)
+}
+func (fsys *LoggingFs) Remove(name string) error {
+	start := time.Now()
+	err := fsys.base.Remove(name)
+	fsys.log(ObservableFsOpNameRemove, name, nil, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) RemoveAll(path string) error {
+	start := time.Now()
+	err := fsys.base.RemoveAll(path)
+	fsys.log(ObservableFsOpNameRemoveAll, path, nil, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) Rename(oldname, newname string) error {
+	start := time.Now()
+	err := fsys.base.Rename(oldname, newname)
+	fsys.log(ObservableFsOpNameRename, oldname, []any{fsys.redact(newname)}, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) Stat(name string) (os.FileInfo, error) {
+	start := time.Now()
+	stat, err := fsys.base.Stat(name)
+	fsys.log(ObservableFsOpNameStat, name, nil, 0, start, err)
+	return stat, err
+}
+func (fsys *LoggingFs) Name() string {
+	return fsys.base.Name()
+}
+func (fsys *LoggingFs) Chmod(name string, mode os.FileMode) error {
+	start := time.Now()
+	err := fsys.base.Chmod(name, mode)
+	fsys.log(ObservableFsOpNameChmod, name, []any{mode}, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) Chown(name string, uid, gid int) error {
+	start := time.Now()
+	err := fsys.base.Chown(name, uid, gid)
+	fsys.log(ObservableFsOpNameChown, name, []any{uid, gid}, 0, start, err)
+	return err
+}
+func (fsys *LoggingFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	start := time.Now()
+	err := fsys.base.Chtimes(name, atime, mtime)
+	fsys.log(ObservableFsOpNameChtimes, name, []any{atime, mtime}, 0, start, err)
+	return err
+}
+
+var _ afero.File = (*loggingFile)(nil)
+
+type loggingFile struct {
+	fsys *LoggingFs
+	path string
+	f    afero.File
+}
+
+func newLoggingFile(fsys *LoggingFs, path string, f afero.File, err error) (afero.File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &loggingFile{
+		fsys: fsys,
+		path: path,
+		f:    f,
+	}, nil
+}
+
+func (f *loggingFile) log(op string, args []any, n int, start time.Time, err error) {
+	f.fsys.log("File."+op, f.path, args, n, start, err)
+}
+
+func (f *loggingFile) Close() error {
+	start := time.Now()
+	err := f.f.Close()
+	f.log(ObservableFsFileOpNameClose, nil, 0, start, err)
+	return err
+}
+func (f *loggingFile) Read(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = f.f.Read(p)
+	f.log(ObservableFsFileOpNameRead, nil, n, start, err)
+	return n, err
+}
+func (f *loggingFile) ReadAt(p []byte, off int64) (n int, err error) {
+	start := time.Now()
+	n, err = f.f.ReadAt(p, off)
+	f.log(ObservableFsFileOpNameReadAt, []any{off}, n, start, err)
+	return n, err
+}
+func (f *loggingFile) Seek(offset int64, whence int) (int64, error) {
+	start := time.Now()
+	n, err := f.f.Seek(offset, whence)
+	f.log(ObservableFsFileOpNameSeek, []any{offset, whence}, 0, start, err)
+	return n, err
+}
+func (f *loggingFile) Write(p []byte) (n int, err error) {
+	start := time.Now()
+	n, err = f.f.Write(p)
+	f.log(ObservableFsFileOpNameWrite, nil, n, start, err)
+	return n, err
+}
+func (f *loggingFile) WriteAt(p []byte, off int64) (n int, err error) {
+	start := time.Now()
+	n, err = f.f.WriteAt(p, off)
+	f.log(ObservableFsFileOpNameWriteAt, []any{off}, n, start, err)
+	return n, err
+}
+func (f *loggingFile) Name() string {
+	return f.f.Name()
+}
+func (f *loggingFile) Readdir(count int) ([]os.FileInfo, error) {
+	start := time.Now()
+	dirent, err := f.f.Readdir(count)
+	f.log(ObservableFsFileOpNameReaddir, []any{count}, 0, start, err)
+	return dirent, err
+}
+func (f *loggingFile) Readdirnames(n int) ([]string, error) {
+	start := time.Now()
+	names, err := f.f.Readdirnames(n)
+	f.log(ObservableFsFileOpNameReaddirnames, []any{n}, 0, start, err)
+	return names, err
+}
+func (f *loggingFile) Stat() (os.FileInfo, error) {
+	start := time.Now()
+	s, err := f.f.Stat()
+	f.log(ObservableFsFileOpNameStat, nil, 0, start, err)
+	return s, err
+}
+func (f *loggingFile) Sync() error {
+	start := time.Now()
+	err := f.f.Sync()
+	f.log(ObservableFsFileOpNameSync, nil, 0, start, err)
+	return err
+}
+func (f *loggingFile) Truncate(size int64) error {
+	start := time.Now()
+	err := f.f.Truncate(size)
+	f.log(ObservableFsFileOpNameTruncate, []any{size}, 0, start, err)
+	return err
+}
+func (f *loggingFile) WriteString(s string) (ret int, err error) {
+	start := time.Now()
+	ret, err = f.f.WriteString(s)
+	f.log(ObservableFsFileOpNameWriteString, []any{s}, ret, start, err)
+	return ret, err
+}
@@ -0,0 +1,113 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func readLogs(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var logs []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]any
+		assert.NilError(t, json.Unmarshal([]byte(line), &m))
+		logs = append(logs, m)
+	}
+	buf.Reset()
+	return logs
+}
+
+func TestLoggingFs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	t.Run("basic", func(t *testing.T) {
+		fsys := NewLoggingFs(afero.NewMemMapFs(), logger, slog.LevelDebug, LoggingFsWithErrorLevel(slog.LevelWarn))
+
+		assert.NilError(t, afero.WriteFile(fsys, "foo", []byte("foobar"), fs.ModePerm))
+		_, err := fsys.Stat("bar")
+		assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+
+		logs := readLogs(t, &buf)
+		var ops []string
+		for _, l := range logs {
+			ops = append(ops, l["op"].(string))
+			assert.Equal(t, l["msg"], "fs op")
+			_, ok := l["duration"]
+			assert.Assert(t, ok)
+		}
+		assert.DeepEqual(t, []string{"OpenFile", "File.Write", "File.Close", "Stat"}, ops)
+		assert.Equal(t, "DEBUG", logs[0]["level"])
+		assert.Equal(t, "foo", logs[0]["path"])
+		assert.Equal(t, float64(6), logs[1]["n"])
+		assert.Equal(t, "WARN", logs[3]["level"])
+		assert.Assert(t, cmp.Contains(logs[3]["err"], "not exist"))
+	})
+
+	t.Run("level", func(t *testing.T) {
+		infoLogger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		fsys := NewLoggingFs(afero.NewMemMapFs(), infoLogger, slog.LevelDebug)
+		assert.NilError(t, fsys.Mkdir("foo", fs.ModePerm))
+		assert.Assert(t, cmp.Len(readLogs(t, &buf), 0))
+	})
+
+	t.Run("redaction", func(t *testing.T) {
+		fsys := NewLoggingFs(
+			afero.NewMemMapFs(),
+			logger,
+			slog.LevelInfo,
+			LoggingFsWithRedactPath(func(string) string { return "<redacted>" }),
+		)
+		assert.NilError(t, afero.WriteFile(fsys, "secret", nil, fs.ModePerm))
+		assert.NilError(t, fsys.Rename("secret", "secret2"))
+		for _, l := range readLogs(t, &buf) {
+			assert.Equal(t, "<redacted>", l["path"])
+			if l["op"] == "Rename" {
+				assert.DeepEqual(t, []any{"<redacted>"}, l["args"])
+			}
+		}
+
+		fsys = NewLoggingFs(afero.NewMemMapFs(), logger, slog.LevelInfo, LoggingFsWithOmitArgs(true))
+		f, err := fsys.Create("foo")
+		assert.NilError(t, err)
+		_, err = f.WriteString("password")
+		assert.NilError(t, err)
+		assert.NilError(t, f.Close())
+		assert.Assert(t, !strings.Contains(buf.String(), "password"))
+		buf.Reset()
+	})
+
+	t.Run("throttle", func(t *testing.T) {
+		fsys := NewLoggingFs(afero.NewMemMapFs(), logger, slog.LevelInfo, LoggingFsWithThrottle(time.Hour, 2))
+		for i := 0; i < 5; i++ {
+			assert.NilError(t, fsys.MkdirAll("foo", fs.ModePerm))
+		}
+		// errors are never dropped.
+		for i := 0; i < 3; i++ {
+			_ = fsys.Remove("nonexistent")
+		}
+		logs := readLogs(t, &buf)
+		assert.Assert(t, cmp.Len(logs, 5))
+
+		fsys.mu.Lock()
+		fsys.window[ObservableFsOpNameMkdirAll].start = time.Now().Add(-2 * time.Hour)
+		fsys.mu.Unlock()
+		assert.NilError(t, fsys.MkdirAll("foo", fs.ModePerm))
+		logs = readLogs(t, &buf)
+		assert.Assert(t, cmp.Len(logs, 1))
+		assert.Equal(t, float64(3), logs[0]["dropped"])
+	})
+}
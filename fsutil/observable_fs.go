@@ -47,10 +47,17 @@ const (
 )
 
 type ObservableFsOp struct {
-	Name string
-	Op   ObservableFsOpName
-	Args []any
-	Err  error
+	Name  string
+	Op    ObservableFsOpName
+	Args  []any
+	Err   error
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns time taken by the op.
+func (o ObservableFsOp) Duration() time.Duration {
+	return o.End.Sub(o.Start)
 }
 
 type ObservableFsFileOp struct {
@@ -58,6 +65,16 @@ type ObservableFsFileOp struct {
 	Op   ObservableFsFileOpName
 	Args []any
 	Err  error
+	// N is number of bytes transferred by Read, ReadAt, Write, WriteAt and WriteString.
+	// It is always 0 for other ops.
+	N     int
+	Start time.Time
+	End   time.Time
+}
+
+// Duration returns time taken by the op.
+func (o ObservableFsFileOp) Duration() time.Duration {
+	return o.End.Sub(o.Start)
 }
 
 type Observer struct {
@@ -76,6 +93,11 @@ func (o *Observer) FileOps() map[string][]ObservableFsFileOp {
 	return o.o.readFileOps()
 }
 
+// Stats aggregates ops recorded so far.
+func (o *Observer) Stats() ObservableFsStats {
+	return o.o.stats()
+}
+
 type ObservableFs struct {
 	mu     sync.Mutex
 	base   afero.Fs
@@ -114,17 +136,19 @@ func (fsys *ObservableFs) readFileOps() map[string][]ObservableFsFileOp {
 	return out
 }
 
-func (fsys *ObservableFs) recordFsOp(name string, op ObservableFsOpName, args []any, err error) {
+func (fsys *ObservableFs) recordFsOp(name string, op ObservableFsOpName, args []any, start time.Time, err error) {
+	end := time.Now()
 	fsys.mu.Lock()
 	defer fsys.mu.Unlock()
-	fsys.fsysOp = append(fsys.fsysOp, ObservableFsOp{normalizePath(name), op, args, err})
+	fsys.fsysOp = append(fsys.fsysOp, ObservableFsOp{normalizePath(name), op, args, err, start, end})
 }
 
-func (fsys *ObservableFs) recordFileOp(name string, op ObservableFsFileOpName, args []any, err error) {
+func (fsys *ObservableFs) recordFileOp(name string, op ObservableFsFileOpName, args []any, n int, start time.Time, err error) {
+	end := time.Now()
 	fsys.mu.Lock()
 	defer fsys.mu.Unlock()
 	name = normalizePath(name)
-	fsys.fileOp[name] = append(fsys.fileOp[name], ObservableFsFileOp{name, op, args, err})
+	fsys.fileOp[name] = append(fsys.fileOp[name], ObservableFsFileOp{name, op, args, err, n, start, end})
 }
 
 func (fsys *ObservableFs) Observer() *Observer {
@@ -132,66 +156,78 @@ func (fsys *ObservableFs) Observer() *Observer {
 }
 
 func (fsys *ObservableFs) Create(name string) (afero.File, error) {
+	start := time.Now()
 	f, err := fsys.base.Create(name)
-	fsys.recordFsOp(name, ObservableFsOpNameCreate, nil, err)
+	fsys.recordFsOp(name, ObservableFsOpNameCreate, nil, start, err)
 	return newObservableFile(fsys, normalizePath(name), f, err)
 }
 func (fsys *ObservableFs) Mkdir(name string, perm os.FileMode) error {
+	start := time.Now()
 	err := fsys.base.Mkdir(name, perm)
-	fsys.recordFsOp(name, ObservableFsOpNameMkdir, []any{perm}, err)
+	fsys.recordFsOp(name, ObservableFsOpNameMkdir, []any{perm}, start, err)
 	return err
 }
 func (fsys *ObservableFs) MkdirAll(path string, perm os.FileMode) error {
+	start := time.Now()
 	err := fsys.base.MkdirAll(path, perm)
-	fsys.recordFsOp(path, ObservableFsOpNameMkdirAll, []any{perm}, err)
+	fsys.recordFsOp(path, ObservableFsOpNameMkdirAll, []any{perm}, start, err)
 	return err
 }
 func (fsys *ObservableFs) Open(name string) (afero.File, error) {
+	start := time.Now()
 	f, err := fsys.base.Open(name)
-	fsys.recordFsOp(name, ObservableFsOpNameOpen, nil, err)
+	fsys.recordFsOp(name, ObservableFsOpNameOpen, nil, start, err)
 	return newObservableFile(fsys, normalizePath(name), f, err)
 }
 func (fsys *ObservableFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	start := time.Now()
 	f, err := fsys.base.OpenFile(name, flag, perm)
-	fsys.recordFsOp(name, ObservableFsOpNameOpenFile, []any{flag, perm}, err)
+	fsys.recordFsOp(name, ObservableFsOpNameOpenFile, []any{flag, perm}, start, err)
 	return newObservableFile(fsys, normalizePath(name), f, err)
 }
 func (fsys *ObservableFs) Remove(name string) error {
+	start := time.Now()
 	err := fsys.base.Remove(name)
-	fsys.recordFsOp(name, ObservableFsOpNameRemove, nil, err)
+	fsys.recordFsOp(name, ObservableFsOpNameRemove, nil, start, err)
 	return err
 }
 func (fsys *ObservableFs) RemoveAll(path string) error {
+	start := time.Now()
 	err := fsys.base.RemoveAll(path)
-	fsys.recordFsOp(path, ObservableFsOpNameRemoveAll, nil, err)
+	fsys.recordFsOp(path, ObservableFsOpNameRemoveAll, nil, start, err)
 	return err
 }
 func (fsys *ObservableFs) Rename(oldname, newname string) error {
+	start := time.Now()
 	err := fsys.base.Rename(oldname, newname)
-	fsys.recordFsOp(oldname, ObservableFsOpNameRename, []any{newname}, err)
+	fsys.recordFsOp(oldname, ObservableFsOpNameRename, []any{newname}, start, err)
 	return err
 }
 func (fsys *ObservableFs) Stat(name string) (os.FileInfo, error) {
+	start := time.Now()
 	stat, err := fsys.base.Stat(name)
-	fsys.recordFsOp(name, ObservableFsOpNameStat, nil, err)
+	fsys.recordFsOp(name, ObservableFsOpNameStat, nil, start, err)
 	return stat, err
 }
 func (fsys *ObservableFs) Name() string {
 	return fsys.base.Name()
 }
 func (fsys *ObservableFs) Chmod(name string, mode os.FileMode) error {
+	start := time.Now()
 	err := fsys.base.Chmod(name, mode)
-	fsys.recordFsOp(name, ObservableFsOpNameChmod, []any{mode}, err)
+	fsys.recordFsOp(name, ObservableFsOpNameChmod, []any{mode}, start, err)
 	return err
 }
 func (fsys *ObservableFs) Chown(name string, uid, gid int) error {
+	start := time.Now()
 	err := fsys.base.Chown(name, uid, gid)
-	fsys.recordFsOp(name, ObservableFsOpNameChown, []any{uid, gid}, err)
+	fsys.recordFsOp(name, ObservableFsOpNameChown, []any{uid, gid}, start, err)
 	return err
 }
 func (fsys *ObservableFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	start := time.Now()
 	err := fsys.base.Chtimes(name, atime, mtime)
-	fsys.recordFsOp(name, ObservableFsOpNameChtimes, []any{atime, mtime}, err)
+	fsys.recordFsOp(name, ObservableFsOpNameChtimes, []any{atime, mtime}, start, err)
 	return err
 }
 
@@ -214,70 +250,82 @@ func newObservableFile(observer *ObservableFs, path string, f afero.File, err er
 	}, nil
 }
 
-func (f *observableFile) record(op ObservableFsFileOpName, args []any, err error) {
-	f.observer.recordFileOp(f.path, op, args, err)
+func (f *observableFile) record(op ObservableFsFileOpName, args []any, n int, start time.Time, err error) {
+	f.observer.recordFileOp(f.path, op, args, n, start, err)
 }
 
 func (f *observableFile) Close() error {
+	start := time.Now()
 	err := f.f.Close()
-	f.record(ObservableFsFileOpNameClose, nil, err)
+	f.record(ObservableFsFileOpNameClose, nil, 0, start, err)
 	return err
 }
 func (f *observableFile) Read(p []byte) (n int, err error) {
+	start := time.Now()
 	n, err = f.f.Read(p)
-	f.record(ObservableFsFileOpNameRead, nil, err)
+	f.record(ObservableFsFileOpNameRead, nil, n, start, err)
 	return n, err
 }
 func (f *observableFile) ReadAt(p []byte, off int64) (n int, err error) {
+	start := time.Now()
 	n, err = f.f.ReadAt(p, off)
-	f.record(ObservableFsFileOpNameReadAt, []any{off}, err)
+	f.record(ObservableFsFileOpNameReadAt, []any{off}, n, start, err)
 	return n, err
 }
 func (f *observableFile) Seek(offset int64, whence int) (int64, error) {
+	start := time.Now()
 	n, err := f.f.Seek(offset, whence)
-	f.record(ObservableFsFileOpNameSeek, []any{offset, whence}, err)
+	f.record(ObservableFsFileOpNameSeek, []any{offset, whence}, 0, start, err)
 	return n, err
 }
 func (f *observableFile) Write(p []byte) (n int, err error) {
+	start := time.Now()
 	n, err = f.f.Write(p)
-	f.record(ObservableFsFileOpNameWrite, nil, err)
+	f.record(ObservableFsFileOpNameWrite, nil, n, start, err)
 	return n, err
 }
 func (f *observableFile) WriteAt(p []byte, off int64) (n int, err error) {
+	start := time.Now()
 	n, err = f.f.WriteAt(p, off)
-	f.record(ObservableFsFileOpNameWriteAt, []any{off}, err)
+	f.record(ObservableFsFileOpNameWriteAt, []any{off}, n, start, err)
 	return n, err
 }
 func (f *observableFile) Name() string {
 	return f.f.Name()
 }
 func (f *observableFile) Readdir(count int) ([]os.FileInfo, error) {
+	start := time.Now()
 	dirent, err := f.f.Readdir(count)
-	f.record(ObservableFsFileOpNameReaddir, []any{count}, err)
+	f.record(ObservableFsFileOpNameReaddir, []any{count}, 0, start, err)
 	return dirent, err
 }
 func (f *observableFile) Readdirnames(n int) ([]string, error) {
+	start := time.Now()
 	names, err := f.f.Readdirnames(n)
-	f.record(ObservableFsFileOpNameReaddirnames, []any{n}, err)
+	f.record(ObservableFsFileOpNameReaddirnames, []any{n}, 0, start, err)
 	return names, err
 }
 func (f *observableFile) Stat() (os.FileInfo, error) {
+	start := time.Now()
 	s, err := f.f.Stat()
-	f.record(ObservableFsFileOpNameStat, nil, err)
+	f.record(ObservableFsFileOpNameStat, nil, 0, start, err)
 	return s, err
 }
 func (f *observableFile) Sync() error {
+	start := time.Now()
 	err := f.f.Sync()
-	f.record(ObservableFsFileOpNameSync, nil, err)
+	f.record(ObservableFsFileOpNameSync, nil, 0, start, err)
 	return err
 }
 func (f *observableFile) Truncate(size int64) error {
+	start := time.Now()
 	err := f.f.Truncate(size)
-	f.record(ObservableFsFileOpNameTruncate, []any{size}, err)
+	f.record(ObservableFsFileOpNameTruncate, []any{size}, 0, start, err)
 	return err
 }
 func (f *observableFile) WriteString(s string) (ret int, err error) {
+	start := time.Now()
 	ret, err = f.f.WriteString(s)
-	f.record(ObservableFsFileOpNameWriteString, []any{s}, err)
+	f.record(ObservableFsFileOpNameWriteString, []any{s}, ret, start, err)
 	return ret, err
 }
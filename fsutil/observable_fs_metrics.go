@@ -0,0 +1,89 @@
+package fsutil
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Expvar returns an expvar.Var which reports Stats as JSON every time it is read.
+// Publish it via expvar.Publish to expose the stats on /debug/vars.
+func (o *Observer) Expvar() expvar.Var {
+	return expvar.Func(func() any { return o.Stats() })
+}
+
+// WriteMetrics writes Stats to w in the Prometheus text exposition format,
+// so that a handler can serve it as a scrape target without depending on the Prometheus client library.
+// Every metric name is prefixed with prefix and an underscore. If prefix is empty, "observable_fs" is used.
+//
+// Metrics written are:
+//   - <prefix>_ops_total, <prefix>_op_errors_total and <prefix>_op_duration_seconds labeled with op and kind,
+//     where kind is "fs" for ops on the afero.Fs or "file" for ops on afero.File.
+//     <prefix>_op_duration_seconds is a summary having 0.5 and 0.99 quantiles.
+//   - <prefix>_read_bytes_total and <prefix>_written_bytes_total.
+func (o *Observer) WriteMetrics(w io.Writer, prefix string) error {
+	if prefix == "" {
+		prefix = "observable_fs"
+	}
+	stats := o.Stats()
+
+	type entry struct {
+		kind, op string
+		stats    ObservableFsOpStats
+	}
+	var entries []entry
+	for k, s := range stats.FsOps {
+		entries = append(entries, entry{"fs", string(k), s})
+	}
+	for k, s := range stats.FileOps {
+		entries = append(entries, entry{"file", string(k), s})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].kind != entries[j].kind {
+			return entries[i].kind > entries[j].kind // "fs" first.
+		}
+		return entries[i].op < entries[j].op
+	})
+
+	bufw := bufio.NewWriter(w)
+	p := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(bufw, format, args...)
+	}
+
+	p("# HELP %s_ops_total Number of calls.\n", prefix)
+	p("# TYPE %s_ops_total counter\n", prefix)
+	for _, e := range entries {
+		p("%s_ops_total{kind=%q,op=%q} %d\n", prefix, e.kind, e.op, e.stats.Count)
+	}
+
+	p("# HELP %s_op_errors_total Number of calls returned an error.\n", prefix)
+	p("# TYPE %s_op_errors_total counter\n", prefix)
+	for _, e := range entries {
+		p("%s_op_errors_total{kind=%q,op=%q} %d\n", prefix, e.kind, e.op, e.stats.Errors)
+	}
+
+	p("# HELP %s_op_duration_seconds Latency of calls.\n", prefix)
+	p("# TYPE %s_op_duration_seconds summary\n", prefix)
+	for _, e := range entries {
+		p("%s_op_duration_seconds{kind=%q,op=%q,quantile=\"0.5\"} %s\n", prefix, e.kind, e.op, seconds(e.stats.P50))
+		p("%s_op_duration_seconds{kind=%q,op=%q,quantile=\"0.99\"} %s\n", prefix, e.kind, e.op, seconds(e.stats.P99))
+		p("%s_op_duration_seconds_sum{kind=%q,op=%q} %s\n", prefix, e.kind, e.op, seconds(e.stats.Total))
+		p("%s_op_duration_seconds_count{kind=%q,op=%q} %d\n", prefix, e.kind, e.op, e.stats.Count)
+	}
+
+	p("# HELP %s_read_bytes_total Bytes read from files.\n", prefix)
+	p("# TYPE %s_read_bytes_total counter\n", prefix)
+	p("%s_read_bytes_total %d\n", prefix, stats.BytesRead)
+	p("# HELP %s_written_bytes_total Bytes written to files.\n", prefix)
+	p("# TYPE %s_written_bytes_total counter\n", prefix)
+	p("%s_written_bytes_total %d\n", prefix, stats.BytesWritten)
+
+	return bufw.Flush()
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%g", d.Seconds())
+}
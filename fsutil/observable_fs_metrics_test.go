@@ -0,0 +1,41 @@
+package fsutil
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestObserver_WriteMetrics(t *testing.T) {
+	fsys := NewObservableFs(afero.NewMemMapFs())
+	assert.NilError(t, afero.WriteFile(fsys, "foo", []byte("foobar"), 0o644))
+	_, err := afero.ReadFile(fsys, "foo")
+	assert.NilError(t, err)
+	_ = fsys.Remove("nonexistent")
+
+	var sb strings.Builder
+	assert.NilError(t, fsys.Observer().WriteMetrics(&sb, "test"))
+	out := sb.String()
+
+	for _, line := range []string{
+		"# TYPE test_ops_total counter",
+		`test_ops_total{kind="fs",op="OpenFile"} 1`,
+		`test_ops_total{kind="fs",op="Remove"} 1`,
+		`test_op_errors_total{kind="fs",op="Remove"} 1`,
+		`test_op_duration_seconds_count{kind="file",op="Write"} 1`,
+		"# TYPE test_op_duration_seconds summary",
+		"test_read_bytes_total 6",
+		"test_written_bytes_total 6",
+	} {
+		assert.Assert(t, cmp.Contains(out, line+"\n"))
+	}
+	assert.Assert(t, strings.Index(out, `kind="fs",op="OpenFile"`) < strings.Index(out, `kind="fs",op="Remove"`))
+
+	var stats ObservableFsStats
+	assert.NilError(t, json.Unmarshal([]byte(fsys.Observer().Expvar().String()), &stats))
+	assert.Equal(t, int64(6), stats.BytesWritten)
+}
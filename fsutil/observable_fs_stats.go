@@ -0,0 +1,99 @@
+package fsutil
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// ObservableFsStats is an aggregated summary of ops recorded by ObservableFs.
+type ObservableFsStats struct {
+	FsOps   map[ObservableFsOpName]ObservableFsOpStats
+	FileOps map[ObservableFsFileOpName]ObservableFsOpStats
+	// BytesRead is total bytes read by Read and ReadAt.
+	BytesRead int64
+	// BytesWritten is total bytes written by Write, WriteAt and WriteString.
+	BytesWritten int64
+}
+
+// ObservableFsOpStats summarizes calls of a single op.
+type ObservableFsOpStats struct {
+	Count  int
+	Errors int
+	Total  time.Duration
+	P50    time.Duration
+	P99    time.Duration
+	Max    time.Duration
+	// Bytes is total bytes transferred. It is only non-zero for read and write ops.
+	Bytes int64
+}
+
+func (fsys *ObservableFs) stats() ObservableFsStats {
+	fsys.mu.Lock()
+	defer fsys.mu.Unlock()
+
+	fsOpDur := map[ObservableFsOpName][]time.Duration{}
+	fsOps := map[ObservableFsOpName]ObservableFsOpStats{}
+	for _, op := range fsys.fsysOp {
+		s := fsOps[op.Op]
+		s.Count++
+		if op.Err != nil {
+			s.Errors++
+		}
+		fsOps[op.Op] = s
+		fsOpDur[op.Op] = append(fsOpDur[op.Op], op.Duration())
+	}
+	for k, durs := range fsOpDur {
+		fsOps[k] = fillLatency(fsOps[k], durs)
+	}
+
+	stats := ObservableFsStats{
+		FsOps:   fsOps,
+		FileOps: map[ObservableFsFileOpName]ObservableFsOpStats{},
+	}
+	fileOpDur := map[ObservableFsFileOpName][]time.Duration{}
+	for _, ops := range fsys.fileOp {
+		for _, op := range ops {
+			s := stats.FileOps[op.Op]
+			s.Count++
+			if op.Err != nil {
+				s.Errors++
+			}
+			s.Bytes += int64(op.N)
+			stats.FileOps[op.Op] = s
+			fileOpDur[op.Op] = append(fileOpDur[op.Op], op.Duration())
+
+			switch op.Op {
+			case ObservableFsFileOpNameRead, ObservableFsFileOpNameReadAt:
+				stats.BytesRead += int64(op.N)
+			case ObservableFsFileOpNameWrite, ObservableFsFileOpNameWriteAt, ObservableFsFileOpNameWriteString:
+				stats.BytesWritten += int64(op.N)
+			}
+		}
+	}
+	for k, durs := range fileOpDur {
+		stats.FileOps[k] = fillLatency(stats.FileOps[k], durs)
+	}
+
+	return stats
+}
+
+func fillLatency(s ObservableFsOpStats, durs []time.Duration) ObservableFsOpStats {
+	slices.Sort(durs)
+	for _, d := range durs {
+		s.Total += d
+	}
+	s.P50 = percentile(durs, 0.50)
+	s.P99 = percentile(durs, 0.99)
+	s.Max = durs[len(durs)-1]
+	return s
+}
+
+// percentile returns p-th percentile of sorted by the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
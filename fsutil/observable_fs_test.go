@@ -0,0 +1,56 @@
+package fsutil
+
+import (
+	"io"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestObservableFs_Stats(t *testing.T) {
+	fsys := NewObservableFs(afero.NewMemMapFs())
+
+	f, err := fsys.Create("foo")
+	assert.NilError(t, err)
+	_, err = f.Write([]byte("foobar"))
+	assert.NilError(t, err)
+	_, err = f.WriteString("baz")
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	f, err = fsys.Open("foo")
+	assert.NilError(t, err)
+	_, err = io.ReadAll(f)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	_, err = fsys.Stat("nonexistent")
+	assert.Assert(t, err != nil)
+
+	for _, op := range fsys.Observer().FsOp() {
+		assert.Assert(t, !op.Start.IsZero())
+		assert.Assert(t, !op.End.Before(op.Start))
+	}
+	for _, op := range fsys.Observer().FileOp("foo") {
+		assert.Assert(t, !op.End.Before(op.Start))
+		if op.Op == ObservableFsFileOpNameWrite {
+			assert.Equal(t, 6, op.N)
+		}
+	}
+
+	stats := fsys.Observer().Stats()
+	assert.Equal(t, int64(9), stats.BytesRead)
+	assert.Equal(t, int64(9), stats.BytesWritten)
+	assert.Equal(t, 1, stats.FsOps[ObservableFsOpNameCreate].Count)
+	assert.Equal(t, 1, stats.FsOps[ObservableFsOpNameStat].Count)
+	assert.Equal(t, 1, stats.FsOps[ObservableFsOpNameStat].Errors)
+	assert.Equal(t, 2, stats.FileOps[ObservableFsFileOpNameClose].Count)
+	assert.Equal(t, int64(6), stats.FileOps[ObservableFsFileOpNameWrite].Bytes)
+	assert.Equal(t, int64(3), stats.FileOps[ObservableFsFileOpNameWriteString].Bytes)
+
+	read := stats.FileOps[ObservableFsFileOpNameRead]
+	assert.Assert(t, read.Count >= 2) // at least one for data and one for io.EOF.
+	assert.Equal(t, int64(9), read.Bytes)
+	assert.Assert(t, read.P50 <= read.P99 && read.P99 <= read.Max && read.Max <= read.Total)
+}
@@ -0,0 +1,697 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+const (
+	// OverlayWhiteoutPrefix is prefix of marker files placed in the upper layer of OverlayFs.
+	// A file named OverlayWhiteoutPrefix + name hides name of the lower layer.
+	OverlayWhiteoutPrefix = ".wh."
+	// OverlayOpaqueMarker is a marker file placed in a directory of the upper layer of OverlayFs.
+	// A directory containing it hides all contents of the directory of the lower layer at the same path.
+	OverlayOpaqueMarker = OverlayWhiteoutPrefix + OverlayWhiteoutPrefix + ".opq"
+)
+
+var _ afero.Fs = (*OverlayFs)(nil)
+
+// OverlayFs is a copy-on-write union of upper and lower.
+//
+// OverlayFs presents contents of both layers as a single tree, where entries of upper shadow ones of lower.
+// lower is never modified; every modification is done in upper.
+// When a file or a directory only in lower is modified, it is copied up to upper first.
+// A removed entry of lower is hidden by a whiteout, an empty file named OverlayWhiteoutPrefix + name, in upper.
+// A directory re-created in place of a removed one, or moved by Rename,
+// has OverlayOpaqueMarker in it so that the contents of lower at the path are no longer visible.
+// Marker files are never listed and names starting with OverlayWhiteoutPrefix are rejected by ErrBadName.
+//
+// As is the case with fs.FS, names are treated as slash-separated paths relative to the root of both layers.
+// Leading slashes are ignored.
+type OverlayFs struct {
+	upper afero.Fs
+	lower fs.FS
+}
+
+// NewOverlayFs returns an OverlayFs which merges upper and lower.
+// upper can be an existing tree previously modified through an OverlayFs over the same lower.
+func NewOverlayFs(upper afero.Fs, lower fs.FS) *OverlayFs {
+	return &OverlayFs{
+		upper: upper,
+		lower: lower,
+	}
+}
+
+func (fsys *OverlayFs) clean(op, name string) (string, error) {
+	p := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if p == "" {
+		return ".", nil
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if strings.HasPrefix(elem, OverlayWhiteoutPrefix) {
+			return "", &fs.PathError{
+				Op:   op,
+				Path: name,
+				Err:  fmt.Errorf("%w: %q is reserved for whiteouts", ErrBadName, elem),
+			}
+		}
+	}
+	return p, nil
+}
+
+func upperName(p string) string {
+	return filepath.FromSlash(p)
+}
+
+func whiteoutName(p string) string {
+	return upperName(path.Join(path.Dir(p), OverlayWhiteoutPrefix+path.Base(p)))
+}
+
+func opaqueName(p string) string {
+	return upperName(path.Join(p, OverlayOpaqueMarker))
+}
+
+func (fsys *OverlayFs) upperExists(name string) (bool, error) {
+	_, err := fsys.upper.Stat(name)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// lowerVisible reports whether p of lower is not hidden by whiteouts, opaque directories or non-directory files in upper.
+// It does not check existence of p in lower.
+func (fsys *OverlayFs) lowerVisible(p string) (bool, error) {
+	if p == "." {
+		return true, nil
+	}
+	cur := "."
+	for _, elem := range strings.Split(p, "/") {
+		if cur != "." {
+			info, err := fsys.upper.Stat(upperName(cur))
+			if err == nil && !info.IsDir() {
+				return false, nil
+			}
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return false, err
+			}
+		}
+		if ok, err := fsys.upperExists(opaqueName(cur)); ok || err != nil {
+			return false, err
+		}
+		cur = path.Join(cur, elem)
+		if ok, err := fsys.upperExists(whiteoutName(cur)); ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// lowerStat stats p in lower if it is visible.
+func (fsys *OverlayFs) lowerStat(p string) (fs.FileInfo, error) {
+	visible, err := fsys.lowerVisible(p)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, fs.ErrNotExist
+	}
+	return fs.Stat(fsys.lower, p)
+}
+
+// stat returns info of p in merged view. inUpper reports whether p is found in upper.
+func (fsys *OverlayFs) stat(p string) (info fs.FileInfo, inUpper bool, err error) {
+	info, err = fsys.upper.Stat(upperName(p))
+	if err == nil {
+		return info, true, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, false, err
+	}
+	info, err = fsys.lowerStat(p)
+	return info, false, err
+}
+
+// copyUp copies p from lower to upper, along with its parent directories.
+// Directories are copied without their contents.
+func (fsys *OverlayFs) copyUp(p string) error {
+	if p == "." {
+		return nil
+	}
+	if ok, err := fsys.upperExists(upperName(p)); ok || err != nil {
+		return err
+	}
+
+	info, err := fsys.lowerStat(p)
+	if err != nil {
+		return err
+	}
+	if err := fsys.copyUp(path.Dir(p)); err != nil {
+		return err
+	}
+
+	name := upperName(p)
+	switch {
+	case info.IsDir():
+		if err := fsys.upper.Mkdir(name, info.Mode().Perm()); err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		if err := fsys.copyUpContent(p, info); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: copying up non regular file %s is not supported", ErrBadInput, p)
+	}
+	return fsys.upper.Chtimes(name, info.ModTime(), info.ModTime())
+}
+
+func (fsys *OverlayFs) copyUpContent(p string, info fs.FileInfo) error {
+	r, err := fsys.lower.Open(p)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	w, err := fsys.upper.OpenFile(upperName(p), os.O_CREATE|os.O_EXCL|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	closeW := once(w.Close)
+	defer func() { _ = closeW() }()
+
+	buf := getBuf()
+	defer putBuf(buf)
+	if _, err := io.CopyBuffer(w, r, *buf); err != nil {
+		return err
+	}
+	return closeW()
+}
+
+// copyUpTree copies p and all its contents up to upper.
+func (fsys *OverlayFs) copyUpTree(p string) error {
+	if err := fsys.copyUp(p); err != nil {
+		return err
+	}
+	info, err := fsys.upper.Stat(upperName(p))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return nil
+	}
+	entries, err := fsys.readDir(p)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := fsys.copyUpTree(path.Join(p, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearWhiteout removes the whiteout for p, reporting whether it has existed.
+func (fsys *OverlayFs) clearWhiteout(p string) (bool, error) {
+	err := fsys.upper.Remove(whiteoutName(p))
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// whiteout hides p of lower if it exists.
+func (fsys *OverlayFs) whiteout(p string) error {
+	if _, err := fsys.lowerStat(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := fsys.copyUp(path.Dir(p)); err != nil {
+		return err
+	}
+	return fsys.touch(whiteoutName(p))
+}
+
+func (fsys *OverlayFs) touch(name string) error {
+	f, err := fsys.upper.OpenFile(name, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// readDir returns merged entries of directory p, sorted by name.
+func (fsys *OverlayFs) readDir(p string) ([]fs.FileInfo, error) {
+	f, err := fsys.open("readdir", p)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return f.Readdir(-1)
+}
+
+func (fsys *OverlayFs) Create(name string) (afero.File, error) {
+	return fsys.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o666)
+}
+
+func (fsys *OverlayFs) Mkdir(name string, perm os.FileMode) error {
+	p, err := fsys.clean("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, _, err := fsys.stat(p); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if err := fsys.copyUpParent("mkdir", name, p); err != nil {
+		return err
+	}
+	whited, err := fsys.clearWhiteout(p)
+	if err != nil {
+		return err
+	}
+	if err := fsys.upper.Mkdir(upperName(p), perm); err != nil {
+		return err
+	}
+	if whited {
+		return fsys.touch(opaqueName(p))
+	}
+	return nil
+}
+
+// copyUpParent copies up the parent directory of p, which must exist as a directory in the merged view.
+func (fsys *OverlayFs) copyUpParent(op, name, p string) error {
+	parent := path.Dir(p)
+	info, _, err := fsys.stat(parent)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return fsys.copyUp(parent)
+}
+
+func (fsys *OverlayFs) MkdirAll(p string, perm os.FileMode) error {
+	cleaned, err := fsys.clean("mkdir", p)
+	if err != nil {
+		return err
+	}
+	if cleaned == "." {
+		return nil
+	}
+	cur := "."
+	for _, elem := range strings.Split(cleaned, "/") {
+		cur = path.Join(cur, elem)
+		info, _, err := fsys.stat(cur)
+		if err == nil {
+			if !info.IsDir() {
+				return &fs.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := fsys.Mkdir(cur, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (fsys *OverlayFs) Open(name string) (afero.File, error) {
+	p, err := fsys.clean("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return fsys.open("open", p)
+}
+
+func (fsys *OverlayFs) open(op, p string) (afero.File, error) {
+	info, inUpper, err := fsys.stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: p, Err: err}
+	}
+
+	lower := afero.FromIOFS{FS: fsys.lower}
+	if !info.IsDir() {
+		if inUpper {
+			return fsys.upper.Open(upperName(p))
+		}
+		return lower.Open(p)
+	}
+
+	dir := &overlayDir{}
+	if inUpper {
+		dir.upper, err = fsys.upper.Open(upperName(p))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if lowerInfo, err := fsys.lowerStat(p); err == nil && lowerInfo.IsDir() {
+		dir.lower, err = lower.Open(p)
+		if err != nil {
+			_ = dir.Close()
+			return nil, err
+		}
+	}
+	dir.File = dir.upper
+	if dir.File == nil {
+		dir.File = dir.lower
+	}
+	return dir, nil
+}
+
+func (fsys *OverlayFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	p, err := fsys.clean("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return fsys.open("open", p)
+	}
+
+	info, inUpper, err := fsys.stat(p)
+	switch {
+	case err == nil:
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if !inUpper {
+			if info.IsDir() || flag&os.O_TRUNC == 0 {
+				err = fsys.copyUp(p)
+			} else {
+				// Content will be truncated anyway. Skip copying.
+				err = fsys.copyUp(path.Dir(p))
+				flag |= os.O_CREATE
+				perm = info.Mode().Perm()
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	case errors.Is(err, fs.ErrNotExist):
+		if flag&os.O_CREATE == 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		if err := fsys.copyUpParent("open", name, p); err != nil {
+			return nil, err
+		}
+		if _, err := fsys.clearWhiteout(p); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	return fsys.upper.OpenFile(upperName(p), flag, perm)
+}
+
+func (fsys *OverlayFs) Remove(name string) error {
+	p, err := fsys.clean("remove", name)
+	if err != nil {
+		return err
+	}
+	info, inUpper, err := fsys.stat(p)
+	if err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+	if info.IsDir() {
+		entries, err := fsys.readDir(p)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if inUpper {
+		// RemoveAll also removes markers left in the directory.
+		if err := fsys.upper.RemoveAll(upperName(p)); err != nil {
+			return err
+		}
+	}
+	return fsys.whiteout(p)
+}
+
+func (fsys *OverlayFs) RemoveAll(name string) error {
+	p, err := fsys.clean("removeall", name)
+	if err != nil {
+		return err
+	}
+	if p == "." {
+		entries, err := fsys.readDir(p)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := fsys.RemoveAll(e.Name()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, _, err := fsys.stat(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := fsys.upper.RemoveAll(upperName(p)); err != nil {
+		return err
+	}
+	return fsys.whiteout(p)
+}
+
+// Rename renames oldname to newname.
+// If oldname is a directory only partially in upper, its whole contents are copied up before the rename.
+// Renaming onto an existing directory, or a directory onto an existing file, fails with fs.ErrExist.
+func (fsys *OverlayFs) Rename(oldname, newname string) error {
+	po, err := fsys.clean("rename", oldname)
+	if err != nil {
+		return err
+	}
+	pn, err := fsys.clean("rename", newname)
+	if err != nil {
+		return err
+	}
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: err}
+	}
+
+	info, _, err := fsys.stat(po)
+	if err != nil {
+		return linkErr(err)
+	}
+	if po == pn {
+		return nil
+	}
+	if newInfo, _, err := fsys.stat(pn); err == nil {
+		if info.IsDir() || newInfo.IsDir() {
+			return linkErr(fs.ErrExist)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	if info.IsDir() {
+		err = fsys.copyUpTree(po)
+	} else {
+		err = fsys.copyUp(po)
+	}
+	if err != nil {
+		return err
+	}
+	if err := fsys.copyUpParent("rename", newname, pn); err != nil {
+		return err
+	}
+	if _, err := fsys.clearWhiteout(pn); err != nil {
+		return err
+	}
+	if err := fsys.upper.Rename(upperName(po), upperName(pn)); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		// The directory is fully materialized in upper.
+		// Hide lower at the new location since it is no longer relevant.
+		if err := fsys.touch(opaqueName(pn)); err != nil {
+			return err
+		}
+	}
+	return fsys.whiteout(po)
+}
+
+func (fsys *OverlayFs) Stat(name string) (os.FileInfo, error) {
+	p, err := fsys.clean("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, _, err := fsys.stat(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return info, nil
+}
+
+func (fsys *OverlayFs) Name() string {
+	return "OverlayFs"
+}
+
+func (fsys *OverlayFs) copyUpForAttr(op, name string) (string, error) {
+	p, err := fsys.clean(op, name)
+	if err != nil {
+		return "", err
+	}
+	if err := fsys.copyUp(p); err != nil {
+		return "", &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return upperName(p), nil
+}
+
+func (fsys *OverlayFs) Chmod(name string, mode os.FileMode) error {
+	n, err := fsys.copyUpForAttr("chmod", name)
+	if err != nil {
+		return err
+	}
+	return fsys.upper.Chmod(n, mode)
+}
+
+func (fsys *OverlayFs) Chown(name string, uid, gid int) error {
+	n, err := fsys.copyUpForAttr("chown", name)
+	if err != nil {
+		return err
+	}
+	return fsys.upper.Chown(n, uid, gid)
+}
+
+func (fsys *OverlayFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	n, err := fsys.copyUpForAttr("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return fsys.upper.Chtimes(n, atime, mtime)
+}
+
+var _ afero.File = (*overlayDir)(nil)
+
+// overlayDir is a directory opened through OverlayFs.
+// Methods other than Close, Readdir and Readdirnames are delegated to the upper directory if any, or the lower one.
+type overlayDir struct {
+	afero.File
+	// either of upper or lower may be nil.
+	upper, lower afero.File
+
+	entries []fs.FileInfo
+	loaded  bool
+	off     int
+}
+
+func (d *overlayDir) Close() error {
+	var errs []error
+	for _, f := range []afero.File{d.upper, d.lower} {
+		if f != nil {
+			if err := f.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (d *overlayDir) load() error {
+	if d.loaded {
+		return nil
+	}
+
+	merged := map[string]fs.FileInfo{}
+	hidden := map[string]bool{}
+	opaque := false
+	if d.upper != nil {
+		infos, err := d.upper.Readdir(-1)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			name := info.Name()
+			switch {
+			case name == OverlayOpaqueMarker:
+				opaque = true
+			case strings.HasPrefix(name, OverlayWhiteoutPrefix):
+				hidden[strings.TrimPrefix(name, OverlayWhiteoutPrefix)] = true
+			default:
+				merged[name] = info
+			}
+		}
+	}
+	if d.lower != nil && !opaque {
+		infos, err := d.lower.Readdir(-1)
+		if err != nil {
+			return err
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if _, ok := merged[name]; ok || hidden[name] {
+				continue
+			}
+			merged[name] = info
+		}
+	}
+
+	d.entries = make([]fs.FileInfo, 0, len(merged))
+	for _, info := range merged {
+		d.entries = append(d.entries, info)
+	}
+	sort.Slice(d.entries, func(i, j int) bool { return d.entries[i].Name() < d.entries[j].Name() })
+	d.loaded = true
+	return nil
+}
+
+func (d *overlayDir) Readdir(count int) ([]os.FileInfo, error) {
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	rest := d.entries[d.off:]
+	if count <= 0 {
+		d.off = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.off += count
+	return rest[:count], nil
+}
+
+func (d *overlayDir) Readdirnames(n int) ([]string, error) {
+	infos, err := d.Readdir(n)
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+	}
+	return names, err
+}
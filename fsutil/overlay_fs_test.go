@@ -0,0 +1,187 @@
+package fsutil
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"syscall"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func newOverlayTestLower() fstest.MapFS {
+	return fstest.MapFS{
+		"foo":         &fstest.MapFile{Data: []byte("foo"), Mode: 0o644},
+		"dir/bar":     &fstest.MapFile{Data: []byte("bar"), Mode: 0o644},
+		"dir/baz":     &fstest.MapFile{Data: []byte("baz"), Mode: 0o600},
+		"dir/sub/qux": &fstest.MapFile{Data: []byte("qux"), Mode: 0o644},
+		"empty":       &fstest.MapFile{Mode: fs.ModeDir | 0o755},
+	}
+}
+
+func readOverlayTree(t *testing.T, fsys afero.Fs) map[string]string {
+	t.Helper()
+	tree := map[string]string{}
+	err := afero.Walk(fsys, ".", func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if info.IsDir() {
+			tree[p] = "<dir>"
+			return nil
+		}
+		bin, err := afero.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		tree[p] = string(bin)
+		return nil
+	})
+	assert.NilError(t, err)
+	return tree
+}
+
+func TestOverlayFs(t *testing.T) {
+	lower := newOverlayTestLower()
+	upper := afero.NewMemMapFs()
+	fsys := NewOverlayFs(upper, lower)
+
+	assert.DeepEqual(
+		t,
+		map[string]string{
+			"foo":         "foo",
+			"dir":         "<dir>",
+			"dir/bar":     "bar",
+			"dir/baz":     "baz",
+			"dir/sub":     "<dir>",
+			"dir/sub/qux": "qux",
+			"empty":       "<dir>",
+		},
+		readOverlayTree(t, fsys),
+	)
+
+	// write to lower file copies it up.
+	f, err := fsys.OpenFile("dir/bar", os.O_WRONLY|os.O_APPEND, 0)
+	assert.NilError(t, err)
+	_, err = f.Write([]byte("bar"))
+	assert.NilError(t, err)
+	assert.NilError(t, f.Close())
+
+	// truncation does not need contents
+	assert.NilError(t, afero.WriteFile(fsys, "dir/baz", []byte("new"), fs.ModePerm))
+	info, err := fsys.Stat("dir/baz")
+	assert.NilError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), info.Mode().Perm())
+
+	assert.NilError(t, afero.WriteFile(fsys, "/dir/sub/new", []byte("new"), fs.ModePerm))
+	assert.NilError(t, fsys.Remove("foo"))
+	assert.NilError(t, fsys.RemoveAll("empty"))
+	assert.NilError(t, fsys.Chmod("dir/sub/qux", 0o600))
+
+	_, err = fsys.Stat("foo")
+	assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+
+	assert.DeepEqual(
+		t,
+		map[string]string{
+			"dir":         "<dir>",
+			"dir/bar":     "barbar",
+			"dir/baz":     "new",
+			"dir/sub":     "<dir>",
+			"dir/sub/new": "new",
+			"dir/sub/qux": "qux",
+		},
+		readOverlayTree(t, fsys),
+	)
+	// lower is intact.
+	assert.DeepEqual(t, newOverlayTestLower(), lower)
+
+	// changes are persisted in upper.
+	fsys = NewOverlayFs(upper, lower)
+	assert.DeepEqual(
+		t,
+		[]string{"dir", "dir/bar", "dir/baz", "dir/sub", "dir/sub/new", "dir/sub/qux"},
+		sortedKeys(readOverlayTree(t, fsys)),
+	)
+
+	// re-creation of a removed file does not resurrect lower contents.
+	_, err = fsys.Stat("foo")
+	assert.Assert(t, errors.Is(err, fs.ErrNotExist))
+	assert.NilError(t, afero.WriteFile(fsys, "foo", []byte("recreated"), fs.ModePerm))
+	bin, err := afero.ReadFile(fsys, "foo")
+	assert.NilError(t, err)
+	assert.Equal(t, "recreated", string(bin))
+
+	err = fsys.Remove("dir")
+	assert.Assert(t, errors.Is(err, syscall.ENOTEMPTY))
+
+	_, err = fsys.Create(".wh.foo")
+	assert.Assert(t, errors.Is(err, ErrBadName))
+}
+
+func TestOverlayFs_directories(t *testing.T) {
+	lower := newOverlayTestLower()
+	fsys := NewOverlayFs(afero.NewMemMapFs(), lower)
+
+	// re-created directory is opaque.
+	assert.NilError(t, fsys.RemoveAll("dir"))
+	assert.NilError(t, fsys.MkdirAll("dir/sub", fs.ModePerm))
+	assert.DeepEqual(
+		t,
+		map[string]string{"foo": "foo", "dir": "<dir>", "dir/sub": "<dir>", "empty": "<dir>"},
+		readOverlayTree(t, fsys),
+	)
+
+	err := fsys.Mkdir("foo", fs.ModePerm)
+	assert.Assert(t, errors.Is(err, fs.ErrExist))
+
+	fsys = NewOverlayFs(afero.NewMemMapFs(), lower)
+	assert.NilError(t, fsys.Rename("dir", "moved"))
+	assert.NilError(t, fsys.Rename("foo", "moved/foo"))
+	assert.DeepEqual(
+		t,
+		map[string]string{
+			"empty":         "<dir>",
+			"moved":         "<dir>",
+			"moved/bar":     "bar",
+			"moved/baz":     "baz",
+			"moved/foo":     "foo",
+			"moved/sub":     "<dir>",
+			"moved/sub/qux": "qux",
+		},
+		readOverlayTree(t, fsys),
+	)
+
+	err = fsys.Rename("empty", "moved")
+	assert.Assert(t, errors.Is(err, fs.ErrExist))
+
+	f, err := fsys.Open("moved")
+	assert.NilError(t, err)
+	defer func() { _ = f.Close() }()
+	names, err := f.Readdirnames(2)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"bar", "baz"}, names)
+	names, err = f.Readdirnames(2)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"foo", "sub"}, names)
+	_, err = f.Readdirnames(2)
+	assert.Assert(t, cmp.ErrorIs(err, io.EOF))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,67 @@
+package fsutil
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// RandomNameGenerator generates a string which replaces '*' in patterns passed to OpenFileRandom and MkdirRandom.
+// It must be safe for concurrent use and must not return a string containing path separators.
+type RandomNameGenerator func() (string, error)
+
+// RandomNameUint32 returns a generator which formats a uint32 from math/rand as zero-padded 10 digits.
+// This is the default generator.
+//
+// It has only 32 bits of randomness, so under heavy parallel use it collides often and the caller may waste retries.
+func RandomNameUint32() RandomNameGenerator {
+	return func() (string, error) {
+		return randomUint32Padded(), nil
+	}
+}
+
+// RandomNameCryptoHex returns a generator which reads n bytes from crypto/rand and hex-encodes them.
+// If n is zero or negative, 16 is used.
+func RandomNameCryptoHex(n int) RandomNameGenerator {
+	if n <= 0 {
+		n = 16
+	}
+	return func() (string, error) {
+		b := make([]byte, n)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("crypto/rand: %w", err)
+		}
+		return hex.EncodeToString(b), nil
+	}
+}
+
+const crockfordBase32 = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// RandomNameULID returns a generator for ULIDs, 26 characters of Crockford's base32
+// encoding a 48 bit millisecond timestamp followed by 80 bits from crypto/rand.
+// Names generated by it are lexically sorted by creation time at millisecond precision.
+func RandomNameULID() RandomNameGenerator {
+	return func() (string, error) {
+		var b [16]byte
+		binary.BigEndian.PutUint64(b[:8], uint64(time.Now().UnixMilli())<<16)
+		if _, err := rand.Read(b[6:]); err != nil {
+			return "", fmt.Errorf("crypto/rand: %w", err)
+		}
+		return encodeULID(b), nil
+	}
+}
+
+func encodeULID(b [16]byte) string {
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	var out [26]byte
+	// 128 bits are encoded as 130 bits, the first character holds top 3 bits.
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordBase32[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
@@ -0,0 +1,81 @@
+package fsutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestRandomNameGenerator(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		gen     RandomNameGenerator
+		pattern *regexp.Regexp
+	}{
+		{"uint32", RandomNameUint32(), regexp.MustCompile(`^[0-9]{10}$`)},
+		{"crypto hex default", RandomNameCryptoHex(0), regexp.MustCompile(`^[0-9a-f]{32}$`)},
+		{"crypto hex", RandomNameCryptoHex(4), regexp.MustCompile(`^[0-9a-f]{8}$`)},
+		{"ulid", RandomNameULID(), regexp.MustCompile(`^[0-7][0-9A-HJKMNP-TV-Z]{25}$`)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			seen := map[string]bool{}
+			for i := 0; i < 100; i++ {
+				s, err := tc.gen()
+				assert.NilError(t, err)
+				assert.Assert(t, tc.pattern.MatchString(s), "generated = %q", s)
+				seen[s] = true
+			}
+			if tc.name != "uint32" {
+				assert.Equal(t, 100, len(seen))
+			}
+		})
+	}
+}
+
+func TestEncodeULID(t *testing.T) {
+	assert.Equal(t, "00000000000000000000000000", encodeULID([16]byte{}))
+	var ff [16]byte
+	copy(ff[:], bytes.Repeat([]byte{0xff}, 16))
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeULID(ff))
+
+	// the timestamp part comes first.
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli())<<16)
+	assert.Equal(t, "01DXF6DT00", encodeULID(b)[:10])
+}
+
+func TestOpenFileRandomWithGenerator(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+
+	f, err := OpenFileRandomWithGenerator(fsys, "/dir", "foo-*.tmp", fs.ModePerm, RandomNameULID())
+	assert.NilError(t, err)
+	_ = f.Close()
+	assert.Assert(t, regexp.MustCompile(`^foo-[0-9A-Z]{26}\.tmp$`).MatchString(filepath.Base(f.Name())), f.Name())
+
+	constant := func() (string, error) { return "same", nil }
+	f, err = MkdirRandomWithGenerator(fsys, "/dir", "bar-*", fs.ModePerm, constant)
+	assert.NilError(t, err)
+	_ = f.Close()
+	_, err = MkdirRandomWithGenerator(fsys, "/dir", "bar-*", fs.ModePerm, constant)
+	assert.ErrorIs(t, err, ErrMaxRetry)
+
+	_, err = OpenFileRandomWithGenerator(fsys, "/dir", "*", fs.ModePerm, func() (string, error) { return "a/b", nil })
+	assert.ErrorIs(t, err, ErrBadName)
+
+	opt := NewSafeWriteOption(WithRandomNameGenerator(RandomNameCryptoHex(8)), WithDisableRemoveOnErr(true))
+	err = opt.SafeWrite(fsys, "/dir/baz", fs.ModePerm, strings.NewReader("baz"), func(afero.Fs, string, string, afero.File) error {
+		return fs.ErrInvalid
+	})
+	var swErr *SafeWriteError
+	assert.Assert(t, errors.As(err, &swErr))
+	assert.Assert(t, regexp.MustCompile(`^baz-[0-9a-f]{16}\.tmp$`).MatchString(filepath.Base(swErr.TmpPath)), swErr.TmpPath)
+}
@@ -1,7 +1,8 @@
 package fsutil
 
 import (
-	"bytes"
+	"context"
+	"crypto"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -12,10 +13,12 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/ngicks/musicbox/stream"
 	"github.com/spf13/afero"
 )
 
@@ -153,6 +156,16 @@ func WithRandomPattern(randomPattern string) (SafeWriteOptionOption, error) {
 	}, nil
 }
 
+// WithRandomNameGenerator sets a generator for the random part of temporary file names.
+// If gen is nil, RandomNameUint32 is used.
+//
+// Consider RandomNameCryptoHex or RandomNameULID if many SafeWrite calls run in parallel in a same directory.
+func WithRandomNameGenerator(gen RandomNameGenerator) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.randomName = gen
+	}
+}
+
 func WithOwner(uid, gid int) SafeWriteOptionOption {
 	return func(o *SafeWriteOption) {
 		o.uid = uid
@@ -161,15 +174,39 @@ func WithOwner(uid, gid int) SafeWriteOptionOption {
 }
 
 func WithDefaultPreProcesses(defaultPreProcess []SafeWritePreProcess) SafeWriteOptionOption {
-	copied := make([]SafeWritePreProcess, len(defaultPreProcess))
-	copy(copied, defaultPreProcess)
+	copied := make([]SafeWritePreProcessCtx, len(defaultPreProcess))
+	for i, pp := range defaultPreProcess {
+		copied[i] = PreProcessCtx(pp)
+	}
 	return func(o *SafeWriteOption) {
 		o.defaultPreProcess = copied
 	}
 }
 
 func WithDefaultPostProcesses(defaultPostProcesses []SafeWritePostProcess) SafeWriteOptionOption {
-	copied := make([]SafeWritePostProcess, len(defaultPostProcesses))
+	copied := make([]SafeWritePostProcessCtx, len(defaultPostProcesses))
+	for i, pp := range defaultPostProcesses {
+		copied[i] = PostProcessCtx(pp)
+	}
+	return func(o *SafeWriteOption) {
+		o.defaultPostProcesses = copied
+	}
+}
+
+// WithDefaultPreProcessesCtx is same as WithDefaultPreProcesses but takes context-aware pre-processes.
+// It replaces pre-processes set by WithDefaultPreProcesses and vice versa.
+func WithDefaultPreProcessesCtx(defaultPreProcess []SafeWritePreProcessCtx) SafeWriteOptionOption {
+	copied := make([]SafeWritePreProcessCtx, len(defaultPreProcess))
+	copy(copied, defaultPreProcess)
+	return func(o *SafeWriteOption) {
+		o.defaultPreProcess = copied
+	}
+}
+
+// WithDefaultPostProcessesCtx is same as WithDefaultPostProcesses but takes context-aware post-processes.
+// It replaces post-processes set by WithDefaultPostProcesses and vice versa.
+func WithDefaultPostProcessesCtx(defaultPostProcesses []SafeWritePostProcessCtx) SafeWriteOptionOption {
+	copied := make([]SafeWritePostProcessCtx, len(defaultPostProcesses))
 	copy(copied, defaultPostProcesses)
 	return func(o *SafeWriteOption) {
 		o.defaultPostProcesses = copied
@@ -182,6 +219,84 @@ func WithDisableSync(disableSync bool) SafeWriteOptionOption {
 	}
 }
 
+// WithMergeExisting makes SafeWriteFs merge the written temporary directory into the destination
+// if the destination already exists as a directory.
+// Instead of a single rename of the directory, each file and directory are renamed separately
+// and conflicting files are handled as configured by WithMergeConflictPolicy.
+// This has no effect on SafeWrite.
+func WithMergeExisting(mergeExisting bool) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.mergeExisting = mergeExisting
+	}
+}
+
+func WithMergeConflictPolicy(policy MergeConflictPolicy) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.mergeConflictPolicy = policy
+	}
+}
+
+// WithPreflightSpaceCheck makes SafeWrite and SafeWriteFs check available space of
+// the temporary directory before creating temporary files.
+// If less than minFree plus the size hint (see WithSizeHint) is available, they fail with ErrInsufficientSpace.
+//
+// The check is skipped if the space checker reports errors.ErrUnsupported.
+// See AvailableSpace for the default behavior and WithSpaceChecker to replace it.
+func WithPreflightSpaceCheck(minFree uint64) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.preflightSpaceCheck = true
+		o.minFree = minFree
+	}
+}
+
+// WithSizeHint sets expected size of the content to be written.
+// Since size differs among calls, it is meant to be applied through Apply.
+//
+//	opt.Apply(WithSizeHint(uint64(size))).SafeWrite(fsys, path, perm, r)
+func WithSizeHint(sizeHint uint64) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.sizeHint = sizeHint
+	}
+}
+
+func WithSpaceChecker(checker SpaceChecker) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.spaceChecker = checker
+	}
+}
+
+// WithSkipIfUnchanged makes SafeWrite compare the temporary file against the existing destination right before rename.
+// If they have same size and content, SafeWrite removes the temporary file instead of renaming it,
+// leaving the destination untouched, including its modification time, mode bits and owner.
+// SafeWriteReport reports it as SafeWriteResult.Unchanged.
+// This has no effect on SafeWriteFs.
+func WithSkipIfUnchanged(skipIfUnchanged bool) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.skipIfUnchanged = skipIfUnchanged
+	}
+}
+
+// WithChecksumSidecar makes SafeWrite write a checksum sidecar file next to the destination.
+// The sidecar is named dstName + suffix and has a line formatted as sha256sum and similar commands do,
+// i.e. "<hex digest>  <base name of destination>\n".
+// If suffix is empty, it is derived from algo, e.g. ".sha256" for crypto.SHA256.
+//
+// In the commit step, the digest is computed by reading back the temporary file,
+// and the sidecar is written to a temporary file in the directory of the destination,
+// which is renamed right after the destination is renamed.
+// If anything fails before the destination is renamed, neither the destination nor the sidecar are changed.
+// If renaming the sidecar fails, the old sidecar, if any, is removed so that no sidecar contradicts the destination,
+// and the error is returned.
+// Readers may still observe the new destination with the old sidecar between the two renames.
+//
+// algo must be linked into the binary, e.g. by importing crypto/sha256, otherwise SafeWrite fails with ErrBadInput.
+// This has no effect on SafeWriteFs.
+func WithChecksumSidecar(algo crypto.Hash, suffix string) SafeWriteOptionOption {
+	return func(o *SafeWriteOption) {
+		o.checksumSidecar = &checksumSidecar{algo: algo, suffix: suffix}
+	}
+}
+
 // PreProcessSeek seeks given files to offset from whence.
 func PreProcessSeek(offset int64, whence int) SafeWritePreProcess {
 	return func(_ afero.Fs, _, _ string, file afero.File) error {
@@ -219,29 +334,144 @@ func PostProcessClose(r io.Closer) SafeWritePostProcess {
 
 // TeeHasher creates a reader reading from r and tee-ing data to h.
 // validator can be passed to SafeWrite to so that it can prevent corrupted files from appearing final destination.
-// validator returns ErrHashSumMismatch on mismatching hashes.
+// Both of piped, at EOF, and validator return *stream.HashSumMismatchError, wrapping ErrHashSumMismatch, on mismatching hashes.
 func TeeHasher(r io.Reader, h hash.Hash, expected []byte) (piped io.Reader, validator SafeWritePostProcess) {
-	piped = io.TeeReader(r, h)
+	piped = stream.NewVerifiedReader(r, h, expected)
 	validator = PostProcessValidateCheckSum(h, expected)
 	return
 }
 
 func PostProcessValidateCheckSum(h hash.Hash, expected []byte) SafeWritePostProcess {
 	return func(_ afero.Fs, _, _ string, _ afero.File) error {
-		actual := h.Sum(nil)
-		if bytes.Equal(expected, actual) {
-			return nil
+		return stream.CompareHashSum(h, expected)
+	}
+}
+
+// checksumSidecar is set by WithChecksumSidecar.
+type checksumSidecar struct {
+	algo   crypto.Hash
+	suffix string
+}
+
+// wrapCommit returns commit which also writes the sidecar as described in WithChecksumSidecar.
+func (c checksumSidecar) wrapCommit(commit func(fsys afero.Fs, tmpName, dstName string) error) func(fsys afero.Fs, tmpName, dstName string) error {
+	return func(fsys afero.Fs, tmpName, dstName string) error {
+		if !c.algo.Available() {
+			return fmt.Errorf("%w: hash function %s is not available", ErrBadInput, c.algo)
 		}
-		return fmt.Errorf(
-			"%w: expected = %s, actual = %s",
-			ErrHashSumMismatch, hex.EncodeToString(expected), hex.EncodeToString(actual),
-		)
+		suffix := c.suffix
+		if suffix == "" {
+			suffix = "." + strings.ToLower(strings.ReplaceAll(c.algo.String(), "-", ""))
+		}
+
+		digest, err := hashFile(fsys, tmpName, c.algo.New())
+		if err != nil {
+			return fmt.Errorf("checksum: %w", err)
+		}
+
+		sidecar := dstName + suffix
+		f, err := OpenFileRandom(fsys, filepath.FromSlash(path.Dir(sidecar)), path.Base(sidecar)+".*.tmp", 0o644)
+		if err != nil {
+			return fmt.Errorf("writing checksum file: %w", err)
+		}
+		tmpSidecar := f.Name()
+		err = func() error {
+			defer func() { _ = f.Close() }()
+			_, err := f.WriteString(hex.EncodeToString(digest) + "  " + path.Base(dstName) + "\n")
+			if err != nil {
+				return err
+			}
+			if err := f.Sync(); err != nil {
+				return err
+			}
+			return f.Close()
+		}()
+		if err != nil {
+			_ = fsys.Remove(tmpSidecar)
+			return fmt.Errorf("writing checksum file: %w", err)
+		}
+
+		if err := commit(fsys, tmpName, dstName); err != nil {
+			_ = fsys.Remove(tmpSidecar)
+			return err
+		}
+
+		if err := fsys.Rename(tmpSidecar, filepath.FromSlash(sidecar)); err != nil {
+			_ = fsys.Remove(tmpSidecar)
+			_ = fsys.Remove(filepath.FromSlash(sidecar))
+			return fmt.Errorf("renaming checksum file: %w", err)
+		}
+		return nil
 	}
 }
 
+func hashFile(fsys afero.Fs, name string, h hash.Hash) ([]byte, error) {
+	f, err := fsys.Open(filepath.FromSlash(name))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	s, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !s.Mode().IsRegular() {
+		return nil, fmt.Errorf("%w: checksum of non regular file is not supported, name = %s", ErrBadInput, filepath.FromSlash(name))
+	}
+
+	buf := getBuf()
+	defer putBuf(buf)
+	if _, err := io.CopyBuffer(h, f, *buf); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+type MergeConflictPolicy string
+
+const (
+	// MergeConflictPolicyError fails merging with ErrMergeConflict before any rename
+	// if a file exists in both of the temporary directory and the destination.
+	MergeConflictPolicyError MergeConflictPolicy = "" // default
+	// MergeConflictPolicyNewestWins keeps whichever has later or equal modification time.
+	// Conflicts between a directory and a non-directory are still reported as ErrMergeConflict.
+	MergeConflictPolicyNewestWins MergeConflictPolicy = "newest_wins"
+)
+
 type SafeWritePreProcess func(fsys afero.Fs, tmpName, dstName string, file afero.File) error
 type SafeWritePostProcess func(fsys afero.Fs, tmpName, dstName string, file afero.File) error
 
+// SafeWritePreProcessCtx is a context-aware SafeWritePreProcess.
+// ctx is the one passed to SafeWriteCtx or SafeWriteFsCtx.
+type SafeWritePreProcessCtx func(ctx context.Context, fsys afero.Fs, tmpName, dstName string, file afero.File) error
+
+// SafeWritePostProcessCtx is a context-aware SafeWritePostProcess.
+// ctx is the one passed to SafeWriteCtx or SafeWriteFsCtx.
+type SafeWritePostProcessCtx func(ctx context.Context, fsys afero.Fs, tmpName, dstName string, file afero.File) error
+
+// PreProcessCtx converts pp into SafeWritePreProcessCtx which ignores ctx.
+func PreProcessCtx(pp SafeWritePreProcess) SafeWritePreProcessCtx {
+	return func(_ context.Context, fsys afero.Fs, tmpName, dstName string, file afero.File) error {
+		return pp(fsys, tmpName, dstName, file)
+	}
+}
+
+// PostProcessCtx converts pp into SafeWritePostProcessCtx which ignores ctx.
+func PostProcessCtx(pp SafeWritePostProcess) SafeWritePostProcessCtx {
+	return func(_ context.Context, fsys afero.Fs, tmpName, dstName string, file afero.File) error {
+		return pp(fsys, tmpName, dstName, file)
+	}
+}
+
+func postProcessesCtx(postProcesses []SafeWritePostProcess) []SafeWritePostProcessCtx {
+	converted := make([]SafeWritePostProcessCtx, len(postProcesses))
+	for i, pp := range postProcesses {
+		converted[i] = PostProcessCtx(pp)
+	}
+	return converted
+}
+
 // Should it use builder pattern?
 
 // SafeWriteOption holds options for safe-write.
@@ -262,11 +492,22 @@ type SafeWriteOption struct {
 
 	// If non negative number, SafeWrite performs Chown after each file creation.
 	uid, gid          int
-	defaultPreProcess []SafeWritePreProcess
+	defaultPreProcess []SafeWritePreProcessCtx
 	// validators which would be executed after validators passed to SafeWrite is done successfully.
-	defaultPostProcesses []SafeWritePostProcess
+	defaultPostProcesses []SafeWritePostProcessCtx
 	// If true, SafeWrite does not perform sync
 	disableSync bool
+	// If true, SafeWriteFs merges the temporary directory into the existing destination.
+	mergeExisting       bool
+	mergeConflictPolicy MergeConflictPolicy
+	// If true, SafeWrite checks available space before creating temporary files.
+	preflightSpaceCheck bool
+	minFree, sizeHint   uint64
+	spaceChecker        SpaceChecker
+	// If true, SafeWrite leaves the destination untouched if it has same content.
+	skipIfUnchanged bool
+	// If non nil, SafeWrite writes a checksum sidecar file in the commit step.
+	checksumSidecar *checksumSidecar
 }
 
 // NewSafeWriteOption returns a newly allocated SafeWriteOption.
@@ -307,6 +548,8 @@ type tmpFileOption struct {
 	// The Last '*' in randomPattern will be replaced with randomly generated string.
 	// If it does not have a single '*', one is appended to the pattern.
 	randomPattern string
+	// randomName generates the string replacing '*'. nil means the default.
+	randomName RandomNameGenerator
 }
 
 // tempDir returns o.tmpDirName if non empty,
@@ -372,7 +615,7 @@ func (o tmpFileOption) open(
 	fsys afero.Fs,
 	p string,
 	perm fs.FileMode,
-	openRandom func(fsys afero.Fs, dir string, pattern string, perm fs.FileMode) (afero.File, error),
+	openRandom func(fsys afero.Fs, dir string, pattern string, perm fs.FileMode, gen RandomNameGenerator) (afero.File, error),
 	openFile func(name string, flag int, perm fs.FileMode) (afero.File, error),
 ) (f afero.File, tmpFilename string, err error) {
 	tmpDir := o.tempDir(p)
@@ -394,6 +637,7 @@ func (o tmpFileOption) open(
 			filepath.FromSlash(tmpDir),
 			openName,
 			perm.Perm(),
+			o.randomName,
 		)
 	} else {
 		openName = o.prefix + name + o.suffixOrDefault()
@@ -414,7 +658,7 @@ func (o tmpFileOption) open(
 }
 
 func (o tmpFileOption) openTmp(fsys afero.Fs, path string, perm fs.FileMode) (f afero.File, tmpFilename string, err error) {
-	return o.open(fsys, path, perm, OpenFileRandom, fsys.OpenFile)
+	return o.open(fsys, path, perm, OpenFileRandomWithGenerator, fsys.OpenFile)
 }
 
 func (o tmpFileOption) openTmpDir(fsys afero.Fs, path string, perm fs.FileMode) (f afero.File, tmpFilename string, err error) {
@@ -422,7 +666,7 @@ func (o tmpFileOption) openTmpDir(fsys afero.Fs, path string, perm fs.FileMode)
 		fsys,
 		path,
 		perm,
-		MkdirRandom,
+		MkdirRandomWithGenerator,
 		func(name string, flag int, perm fs.FileMode) (afero.File, error) {
 			name = filepath.FromSlash(name)
 			err := fsys.Mkdir(name, perm|0o300) // writable and executable, since we are creating files under.
@@ -451,29 +695,55 @@ func (o SafeWriteOption) CleanTmp(fsys afero.Fs) error {
 }
 
 func (o SafeWriteOption) safeWrite(
+	ctx context.Context,
 	fsys afero.Fs,
 	dstName string,
 	perm fs.FileMode,
 	openTmp func(fsys afero.Fs, path string, perm fs.FileMode) (f afero.File, tmpFilename string, err error),
 	copyTo func(dst afero.File, tmpFilename string) error,
-	postProcesses ...SafeWritePostProcess,
+	commit func(fsys afero.Fs, tmpName, dstName string) error,
+	postProcesses ...SafeWritePostProcessCtx,
 ) (err error) {
 	// internal paths are always slash-separated
 	// filepath.FromSlash is called right before calling afero methods.
 	dstName = normalizePath(dstName)
 
+	var tmpName string
+	wrapErr := func(stage SafeWriteStage, err error) error {
+		e := &SafeWriteError{Stage: stage, DstPath: filepath.FromSlash(dstName), Err: err}
+		if tmpName != "" {
+			e.TmpPath = filepath.FromSlash(tmpName)
+		}
+		return e
+	}
+
+	if err := ctx.Err(); err != nil {
+		return wrapErr(SafeWriteStageMkdir, err)
+	}
+
 	if !o.disableMkdir {
 		err = mkdirAll(fsys, o.tempDir(dstName), fs.ModePerm)
 		// We do not call chmod for dirs since
 		// it can be invoked by the caller anytime if they wish to.
 		if err != nil {
-			return fmt.Errorf("SafeWrite, mkdirAll: %w", err)
+			return wrapErr(SafeWriteStageMkdir, err)
 		}
 	}
 
+	if o.preflightSpaceCheck {
+		err = o.checkSpace(fsys, o.tempDir(dstName))
+		if err != nil {
+			return wrapErr(SafeWriteStagePreflight, err)
+		}
+	}
+
+	if err = ctx.Err(); err != nil {
+		return wrapErr(SafeWriteStageOpen, err)
+	}
+
 	f, tmpName, err := openTmp(fsys, dstName, perm.Perm())
 	if err != nil {
-		return fmt.Errorf("SafeWrite, %w", err)
+		return wrapErr(SafeWriteStageOpen, err)
 	}
 
 	// Multiple calls for Close is documented as undefined.
@@ -496,21 +766,24 @@ func (o SafeWriteOption) safeWrite(
 	}()
 
 	for _, pp := range o.defaultPreProcess {
-		err = pp(fsys, tmpName, dstName, f)
+		err = pp(ctx, fsys, tmpName, dstName, f)
 		if err != nil {
-			return fmt.Errorf("SafeWrite, preprocess: %w", err)
+			return wrapErr(SafeWriteStagePreProcess, err)
 		}
 	}
 
 	err = copyTo(f, tmpName)
+	if err == nil {
+		err = ctx.Err()
+	}
 	if err != nil {
-		return fmt.Errorf("SafeWrite, copy: %w", err)
+		return wrapErr(SafeWriteStageCopy, err)
 	}
 
 	if o.forcePerm {
 		err = fsys.Chmod(filepath.FromSlash(tmpName), perm.Perm()|0o300)
 		if err != nil {
-			return fmt.Errorf("SafeWrite, chmod: %w", err)
+			return wrapErr(SafeWriteStageChmod, err)
 		}
 	}
 
@@ -521,50 +794,144 @@ func (o SafeWriteOption) safeWrite(
 		}
 		err = fsys.Chown(tmpName, uid, gid)
 		if err != nil {
-			return fmt.Errorf("SafeWrite, chown: %w", err)
+			return wrapErr(SafeWriteStageChown, err)
 		}
 	}
 
 	for _, pp := range postProcesses {
-		err = pp(fsys, tmpName, dstName, f)
+		err = pp(ctx, fsys, tmpName, dstName, f)
 		if err != nil {
-			return fmt.Errorf("SafeWrite, postprocess: %w", err)
+			return wrapErr(SafeWriteStagePostProcess, err)
 		}
 	}
 	for _, pp := range o.defaultPostProcesses {
-		err = pp(fsys, tmpName, dstName, f)
+		err = pp(ctx, fsys, tmpName, dstName, f)
 		if err != nil {
-			return fmt.Errorf("SafeWrite, postprocess: %w", err)
+			return wrapErr(SafeWriteStagePostProcess, err)
 		}
 	}
 
 	if !o.disableSync {
 		err = f.Sync()
 		if err != nil {
-			return fmt.Errorf("SafeWrite, sync: %w", err)
+			return wrapErr(SafeWriteStageSync, err)
 		}
 	}
 
+	// The last chance to abort. After this point, the destination is changed.
+	if err = ctx.Err(); err != nil {
+		return wrapErr(SafeWriteStageCommit, err)
+	}
+
 	err = closeOnce()
 	if err != nil {
-		return fmt.Errorf("SafeWrite, close: %w", err)
+		return wrapErr(SafeWriteStageClose, err)
 	}
 
 	if !o.disableMkdir {
 		err = mkdirAll(fsys, filepath.Dir(dstName), fs.ModePerm)
 		if err != nil {
-			return fmt.Errorf("SafeWrite, mkdirAll: %w", err)
+			return wrapErr(SafeWriteStageMkdir, err)
 		}
 	}
 
-	err = fsys.Rename(filepath.FromSlash(tmpName), filepath.FromSlash(dstName))
+	err = commit(fsys, tmpName, dstName)
 	if err != nil {
-		return fmt.Errorf("SafeWrite, rename: %w", err)
+		return wrapErr(SafeWriteStageCommit, err)
 	}
 
 	return nil
 }
 
+func rename(fsys afero.Fs, tmpName, dstName string) error {
+	err := fsys.Rename(filepath.FromSlash(tmpName), filepath.FromSlash(dstName))
+	if err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+func (o SafeWriteOption) renameOrMerge(fsys afero.Fs, tmpName, dstName string) error {
+	if !o.mergeExisting {
+		return rename(fsys, tmpName, dstName)
+	}
+	s, err := fsys.Stat(filepath.FromSlash(dstName))
+	if err != nil || !s.IsDir() {
+		return rename(fsys, tmpName, dstName)
+	}
+	err = mergeDir(fsys, tmpName, dstName, o.mergeConflictPolicy)
+	if err != nil {
+		return fmt.Errorf("merge: %w", err)
+	}
+	return nil
+}
+
+// mergeDir moves contents of src into dst.
+// Conflicts are all checked before any rename
+// but the move as a whole is not atomic.
+func mergeDir(fsys afero.Fs, src, dst string, policy MergeConflictPolicy) error {
+	type move struct {
+		from, to string
+	}
+	var moves []move
+
+	err := fs.WalkDir(afero.NewIOFS(fsys), src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == src {
+			return nil
+		}
+
+		target := path.Join(dst, strings.TrimPrefix(p, src+"/"))
+		dstInfo, err := fsys.Stat(filepath.FromSlash(target))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+			moves = append(moves, move{p, target})
+			if d.IsDir() {
+				// moving whole directory.
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case d.IsDir() && dstInfo.IsDir():
+			return nil
+		case d.IsDir() || dstInfo.IsDir():
+			return fmt.Errorf("%w: file type mismatch, path = %s", ErrMergeConflict, filepath.FromSlash(target))
+		}
+
+		switch policy {
+		default: // MergeConflictPolicyError
+			return fmt.Errorf("%w: already exists, path = %s", ErrMergeConflict, filepath.FromSlash(target))
+		case MergeConflictPolicyNewestWins:
+			srcInfo, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if !srcInfo.ModTime().Before(dstInfo.ModTime()) {
+				moves = append(moves, move{p, target})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range moves {
+		err := fsys.Rename(filepath.FromSlash(m.from), filepath.FromSlash(m.to))
+		if err != nil {
+			return err
+		}
+	}
+
+	return fsys.RemoveAll(filepath.FromSlash(src))
+}
+
 // SafeWrite writes the content of r to path under fsys safely.
 //
 // SafeWrite first creates a temporal directory and a temporal file there.
@@ -581,19 +948,94 @@ func (o SafeWriteOption) SafeWrite(
 	r io.Reader,
 	postProcesses ...SafeWritePostProcess,
 ) (err error) {
-	return o.safeWrite(
+	_, err = o.SafeWriteReport(fsys, path, perm, r, postProcesses...)
+	return err
+}
+
+// SafeWriteCtx is same as SafeWrite but takes ctx and context-aware post-processes.
+//
+// ctx is checked between each step and reading from r is stopped once ctx is cancelled.
+// If ctx is cancelled before the temporary file is renamed to path, path is left untouched
+// and the returned error wraps ctx.Err().
+func (o SafeWriteOption) SafeWriteCtx(
+	ctx context.Context,
+	fsys afero.Fs,
+	path string,
+	perm fs.FileMode,
+	r io.Reader,
+	postProcesses ...SafeWritePostProcessCtx,
+) (err error) {
+	_, err = o.safeWriteReport(ctx, fsys, path, perm, r, postProcesses...)
+	return err
+}
+
+// SafeWriteResult reports what SafeWriteReport has done.
+type SafeWriteResult struct {
+	// Unchanged is true if the destination is left untouched because it already has same content.
+	// See WithSkipIfUnchanged.
+	Unchanged bool
+}
+
+// SafeWriteReport is same as SafeWrite but also returns SafeWriteResult.
+func (o SafeWriteOption) SafeWriteReport(
+	fsys afero.Fs,
+	path string,
+	perm fs.FileMode,
+	r io.Reader,
+	postProcesses ...SafeWritePostProcess,
+) (result SafeWriteResult, err error) {
+	return o.safeWriteReport(context.Background(), fsys, path, perm, r, postProcessesCtx(postProcesses)...)
+}
+
+func (o SafeWriteOption) safeWriteReport(
+	ctx context.Context,
+	fsys afero.Fs,
+	path string,
+	perm fs.FileMode,
+	r io.Reader,
+	postProcesses ...SafeWritePostProcessCtx,
+) (result SafeWriteResult, err error) {
+	commit := rename
+	if o.skipIfUnchanged {
+		commit = func(fsys afero.Fs, tmpName, dstName string) error {
+			unchanged, err := sameFileContent(fsys, tmpName, dstName)
+			if err != nil {
+				return fmt.Errorf("compare: %w", err)
+			}
+			if !unchanged {
+				return rename(fsys, tmpName, dstName)
+			}
+			result.Unchanged = true
+			if err := fsys.Remove(filepath.FromSlash(tmpName)); err != nil {
+				return fmt.Errorf("remove: %w", err)
+			}
+			return nil
+		}
+	}
+	if o.checksumSidecar != nil {
+		commit = o.checksumSidecar.wrapCommit(commit)
+	}
+	err = o.safeWrite(
+		ctx,
 		fsys,
 		path,
 		perm,
 		o.tmpFileOption.openTmp,
 		func(dst afero.File, _ string) error {
+			src := r
+			// wrapping only when needed keeps fast paths of io.Copy, e.g. io.ReaderFrom of *os.File.
+			if ctx.Done() != nil {
+				src = stream.NewCancellable(ctx, r)
+			}
 			b := getBuf()
 			defer putBuf(b)
-			_, err := io.CopyBuffer(dst, r, *b)
+			_, err := io.CopyBuffer(dst, src, *b)
 			return err
 		},
+		commit,
 		postProcesses...,
 	)
+	return result, err
 }
 
 // SafeWriteFs copies content of src into dir under fsys.
@@ -603,6 +1045,7 @@ func (o SafeWriteOption) SafeWrite(
 // After src is fully copied, it calls rename to move the file to path,
 // which also indicates that if dir already exists and non empty,
 // SafeWriteFs fails to rename the directory.
+// If o is configured with WithMergeExisting(true), contents are merged into dir instead.
 //
 // SafeWriteFs switches its behavior based on configuration of o.
 func (o SafeWriteOption) SafeWriteFs(
@@ -611,19 +1054,69 @@ func (o SafeWriteOption) SafeWriteFs(
 	perm fs.FileMode,
 	src fs.FS,
 	postProcesses ...SafeWritePostProcess,
+) error {
+	return o.SafeWriteFsCtx(context.Background(), fsys, dir, perm, src, postProcessesCtx(postProcesses)...)
+}
+
+// SafeWriteFsCtx is same as SafeWriteFs but takes ctx and context-aware post-processes.
+//
+// ctx is checked between each step and also passed to CopyFS as CopyFsWithContext,
+// overriding one set by WithCopyFsOptions.
+func (o SafeWriteOption) SafeWriteFsCtx(
+	ctx context.Context,
+	fsys afero.Fs,
+	dir string,
+	perm fs.FileMode,
+	src fs.FS,
+	postProcesses ...SafeWritePostProcessCtx,
 ) error {
 	return o.safeWrite(
+		ctx,
 		fsys,
 		dir,
 		perm,
 		o.tmpFileOption.openTmpDir,
 		func(dst afero.File, tmpFilename string) error {
-			return CopyFS(afero.NewBasePathFs(fsys, filepath.FromSlash(tmpFilename)), src, o.copyFsOptions...)
+			opts := append(slices.Clip(o.copyFsOptions), CopyFsWithContext(ctx))
+			return CopyFS(afero.NewBasePathFs(fsys, filepath.FromSlash(tmpFilename)), src, opts...)
 		},
+		o.renameOrMerge,
 		postProcesses...,
 	)
 }
 
+// sameFileContent reports whether a and b are both regular files having same content.
+// It returns false without an error if b does not exist.
+func sameFileContent(fsys afero.Fs, a, b string) (bool, error) {
+	bInfo, err := fsys.Stat(filepath.FromSlash(b))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	aInfo, err := fsys.Stat(filepath.FromSlash(a))
+	if err != nil {
+		return false, err
+	}
+	if !aInfo.Mode().IsRegular() || !bInfo.Mode().IsRegular() || aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	af, err := fsys.Open(filepath.FromSlash(a))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = af.Close() }()
+	bf, err := fsys.Open(filepath.FromSlash(b))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = bf.Close() }()
+
+	return sameReader(af, bf, aInfo.Size(), bInfo.Size())
+}
+
 // mkdirAll calls MkdirAll on fsys.
 // If dir is an invalid value ("" || "." || filepath.Separator),
 // It swallows error since some implementation refuses to create root dir.
@@ -651,11 +1144,24 @@ func isEmptyDir(dir string) bool {
 }
 
 func OpenFileRandom(fsys afero.Fs, dir string, pattern string, perm fs.FileMode) (afero.File, error) {
+	return OpenFileRandomWithGenerator(fsys, dir, pattern, perm, nil)
+}
+
+// OpenFileRandomWithGenerator is same as OpenFileRandom but replaces '*' in pattern with strings generated by gen.
+// If gen is nil, RandomNameUint32 is used.
+func OpenFileRandomWithGenerator(
+	fsys afero.Fs,
+	dir string,
+	pattern string,
+	perm fs.FileMode,
+	gen RandomNameGenerator,
+) (afero.File, error) {
 	return openRandom(
 		fsys,
 		filepath.ToSlash(dir), // always slash-separated internally
 		pattern,
 		perm,
+		gen,
 		func(fsys afero.Fs, name string, perm fs.FileMode) (afero.File, error) {
 			return fsys.OpenFile(filepath.FromSlash(name), os.O_RDWR|os.O_CREATE|os.O_EXCL, perm|0o200) // at least writable
 		},
@@ -663,11 +1169,24 @@ func OpenFileRandom(fsys afero.Fs, dir string, pattern string, perm fs.FileMode)
 }
 
 func MkdirRandom(fsys afero.Fs, dir string, pattern string, perm fs.FileMode) (afero.File, error) {
+	return MkdirRandomWithGenerator(fsys, dir, pattern, perm, nil)
+}
+
+// MkdirRandomWithGenerator is same as MkdirRandom but replaces '*' in pattern with strings generated by gen.
+// If gen is nil, RandomNameUint32 is used.
+func MkdirRandomWithGenerator(
+	fsys afero.Fs,
+	dir string,
+	pattern string,
+	perm fs.FileMode,
+	gen RandomNameGenerator,
+) (afero.File, error) {
 	return openRandom(
 		fsys,
 		filepath.ToSlash(dir),
 		pattern,
 		perm,
+		gen,
 		func(fsys afero.Fs, name string, perm fs.FileMode) (afero.File, error) {
 			name = filepath.FromSlash(name)
 			err := fsys.Mkdir(name, perm)
@@ -684,11 +1203,15 @@ func openRandom(
 	dir string,
 	pattern string,
 	perm fs.FileMode,
+	gen RandomNameGenerator,
 	open func(fsys afero.Fs, name string, perm fs.FileMode) (afero.File, error),
 ) (afero.File, error) {
 	if dir == "" {
 		dir = "tmp"
 	}
+	if gen == nil {
+		gen = RandomNameUint32()
+	}
 
 	if strings.ContainsFunc(pattern, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
 		return nil, fmt.Errorf("%w: pattern %q contains path separators", ErrBadPattern, pattern)
@@ -703,7 +1226,13 @@ func openRandom(
 
 	attempt := 0
 	for {
-		random := randomUint32Padded()
+		random, err := gen()
+		if err != nil {
+			return nil, err
+		}
+		if strings.ContainsFunc(random, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+			return nil, fmt.Errorf("%w: generated name %q contains path separators", ErrBadName, random)
+		}
 		name := path.Join(dir, prefix+random+suffix)
 		f, err := open(fsys, name, perm.Perm())
 		if err == nil {
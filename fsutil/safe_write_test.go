@@ -2,6 +2,10 @@ package fsutil
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
 	"io/fs"
@@ -12,6 +16,9 @@ import (
 	"strings"
 	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+	"time"
 
 	"github.com/spf13/afero"
 	"gotest.tools/v3/assert"
@@ -595,3 +602,319 @@ func assertNotContainsFileOp(t *testing.T, ops []ObservableFsFileOp, op Observab
 	t.Helper()
 	assert.Assert(t, !slices.ContainsFunc(ops, func(offo ObservableFsFileOp) bool { return offo.Op == op }))
 }
+
+// SafeWrite normalizes paths to be rooted. Paths are also rooted here since MemMapFs distinguishes "foo" from "/foo".
+func TestSafeWriteFs_MergeExisting(t *testing.T) {
+	prepare := func(t *testing.T) afero.Fs {
+		t.Helper()
+		fsys := afero.NewMemMapFs()
+		assert.NilError(t, fsys.MkdirAll("/foo/random1.txt", fs.ModePerm))
+		assert.NilError(t, afero.WriteFile(fsys, "/foo/random1.txt/existing", []byte("existing"), fs.ModePerm))
+		assert.NilError(t, afero.WriteFile(fsys, "/foo/random2.txt", []byte("existing"), fs.ModePerm))
+		return fsys
+	}
+
+	t.Run("conflict error", func(t *testing.T) {
+		fsys := prepare(t)
+		opt := NewSafeWriteOption(WithTmpDir("tmp"), WithMergeExisting(true))
+		err := opt.SafeWriteFs(fsys, "foo", fs.ModePerm, ignoreHiddenFile(os.DirFS("testdata/fs6")))
+		assert.Assert(t, cmp.ErrorIs(err, ErrMergeConflict))
+		bin, err := afero.ReadFile(fsys, "/foo/random2.txt")
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Equal(string(bin), "existing"))
+		dirents, err := afero.ReadDir(fsys, "/tmp")
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Len(dirents, 0))
+	})
+
+	t.Run("no conflict", func(t *testing.T) {
+		fsys := afero.NewMemMapFs()
+		assert.NilError(t, afero.WriteFile(fsys, "/foo/random3.txt", []byte("existing"), fs.ModePerm))
+		opt := NewSafeWriteOption(WithTmpDir("tmp"), WithMergeExisting(true))
+		err := opt.SafeWriteFs(fsys, "foo", fs.ModePerm, ignoreHiddenFile(os.DirFS("testdata/fs6")))
+		assert.NilError(t, err)
+		assertSeen(t, fsys, "/foo", []string{
+			"/foo/random1.txt",
+			"/foo/random2.txt",
+			"/foo/random3.txt",
+		})
+		dirents, err := afero.ReadDir(fsys, "/tmp")
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Len(dirents, 0))
+	})
+
+	t.Run("newest wins", func(t *testing.T) {
+		fsys := prepare(t)
+		future := time.Now().Add(time.Hour)
+		assert.NilError(t, fsys.Chtimes("/foo/random2.txt", future, future))
+		assert.NilError(t, fsys.MkdirAll("/foo/random1.txt", fs.ModePerm))
+		assert.NilError(t, afero.WriteFile(fsys, "/foo/random1.txt/.gitkeep", []byte("old"), fs.ModePerm))
+		past := time.Now().Add(-time.Hour)
+		assert.NilError(t, fsys.Chtimes("/foo/random1.txt/.gitkeep", past, past))
+
+		opt := NewSafeWriteOption(
+			WithTmpDir("tmp"),
+			WithMergeExisting(true),
+			WithMergeConflictPolicy(MergeConflictPolicyNewestWins),
+		)
+		err := opt.SafeWriteFs(fsys, "foo", fs.ModePerm, os.DirFS("testdata/fs6"))
+		assert.NilError(t, err)
+
+		bin, err := afero.ReadFile(fsys, "/foo/random2.txt")
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Equal(string(bin), "existing"))
+		bin, err = afero.ReadFile(fsys, "/foo/random1.txt/.gitkeep")
+		assert.NilError(t, err)
+		assert.Assert(t, string(bin) != "old")
+		_, err = fsys.Stat("/foo/random1.txt/existing")
+		assert.NilError(t, err)
+	})
+}
+
+func TestSafeWrite_PreflightSpaceCheck(t *testing.T) {
+	t.Run("AvailableSpace", func(t *testing.T) {
+		_, fsys, clean := prepareDeeplyNestedBasePathFs()
+		defer clean()
+		assert.NilError(t, fsys.MkdirAll("foo", fs.ModePerm))
+		available, err := AvailableSpace(NewObservableFs(fsys), "foo")
+		assert.NilError(t, err)
+		assert.Assert(t, available > 0)
+
+		_, err = AvailableSpace(afero.NewMemMapFs(), "/")
+		assert.Assert(t, cmp.ErrorIs(err, errors.ErrUnsupported))
+	})
+
+	checker := func(available uint64) SpaceChecker {
+		return func(fsys afero.Fs, dir string) (uint64, error) { return available, nil }
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []SafeWriteOptionOption
+		err  error
+	}{
+		{
+			name: "enough space",
+			opts: []SafeWriteOptionOption{WithPreflightSpaceCheck(10), WithSizeHint(9), WithSpaceChecker(checker(19))},
+		},
+		{
+			name: "insufficient space",
+			opts: []SafeWriteOptionOption{WithPreflightSpaceCheck(10), WithSizeHint(9), WithSpaceChecker(checker(18))},
+			err:  ErrInsufficientSpace,
+		},
+		{
+			name: "unsupported is skipped",
+			opts: []SafeWriteOptionOption{WithPreflightSpaceCheck(10)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := NewObservableFs(afero.NewMemMapFs())
+			opt := NewSafeWriteOption(tc.opts...)
+			err := opt.SafeWrite(fsys, "foo", fs.ModePerm, bytes.NewBufferString("foobarbaz"))
+			assert.Assert(t, cmp.ErrorIs(err, tc.err))
+			if tc.err != nil {
+				assertNotContainsFsOp(t, fsys.Observer().FsOp(), ObservableFsOpNameOpenFile)
+			}
+		})
+	}
+}
+
+func TestSafeWrite_WithChecksumSidecar(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	opt := NewSafeWriteOption(WithChecksumSidecar(crypto.SHA256, ""))
+
+	content := []byte("foobarbaz")
+	err := opt.SafeWrite(fsys, "/dir/foo.txt", fs.ModePerm, bytes.NewReader(content))
+	assert.NilError(t, err)
+
+	sum := sha256.Sum256(content)
+	bin, err := afero.ReadFile(fsys, "/dir/foo.txt.sha256")
+	assert.NilError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:])+"  foo.txt\n", string(bin))
+
+	dirents, err := afero.ReadDir(fsys, "/dir")
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(dirents))
+
+	err = opt.Apply(WithChecksumSidecar(crypto.SHA256, ".sum")).SafeWrite(fsys, "/dir/bar.txt", fs.ModePerm, bytes.NewReader(content))
+	assert.NilError(t, err)
+	_, err = fsys.Stat("/dir/bar.txt.sum")
+	assert.NilError(t, err)
+
+	err = opt.Apply(WithChecksumSidecar(crypto.Hash(0), ".sum")).SafeWrite(fsys, "/dir/baz.txt", fs.ModePerm, bytes.NewReader(content))
+	assert.Assert(t, cmp.ErrorIs(err, ErrBadInput))
+	_, err = fsys.Stat("/dir/baz.txt")
+	assert.Assert(t, cmp.ErrorIs(err, fs.ErrNotExist))
+}
+
+func TestSafeWrite_WithChecksumSidecar_os(t *testing.T) {
+	fsys := afero.NewBasePathFs(afero.NewOsFs(), t.TempDir())
+	// temporary files are created in a separate directory, and the directory of the destination does not exist yet.
+	opt := NewSafeWriteOption(WithTmpDir("tmp"), WithChecksumSidecar(crypto.SHA256, ""))
+
+	content := []byte("foobarbaz")
+	err := opt.SafeWrite(fsys, "nonexistent/dir/foo.txt", fs.ModePerm, bytes.NewReader(content))
+	assert.NilError(t, err)
+
+	sum := sha256.Sum256(content)
+	bin, err := afero.ReadFile(fsys, "nonexistent/dir/foo.txt.sha256")
+	assert.NilError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:])+"  foo.txt\n", string(bin))
+	dirents, err := afero.ReadDir(fsys, "nonexistent/dir")
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(dirents))
+
+	// renaming the destination fails since it is a non empty directory.
+	assert.NilError(t, fsys.MkdirAll("occupied/bar.txt/child", fs.ModePerm))
+	err = opt.SafeWrite(fsys, "occupied/bar.txt", fs.ModePerm, bytes.NewReader(content))
+	assert.Assert(t, err != nil)
+	dirents, err = afero.ReadDir(fsys, "occupied")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(dirents))
+	assert.Equal(t, "bar.txt", dirents[0].Name())
+}
+
+func TestSafeWrite_SkipIfUnchanged(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	opt := NewSafeWriteOption(WithSkipIfUnchanged(true))
+
+	result, err := opt.SafeWriteReport(fsys, "/foo", fs.ModePerm, strings.NewReader("foo"))
+	assert.NilError(t, err)
+	assert.Assert(t, !result.Unchanged)
+
+	mtime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.NilError(t, fsys.Chtimes("/foo", mtime, mtime))
+
+	result, err = opt.SafeWriteReport(fsys, "/foo", fs.ModePerm, strings.NewReader("foo"))
+	assert.NilError(t, err)
+	assert.Assert(t, result.Unchanged)
+	s, err := fsys.Stat("/foo")
+	assert.NilError(t, err)
+	assert.Assert(t, s.ModTime().Equal(mtime))
+	dirents, err := afero.ReadDir(fsys, "/")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(dirents)) // temp file is removed.
+
+	for _, content := range []string{"bar", "foobar"} {
+		result, err = opt.SafeWriteReport(fsys, "/foo", fs.ModePerm, strings.NewReader(content))
+		assert.NilError(t, err)
+		assert.Assert(t, !result.Unchanged)
+		bin, err := afero.ReadFile(fsys, "/foo")
+		assert.NilError(t, err)
+		assert.Equal(t, content, string(bin))
+	}
+}
+
+func TestSafeWrite_Ctx(t *testing.T) {
+	type ctxKey struct{}
+
+	fsys := afero.NewMemMapFs()
+	opt := NewSafeWriteOption()
+
+	var seen any
+	ctx := context.WithValue(context.Background(), ctxKey{}, "bar")
+	err := opt.SafeWriteCtx(
+		ctx,
+		fsys,
+		"/foo",
+		fs.ModePerm,
+		strings.NewReader("foo"),
+		func(ctx context.Context, fsys afero.Fs, tmpName, dstName string, file afero.File) error {
+			seen = ctx.Value(ctxKey{})
+			return nil
+		},
+	)
+	assert.NilError(t, err)
+	assert.Equal(t, "bar", seen)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = opt.SafeWriteCtx(cancelled, fsys, "/foo", fs.ModePerm, strings.NewReader("baz"))
+	assert.ErrorIs(t, err, context.Canceled)
+	err = opt.SafeWriteFsCtx(cancelled, fsys, "/dir", fs.ModePerm, fstest.MapFS{"a": {Data: []byte("a")}})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// cancelled while post-processing.
+	ctx, cancel = context.WithCancel(context.Background())
+	err = opt.SafeWriteCtx(
+		ctx,
+		fsys,
+		"/foo",
+		fs.ModePerm,
+		strings.NewReader("baz"),
+		func(context.Context, afero.Fs, string, string, afero.File) error {
+			cancel()
+			return nil
+		},
+	)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	bin, err := afero.ReadFile(fsys, "/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, "foo", string(bin))
+	dirents, err := afero.ReadDir(fsys, "/")
+	assert.NilError(t, err)
+	assert.Equal(t, 1, len(dirents)) // no temp file is left.
+}
+
+// writerToRecorder records whether io.Copy used its io.WriterTo.
+type writerToRecorder struct {
+	r      io.Reader
+	called bool
+}
+
+func (w *writerToRecorder) Read(p []byte) (int, error) {
+	return w.r.Read(p)
+}
+
+func (w *writerToRecorder) WriteTo(dst io.Writer) (int64, error) {
+	w.called = true
+	return io.Copy(dst, w.r)
+}
+
+func TestSafeWrite_Ctx_fastPath(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	opt := NewSafeWriteOption()
+
+	// r is not wrapped if ctx is never cancelled.
+	r := &writerToRecorder{r: strings.NewReader("foo")}
+	assert.NilError(t, opt.SafeWrite(fsys, "/foo", fs.ModePerm, r))
+	assert.Assert(t, r.called)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r = &writerToRecorder{r: strings.NewReader("bar")}
+	assert.NilError(t, opt.SafeWriteCtx(ctx, fsys, "/bar", fs.ModePerm, r))
+	assert.Assert(t, !r.called)
+
+	bin, err := afero.ReadFile(fsys, "/bar")
+	assert.NilError(t, err)
+	assert.Equal(t, "bar", string(bin))
+}
+
+func TestSafeWrite_Error(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	opt := NewSafeWriteOption()
+
+	sentinel := errors.New("sentinel")
+	err := opt.SafeWrite(
+		fsys,
+		"/foo",
+		fs.ModePerm,
+		strings.NewReader("foo"),
+		func(afero.Fs, string, string, afero.File) error { return sentinel },
+	)
+	assert.ErrorIs(t, err, sentinel)
+	var swErr *SafeWriteError
+	assert.Assert(t, errors.As(err, &swErr))
+	assert.Equal(t, SafeWriteStagePostProcess, swErr.Stage)
+	assert.Equal(t, filepath.FromSlash("/foo"), swErr.DstPath)
+	assert.Assert(t, swErr.TmpPath != "")
+	_, err = fsys.Stat(swErr.TmpPath)
+	assert.ErrorIs(t, err, fs.ErrNotExist) // removed on error.
+
+	err = opt.SafeWrite(fsys, "/foo", fs.ModePerm, iotest.ErrReader(sentinel))
+	assert.Assert(t, errors.As(err, &swErr))
+	assert.Equal(t, SafeWriteStageCopy, swErr.Stage)
+}
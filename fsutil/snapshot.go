@@ -0,0 +1,225 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// TreeSnapshot is an in-memory copy of a directory tree taken by Snapshot.
+// It is immutable and safe for concurrent use.
+type TreeSnapshot struct {
+	root    string
+	entries []snapshotEntry
+	index   map[string]int
+	size    int64
+}
+
+type snapshotEntry struct {
+	// slash-separated path relative to root. "." is root itself.
+	rel     string
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+// Root returns the path passed to Snapshot.
+func (s *TreeSnapshot) Root() string {
+	return s.root
+}
+
+// Size returns total bytes of file contents held by s.
+func (s *TreeSnapshot) Size() int64 {
+	return s.size
+}
+
+// Snapshot reads the whole tree under root in fsys into memory.
+// Only directories and regular files are supported; Snapshot returns an error wrapping ErrBadInput for others.
+// Mode bits and modification times are recorded along with contents.
+//
+// Since everything is held in memory, Snapshot is meant for small trees, e.g. configuration directories.
+func Snapshot(fsys afero.Fs, root string) (*TreeSnapshot, error) {
+	s := &TreeSnapshot{root: root, index: map[string]int{}}
+	err := afero.Walk(fsys, root, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		entry := snapshotEntry{
+			rel:     filepath.ToSlash(rel),
+			mode:    info.Mode(),
+			modTime: info.ModTime(),
+		}
+		switch {
+		case info.IsDir():
+		case info.Mode().IsRegular():
+			entry.data, err = afero.ReadFile(fsys, p)
+			if err != nil {
+				return err
+			}
+			s.size += int64(len(entry.data))
+		default:
+			return fmt.Errorf("%w: non regular file is not supported, path = %s", ErrBadInput, p)
+		}
+		s.index[entry.rel] = len(s.entries)
+		s.entries = append(s.entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("fsutil.Snapshot: %w", err)
+	}
+	if len(s.entries) == 0 || !s.entries[0].mode.IsDir() {
+		return nil, fmt.Errorf("fsutil.Snapshot: %w: %s is not a directory", ErrBadInput, root)
+	}
+	return s, nil
+}
+
+// Restore rolls back the directory at snapshot.Root() in fsys to the state recorded in snapshot.
+//
+// Entries not in snapshot are removed, and missing or modified entries are re-created.
+// Files having same content are left untouched except for mode bits and modification times.
+// If root itself no longer exists, it is created.
+//
+// Restore is not atomic. If it fails halfway, it can be called again with the same snapshot.
+func Restore(fsys afero.Fs, snapshot *TreeSnapshot) error {
+	if err := restore(fsys, snapshot); err != nil {
+		return fmt.Errorf("fsutil.Restore: %w", err)
+	}
+	return nil
+}
+
+func restore(fsys afero.Fs, s *TreeSnapshot) error {
+	name := func(rel string) string {
+		return filepath.Join(s.root, filepath.FromSlash(rel))
+	}
+
+	// Remove entries which are not in the snapshot or whose type has changed.
+	var stale []string
+	err := afero.Walk(fsys, s.root, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(s.root, p)
+		if err != nil {
+			return err
+		}
+		i, ok := s.index[filepath.ToSlash(rel)]
+		if ok && s.entries[i].mode.Type() == info.Mode().Type() {
+			return nil
+		}
+		stale = append(stale, p)
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil && !(errors.Is(err, fs.ErrNotExist) && len(stale) == 0) {
+		return err
+	}
+	for _, p := range stale {
+		if err := fsys.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+
+	// entries are in the walk order; parents always precede children.
+	for _, e := range s.entries {
+		n := name(e.rel)
+		if e.mode.IsDir() {
+			// Permissive mode in case that recorded mode does not allow writes to it.
+			// Exact mode is restored later.
+			if err := fsys.MkdirAll(n, fs.ModePerm); err != nil {
+				return err
+			}
+			if err := fsys.Chmod(n, e.mode.Perm()|0o700); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := restoreFile(fsys, n, e); err != nil {
+			return err
+		}
+	}
+
+	// Restore attributes of directories in reverse order,
+	// since writes to children update modification time of parents.
+	dirs := make([]snapshotEntry, 0)
+	for _, e := range s.entries {
+		if e.mode.IsDir() {
+			dirs = append(dirs, e)
+		}
+	}
+	sort.SliceStable(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i].rel, "/") > strings.Count(dirs[j].rel, "/")
+	})
+	for _, e := range dirs {
+		n := name(e.rel)
+		if err := fsys.Chmod(n, e.mode.Perm()); err != nil {
+			return err
+		}
+		if err := fsys.Chtimes(n, e.modTime, e.modTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreFile(fsys afero.Fs, name string, e snapshotEntry) error {
+	same, err := sameContent(fsys, name, e.data)
+	if err != nil {
+		return err
+	}
+	if !same {
+		// an existing read-only file can not be opened for writing. The recorded mode is applied below anyway.
+		if info, err := fsys.Stat(name); err == nil && info.Mode().Perm()&0o200 == 0 {
+			if err := fsys.Chmod(name, info.Mode().Perm()|0o200); err != nil {
+				return err
+			}
+		}
+		f, err := fsys.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, e.mode.Perm()|0o200)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(e.data)
+		if err == nil {
+			err = f.Sync()
+		}
+		if cErr := f.Close(); err == nil {
+			err = cErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := fsys.Chmod(name, e.mode.Perm()); err != nil {
+		return err
+	}
+	return fsys.Chtimes(name, e.modTime, e.modTime)
+}
+
+func sameContent(fsys afero.Fs, name string, data []byte) (bool, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return sameReader(f, bytes.NewReader(data), info.Size(), int64(len(data)))
+}
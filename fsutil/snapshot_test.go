@@ -0,0 +1,101 @@
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestSnapshot(t *testing.T) {
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tempDir := t.TempDir()
+	fsys := afero.NewBasePathFs(afero.NewOsFs(), tempDir)
+
+	src := fstest.MapFS{
+		"foo":         &fstest.MapFile{Data: []byte("foo"), Mode: 0o644, ModTime: mtime},
+		"dir":         &fstest.MapFile{Mode: fs.ModeDir | 0o755, ModTime: mtime},
+		"dir/bar":     &fstest.MapFile{Data: []byte("bar"), Mode: 0o600, ModTime: mtime},
+		"dir/sub":     &fstest.MapFile{Mode: fs.ModeDir | 0o750, ModTime: mtime},
+		"dir/sub/baz": &fstest.MapFile{Data: []byte("baz"), Mode: 0o644, ModTime: mtime},
+	}
+	assert.NilError(t, fsys.MkdirAll("root", fs.ModePerm))
+	assert.NilError(t, CopyFS(afero.NewBasePathFs(fsys, "root"), src))
+	for p, f := range src {
+		assert.NilError(t, fsys.Chtimes("root/"+p, f.ModTime, f.ModTime))
+	}
+
+	snapshot, err := Snapshot(fsys, "root")
+	assert.NilError(t, err)
+	assert.Equal(t, "root", snapshot.Root())
+	assert.Equal(t, int64(9), snapshot.Size())
+
+	assertRestored := func(t *testing.T) {
+		t.Helper()
+		result, err := Equal(afero.NewIOFS(afero.NewBasePathFs(fsys, "root")), src)
+		assert.NilError(t, err)
+		assert.Assert(t, result.Equal(), "%#v", result)
+		info, err := fsys.Stat("root/dir/sub")
+		assert.NilError(t, err)
+		assert.Assert(t, info.ModTime().Equal(mtime))
+	}
+
+	assert.NilError(t, afero.WriteFile(fsys, "root/foo", []byte("modified"), 0o644))
+	assert.NilError(t, fsys.Chmod("root/dir/bar", 0o644))
+	assert.NilError(t, fsys.RemoveAll("root/dir/sub"))
+	assert.NilError(t, fsys.Mkdir("root/dir/bar2", fs.ModePerm))
+	assert.NilError(t, afero.WriteFile(fsys, "root/dir/bar2/new", []byte("new"), 0o644))
+	assert.NilError(t, fsys.Remove("root/foo"))
+	assert.NilError(t, fsys.Mkdir("root/foo", fs.ModePerm))
+
+	assert.NilError(t, Restore(fsys, snapshot))
+	assertRestored(t)
+
+	assert.NilError(t, fsys.RemoveAll("root"))
+	assert.NilError(t, Restore(fsys, snapshot))
+	assertRestored(t)
+
+	_, err = Snapshot(fsys, "root/foo")
+	assert.Assert(t, cmp.ErrorIs(err, ErrBadInput))
+}
+
+// permissionFs rejects opening files lacking the owner write bit for writing, as the OS does for non root users.
+type permissionFs struct {
+	afero.Fs
+}
+
+func (fsys permissionFs) OpenFile(name string, flag int, perm fs.FileMode) (afero.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if info, err := fsys.Fs.Stat(name); err == nil && info.Mode().Perm()&0o200 == 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+		}
+	}
+	return fsys.Fs.OpenFile(name, flag, perm)
+}
+
+func TestSnapshot_readOnly(t *testing.T) {
+	fsys := permissionFs{afero.NewMemMapFs()}
+	assert.NilError(t, fsys.MkdirAll("root", fs.ModePerm))
+	assert.NilError(t, afero.WriteFile(fsys, "root/ro", []byte("ro"), 0o644))
+	assert.NilError(t, fsys.Chmod("root/ro", 0o444))
+
+	snapshot, err := Snapshot(fsys, "root")
+	assert.NilError(t, err)
+
+	assert.NilError(t, fsys.Chmod("root/ro", 0o644))
+	assert.NilError(t, afero.WriteFile(fsys, "root/ro", []byte("modified"), 0o644))
+	assert.NilError(t, fsys.Chmod("root/ro", 0o444))
+
+	assert.NilError(t, Restore(fsys, snapshot))
+	bin, err := afero.ReadFile(fsys, "root/ro")
+	assert.NilError(t, err)
+	assert.Equal(t, "ro", string(bin))
+	info, err := fsys.Stat("root/ro")
+	assert.NilError(t, err)
+	assert.Equal(t, fs.FileMode(0o444), info.Mode().Perm())
+}
@@ -0,0 +1,76 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// SpaceChecker reports how many bytes are available for writing under dir in fsys.
+// It returns an error wrapping errors.ErrUnsupported if it is not able to tell.
+type SpaceChecker func(fsys afero.Fs, dir string) (available uint64, err error)
+
+// AvailableSpace is the default SpaceChecker.
+//
+// AvailableSpace opens dir and unwraps the opened file until it reaches *os.File,
+// then stats the filesystem where the file resides.
+// It unwraps files opened through *afero.OsFs, *afero.BasePathFs (arbitrarily nested), *ObservableFs and *LoggingFs.
+// For other file types or on platforms where statfs is not available,
+// it returns an error wrapping errors.ErrUnsupported.
+func AvailableSpace(fsys afero.Fs, dir string) (uint64, error) {
+	f, err := fsys.Open(filepath.FromSlash(dir))
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	osFile, ok := unwrapOsFile(f)
+	if !ok {
+		return 0, fmt.Errorf("%w: %T is not backed by *os.File", errors.ErrUnsupported, f)
+	}
+	return statfsAvailable(osFile)
+}
+
+func unwrapOsFile(f afero.File) (*os.File, bool) {
+	for {
+		switch x := f.(type) {
+		case *os.File:
+			return x, true
+		case *afero.BasePathFile:
+			f = x.File
+		case *observableFile:
+			f = x.f
+		case *loggingFile:
+			f = x.f
+		default:
+			return nil, false
+		}
+	}
+}
+
+func (o SafeWriteOption) checkSpace(fsys afero.Fs, dir string) error {
+	checker := o.spaceChecker
+	if checker == nil {
+		checker = AvailableSpace
+	}
+
+	available, err := checker(fsys, dir)
+	if err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		return err
+	}
+
+	required := o.minFree + o.sizeHint
+	if available < required {
+		return fmt.Errorf(
+			"%w: %d bytes available under %s, but at least %d bytes are required",
+			ErrInsufficientSpace, available, filepath.FromSlash(dir), required,
+		)
+	}
+	return nil
+}
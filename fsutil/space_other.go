@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func statfsAvailable(f *os.File) (uint64, error) {
+	return 0, fmt.Errorf("%w: statfs on %s", errors.ErrUnsupported, runtime.GOOS)
+}
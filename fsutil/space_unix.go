@@ -0,0 +1,16 @@
+//go:build linux || darwin
+
+package fsutil
+
+import (
+	"os"
+	"syscall"
+)
+
+func statfsAvailable(f *os.File) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Fstatfs(int(f.Fd()), &st); err != nil {
+		return 0, &os.PathError{Op: "fstatfs", Path: f.Name(), Err: err}
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
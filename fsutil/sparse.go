@@ -0,0 +1,134 @@
+package fsutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// sparseBlockSize is granularity of zero run detection in the portable fallback.
+// Zero runs shorter than this are written as is.
+const sparseBlockSize = 4 * 1024
+
+var zeroBlock = make([]byte, sparseBlockSize)
+
+// copySparse copies r to w while leaving holes in w.
+//
+// If r is *os.File and the platform supports SEEK_DATA / SEEK_HOLE,
+// only data regions reported by the source filesystem are copied.
+// Otherwise it falls back to copying r while skipping zero filled blocks.
+//
+// w is finally truncated to the end of data so that trailing holes are preserved.
+func copySparse(w afero.File, r fs.File, wrap func(r io.Reader) io.Reader, buf []byte) error {
+	if f, ok := r.(*os.File); ok {
+		err := copyDataRegions(w, f, wrap, buf)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return copySkippingZeros(w, wrap(r), buf)
+}
+
+func copyDataRegions(w afero.File, f *os.File, wrap func(r io.Reader) io.Reader, buf []byte) error {
+	if !seekDataSupported {
+		return errors.ErrUnsupported
+	}
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	var off int64
+	for off < size {
+		data, err := f.Seek(off, seekData)
+		if err != nil {
+			if isENXIO(err) {
+				// rest of the file is a hole.
+				break
+			}
+			if off == 0 {
+				// The filesystem may refuse SEEK_DATA, e.g. EINVAL.
+				return fmt.Errorf("%w: %w", errors.ErrUnsupported, err)
+			}
+			return err
+		}
+		hole, err := f.Seek(data, seekHole)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Seek(data, io.SeekStart); err != nil {
+			return err
+		}
+		if n, err := io.CopyBuffer(w, wrap(io.NewSectionReader(f, data, hole-data)), buf); err != nil {
+			return fmt.Errorf("%w at %d", err, data+n)
+		}
+		off = hole
+	}
+
+	return w.Truncate(size)
+}
+
+func copySkippingZeros(w afero.File, r io.Reader, buf []byte) error {
+	var total int64
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if werr := writeNonZeroBlocks(w, buf[:n]); werr != nil {
+				return fmt.Errorf("%w at %d", werr, total)
+			}
+			total += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w at %d", err, total)
+		}
+	}
+	return w.Truncate(total)
+}
+
+// writeNonZeroBlocks writes p to w, seeking over zero filled blocks instead of writing them.
+func writeNonZeroBlocks(w io.WriteSeeker, p []byte) error {
+	blockEnd := func(i int) int {
+		if i+sparseBlockSize > len(p) {
+			return len(p)
+		}
+		return i + sparseBlockSize
+	}
+
+	for i := 0; i < len(p); {
+		end := blockEnd(i)
+		if bytes.Equal(p[i:end], zeroBlock[:end-i]) {
+			if _, err := w.Seek(int64(end-i), io.SeekCurrent); err != nil {
+				return err
+			}
+			i = end
+			continue
+		}
+
+		j := end
+		for j < len(p) {
+			next := blockEnd(j)
+			if bytes.Equal(p[j:next], zeroBlock[:next-j]) {
+				break
+			}
+			j = next
+		}
+		if _, err := w.Write(p[i:j]); err != nil {
+			return err
+		}
+		i = j
+	}
+	return nil
+}
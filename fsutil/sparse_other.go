@@ -0,0 +1,13 @@
+//go:build !linux && !freebsd && !darwin
+
+package fsutil
+
+const (
+	seekDataSupported = false
+	seekData          = 0
+	seekHole          = 0
+)
+
+func isENXIO(err error) bool {
+	return false
+}
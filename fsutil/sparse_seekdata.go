@@ -0,0 +1,18 @@
+//go:build linux || freebsd
+
+package fsutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	seekDataSupported = true
+	seekData          = 3 // SEEK_DATA
+	seekHole          = 4 // SEEK_HOLE
+)
+
+func isENXIO(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
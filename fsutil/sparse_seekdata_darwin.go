@@ -0,0 +1,18 @@
+//go:build darwin
+
+package fsutil
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	seekDataSupported = true
+	seekData          = 4 // SEEK_DATA
+	seekHole          = 3 // SEEK_HOLE
+)
+
+func isENXIO(err error) bool {
+	return errors.Is(err, syscall.ENXIO)
+}
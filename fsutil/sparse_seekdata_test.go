@@ -0,0 +1,47 @@
+//go:build linux
+
+package fsutil
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestCopyFS_sparse_allocation(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	const size = 64 * 1024 * 1024
+	f, err := os.Create(filepath.Join(srcDir, "sparse"))
+	assert.NilError(t, err)
+	_, err = f.WriteAt([]byte("foo"), size/2)
+	assert.NilError(t, err)
+	assert.NilError(t, f.Truncate(size))
+	assert.NilError(t, f.Close())
+
+	srcBlocks := allocatedBlocks(t, filepath.Join(srcDir, "sparse"))
+	if srcBlocks*512 >= size {
+		t.Skip("filesystem does not support sparse files")
+	}
+
+	err = CopyFS(afero.NewBasePathFs(afero.NewOsFs(), dstDir), os.DirFS(srcDir), CopyFsWithSparse(true))
+	assert.NilError(t, err)
+
+	s, err := os.Stat(filepath.Join(dstDir, "sparse"))
+	assert.NilError(t, err)
+	assert.Equal(t, s.Size(), int64(size))
+	dstBlocks := allocatedBlocks(t, filepath.Join(dstDir, "sparse"))
+	assert.Assert(t, dstBlocks*512 < size/2, "dst allocates %d blocks", dstBlocks)
+}
+
+func allocatedBlocks(t *testing.T, name string) int64 {
+	t.Helper()
+	s, err := os.Stat(name)
+	assert.NilError(t, err)
+	return s.Sys().(*syscall.Stat_t).Blocks
+}
@@ -0,0 +1,99 @@
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func sparseContent() []byte {
+	b := make([]byte, 3*sparseBlockSize+1024)
+	copy(b[sparseBlockSize+10:], "foo")
+	copy(b[2*sparseBlockSize+sparseBlockSize/2:], bytes.Repeat([]byte{1}, sparseBlockSize))
+	return b
+}
+
+func TestCopyFS_sparse_fallback(t *testing.T) {
+	content := sparseContent()
+	src := fstest.MapFS{
+		"sparse": &fstest.MapFile{Data: content, Mode: 0o644},
+		"empty":  &fstest.MapFile{Data: []byte{}, Mode: 0o644},
+		"zeros":  &fstest.MapFile{Data: make([]byte, sparseBlockSize*2), Mode: 0o644},
+	}
+
+	dst := NewObservableFs(afero.NewMemMapFs())
+	err := CopyFS(dst, src, CopyFsWithSparse(true), CopyFsWithNoChmod(true))
+	assert.NilError(t, err)
+
+	eq, err := Equal(src, afero.NewIOFS(dst), CopyFsWithNoChmod(true))
+	assert.NilError(t, err)
+	assert.Assert(t, eq.Equal(), "%v", eq)
+
+	var written, seeked int
+	for _, op := range dst.Observer().FileOp("sparse") {
+		switch op.Op {
+		case ObservableFsFileOpNameWrite:
+			written++
+		case ObservableFsFileOpNameSeek:
+			seeked++
+		}
+	}
+	// a zero block followed by contiguous non-zero blocks.
+	assert.Assert(t, cmp.Equal(written, 1))
+	assert.Assert(t, cmp.Equal(seeked, 1))
+}
+
+func TestCopyFS_sparse_osFile(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := t.TempDir()
+
+	content := sparseContent()
+	f, err := os.Create(filepath.Join(srcDir, "sparse"))
+	assert.NilError(t, err)
+	// leaves holes where possible.
+	assert.NilError(t, writeNonZeroBlocks(f, content))
+	assert.NilError(t, f.Truncate(int64(len(content))+16*sparseBlockSize))
+	assert.NilError(t, f.Close())
+
+	dst := afero.NewBasePathFs(afero.NewOsFs(), dstDir)
+	err = CopyFS(dst, os.DirFS(srcDir), CopyFsWithSparse(true))
+	assert.NilError(t, err)
+
+	eq, err := Equal(os.DirFS(srcDir), afero.NewIOFS(dst))
+	assert.NilError(t, err)
+	assert.Assert(t, eq.Equal(), "%v", eq)
+
+	copied, err := afero.ReadFile(dst, "sparse")
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(copied[:len(content)], content))
+	assert.Assert(t, cmp.Len(copied, len(content)+16*sparseBlockSize))
+}
+
+func TestWriteNonZeroBlocks(t *testing.T) {
+	for _, p := range [][]byte{
+		{},
+		make([]byte, 10),
+		make([]byte, sparseBlockSize),
+		bytes.Repeat([]byte{1}, sparseBlockSize+1),
+		sparseContent(),
+	} {
+		mem := afero.NewMemMapFs()
+		f, err := mem.OpenFile("foo", os.O_CREATE|os.O_RDWR, fs.ModePerm)
+		assert.NilError(t, err)
+		assert.NilError(t, writeNonZeroBlocks(f, p))
+		assert.NilError(t, f.Truncate(int64(len(p))))
+		_, err = f.Seek(0, io.SeekStart)
+		assert.NilError(t, err)
+		bin, err := io.ReadAll(f)
+		assert.NilError(t, err)
+		assert.Assert(t, bytes.Equal(p, bin))
+	}
+}
@@ -0,0 +1,111 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// ReadLinkFS is an fs.FS which is able to read symbolic links.
+// The method set is same as fs.ReadLinkFS of Go 1.25 or later,
+// so os.DirFS and fstest.MapFS built with recent toolchain implement it.
+type ReadLinkFS interface {
+	fs.FS
+	// ReadLink returns the destination of the named symbolic link.
+	ReadLink(name string) (string, error)
+	// Lstat returns a FileInfo describing the named file without following symbolic links.
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// SpecialFilePolicy decides how sockets, named pipes, devices and other irregular files are handled.
+type SpecialFilePolicy string
+
+const (
+	// SpecialFilePolicyDefault follows CopyFsWithIgnoreNonRegularFile,
+	// that is, special files are an error unless the option is set.
+	SpecialFilePolicyDefault SpecialFilePolicy = ""
+	// SpecialFilePolicyError makes special files an error even if CopyFsWithIgnoreNonRegularFile is set.
+	SpecialFilePolicyError SpecialFilePolicy = "error"
+	// SpecialFilePolicyIgnore skips special files.
+	SpecialFilePolicyIgnore SpecialFilePolicy = "ignore"
+	// SpecialFilePolicyModeOnly makes Equal compare only mode bits of special files, without opening them.
+	// Since afero.Fs is not able to create special files, CopyFS treats this as SpecialFilePolicyError.
+	SpecialFilePolicyModeOnly SpecialFilePolicy = "mode_only"
+)
+
+// CopyFsWithSymlink makes CopyFS and Equal handle symbolic links as links, instead of following them.
+//
+// CopyFS creates links having same targets in dst. Targets are passed to afero.Linker verbatim, without any validation.
+// Note that afero.BasePathFs resolves targets under its base path and rejects relative ones pointing outside of it.
+// src must implement ReadLinkFS and dst must implement afero.Linker, otherwise CopyFS fails when encountering a link.
+// Equal compares link targets and reports EqualReasonLinkTargetMismatch for difference.
+// Both of dst and src must implement ReadLinkFS for Equal.
+//
+// Mode bits of links are not copied nor compared, since they are not meaningful on most platforms.
+func CopyFsWithSymlink(symlink bool) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.symlink = symlink
+	}
+}
+
+// CopyFsWithSpecialFilePolicy sets policy for special files.
+// The default is SpecialFilePolicyDefault.
+func CopyFsWithSpecialFilePolicy(policy SpecialFilePolicy) CopyFsOption {
+	return func(o *copyFsOption) {
+		o.specialFilePolicy = policy
+	}
+}
+
+// nonRegular decides how a non regular file of mode should be handled.
+func (o copyFsOption) nonRegular(mode fs.FileMode) nonRegularFileHandling {
+	if mode&fs.ModeSymlink != 0 {
+		if o.symlink {
+			return nonRegularFileHandlingTrySymlink
+		}
+		return o.handleNonRegularFile
+	}
+	switch o.specialFilePolicy {
+	case SpecialFilePolicyError:
+		return nonRegularFileHandlingError
+	case SpecialFilePolicyIgnore:
+		return nonRegularFileHandlingIgnore
+	case SpecialFilePolicyModeOnly:
+		return nonRegularFileHandlingModeOnly
+	}
+	return o.handleNonRegularFile
+}
+
+// needsLstat reports whether type of files must be examined without following links or opening them.
+func (o copyFsOption) needsLstat() bool {
+	return o.symlink || o.specialFilePolicy != SpecialFilePolicyDefault
+}
+
+// lstat calls Lstat if fsys implements ReadLinkFS, fs.Stat otherwise.
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if rl, ok := fsys.(ReadLinkFS); ok {
+		return rl.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+func readLink(fsys fs.FS, name string) (string, error) {
+	rl, ok := fsys.(ReadLinkFS)
+	if !ok {
+		return "", fmt.Errorf("%w: %T does not implement ReadLinkFS, reading link %s", ErrBadInput, fsys, name)
+	}
+	return rl.ReadLink(name)
+}
+
+func copySymlink(dst afero.Fs, src fs.FS, p string) error {
+	linker, ok := dst.(afero.Linker)
+	if !ok {
+		return fmt.Errorf("%w: %T does not implement afero.Linker, copying link %s", ErrBadInput, dst, p)
+	}
+	target, err := readLink(src, p)
+	if err != nil {
+		return err
+	}
+	return linker.SymlinkIfPossible(target, filepath.FromSlash(p))
+}
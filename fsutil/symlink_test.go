@@ -0,0 +1,98 @@
+package fsutil
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestCopyFS_symlink(t *testing.T) {
+	src := fstest.MapFS{
+		"foo":      &fstest.MapFile{Data: []byte("foo"), Mode: 0o644},
+		"dir/link": &fstest.MapFile{Data: []byte("/foo"), Mode: fs.ModeSymlink | 0o777},
+		"pipe":     &fstest.MapFile{Mode: fs.ModeNamedPipe | 0o644},
+	}
+
+	tempDir := t.TempDir()
+	dst := afero.NewBasePathFs(afero.NewOsFs(), tempDir)
+
+	err := CopyFS(afero.NewBasePathFs(afero.NewOsFs(), t.TempDir()), src, CopyFsWithSymlink(true))
+	assert.Assert(t, cmp.ErrorIs(err, ErrBadInput))
+
+	err = CopyFS(dst, src, CopyFsWithSymlink(true), CopyFsWithSpecialFilePolicy(SpecialFilePolicyIgnore))
+	assert.NilError(t, err)
+
+	// afero.BasePathFs resolves targets under its base path.
+	target, err := os.Readlink(tempDir + "/dir/link")
+	assert.NilError(t, err)
+	assert.Equal(t, filepath.Join(tempDir, "foo"), target)
+	_, err = os.Lstat(tempDir + "/pipe")
+	assert.Assert(t, cmp.ErrorIs(err, fs.ErrNotExist))
+
+	// without the option link is followed.
+	src["dir/link"].Data = []byte("../foo")
+	tempDir2 := t.TempDir()
+	err = CopyFS(afero.NewBasePathFs(afero.NewOsFs(), tempDir2), src, CopyFsWithIgnoreNonRegularFile())
+	assert.NilError(t, err)
+	info, err := os.Lstat(tempDir2 + "/dir/link")
+	assert.NilError(t, err)
+	assert.Assert(t, info.Mode().IsRegular())
+
+	err = CopyFS(afero.NewMemMapFs(), src, CopyFsWithSymlink(true), CopyFsWithSpecialFilePolicy(SpecialFilePolicyIgnore))
+	assert.Assert(t, cmp.ErrorIs(err, ErrBadInput))
+}
+
+func TestEqual_symlinkAndSpecialFile(t *testing.T) {
+	newFs := func() fstest.MapFS {
+		return fstest.MapFS{
+			"foo":  &fstest.MapFile{Data: []byte("foo"), Mode: 0o644},
+			"bar":  &fstest.MapFile{Data: []byte("bar"), Mode: 0o644},
+			"link": &fstest.MapFile{Data: []byte("foo"), Mode: fs.ModeSymlink | 0o777},
+			"pipe": &fstest.MapFile{Mode: fs.ModeNamedPipe | 0o644},
+		}
+	}
+
+	dst, src := newFs(), newFs()
+
+	_, err := Equal(dst, src, CopyFsWithSymlink(true))
+	assert.Assert(t, cmp.ErrorIs(err, ErrBadInput))
+
+	opts := []CopyFsOption{CopyFsWithSymlink(true), CopyFsWithSpecialFilePolicy(SpecialFilePolicyModeOnly)}
+	result, err := Equal(dst, src, opts...)
+	assert.NilError(t, err)
+	assert.Assert(t, result.Equal(), "%#v", result)
+
+	src["link"].Data = []byte("bar")
+	src["pipe"].Mode = fs.ModeNamedPipe | 0o600
+	src["foo"] = &fstest.MapFile{Data: []byte("bar"), Mode: fs.ModeSymlink | 0o777}
+	result, err = Equal(dst, src, opts...)
+	assert.NilError(t, err)
+	assert.DeepEqual(
+		t,
+		EqualResult{
+			{Reason: EqualReasonModeMismatch, Path: "foo", DstVal: fs.FileMode(0o644), SrcVal: fs.ModeSymlink | 0o777},
+			{Reason: EqualReasonLinkTargetMismatch, Path: "link", DstVal: "foo", SrcVal: "bar"},
+			{Reason: EqualReasonModeMismatch, Path: "pipe", DstVal: fs.ModeNamedPipe | 0o644, SrcVal: fs.ModeNamedPipe | 0o600},
+		},
+		result,
+	)
+
+	result, err = Equal(
+		dst, src,
+		CopyFsWithSymlink(true),
+		CopyFsWithSpecialFilePolicy(SpecialFilePolicyIgnore),
+	)
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Len(result, 2))
+
+	// links are followed without CopyFsWithSymlink.
+	result, err = Equal(dst, newFs(), CopyFsWithIgnoreNonRegularFile())
+	assert.NilError(t, err)
+	assert.Assert(t, result.Equal())
+}
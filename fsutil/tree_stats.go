@@ -0,0 +1,145 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// TreeStats is statistics of a file tree computed by Stats.
+type TreeStats struct {
+	// Bytes is the total size of regular files.
+	Bytes int64
+	// Files and Dirs are numbers of regular files and directories, excluding root.
+	Files, Dirs int
+	// Others is number of non regular files, e.g. symlinks. They are not followed.
+	Others int
+	// MaxDepth is the deepest level of entries. Direct children of root are at level 1.
+	MaxDepth int
+	// Largest holds largest regular files in descending order of size.
+	// Files of same size are ordered by path.
+	Largest []TreeStatsFile
+}
+
+type TreeStatsFile struct {
+	// Path is a slash-separated path joined with root.
+	Path string
+	Size int64
+}
+
+type statsOption struct {
+	largest int
+	workers int
+}
+
+type StatsOption func(o *statsOption)
+
+// StatsWithLargest sets number of files reported in TreeStats.Largest. The default is 10.
+func StatsWithLargest(n int) StatsOption {
+	return func(o *statsOption) {
+		o.largest = n
+	}
+}
+
+// StatsWithWorkers makes Stats walk the tree with WalkConcurrent using workers goroutines.
+// If workers is zero, which is the default, the tree is walked sequentially.
+func StatsWithWorkers(workers int) StatsOption {
+	return func(o *statsOption) {
+		o.workers = workers
+	}
+}
+
+// Stats walks the tree rooted at root and returns its statistics.
+// Sizes are those reported by fs.DirEntry.Info, so sparse files are counted by their apparent size.
+func Stats(fsys fs.FS, root string, opts ...StatsOption) (TreeStats, error) {
+	opt := statsOption{largest: 10}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	root = path.Clean(root)
+	var (
+		mu    sync.Mutex
+		stats TreeStats
+	)
+	walkFn := func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+
+		var size int64
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size = info.Size()
+		}
+
+		depth := strings.Count(p, "/") + 1
+		if root != "." {
+			depth -= strings.Count(root, "/") + 1
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		stats.MaxDepth = max(stats.MaxDepth, depth)
+		switch {
+		case d.IsDir():
+			stats.Dirs++
+		case d.Type().IsRegular():
+			stats.Files++
+			stats.Bytes += size
+			stats.Largest = insertLargest(stats.Largest, TreeStatsFile{Path: p, Size: size}, opt.largest)
+		default:
+			stats.Others++
+		}
+		return nil
+	}
+
+	var err error
+	if opt.workers > 0 {
+		err = WalkConcurrent(fsys, root, opt.workers, walkFn)
+	} else {
+		err = fs.WalkDir(fsys, root, walkFn)
+	}
+	if err != nil {
+		return TreeStats{}, fmt.Errorf("fsutil.Stats: %w", err)
+	}
+	return stats, nil
+}
+
+// insertLargest inserts f into largest, keeping it sorted and at most n elements.
+func insertLargest(largest []TreeStatsFile, f TreeStatsFile, n int) []TreeStatsFile {
+	if n <= 0 {
+		return largest
+	}
+	i := sort.Search(len(largest), func(i int) bool {
+		l := largest[i]
+		return l.Size < f.Size || (l.Size == f.Size && l.Path > f.Path)
+	})
+	if i >= n {
+		return largest
+	}
+	if len(largest) < n {
+		largest = append(largest, TreeStatsFile{})
+	}
+	copy(largest[i+1:], largest[i:])
+	largest[i] = f
+	return largest
+}
+
+// DirSize returns the total size of regular files under root.
+func DirSize(fsys fs.FS, root string) (int64, error) {
+	stats, err := Stats(fsys, root, StatsWithLargest(0))
+	if err != nil {
+		return 0, fmt.Errorf("fsutil.DirSize: %w", err)
+	}
+	return stats.Bytes, nil
+}
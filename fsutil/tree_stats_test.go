@@ -0,0 +1,50 @@
+package fsutil
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStats(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":         {Data: []byte("aaaa")},
+		"b":         {Data: []byte("bb")},
+		"dir/c":     {Data: []byte("cccc")},
+		"dir/sub/d": {Data: []byte("d")},
+		"dir/empty": {Mode: fs.ModeDir},
+		"link":      {Data: []byte("a"), Mode: fs.ModeSymlink},
+	}
+
+	for _, workers := range []int{0, 1, 4} {
+		stats, err := Stats(fsys, ".", StatsWithLargest(3), StatsWithWorkers(workers))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, TreeStats{
+			Bytes:    11,
+			Files:    4,
+			Dirs:     3,
+			Others:   1,
+			MaxDepth: 3,
+			Largest: []TreeStatsFile{
+				{Path: "a", Size: 4},
+				{Path: "dir/c", Size: 4},
+				{Path: "b", Size: 2},
+			},
+		}, stats)
+	}
+
+	stats, err := Stats(fsys, "dir")
+	assert.NilError(t, err)
+	assert.Equal(t, 2, stats.MaxDepth)
+	assert.Equal(t, 2, len(stats.Largest))
+	assert.Equal(t, "dir/c", stats.Largest[0].Path)
+
+	size, err := DirSize(fsys, ".")
+	assert.NilError(t, err)
+	assert.Equal(t, int64(11), size)
+
+	_, err = Stats(fsys, "nonexistent")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
@@ -0,0 +1,93 @@
+package fsutil
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ValidateFsPaths walks src and checks that every path in it is safe to be written under a destination directory.
+// It is meant for sources built from untrusted inputs, e.g. archives, whose fs.FS implementation
+// might not sanitize names.
+//
+// A path is considered unsafe if any of its elements
+//   - is empty, "." or "..",
+//   - contains '/', '\\' or NUL,
+//   - has a volume name (e.g. "C:"), or
+//   - is a device-reserved name on Windows (e.g. "CON", "nul.txt", "COM1").
+//
+// If any is found, an error wrapping ErrUnsafePath and listing all unsafe paths is returned.
+func ValidateFsPaths(src fs.FS) error {
+	var unsafe []string
+	err := fs.WalkDir(src, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == "." {
+			return nil
+		}
+		if !isSafePath(p) || !isSafePathElement(d.Name()) {
+			unsafe = append(unsafe, p)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fsutil.ValidateFsPaths: %w", err)
+	}
+	if len(unsafe) > 0 {
+		quoted := make([]string, len(unsafe))
+		for i, p := range unsafe {
+			quoted[i] = fmt.Sprintf("%q", p)
+		}
+		return fmt.Errorf("fsutil.ValidateFsPaths: %w: %s", ErrUnsafePath, strings.Join(quoted, ", "))
+	}
+	return nil
+}
+
+func isSafePath(p string) bool {
+	if !fs.ValidPath(p) || path.IsAbs(p) || filepath.IsAbs(p) || filepath.VolumeName(p) != "" {
+		return false
+	}
+	for _, elem := range strings.Split(p, "/") {
+		if !isSafePathElement(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+func isSafePathElement(name string) bool {
+	if name == "" || name == "." || name == ".." {
+		return false
+	}
+	if strings.ContainsAny(name, "/\\\x00") {
+		return false
+	}
+	// "C:" or "C:foo" is drive relative on Windows.
+	if len(name) >= 2 && name[1] == ':' {
+		return false
+	}
+	return !isWindowsReservedName(name)
+}
+
+// isWindowsReservedName reports whether name is one of device names reserved on Windows.
+// Reserved names are matched case-insensitively, ignoring extensions and trailing spaces,
+// i.e. "con", "NUL.txt" and "aux .tar.gz" are all reserved.
+func isWindowsReservedName(name string) bool {
+	base, _, _ := strings.Cut(name, ".")
+	base = strings.ToUpper(strings.TrimRight(base, " "))
+	switch base {
+	case "CON", "PRN", "AUX", "NUL", "CONIN$", "CONOUT$":
+		return true
+	}
+	if len(base) == 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		c := base[3]
+		return '1' <= c && c <= '9'
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package fsutil
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+// unsafeFs is an fs.FS which does not validate names, like naive archive readers.
+type unsafeFs struct {
+	fstest.MapFS
+	names []string
+}
+
+func (u unsafeFs) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name != "." {
+		return u.MapFS.ReadDir(name)
+	}
+	dirents, err := u.MapFS.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range u.names {
+		dirents = append(dirents, fs.FileInfoToDirEntry(fakeFileInfo{name: n}))
+	}
+	return dirents, nil
+}
+
+type fakeFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (f fakeFileInfo) Name() string      { return f.name }
+func (f fakeFileInfo) IsDir() bool       { return false }
+func (f fakeFileInfo) Mode() fs.FileMode { return 0o644 }
+
+func TestValidateFsPaths(t *testing.T) {
+	safe := fstest.MapFS{
+		"foo/bar.txt":   &fstest.MapFile{Data: []byte("bar")},
+		"console/a.txt": &fstest.MapFile{Data: []byte("a")},
+		"com0":          &fstest.MapFile{Data: []byte("com0")},
+	}
+	assert.NilError(t, ValidateFsPaths(safe))
+
+	for _, name := range []string{
+		"..",
+		"../../etc/passwd",
+		"C:evil",
+		`foo\bar`,
+		"CON",
+		"nul.txt",
+		"aux .tar.gz",
+		"com1",
+		"LPT9.log",
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := unsafeFs{MapFS: safe, names: []string{name}}
+			err := ValidateFsPaths(src)
+			assert.Assert(t, cmp.ErrorIs(err, ErrUnsafePath))
+
+			dst := afero.NewMemMapFs()
+			err = CopyFS(dst, src, CopyFsWithRejectUnsafePaths(true))
+			assert.Assert(t, cmp.ErrorIs(err, ErrUnsafePath))
+			dirents, err := afero.ReadDir(dst, ".")
+			assert.NilError(t, err)
+			assert.Assert(t, cmp.Len(dirents, 0))
+		})
+	}
+
+	unsafe := fstest.MapFS{
+		"foo/prn/a.txt": &fstest.MapFile{Data: []byte("a")},
+		"foo/Aux":       &fstest.MapFile{Data: []byte("aux")},
+	}
+	err := ValidateFsPaths(unsafe)
+	assert.Assert(t, cmp.ErrorIs(err, ErrUnsafePath))
+	assert.ErrorContains(t, err, `"foo/Aux", "foo/prn"`)
+
+	dst := afero.NewMemMapFs()
+	err = CopyFsPath(dst, unsafe, []string{"foo/prn/a.txt"}, CopyFsWithRejectUnsafePaths(true))
+	assert.Assert(t, cmp.ErrorIs(err, ErrUnsafePath))
+	err = CopyFsPath(dst, safe, []string{"foo/bar.txt"}, CopyFsWithRejectUnsafePaths(true))
+	assert.NilError(t, err)
+}
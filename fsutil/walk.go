@@ -0,0 +1,164 @@
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/ngicks/musicbox/stream"
+)
+
+// WalkConcurrent walks the file tree rooted at root, calling fn for each file or directory in the tree, including root.
+// It is a concurrent version of fs.WalkDir.
+// Up to workers goroutines call fn simultaneously, so fn must be goroutine safe.
+// If workers is zero or negative, runtime.GOMAXPROCS(0) is used.
+//
+// Differences from fs.WalkDir are:
+//   - The order of calls to fn is not deterministic.
+//     Only guarantee is that fn is called for a directory before its contents.
+//   - Returning fs.SkipDir for a non-directory is same as returning nil,
+//     since remaining files in the containing directory may have already been visited.
+//   - An error returned from fn, other than fs.SkipDir and fs.SkipAll, does not stop the walk.
+//     It is treated as fs.SkipDir for the entry, and the walk goes on for other entries.
+//     All errors are combined and sorted by path once the walk finishes,
+//     so that the returned errors do not depend on scheduling.
+//
+// Returning fs.SkipAll stops the walk as it would for fs.WalkDir.
+func WalkConcurrent(fsys fs.FS, root string, workers int, fn fs.WalkDirFunc) error {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		err = fn(root, nil, err)
+		if err == nil || errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+			return nil
+		}
+		return fmt.Errorf("fsutil.WalkConcurrent: %w", err)
+	}
+
+	w := &walker{
+		fsys:    fsys,
+		fn:      fn,
+		queue:   []walkTask{{path: root, d: fs.FileInfoToDirEntry(info)}},
+		pending: 1,
+	}
+	w.cond = sync.NewCond(&w.mu)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.work()
+		}()
+	}
+	wg.Wait()
+
+	if len(w.errs) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(w.errs, func(i, j int) bool { return w.errs[i].path < w.errs[j].path })
+	errs := make([]error, len(w.errs))
+	for i, e := range w.errs {
+		errs[i] = e.err
+	}
+	if len(errs) == 1 {
+		return fmt.Errorf("fsutil.WalkConcurrent: %w", errs[0])
+	}
+	return fmt.Errorf("fsutil.WalkConcurrent: %w", stream.NewMultiError(errs))
+}
+
+type walkTask struct {
+	path string
+	d    fs.DirEntry
+}
+
+type walkErr struct {
+	path string
+	err  error
+}
+
+type walker struct {
+	fsys fs.FS
+	fn   fs.WalkDirFunc
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// queue holds tasks not yet started.
+	queue []walkTask
+	// pending is number of queued or running tasks.
+	pending int
+	stopped bool
+	errs    []walkErr
+}
+
+func (w *walker) work() {
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && w.pending > 0 && !w.stopped {
+			w.cond.Wait()
+		}
+		if w.stopped || len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		task := w.queue[len(w.queue)-1]
+		w.queue = w.queue[:len(w.queue)-1]
+		w.mu.Unlock()
+
+		children, err := w.visit(task)
+
+		w.mu.Lock()
+		w.pending--
+		switch {
+		case errors.Is(err, fs.SkipAll):
+			w.stopped = true
+		case err != nil:
+			w.errs = append(w.errs, walkErr{path: task.path, err: err})
+		case !w.stopped:
+			w.queue = append(w.queue, children...)
+			w.pending += len(children)
+		}
+		w.cond.Broadcast()
+		w.mu.Unlock()
+	}
+}
+
+// visit calls fn for task and returns tasks for its children if task is a directory to be walked into.
+func (w *walker) visit(task walkTask) ([]walkTask, error) {
+	err := w.fn(task.path, task.d, nil)
+	if err != nil {
+		if errors.Is(err, fs.SkipDir) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if !task.d.IsDir() {
+		return nil, nil
+	}
+
+	dirents, err := fs.ReadDir(w.fsys, task.path)
+	if err != nil {
+		err = w.fn(task.path, task.d, err)
+		if err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	}
+
+	children := make([]walkTask, len(dirents))
+	for i, d := range dirents {
+		children[i] = walkTask{path: path.Join(task.path, d.Name()), d: d}
+	}
+	return children, nil
+}
@@ -0,0 +1,129 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestWalkConcurrent(t *testing.T) {
+	fsys := os.DirFS("testdata")
+
+	var expected []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		expected = append(expected, path)
+		return nil
+	})
+	assert.NilError(t, err)
+
+	for _, workers := range []int{0, 1, 3, 16} {
+		var (
+			mu   sync.Mutex
+			seen []string
+		)
+		err := WalkConcurrent(fsys, ".", workers, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, path)
+			return nil
+		})
+		assert.NilError(t, err)
+		slices.Sort(seen)
+		assert.Assert(t, cmp.DeepEqual(expected, seen), "workers = %d", workers)
+	}
+
+	t.Run("SkipDir", func(t *testing.T) {
+		var (
+			mu   sync.Mutex
+			seen []string
+		)
+		err := WalkConcurrent(fsys, ".", 4, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != "." {
+				return fs.SkipDir
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, p)
+			return nil
+		})
+		assert.NilError(t, err)
+		slices.Sort(seen)
+		assert.Assert(t, cmp.DeepEqual([]string{".", "random1.txt", "random2.txt"}, seen))
+	})
+
+	t.Run("all errors are returned sorted by path", func(t *testing.T) {
+		errFoo := errors.New("foo")
+		var files []string
+		for _, p := range expected {
+			if info, err := fs.Stat(fsys, p); err == nil && !info.IsDir() {
+				files = append(files, p)
+			}
+		}
+		assert.Assert(t, len(files) > 1)
+
+		for i := 0; i < 10; i++ {
+			err := WalkConcurrent(fsys, ".", 16, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if !d.IsDir() {
+					return &fs.PathError{Op: "walk", Path: p, Err: errFoo}
+				}
+				return nil
+			})
+			assert.Assert(t, cmp.ErrorIs(err, errFoo))
+
+			var multi interface{ Unwrap() []error }
+			assert.Assert(t, errors.As(err, &multi))
+			var paths []string
+			for _, e := range multi.Unwrap() {
+				paths = append(paths, e.(*fs.PathError).Path)
+			}
+			assert.Assert(t, cmp.DeepEqual(files, paths))
+		}
+	})
+
+	t.Run("entries under failed directory are skipped", func(t *testing.T) {
+		var (
+			mu   sync.Mutex
+			seen []string
+		)
+		err := WalkConcurrent(fsys, ".", 4, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != "." {
+				return errors.New("dir")
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			seen = append(seen, p)
+			return nil
+		})
+		assert.ErrorContains(t, err, "dir")
+		slices.Sort(seen)
+		assert.Assert(t, cmp.DeepEqual([]string{".", "random1.txt", "random2.txt"}, seen))
+	})
+
+	t.Run("root not exist", func(t *testing.T) {
+		err := WalkConcurrent(fsys, "nonexistent", 4, func(p string, d fs.DirEntry, err error) error {
+			return err
+		})
+		assert.Assert(t, cmp.ErrorIs(err, fs.ErrNotExist))
+	})
+}
@@ -0,0 +1,323 @@
+package fsutil
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/afero"
+)
+
+type FsEventOp string
+
+const (
+	FsEventOpCreate FsEventOp = "create"
+	FsEventOpWrite  FsEventOp = "write"
+	FsEventOpRemove FsEventOp = "remove"
+	FsEventOpChmod  FsEventOp = "chmod"
+	// FsEventOpError is sent when the watcher has encountered an error.
+	// Err of the event is non nil and Path may be empty.
+	FsEventOpError FsEventOp = "error"
+)
+
+// FsEvent is a change observed by Watch.
+// Renames are reported as a pair of FsEventOpRemove and FsEventOpCreate.
+type FsEvent struct {
+	// Path is a path of changed file, joined with root passed to Watch.
+	Path string
+	Op   FsEventOp
+	Err  error
+}
+
+type watchOption struct {
+	interval     time.Duration
+	forcePolling bool
+	nonRecursive bool
+}
+
+type WatchOption func(o *watchOption)
+
+// WatchWithInterval sets interval of polling. The default is 1 second.
+func WatchWithInterval(interval time.Duration) WatchOption {
+	return func(o *watchOption) {
+		o.interval = interval
+	}
+}
+
+// WatchWithPolling forces Watch to poll even if fsys is *afero.OsFs.
+func WatchWithPolling(forcePolling bool) WatchOption {
+	return func(o *watchOption) {
+		o.forcePolling = forcePolling
+	}
+}
+
+// WatchWithRecursive sets whether Watch watches the whole tree under root. The default is true.
+// If false, only root and its direct children are watched, and a directory created under root is not descended into.
+func WatchWithRecursive(recursive bool) WatchOption {
+	return func(o *watchOption) {
+		o.nonRecursive = !recursive
+	}
+}
+
+// Watch watches changes to the tree under root in fsys.
+// Events are sent to the returned channel until stop is called.
+// stop waits for the watcher to exit and then closes the channel. It is safe to call stop multiple times.
+//
+// If fsys is *afero.OsFs, Watch uses fsnotify, adding each directory under root,
+// or only root if WatchWithRecursive(false) is given, to the watch list.
+// Otherwise, or if fsnotify is not available on the platform, Watch falls back to polling:
+// it walks the tree every interval and compares sizes, modification times and mode bits of files with the previous walk.
+// Changes happening between two polls may be coalesced or missed,
+// e.g. a file created and then removed is never reported.
+//
+// In either case, the caller must keep receiving from the channel, since the watcher blocks until events are received.
+func Watch(fsys afero.Fs, root string, opts ...WatchOption) (events <-chan FsEvent, stop func()) {
+	opt := watchOption{interval: time.Second}
+	for _, o := range opts {
+		o(&opt)
+	}
+
+	ch := make(chan FsEvent)
+	done := make(chan struct{})
+	w := &watcher{fsys: fsys, root: root, opt: opt, ch: ch, done: done}
+	if _, ok := fsys.(*afero.OsFs); ok && !opt.forcePolling {
+		if notify, err := fsnotify.NewWatcher(); err == nil {
+			w.notify = notify
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.run()
+	}()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			close(ch)
+		})
+	}
+}
+
+type watchedStat struct {
+	isDir   bool
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+type watcher struct {
+	fsys   afero.Fs
+	root   string
+	opt    watchOption
+	ch     chan<- FsEvent
+	done   <-chan struct{}
+	notify *fsnotify.Watcher
+}
+
+func (w *watcher) send(ev FsEvent) bool {
+	select {
+	case w.ch <- ev:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+func (w *watcher) run() {
+	if w.notify != nil {
+		w.runNotify()
+		return
+	}
+	w.runPolling()
+}
+
+func (w *watcher) scan() (map[string]watchedStat, error) {
+	stats := map[string]watchedStat{}
+	err := w.walk(w.root, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			// removed while walking.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		stats[p] = watchedStat{
+			isDir:   info.IsDir(),
+			size:    info.Size(),
+			mode:    info.Mode(),
+			modTime: info.ModTime(),
+		}
+		return nil
+	})
+	return stats, err
+}
+
+func (w *watcher) runPolling() {
+	prev, err := w.scan()
+	if err != nil && !w.send(FsEvent{Op: FsEventOpError, Err: err}) {
+		return
+	}
+
+	ticker := time.NewTicker(w.opt.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+
+		cur, err := w.scan()
+		if err != nil {
+			if !w.send(FsEvent{Op: FsEventOpError, Err: err}) {
+				return
+			}
+			continue
+		}
+		for _, ev := range diffWatchedStats(prev, cur) {
+			if !w.send(ev) {
+				return
+			}
+		}
+		prev = cur
+	}
+}
+
+func diffWatchedStats(prev, cur map[string]watchedStat) []FsEvent {
+	var events []FsEvent
+	for p, c := range cur {
+		pr, ok := prev[p]
+		switch {
+		case !ok:
+			events = append(events, FsEvent{Path: p, Op: FsEventOpCreate})
+		case pr.isDir != c.isDir:
+			events = append(events, FsEvent{Path: p, Op: FsEventOpRemove}, FsEvent{Path: p, Op: FsEventOpCreate})
+		case !c.isDir && (pr.size != c.size || !pr.modTime.Equal(c.modTime)):
+			events = append(events, FsEvent{Path: p, Op: FsEventOpWrite})
+		case pr.mode != c.mode:
+			events = append(events, FsEvent{Path: p, Op: FsEventOpChmod})
+		}
+	}
+	for p := range prev {
+		if _, ok := cur[p]; !ok {
+			events = append(events, FsEvent{Path: p, Op: FsEventOpRemove})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+	return events
+}
+
+func (w *watcher) runNotify() {
+	defer func() { _ = w.notify.Close() }()
+
+	if err := w.addTree(w.root, false); err != nil {
+		if errors.Is(err, errWatcherStopped) || !w.send(FsEvent{Op: FsEventOpError, Err: err}) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return
+			}
+			if !w.send(FsEvent{Op: FsEventOpError, Err: err}) {
+				return
+			}
+		case ev, ok := <-w.notify.Events:
+			if !ok {
+				return
+			}
+			for _, op := range []struct {
+				mask fsnotify.Op
+				op   FsEventOp
+			}{
+				{fsnotify.Create, FsEventOpCreate},
+				{fsnotify.Write, FsEventOpWrite},
+				{fsnotify.Remove | fsnotify.Rename, FsEventOpRemove},
+				{fsnotify.Chmod, FsEventOpChmod},
+			} {
+				if ev.Op&op.mask == 0 {
+					continue
+				}
+				if op.op == FsEventOpCreate && !w.opt.nonRecursive {
+					// fsnotify does not watch recursively.
+					if !w.send(FsEvent{Path: filepath.Clean(ev.Name), Op: op.op}) {
+						return
+					}
+					if info, err := w.fsys.Stat(ev.Name); err == nil && info.IsDir() {
+						if err := w.addTree(ev.Name, true); err != nil {
+							if errors.Is(err, errWatcherStopped) || !w.send(FsEvent{Op: FsEventOpError, Err: err}) {
+								return
+							}
+						}
+					}
+					continue
+				}
+				if !w.send(FsEvent{Path: filepath.Clean(ev.Name), Op: op.op}) {
+					return
+				}
+			}
+		}
+	}
+}
+
+var errWatcherStopped = errors.New("watcher stopped")
+
+// walk is afero.Walk, which only visits root and its direct children if the watcher is not recursive.
+func (w *watcher) walk(root string, fn filepath.WalkFunc) error {
+	if !w.opt.nonRecursive {
+		return afero.Walk(w.fsys, root, fn)
+	}
+	info, err := w.fsys.Stat(root)
+	if err != nil || !info.IsDir() {
+		return fn(root, info, err)
+	}
+	if err := fn(root, info, nil); err != nil {
+		return err
+	}
+	entries, err := afero.ReadDir(w.fsys, root)
+	if err != nil {
+		return fn(root, info, err)
+	}
+	for _, e := range entries {
+		if err := fn(filepath.Join(root, e.Name()), e, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTree adds directories under root to the watch list.
+// If reportCreate is true, it sends FsEventOpCreate for entries under root,
+// since they may have been created before the watch is added.
+func (w *watcher) addTree(root string, reportCreate bool) error {
+	return w.walk(root, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if reportCreate && p != root && !w.send(FsEvent{Path: p, Op: FsEventOpCreate}) {
+			return errWatcherStopped
+		}
+		// children are listed only to be reported for the non recursive watcher.
+		if !info.IsDir() || (w.opt.nonRecursive && p != root) {
+			return nil
+		}
+		return w.notify.Add(p)
+	})
+}
@@ -0,0 +1,122 @@
+package fsutil
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+// waitEvent receives events until one satisfying cond arrives.
+func waitEvent(t *testing.T, events <-chan FsEvent, cond func(ev FsEvent) bool) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			assert.NilError(t, ev.Err)
+			if cond(ev) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for event")
+		}
+	}
+}
+
+func is(p string, op FsEventOp) func(ev FsEvent) bool {
+	return func(ev FsEvent) bool { return ev.Path == p && ev.Op == op }
+}
+
+func testWatch(t *testing.T, fsys afero.Fs, root string, opts ...WatchOption) {
+	events, stop := Watch(fsys, root, opts...)
+	defer stop()
+
+	join := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+
+	// let the watcher scan initial state.
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NilError(t, afero.WriteFile(fsys, join("foo"), []byte("foo"), 0o644))
+	waitEvent(t, events, is(join("foo"), FsEventOpCreate))
+
+	assert.NilError(t, fsys.MkdirAll(join("dir/sub"), fs.ModePerm))
+	waitEvent(t, events, is(join("dir/sub"), FsEventOpCreate))
+
+	// let the watcher observe directories.
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NilError(t, afero.WriteFile(fsys, join("dir/sub/bar"), []byte("bar"), 0o644))
+	waitEvent(t, events, is(join("dir/sub/bar"), FsEventOpCreate))
+
+	assert.NilError(t, afero.WriteFile(fsys, join("foo"), []byte("foofoo"), 0o644))
+	waitEvent(t, events, is(join("foo"), FsEventOpWrite))
+
+	assert.NilError(t, fsys.Remove(join("foo")))
+	waitEvent(t, events, is(join("foo"), FsEventOpRemove))
+
+	stop()
+	stop()
+	_, ok := <-events
+	assert.Assert(t, !ok)
+}
+
+func TestWatch(t *testing.T) {
+	t.Run("polling", func(t *testing.T) {
+		fsys := afero.NewMemMapFs()
+		assert.NilError(t, fsys.MkdirAll("/root", fs.ModePerm))
+		testWatch(t, fsys, "/root", WatchWithInterval(10*time.Millisecond))
+	})
+	t.Run("fsnotify", func(t *testing.T) {
+		testWatch(t, afero.NewOsFs(), t.TempDir())
+	})
+	t.Run("forced polling", func(t *testing.T) {
+		testWatch(t, afero.NewOsFs(), t.TempDir(), WatchWithPolling(true), WatchWithInterval(10*time.Millisecond))
+	})
+}
+
+func testWatchNonRecursive(t *testing.T, fsys afero.Fs, root string, opts ...WatchOption) {
+	join := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+	assert.NilError(t, fsys.MkdirAll(join("dir"), fs.ModePerm))
+
+	events, stop := Watch(fsys, root, append(opts, WatchWithRecursive(false))...)
+	defer stop()
+
+	time.Sleep(50 * time.Millisecond)
+
+	notNested := func(p string, op FsEventOp) func(ev FsEvent) bool {
+		return func(ev FsEvent) bool {
+			rel, err := filepath.Rel(root, ev.Path)
+			assert.NilError(t, err)
+			assert.Assert(t, filepath.Base(rel) == rel, "nested event: %+v", ev)
+			return ev.Path == p && ev.Op == op
+		}
+	}
+
+	assert.NilError(t, afero.WriteFile(fsys, join("dir/bar"), []byte("bar"), 0o644))
+	assert.NilError(t, fsys.Mkdir(join("new"), fs.ModePerm))
+	waitEvent(t, events, notNested(join("new"), FsEventOpCreate))
+
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NilError(t, afero.WriteFile(fsys, join("new/baz"), []byte("baz"), 0o644))
+	assert.NilError(t, afero.WriteFile(fsys, join("foo"), []byte("foo"), 0o644))
+	waitEvent(t, events, notNested(join("foo"), FsEventOpCreate))
+
+	assert.NilError(t, afero.WriteFile(fsys, join("foo"), []byte("foofoo"), 0o644))
+	waitEvent(t, events, notNested(join("foo"), FsEventOpWrite))
+}
+
+func TestWatch_nonRecursive(t *testing.T) {
+	t.Run("polling", func(t *testing.T) {
+		fsys := afero.NewMemMapFs()
+		assert.NilError(t, fsys.MkdirAll("/root", fs.ModePerm))
+		testWatchNonRecursive(t, fsys, "/root", WatchWithInterval(10*time.Millisecond))
+	})
+	t.Run("fsnotify", func(t *testing.T) {
+		testWatchNonRecursive(t, afero.NewOsFs(), t.TempDir())
+	})
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// Backend is a flat object store SplittingStorage keeps chunks and metadata in.
+//
+// Names are rooted, filepath.Separator-separated paths, e.g. "/foo/bar_000".
+// Backends without hierarchy treat them as opaque keys.
+//
+// *SafeWriter implements Backend over afero.Fs and *S3Backend does over S3-compatible object storage.
+type Backend interface {
+	// Put stores content read from r at name, replacing existing one.
+	// The object must become visible atomically, only after r is fully read and Put succeeds.
+	// perm may be ignored by backends without permission bits.
+	Put(ctx context.Context, name string, perm fs.FileMode, r io.Reader) error
+	// Get opens the object stored at name.
+	// It returns an error wrapping fs.ErrNotExist if there is no such object.
+	// The returned reader may also implement io.ReaderAt.
+	Get(ctx context.Context, name string) (io.ReadCloser, error)
+	// Stat returns the object stored at name.
+	// It returns an error wrapping fs.ErrNotExist if there is no such object.
+	Stat(ctx context.Context, name string) (BackendObject, error)
+	// Delete removes the object stored at name.
+	// It may return an error wrapping fs.ErrNotExist if there is no such object,
+	// while backends unable to detect it return nil.
+	Delete(ctx context.Context, name string) error
+	// List returns objects whose names have prefix, in lexical order.
+	List(ctx context.Context, prefix string) ([]BackendObject, error)
+}
+
+// BackendObject describes an object stored in Backend.
+type BackendObject struct {
+	Name string
+	Size int64
+}
+
+// renamingBackend is implemented by backends which can move objects cheaply, e.g. *SafeWriter.
+// SplittingStorage stages chunks and moves them on commit only if the backend implements it.
+type renamingBackend interface {
+	Backend
+	Rename(ctx context.Context, oldname, newname string) error
+	RemoveAll(ctx context.Context, name string) error
+}
+
+var _ renamingBackend = (*SafeWriter)(nil)
+
+// Put implements Backend by WriteContext.
+func (s *SafeWriter) Put(ctx context.Context, name string, perm fs.FileMode, r io.Reader) error {
+	return s.WriteContext(ctx, name, perm, r)
+}
+
+// Get implements Backend. The returned reader is afero.File.
+func (s *SafeWriter) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.fsys.Open(name)
+}
+
+// Stat implements Backend. It returns an error wrapping fs.ErrNotExist if name is a directory.
+func (s *SafeWriter) Stat(ctx context.Context, name string) (BackendObject, error) {
+	if err := ctx.Err(); err != nil {
+		return BackendObject{}, err
+	}
+	info, err := s.fsys.Stat(name)
+	if err != nil {
+		return BackendObject{}, err
+	}
+	if info.IsDir() {
+		return BackendObject{}, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return BackendObject{Name: filepath.Clean(name), Size: info.Size()}, nil
+}
+
+// Delete implements Backend.
+func (s *SafeWriter) Delete(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.fsys.Remove(name)
+}
+
+// List implements Backend by walking the whole fsys. Directories are not listed.
+func (s *SafeWriter) List(ctx context.Context, prefix string) ([]BackendObject, error) {
+	var out []BackendObject
+	err := afero.Walk(s.fsys, string(filepath.Separator), func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasPrefix(p, prefix) {
+			return nil
+		}
+		out = append(out, BackendObject{Name: p, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// Rename moves oldname to newname, creating parent directories of newname.
+func (s *SafeWriter) Rename(ctx context.Context, oldname, newname string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.fsys.MkdirAll(filepath.Dir(newname), fs.ModePerm); err != nil {
+		return err
+	}
+	return s.fsys.Rename(oldname, newname)
+}
+
+// RemoveAll removes name and any children it contains.
+func (s *SafeWriter) RemoveAll(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.fsys.RemoveAll(name)
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ngicks/musicbox/stream"
+	"github.com/spf13/afero"
+)
+
+// Storage is a store of files, satisfied by *SplittingStorage.
+type Storage interface {
+	Write(path string, perm fs.FileMode, r io.Reader) ([]string, error)
+	Read(path string) (r stream.ReadAtReadSeekCloser, size int, err error)
+	Delete(path string) error
+}
+
+var _ Storage = (*SplittingStorage)(nil)
+
+// CachePolicy configures CachedStorage.
+type CachePolicy struct {
+	// MaxBytes is the budget of total size of cached files. Zero means unlimited.
+	// Files larger than MaxBytes are never cached.
+	MaxBytes int64
+	// MaxEntries is the budget of number of cached files. Zero means unlimited.
+	MaxEntries int
+	// WriteBack makes Write store files only in the cache.
+	// They are written to the primary storage by Flush,
+	// or when Write exceeds the budget and they are the least recently used.
+	// Otherwise Write writes files to both of the cache and the primary.
+	WriteBack bool
+}
+
+const (
+	cacheDataDir  = "data"
+	cacheDirtyDir = "dirty"
+)
+
+type cacheEntry struct {
+	path  string
+	size  int64
+	dirty bool
+	perm  fs.FileMode
+}
+
+// CachedStorage caches files of the primary Storage in a local afero.Fs,
+// evicting least recently used ones to keep the cache within CachePolicy.
+// It is useful when the primary is slow, e.g. backed by a network file system or object storage.
+//
+// Cached files are stored under "data" in the cache fsys.
+// For write-back caching, files not yet written to the primary are marked under "dirty"
+// so that they survive restarts.
+//
+// Methods of CachedStorage are goroutine safe but serialized, including reads from the primary on miss.
+//
+// Files opened by Read are served directly from the cache fsys and may be evicted while being read.
+// On Linux and MemMapFs, readers keep reading removed files.
+type CachedStorage struct {
+	primary Storage
+	cache   *SafeWriter
+	policy  CachePolicy
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru holds *cacheEntry, the most recently used at front.
+	lru  *list.List
+	size int64
+}
+
+// NewCachedStorage returns CachedStorage serving files of primary from cache.
+// Files already in cache, e.g. by a previous process, are loaded and
+// ordered by their modification time for LRU.
+func NewCachedStorage(primary Storage, cache *SafeWriter, policy CachePolicy) (*CachedStorage, error) {
+	c := &CachedStorage{
+		primary: primary,
+		cache:   cache,
+		policy:  policy,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("storage.NewCachedStorage: %w", err)
+	}
+	return c, nil
+}
+
+func (c *CachedStorage) dataPath(path string) string {
+	return filepath.Join(string(filepath.Separator), cacheDataDir, path)
+}
+
+func (c *CachedStorage) dirtyPath(path string) string {
+	return filepath.Join(string(filepath.Separator), cacheDirtyDir, path)
+}
+
+func (c *CachedStorage) load() error {
+	type found struct {
+		entry   *cacheEntry
+		modTime time.Time
+	}
+	var files []found
+	dataRoot := c.dataPath("")
+	err := afero.Walk(c.cache.fsys, dataRoot, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		path := filepath.Join(string(filepath.Separator), strings.TrimPrefix(p, dataRoot))
+		entry := &cacheEntry{path: path, size: info.Size()}
+		if bin, err := afero.ReadFile(c.cache.fsys, c.dirtyPath(path)); err == nil {
+			perm, _ := strconv.ParseUint(string(bin), 8, 32)
+			entry.dirty, entry.perm = true, fs.FileMode(perm)
+		}
+		files = append(files, found{entry: entry, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, f := range files {
+		c.entries[f.entry.path] = c.lru.PushBack(f.entry)
+		c.size += f.entry.size
+	}
+	return nil
+}
+
+func (c *CachedStorage) overBudget() bool {
+	return (c.policy.MaxBytes > 0 && c.size > c.policy.MaxBytes) ||
+		(c.policy.MaxEntries > 0 && c.lru.Len() > c.policy.MaxEntries)
+}
+
+func (c *CachedStorage) fits(size int64) bool {
+	return c.policy.MaxBytes <= 0 || size <= c.policy.MaxBytes
+}
+
+// add registers path as most recently used. c.mu must be held.
+func (c *CachedStorage) add(entry *cacheEntry) {
+	c.remove(entry.path)
+	c.entries[entry.path] = c.lru.PushFront(entry)
+	c.size += entry.size
+}
+
+// remove unregisters path. c.mu must be held.
+func (c *CachedStorage) remove(path string) {
+	if elem, ok := c.entries[path]; ok {
+		c.size -= elem.Value.(*cacheEntry).size
+		c.lru.Remove(elem)
+		delete(c.entries, path)
+	}
+}
+
+// evict removes least recently used entries until the cache is within the budget.
+// Dirty entries are flushed before removal if flushDirty is true, and otherwise skipped.
+// The entry at keep is never evicted, leaving the cache over the budget if nothing else can be.
+// c.mu must be held.
+func (c *CachedStorage) evict(flushDirty bool, keep string) error {
+	var errs []error
+	for elem := c.lru.Back(); elem != nil && c.overBudget(); {
+		prev := elem.Prev()
+		entry := elem.Value.(*cacheEntry)
+		if entry.path == keep {
+			elem = prev
+			continue
+		}
+		if entry.dirty {
+			if !flushDirty {
+				elem = prev
+				continue
+			}
+			if err := c.flush(entry); err != nil {
+				errs = append(errs, err)
+				elem = prev
+				continue
+			}
+		}
+		c.remove(entry.path)
+		if err := c.cache.fsys.Remove(c.dataPath(entry.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+		elem = prev
+	}
+	return errors.Join(errs...)
+}
+
+// flush writes a dirty entry to the primary. c.mu must be held.
+func (c *CachedStorage) flush(entry *cacheEntry) error {
+	f, err := c.cache.fsys.Open(c.dataPath(entry.path))
+	if err != nil {
+		return err
+	}
+	_, err = c.primary.Write(entry.path, entry.perm, f)
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("flushing %s: %w", entry.path, err)
+	}
+	entry.dirty = false
+	if err := c.cache.fsys.Remove(c.dirtyPath(entry.path)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Read reads the file stored at path from the cache.
+// On miss, the file is read from the primary and stored to the cache, evicting others if needed.
+// Files which never fit in the budget are served directly from the primary.
+func (c *CachedStorage) Read(path string) (r stream.ReadAtReadSeekCloser, size int, err error) {
+	path = filepath.Clean(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[path]; ok {
+		f, err := c.cache.fsys.Open(c.dataPath(path))
+		if err == nil {
+			c.lru.MoveToFront(elem)
+			return f, int(elem.Value.(*cacheEntry).size), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, err
+		}
+		// removed from outside.
+		c.remove(path)
+	}
+
+	pr, size, err := c.primary.Read(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !c.fits(int64(size)) {
+		return pr, size, nil
+	}
+	err = c.cache.Write(c.dataPath(path), fs.ModePerm, pr)
+	_ = pr.Close()
+	if err != nil {
+		return nil, 0, err
+	}
+	c.add(&cacheEntry{path: path, size: int64(size)})
+	// keeps the entry being returned even when remaining ones are all dirty.
+	_ = c.evict(false, path)
+
+	f, err := c.cache.fsys.Open(c.dataPath(path))
+	if err != nil {
+		return nil, 0, err
+	}
+	return f, size, nil
+}
+
+// Write stores content read from r at path.
+//
+// Content is first written to the cache.
+// Unless CachePolicy.WriteBack is set, it is then written to the primary and
+// Write returns paths returned from the primary.
+// In write-back mode, it returns nil paths and errors from the primary, e.g. ErrAlreadyExists,
+// are reported by Flush or by Write that flushes the file for eviction.
+func (c *CachedStorage) Write(path string, perm fs.FileMode, r io.Reader) ([]string, error) {
+	path = filepath.Clean(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[path]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrAlreadyExists, path)
+	}
+
+	counter := stream.NewCountingReader(r)
+	if err := c.cache.Write(c.dataPath(path), perm, counter); err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{path: path, size: counter.Count(), perm: perm}
+
+	if !c.policy.WriteBack {
+		f, err := c.cache.fsys.Open(c.dataPath(path))
+		if err != nil {
+			return nil, err
+		}
+		paths, err := c.primary.Write(path, perm, f)
+		_ = f.Close()
+		if err != nil || !c.fits(entry.size) {
+			_ = c.cache.fsys.Remove(c.dataPath(path))
+			return paths, err
+		}
+		c.add(entry)
+		return paths, c.evict(false, "")
+	}
+
+	entry.dirty = true
+	err := c.cache.Write(c.dirtyPath(path), fs.ModePerm, strings.NewReader(strconv.FormatUint(uint64(perm), 8)))
+	if err != nil {
+		_ = c.cache.fsys.Remove(c.dataPath(path))
+		return nil, err
+	}
+	c.add(entry)
+	return nil, c.evict(true, "")
+}
+
+// Flush writes all files stored in write-back mode to the primary.
+// It continues after a failure and returns all errors combined.
+func (c *CachedStorage) Flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for elem := c.lru.Back(); elem != nil; elem = elem.Prev() {
+		if entry := elem.Value.(*cacheEntry); entry.dirty {
+			if err := c.flush(entry); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Delete removes the file stored at path from both of the cache and the primary.
+// Files stored in write-back mode and not yet flushed are only removed from the cache.
+func (c *CachedStorage) Delete(path string) error {
+	path = filepath.Clean(path)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var dirty bool
+	if elem, ok := c.entries[path]; ok {
+		dirty = elem.Value.(*cacheEntry).dirty
+		c.remove(path)
+		for _, p := range []string{c.dataPath(path), c.dirtyPath(path)} {
+			if err := c.cache.fsys.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if dirty {
+		return nil
+	}
+	return c.primary.Delete(path)
+}
+
+// Size returns the total size and the number of cached files.
+func (c *CachedStorage) Size() (bytes int64, entries int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size, c.lru.Len()
+}
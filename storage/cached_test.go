@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func readAllStorage(t *testing.T, s Storage, path string) []byte {
+	t.Helper()
+	r, _, err := s.Read(path)
+	assert.NilError(t, err)
+	defer func() { _ = r.Close() }()
+	bin, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	return bin
+}
+
+func TestCachedStorage(t *testing.T) {
+	primary, _, _ := newTestSplittingStorage(t)
+	cacheFsys := afero.NewMemMapFs()
+	cache := NewSafeWriter(cacheFsys, *fsutil.NewSafeWriteOption())
+
+	for _, p := range []string{"/foo", "/bar", "/baz"} {
+		_, err := primary.Write(p, fs.ModePerm, bytes.NewReader(randomBytes))
+		assert.NilError(t, err)
+	}
+
+	c, err := NewCachedStorage(primary, cache, CachePolicy{MaxEntries: 2})
+	assert.NilError(t, err)
+
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, c, "/foo")))
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, c, "/bar")))
+	// served from the cache.
+	assert.NilError(t, primary.Delete("/foo"))
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, c, "/foo")))
+
+	// /bar is the least recently used.
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, c, "/baz")))
+	size, entries := c.Size()
+	assert.Equal(t, int64(2*len(randomBytes)), size)
+	assert.Equal(t, 2, entries)
+	_, err = cacheFsys.Stat("/data/bar")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	// files larger than the budget are not cached.
+	small, err := NewCachedStorage(primary, NewSafeWriter(afero.NewMemMapFs(), *fsutil.NewSafeWriteOption()), CachePolicy{MaxBytes: 1024})
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, small, "/bar")))
+	_, entries = small.Size()
+	assert.Equal(t, 0, entries)
+
+	// write-through
+	_, err = c.Write("/qux", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, primary, "/qux")))
+	_, err = c.Write("/qux", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+}
+
+func TestCachedStorage_WriteBack(t *testing.T) {
+	primary, _, _ := newTestSplittingStorage(t)
+	cacheFsys := afero.NewMemMapFs()
+	cache := NewSafeWriter(cacheFsys, *fsutil.NewSafeWriteOption())
+
+	c, err := NewCachedStorage(primary, cache, CachePolicy{MaxEntries: 2, WriteBack: true})
+	assert.NilError(t, err)
+
+	paths, err := c.Write("/foo", 0o600, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(paths))
+	_, _, err = primary.Read("/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, c, "/foo")))
+
+	// dirty entries survive restarts.
+	c, err = NewCachedStorage(primary, cache, CachePolicy{MaxEntries: 2, WriteBack: true})
+	assert.NilError(t, err)
+	_, err = c.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	// exceeding the budget flushes the least recently used.
+	_, err = c.Write("/baz", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, primary, "/foo")))
+	_, _, err = primary.Read("/bar")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NilError(t, c.Flush())
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, primary, "/bar")))
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, primary, "/baz")))
+	_, err = cacheFsys.Stat("/dirty/bar")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NilError(t, c.Delete("/bar"))
+	_, _, err = primary.Read("/bar")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, _, err = c.Read("/bar")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCachedStorage_Read_overDirty(t *testing.T) {
+	primary, _, _ := newTestSplittingStorage(t)
+	cache := NewSafeWriter(afero.NewMemMapFs(), *fsutil.NewSafeWriteOption())
+
+	for _, p := range []string{"/foo", "/baz"} {
+		_, err := primary.Write(p, fs.ModePerm, bytes.NewReader(randomBytes))
+		assert.NilError(t, err)
+	}
+
+	c, err := NewCachedStorage(primary, cache, CachePolicy{MaxEntries: 1, WriteBack: true})
+	assert.NilError(t, err)
+
+	// /foo stays dirty since flushing it fails with ErrAlreadyExists.
+	_, err = c.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	_, err = c.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	_, entries := c.Size()
+	assert.Equal(t, 1, entries)
+
+	// a miss must not evict the file being returned.
+	assert.Assert(t, bytes.Equal(randomBytes, readAllStorage(t, c, "/baz")))
+	_, entries = c.Size()
+	assert.Equal(t, 2, entries)
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"math/bits"
+)
+
+// gearTable is a table of pseudo random numbers for the gear hash.
+// It is generated by splitmix64 with a fixed seed, so that chunk boundaries are stable across processes.
+var gearTable = func() (table [256]uint64) {
+	x := uint64(0x6d757369_63626f78)
+	for i := range table {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+type cdcSplitter struct {
+	r             *fusedReader
+	min, avg, max int
+	maskS, maskL  uint64
+	buf           []byte
+	start, end    int
+	failed        bool
+}
+
+// SplitReaderCDC returns ReaderSplitter splitting r at content-defined boundaries by FastCDC,
+// a gear based rolling hash with normalized chunking.
+//
+// Chunks are at least minSize, except the last one, and at most maxSize bytes long, averaging around avgSize.
+// Boundaries depend only on preceding bytes within a chunk,
+// so inserting or removing bytes in the source changes only a few chunks around the edit.
+// Size returns maxSize.
+//
+// It panics unless 0 < minSize <= avgSize <= maxSize.
+func SplitReaderCDC(r io.Reader, minSize, avgSize, maxSize uint) ReaderSplitter {
+	if minSize == 0 || minSize > avgSize || avgSize > maxSize {
+		panic("invalid sizes in SplitReaderCDC")
+	}
+	b := bits.Len(avgSize) - 1 // round down to a power of 2
+	return &cdcSplitter{
+		r:     &fusedReader{R: r},
+		min:   int(minSize),
+		avg:   int(avgSize),
+		max:   int(maxSize),
+		maskS: cdcMask(b + 1),
+		maskL: cdcMask(b - 1),
+		buf:   make([]byte, 2*maxSize),
+	}
+}
+
+// cdcMask returns a mask having n upper bits set, which are affected by the most recent bytes.
+func cdcMask(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	if n > 64 {
+		n = 64
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+func (s *cdcSplitter) Size() int {
+	return s.max
+}
+
+func (s *cdcSplitter) fill() {
+	if s.start > 0 {
+		s.end = copy(s.buf, s.buf[s.start:s.end])
+		s.start = 0
+	}
+	for s.end-s.start < s.max && !s.r.Melted() {
+		n, _ := s.r.Read(s.buf[s.end:])
+		s.end += n
+	}
+}
+
+func (s *cdcSplitter) Next() (r io.Reader, ok bool) {
+	if s.end-s.start < s.max {
+		s.fill()
+	}
+	if s.start == s.end {
+		if s.r.Err != nil && s.r.Err != io.EOF && !s.failed {
+			// propagate the error to the caller, only once.
+			s.failed = true
+			return &errReader{err: s.r.Err}, true
+		}
+		return nil, false
+	}
+
+	n := s.cut(s.buf[s.start:s.end])
+	chunk := s.buf[s.start : s.start+n]
+	s.start += n
+	return bytes.NewReader(chunk), true
+}
+
+// cut returns the length of the chunk at the head of data.
+func (s *cdcSplitter) cut(data []byte) int {
+	if len(data) <= s.min {
+		return len(data)
+	}
+	if len(data) > s.max {
+		data = data[:s.max]
+	}
+	normal := s.avg
+	if normal > len(data) {
+		normal = len(data)
+	}
+
+	var h uint64
+	i := s.min
+	for ; i < normal; i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&s.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < len(data); i++ {
+		h = (h << 1) + gearTable[data[i]]
+		if h&s.maskL == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
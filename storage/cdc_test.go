@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func splitAll(t *testing.T, splitter ReaderSplitter) [][]byte {
+	t.Helper()
+	var chunks [][]byte
+	for {
+		r, ok := splitter.Next()
+		if !ok {
+			return chunks
+		}
+		bin, err := io.ReadAll(r)
+		assert.NilError(t, err)
+		chunks = append(chunks, bin)
+	}
+}
+
+func TestSplitReaderCDC(t *testing.T) {
+	src := make([]byte, 1<<20)
+	_, _ = rand.New(rand.NewSource(1)).Read(src)
+
+	const minSize, avgSize, maxSize = 2 * 1024, 8 * 1024, 32 * 1024
+	splitter := SplitReaderCDC(bytes.NewReader(src), minSize, avgSize, maxSize)
+	assert.Equal(t, maxSize, splitter.Size())
+
+	chunks := splitAll(t, splitter)
+	assert.Assert(t, bytes.Equal(src, bytes.Join(chunks, nil)))
+	for i, c := range chunks {
+		assert.Assert(t, len(c) <= maxSize)
+		if i != len(chunks)-1 {
+			assert.Assert(t, len(c) >= minSize)
+		}
+	}
+	avg := len(src) / len(chunks)
+	assert.Assert(t, avgSize/2 < avg && avg < avgSize*2, "avg = %d", avg)
+
+	// boundaries survive an insertion.
+	inserted := append(append(bytes.Clone(src[:len(src)/2]), []byte("inserted")...), src[len(src)/2:]...)
+	sums := map[[32]byte]bool{}
+	for _, c := range chunks {
+		sums[sha256.Sum256(c)] = true
+	}
+	var shared int
+	insertedChunks := splitAll(t, SplitReaderCDC(bytes.NewReader(inserted), minSize, avgSize, maxSize))
+	for _, c := range insertedChunks {
+		if sums[sha256.Sum256(c)] {
+			shared++
+		}
+	}
+	assert.Assert(t, shared >= len(insertedChunks)-3, "shared = %d, total = %d", shared, len(insertedChunks))
+
+	assert.Equal(t, 0, len(splitAll(t, SplitReaderCDC(bytes.NewReader(nil), minSize, avgSize, maxSize))))
+}
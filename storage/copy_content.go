@@ -11,8 +11,8 @@ import (
 
 // CopyContents copies each field of contents to its corresponding field of pathHandle.
 //
-// pathHandle and contents must be flat structs and
-// must only contain exported afero.Fs, fs.FS fields respectively.
+// pathHandle and contents must be structs and
+// must only contain exported afero.Fs, fs.FS fields respectively, or nested structs of same shape.
 //
 //	type pathHandle struct {
 //		RuntimeEnvFiles afero.Fs
@@ -54,9 +54,20 @@ func CopyContents(pathHandle, contents any) error {
 		cRv = cRv.Elem()
 	}
 
-	for i := 0; i < hRv.NumField(); i++ {
-		hf := hRv.Field(i)
+	return copyContents(hRv, cRv)
+}
+
+func copyContents(hRv, cRv reflect.Value) error {
+	for i := 0; i < cRv.NumField(); i++ {
 		cf := cRv.Field(i)
+		hf := hRv.FieldByName(cRv.Type().Field(i).Name)
+
+		if cf.Kind() == reflect.Struct {
+			if err := copyContents(hf, cf); err != nil {
+				return err
+			}
+			continue
+		}
 
 		if cf.IsNil() {
 			continue
@@ -75,6 +86,12 @@ func ValidateCopyContentsInput(pathHandle, dirContents any, allowNilField bool)
 }
 
 func validCopyContentsInput(hRv, cRv reflect.Value, allowNilField bool) error {
+	return validContents(hRv, cRv, allowNilField, false)
+}
+
+// validContents validates contents against pathHandle.
+// If allowReadOnly is true, pathHandle may have read-only fields, see PrepareHandle.
+func validContents(hRv, cRv reflect.Value, allowNilField, allowReadOnly bool) error {
 	if hRv.Kind() == reflect.Pointer && !hRv.IsNil() {
 		hRv = hRv.Elem()
 	}
@@ -89,6 +106,10 @@ func validCopyContentsInput(hRv, cRv reflect.Value, allowNilField bool) error {
 		return fmt.Errorf("%w: initialContents is not a struct", ErrInvalidInput)
 	}
 
+	return validCopyContentsFields(hRv, cRv, allowNilField, allowReadOnly)
+}
+
+func validCopyContentsFields(hRv, cRv reflect.Value, allowNilField, allowReadOnly bool) error {
 	if hRv.NumField() != cRv.NumField() {
 		return fmt.Errorf("%w: pathHandle and initialContents mismatches their NumField", ErrInvalidInput)
 	}
@@ -99,6 +120,12 @@ func validCopyContentsInput(hRv, cRv reflect.Value, allowNilField bool) error {
 
 		fieldNames[st.Name] = struct{}{}
 
+		if st.Type.Kind() == reflect.Struct {
+			continue
+		}
+		if allowReadOnly && isReadOnlyHandleType(st.Type) {
+			continue
+		}
 		if !st.Type.Implements(aferoFsType) {
 			return fmt.Errorf(
 				"%w: pathHandle must only have exported afero.Fs field, but is %s",
@@ -113,17 +140,31 @@ func validCopyContentsInput(hRv, cRv reflect.Value, allowNilField bool) error {
 	for i := 0; i < cRv.NumField(); i++ {
 		st := cRv.Type().Field(i)
 
-		if !st.Type.Implements(fsFsType) {
+		if _, ok := fieldNames[st.Name]; !ok {
 			return fmt.Errorf(
-				"%w: contents must only have exported fs.FS field, but is %s",
-				ErrInvalidInput, st.Type.String(),
+				"%w: pathHandle and contents must have exact same keyed exported fields, but field %s does not exist in pathHandle",
+				ErrInvalidInput, st.Name,
 			)
 		}
 
-		if _, ok := fieldNames[st.Name]; !ok {
+		hf := hRv.FieldByName(st.Name)
+		if st.Type.Kind() == reflect.Struct || hf.Kind() == reflect.Struct {
+			if st.Type.Kind() != hf.Kind() {
+				return fmt.Errorf(
+					"%w: field %s must be a struct in both of pathHandle and contents",
+					ErrInvalidInput, st.Name,
+				)
+			}
+			if err := validCopyContentsFields(hf, cRv.Field(i), allowNilField, allowReadOnly); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !st.Type.Implements(fsFsType) {
 			return fmt.Errorf(
-				"%w: pathHandle and contents must have exact same keyed exported fields, but field %s does not exist in pathHandle",
-				ErrInvalidInput, st.Name,
+				"%w: contents must only have exported fs.FS field, but is %s",
+				ErrInvalidInput, st.Type.String(),
 			)
 		}
 	}
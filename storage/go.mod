@@ -3,12 +3,16 @@ module github.com/ngicks/musicbox/storage
 go 1.20.0
 
 require (
+	github.com/klauspost/compress v1.17.4
 	github.com/ngicks/musicbox/fsutil v0.0.0-20240303195148-edbd76b1e320
+	github.com/ngicks/musicbox/stream v0.0.0-20240310233034-2cafc1fbba1d
 	github.com/spf13/afero v1.11.0
+	golang.org/x/crypto v0.18.0
 	gotest.tools/v3 v3.5.1
 )
 
 require (
 	github.com/google/go-cmp v0.5.9 // indirect
+	golang.org/x/sys v0.16.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+
+	"github.com/spf13/afero"
+)
+
+// ErrInvalidHandle is returned from ValidateHandle if directories differ from what pathSet declares.
+var ErrInvalidHandle = errors.New("invalid handle")
+
+// pathSetDir is a directory declared by a field of pathSet.
+type pathSetDir struct {
+	// field is dot-separated names of the field and its enclosing fields.
+	field string
+	path  string
+	tag   pathSetTag
+	// nested is true for a tagged nested struct, whose directory contains directories of its fields.
+	nested bool
+}
+
+// pathSetDirs lists directories declared by pathSet in definition order, enclosing directories first.
+// Untagged nested structs are not listed since they declare no directory.
+func pathSetDirs(pathSet any) ([]pathSetDir, error) {
+	sRv := reflect.ValueOf(pathSet)
+	if sRv.Kind() == reflect.Pointer && !sRv.IsNil() {
+		sRv = sRv.Elem()
+	}
+	if sRv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: dirSet must be a struct type but kind is %s", ErrInvalidInput, sRv.Kind())
+	}
+	var dirs []pathSetDir
+	err := appendPathSetDirs(&dirs, "", ".", sRv)
+	return dirs, err
+}
+
+func appendPathSetDirs(dirs *[]pathSetDir, prefix, parent string, sRv reflect.Value) error {
+	for i := 0; i < sRv.NumField(); i++ {
+		sf := sRv.Type().Field(i)
+		name := sf.Name
+		if prefix != "" {
+			name = prefix + "." + sf.Name
+		}
+		tag, err := parsePathSetTag(sf)
+		if err != nil {
+			return err
+		}
+
+		field := sRv.Field(i)
+		path := pathSetFieldPath(parent, field, tag)
+		switch field.Kind() {
+		case reflect.Struct:
+			if tag.dir != "" {
+				*dirs = append(*dirs, pathSetDir{field: name, path: path, tag: tag, nested: true})
+			}
+			if err := appendPathSetDirs(dirs, name, path, field); err != nil {
+				return err
+			}
+		case reflect.String:
+			if field.String() == "" && tag.dir == "" {
+				return fmt.Errorf("%w: dirSet specifies empty directory for field %s", ErrInvalidInput, name)
+			}
+			if !filepath.IsLocal(path) {
+				return fmt.Errorf("%w: field %s specifies absolute directory or parent directory.", ErrInvalidInput, name)
+			}
+			*dirs = append(*dirs, pathSetDir{field: name, path: path, tag: tag})
+		default:
+			return fmt.Errorf(
+				"%w: dirSet must only have exported string or struct fields, but field %s has %s field",
+				ErrInvalidInput, name, field.Kind(),
+			)
+		}
+	}
+	return nil
+}
+
+// ValidateHandle checks that directories prepared by PrepareHandle for pathSet still exist under base
+// and have permission bits specified by `pathset` tags.
+//
+// It reports all problems found, combined by errors.Join.
+// Missing directories are reported by errors wrapping fs.ErrNotExist
+// and other mismatches are reported by errors wrapping ErrInvalidHandle.
+func ValidateHandle(base afero.Fs, pathSet any) error {
+	dirs, err := pathSetDirs(pathSet)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, d := range dirs {
+		info, err := base.Stat(d.path)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("field %s: %w", d.field, err))
+		case !info.IsDir():
+			errs = append(errs, fmt.Errorf("%w: field %s: %s is not a directory", ErrInvalidHandle, d.field, d.path))
+		case d.tag.hasMode && info.Mode().Perm() != d.tag.mode:
+			errs = append(errs, fmt.Errorf(
+				"%w: field %s: %s has mode %o, expected %o",
+				ErrInvalidHandle, d.field, d.path, info.Mode().Perm(), d.tag.mode,
+			))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TeardownPolicy configures TeardownHandle.
+type TeardownPolicy struct {
+	// ArchiveDir, if non empty, is a directory relative to base
+	// to which directories are moved, keeping their paths relative to base, instead of being removed.
+	// TeardownHandle fails with an error wrapping fs.ErrExist if the destination already exists.
+	ArchiveDir string
+}
+
+// TeardownHandle removes, or archives if policy says so, directories prepared by PrepareHandle for pathSet under base.
+//
+// Directories for string fields are removed with all their contents.
+// Directories of tagged nested structs are removed only if they are empty after that,
+// so that contents not declared by pathSet are kept.
+// Missing directories are ignored, thus TeardownHandle can be called again after a failure.
+func TeardownHandle(base afero.Fs, pathSet any, policy TeardownPolicy) error {
+	dirs, err := pathSetDirs(pathSet)
+	if err != nil {
+		return err
+	}
+	if policy.ArchiveDir != "" && !filepath.IsLocal(filepath.FromSlash(policy.ArchiveDir)) {
+		return fmt.Errorf("%w: ArchiveDir is absolute directory or parent directory.", ErrInvalidInput)
+	}
+
+	for _, d := range dirs {
+		if d.nested {
+			continue
+		}
+		if _, err := base.Stat(d.path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if policy.ArchiveDir == "" {
+			if err := base.RemoveAll(d.path); err != nil {
+				return fmt.Errorf("field %s: %w", d.field, err)
+			}
+			continue
+		}
+		if err := archiveDir(base, d.path, filepath.Join(filepath.FromSlash(policy.ArchiveDir), d.path)); err != nil {
+			return fmt.Errorf("field %s: %w", d.field, err)
+		}
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		d := dirs[i]
+		if !d.nested {
+			continue
+		}
+		dirents, err := afero.ReadDir(base, d.path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if len(dirents) > 0 {
+			continue
+		}
+		if err := base.Remove(d.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("field %s: %w", d.field, err)
+		}
+	}
+	return nil
+}
+
+func archiveDir(base afero.Fs, src, dst string) error {
+	if _, err := base.Stat(dst); err == nil {
+		return &fs.PathError{Op: "archive", Path: dst, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := base.MkdirAll(filepath.Dir(dst), fs.ModeDir|0o777); err != nil {
+		return err
+	}
+	return base.Rename(src, dst)
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"io/fs"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gotest.tools/v3/assert"
+)
+
+func TestValidateHandle(t *testing.T) {
+	base := afero.NewMemMapFs()
+	pathSet := nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}}
+	_, err := PrepareHandle[nestedDirSet, nestedPathHandle](base, pathSet, nil)
+	assert.NilError(t, err)
+
+	assert.NilError(t, ValidateHandle(base, pathSet))
+
+	assert.NilError(t, base.Chmod("data/cache", fs.ModeDir|0o755))
+	assert.NilError(t, base.RemoveAll("config"))
+	err = ValidateHandle(base, pathSet)
+	assert.ErrorIs(t, err, ErrInvalidHandle)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.ErrorIs(t, ValidateHandle(base, invalidDirSet{Foo: "foo"}), ErrInvalidInput)
+}
+
+func TestTeardownHandle(t *testing.T) {
+	pathSet := nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}}
+
+	t.Run("remove", func(t *testing.T) {
+		base := afero.NewMemMapFs()
+		handle, err := PrepareHandle[nestedDirSet, nestedPathHandle](base, pathSet, nil)
+		assert.NilError(t, err)
+		assert.NilError(t, afero.WriteFile(handle.Data.Cache, "foo", []byte("foo"), 0o644))
+
+		assert.NilError(t, TeardownHandle(base, pathSet, TeardownPolicy{}))
+		for _, p := range []string{"config", "data/cache", "data/blobs", "data"} {
+			_, err := base.Stat(p)
+			assert.ErrorIs(t, err, fs.ErrNotExist, "path = %s", p)
+		}
+		// idempotent
+		assert.NilError(t, TeardownHandle(base, pathSet, TeardownPolicy{}))
+	})
+
+	t.Run("archive", func(t *testing.T) {
+		base := afero.NewMemMapFs()
+		handle, err := PrepareHandle[nestedDirSet, nestedPathHandle](base, pathSet, nil)
+		assert.NilError(t, err)
+		assert.NilError(t, afero.WriteFile(handle.Data.Cache, "foo", []byte("foo"), 0o644))
+		// not declared by pathSet.
+		assert.NilError(t, afero.WriteFile(base, "data/other", []byte("other"), 0o644))
+
+		assert.NilError(t, TeardownHandle(base, pathSet, TeardownPolicy{ArchiveDir: "archive"}))
+		bin, err := afero.ReadFile(base, "archive/data/cache/foo")
+		assert.NilError(t, err)
+		assert.Equal(t, "foo", string(bin))
+		_, err = base.Stat("data/cache")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+		_, err = base.Stat("data/other")
+		assert.NilError(t, err)
+
+		_, err = PrepareHandle[nestedDirSet, nestedPathHandle](base, pathSet, nil)
+		assert.NilError(t, err)
+		assert.ErrorIs(t, TeardownHandle(base, pathSet, TeardownPolicy{ArchiveDir: "archive"}), fs.ErrExist)
+	})
+}
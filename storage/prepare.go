@@ -6,7 +6,10 @@ import (
 	"io/fs"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 
+	"github.com/ngicks/musicbox/fsutil"
 	"github.com/spf13/afero"
 )
 
@@ -15,8 +18,54 @@ var ErrInvalidInput = errors.New("invalid input")
 var (
 	aferoFsType = reflect.TypeOf((*afero.Fs)(nil)).Elem()
 	fsFsType    = reflect.TypeOf((*fs.FS)(nil)).Elem()
+	ioFsType    = reflect.TypeOf(afero.IOFS{})
 )
 
+// isReadOnlyHandleType reports whether a handle field of type t is given a read-only view.
+func isReadOnlyHandleType(t reflect.Type) bool {
+	return t.Kind() == reflect.Interface && !t.Implements(aferoFsType) && ioFsType.AssignableTo(t)
+}
+
+// readOnlyView returns a read-only fs.FS of fsys. Unlike afero.NewIOFS, writing through its Fs field also fails.
+func readOnlyView(fsys afero.Fs) afero.IOFS {
+	return afero.NewIOFS(afero.NewReadOnlyFs(fsys))
+}
+
+// PrepareHandle creates directories under base as specified by pathSet
+// and returns handle H whose afero.Fs fields are rooted at the corresponding directories.
+// If initialContents is non nil, it is copied into the handle by CopyContents.
+//
+// pathSet is a struct whose exported fields are either strings or nested structs.
+// H must have fields with exact same names, afero.Fs for strings and structs of same shape for nested structs.
+// A string field specifies a directory, relative to base or to the directory of the enclosing struct.
+//
+// Fields of H can also be fs.FS, or other interfaces afero.IOFS implements, e.g. fs.ReadDirFS,
+// to declare the directory is only read through the handle.
+// They are set to read-only views of the directories.
+// initialContents is still copied into them.
+//
+// Fields of pathSet can be tagged with `pathset:"dir,mode=0750"`.
+// For a string field, dir is used if the field is empty.
+// For a nested struct field, dir is the directory which its fields are relative to.
+// It is created if tagged, and otherwise fields of the nested struct are relative to the enclosing directory.
+// mode, in octal, sets permission bits of the directory.
+// Directories without mode are created with 0o777 before umask and existing ones are left unchanged.
+//
+//	type pathSet struct {
+//		Config string `pathset:",mode=0750"`
+//		Data   struct {
+//			Cache string `pathset:"cache,mode=0700"`
+//			Blobs string
+//		} `pathset:"data"`
+//	}
+//
+//	type handle struct {
+//		Config fs.FS
+//		Data   struct {
+//			Cache afero.Fs
+//			Blobs afero.Fs
+//		}
+//	}
 func PrepareHandle[S, H any](base afero.Fs, pathSet S, initialContents any) (H, error) {
 	var handle, zero H
 
@@ -27,39 +76,209 @@ func PrepareHandle[S, H any](base afero.Fs, pathSet S, initialContents any) (H,
 		return zero, err
 	}
 
-	hRv = hRv.Elem()
-
-	for i := 0; i < sRv.NumField(); i++ {
-		field := sRv.Field(i)
-		// field.String() does not panic upon invoked for non string field.
-		// That's not what we want it to be.
-		name, path := sRv.Type().Field(i).Name, field.Interface().(string)
-		path = filepath.Clean(filepath.FromSlash(path))
-
-		err := base.MkdirAll(path, fs.ModeDir|0o777)
+	var icRv reflect.Value
+	if initialContents != nil {
+		icRv = reflect.ValueOf(initialContents)
+		err := validContents(hRv.Elem(), icRv, true, true)
 		if err != nil {
 			return zero, err
 		}
-
-		fsys := afero.NewBasePathFs(base, path)
-		aferoField := hRv.FieldByName(name)
-		aferoField.Set(reflect.ValueOf(fsys))
+		if icRv.Kind() == reflect.Pointer {
+			icRv = icRv.Elem()
+		}
 	}
 
-	if initialContents != nil {
-		icRv := reflect.ValueOf(initialContents)
-		err := validCopyContentsInput(hRv, icRv, true)
-		if err != nil {
+	if sRv.Kind() != reflect.Invalid {
+		if err := prepareDirs(base, ".", sRv, hRv.Elem(), icRv); err != nil {
 			return zero, err
 		}
-		err = CopyContents(handle, initialContents)
+	}
+
+	return handle, nil
+
+}
+
+// pathSetTag is a parsed `pathset` struct tag.
+type pathSetTag struct {
+	dir     string
+	mode    fs.FileMode
+	hasMode bool
+}
+
+func parsePathSetTag(field reflect.StructField) (pathSetTag, error) {
+	var tag pathSetTag
+	v, ok := field.Tag.Lookup("pathset")
+	if !ok {
+		return tag, nil
+	}
+	dir, opts, _ := strings.Cut(v, ",")
+	tag.dir = dir
+	for opts != "" {
+		var opt string
+		opt, opts, _ = strings.Cut(opts, ",")
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "mode":
+			mode, err := strconv.ParseUint(val, 8, 32)
+			if err != nil || mode > 0o777 {
+				return tag, fmt.Errorf("%w: field %s has invalid mode %q", ErrInvalidInput, field.Name, val)
+			}
+			tag.mode, tag.hasMode = fs.FileMode(mode), true
+		default:
+			return tag, fmt.Errorf("%w: field %s has unknown pathset option %q", ErrInvalidInput, field.Name, opt)
+		}
+	}
+	if tag.dir != "" && !filepath.IsLocal(filepath.FromSlash(tag.dir)) {
+		return tag, fmt.Errorf("%w: field %s specifies absolute directory or parent directory in tag.", ErrInvalidInput, field.Name)
+	}
+	return tag, nil
+}
+
+func mkdirTagged(base afero.Fs, path string, tag pathSetTag) error {
+	if !tag.hasMode {
+		return base.MkdirAll(path, fs.ModeDir|0o777)
+	}
+	if err := base.MkdirAll(path, fs.ModeDir|tag.mode); err != nil {
+		return err
+	}
+	// MkdirAll is affected by umask and does nothing for existing directories.
+	return base.Chmod(path, fs.ModeDir|tag.mode)
+}
+
+// pathSetFieldPath returns the directory which the field of pathSet specifies under parent.
+// For a nested struct without the tag, it is parent itself.
+func pathSetFieldPath(parent string, field reflect.Value, tag pathSetTag) string {
+	if field.Kind() == reflect.Struct {
+		if tag.dir == "" {
+			return parent
+		}
+		return filepath.Join(parent, filepath.FromSlash(tag.dir))
+	}
+	// Kind is checked to be string. Use String rather than Interface().(string) to allow named string types.
+	p := field.String()
+	if p == "" {
+		p = tag.dir
+	}
+	return filepath.Join(parent, filepath.Clean(filepath.FromSlash(p)))
+}
+
+// prepareDirs creates directories specified by sRv under parent, copies contents of cRv into them
+// and sets handles to hRv. cRv may be an invalid Value for no contents.
+// Inputs must be validated by validPrepareInput and validContents beforehand.
+func prepareDirs(base afero.Fs, parent string, sRv, hRv, cRv reflect.Value) error {
+	for i := 0; i < sRv.NumField(); i++ {
+		sf := sRv.Type().Field(i)
+		tag, err := parsePathSetTag(sf)
 		if err != nil {
-			return zero, err
+			return err
+		}
+		field, hField := sRv.Field(i), hRv.FieldByName(sf.Name)
+		var cField reflect.Value
+		if cRv.IsValid() {
+			cField = cRv.FieldByName(sf.Name)
+		}
+
+		if field.Kind() == reflect.Struct {
+			dir := pathSetFieldPath(parent, field, tag)
+			if tag.dir != "" {
+				if err := mkdirTagged(base, dir, tag); err != nil {
+					return err
+				}
+			}
+			if err := prepareDirs(base, dir, field, hField, cField); err != nil {
+				return err
+			}
+			continue
+		}
+
+		path := pathSetFieldPath(parent, field, tag)
+
+		if err := mkdirTagged(base, path, tag); err != nil {
+			return err
+		}
+
+		fsys := afero.NewBasePathFs(base, path)
+		if cField.IsValid() && !cField.IsNil() {
+			if err := fsutil.CopyFS(fsys, cField.Interface().(fs.FS)); err != nil {
+				return err
+			}
+		}
+		if isReadOnlyHandleType(hField.Type()) {
+			hField.Set(reflect.ValueOf(readOnlyView(fsys)))
+		} else {
+			hField.Set(reflect.ValueOf(fsys))
 		}
 	}
+	return nil
+}
 
-	return handle, nil
+// ReadOnlyHandle returns R whose fields are read-only views of same-named afero.Fs fields of handle,
+// e.g. to pass a handle returned from PrepareHandle to components which should only read it.
+//
+// R must have same shape as handle, with fs.FS, or other interfaces afero.IOFS implements, in place of afero.Fs.
+// Fields of R may also be afero.Fs, which are set to afero.NewReadOnlyFs.
+// Nil fields of handle are left nil.
+func ReadOnlyHandle[R any](handle any) (R, error) {
+	var view, zero R
+
+	hRv := reflect.ValueOf(handle)
+	if hRv.Kind() == reflect.Pointer && !hRv.IsNil() {
+		hRv = hRv.Elem()
+	}
+	vRv := reflect.ValueOf(&view).Elem()
+	if hRv.Kind() != reflect.Struct || vRv.Kind() != reflect.Struct {
+		return zero, fmt.Errorf("%w: handle and R must be structs", ErrInvalidInput)
+	}
+
+	if err := readOnlyFields("", hRv, vRv); err != nil {
+		return zero, err
+	}
+	return view, nil
+}
+
+func readOnlyFields(prefix string, hRv, vRv reflect.Value) error {
+	if hRv.NumField() != vRv.NumField() {
+		return fmt.Errorf("%w: handle and R mismatches their NumField", ErrInvalidInput)
+	}
+	for i := 0; i < vRv.NumField(); i++ {
+		vf := vRv.Type().Field(i)
+		name := vf.Name
+		if prefix != "" {
+			name = prefix + "." + vf.Name
+		}
+		hf := hRv.FieldByName(vf.Name)
+		if !hf.IsValid() {
+			return fmt.Errorf("%w: field %s does not exist in handle", ErrInvalidInput, name)
+		}
+
+		switch {
+		case vf.Type.Kind() == reflect.Struct && hf.Kind() == reflect.Struct:
+			if err := readOnlyFields(name, hf, vRv.Field(i)); err != nil {
+				return err
+			}
+			continue
+		case !hf.Type().Implements(aferoFsType) || hf.Kind() == reflect.Struct:
+			return fmt.Errorf("%w: field %s of handle must be afero.Fs, but is %s", ErrInvalidInput, name, hf.Type())
+		}
 
+		var fsys afero.Fs
+		if !hf.IsNil() {
+			fsys = hf.Interface().(afero.Fs)
+		}
+		switch {
+		case isReadOnlyHandleType(vf.Type):
+			if fsys != nil {
+				vRv.Field(i).Set(reflect.ValueOf(readOnlyView(fsys)))
+			}
+		case vf.Type == aferoFsType:
+			if fsys != nil {
+				vRv.Field(i).Set(reflect.ValueOf(afero.NewReadOnlyFs(fsys)))
+			}
+		default:
+			return fmt.Errorf("%w: field %s of R must be fs.FS or afero.Fs, but is %s", ErrInvalidInput, name, vf.Type)
+		}
+	}
+	return nil
 }
 
 // func isEmpty(s string) bool {
@@ -95,23 +314,29 @@ func validPrepareInput(sRv, hRv reflect.Value) error {
 		)
 	}
 
-	hRv = hRv.Elem()
+	return validPrepareFields("", sRv, hRv.Elem())
+}
 
+// validPrepareFields validates fields of sRv and hRv, both are structs.
+// prefix is the dot-separated names of enclosing fields, used in error messages.
+func validPrepareFields(prefix string, sRv, hRv reflect.Value) error {
 	if sRv.NumField() != hRv.NumField() {
+		at := ""
+		if prefix != "" {
+			at = " at " + prefix
+		}
 		return fmt.Errorf(
 			"%w: unmatched NumField, dirSet and pathHandle must have exact same keyed exported fields,"+
-				" dirSet has %d fields, pathHandle has %d fields.",
-			ErrInvalidInput, sRv.NumField(), hRv.NumField(),
+				" dirSet has %d fields, pathHandle has %d fields%s.",
+			ErrInvalidInput, sRv.NumField(), hRv.NumField(), at,
 		)
 	}
 
-	hFieldSet := make(map[string]struct{})
 	for i := 0; i < hRv.NumField(); i++ {
-		hFieldSet[hRv.Type().Field(i).Name] = struct{}{}
 		field := hRv.Type().Field(i)
-		if !field.Type.Implements(aferoFsType) {
+		if field.Type.Kind() != reflect.Struct && !field.Type.Implements(aferoFsType) && !isReadOnlyHandleType(field.Type) {
 			return fmt.Errorf(
-				"%w: pathHandle must only have exported afero.Fs field, but is %s",
+				"%w: pathHandle must only have exported afero.Fs, fs.FS or struct field, but is %s",
 				ErrInvalidInput, field.Type.String(),
 			)
 		}
@@ -120,25 +345,59 @@ func validPrepareInput(sRv, hRv reflect.Value) error {
 	for i := 0; i < sRv.NumField(); i++ {
 		// It does not need to be exact same layout (definition order).
 		dirSetField := sRv.Field(i)
-		dirSetFieldName := sRv.Type().Field(i).Name
-		if dirSetField.Kind() != reflect.String {
+		sf := sRv.Type().Field(i)
+		dirSetFieldName := sf.Name
+		if prefix != "" {
+			dirSetFieldName = prefix + "." + sf.Name
+		}
+		hf, ok := hRv.Type().FieldByName(sf.Name)
+		if !ok {
 			return fmt.Errorf(
-				"%w: dirSet must only have exported string fields, but field %s has %s field",
+				"%w: dirSet and pathHandle must have exact same keyed exported fields, but field %s does not exist in pathHandle",
+				ErrInvalidInput, dirSetFieldName,
+			)
+		}
+
+		tag, err := parsePathSetTag(sf)
+		if err != nil {
+			return err
+		}
+
+		switch dirSetField.Kind() {
+		case reflect.Struct:
+			if hf.Type.Kind() != reflect.Struct {
+				return fmt.Errorf(
+					"%w: field %s is a struct in dirSet but is %s in pathHandle",
+					ErrInvalidInput, dirSetFieldName, hf.Type.String(),
+				)
+			}
+			if err := validPrepareFields(dirSetFieldName, dirSetField, hRv.FieldByName(sf.Name)); err != nil {
+				return err
+			}
+			continue
+		case reflect.String:
+		default:
+			return fmt.Errorf(
+				"%w: dirSet must only have exported string or struct fields, but field %s has %s field",
 				ErrInvalidInput, dirSetFieldName, dirSetField.Kind(),
 			)
 		}
-		if _, ok := hFieldSet[dirSetFieldName]; !ok {
+
+		if hf.Type.Kind() == reflect.Struct {
 			return fmt.Errorf(
-				"%w: dirSet and pathHandle must have exact same keyed exported fields, but field %s does not exist in pathHandle",
+				"%w: field %s is a string in dirSet but is a struct in pathHandle",
 				ErrInvalidInput, dirSetFieldName,
 			)
 		}
 
-		v := dirSetField.Interface().(string)
+		v := dirSetField.String()
+		if v == "" {
+			v = tag.dir
+		}
 		if v == "" {
 			return fmt.Errorf("%w: dirSet specifies empty directory", ErrInvalidInput)
 		}
-		if !filepath.IsLocal(v) {
+		if !filepath.IsLocal(filepath.FromSlash(v)) {
 			return fmt.Errorf("%w: dirSet specifies absolute directory or parent directory.", ErrInvalidInput)
 		}
 	}
@@ -3,8 +3,10 @@ package storage
 import (
 	_ "embed"
 	"errors"
+	"io/fs"
 	"reflect"
 	"testing"
+	"testing/fstest"
 
 	"github.com/spf13/afero"
 	"gotest.tools/v3/assert"
@@ -121,6 +123,29 @@ func TestPrepare_validPrepareInput(t *testing.T) {
 			h:   &pathHandle2{},
 			err: ErrInvalidInput,
 		},
+		{
+			name: "nested",
+			s:    nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}},
+			h:    &nestedPathHandle{},
+		},
+		{
+			name: "nested, unmatched kind",
+			s:    nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}},
+			h:    &invalidNestedPathHandle{},
+			err:  ErrInvalidInput,
+		},
+		{
+			name: "invalid mode",
+			s:    taggedDirSet{Foo: "foo"},
+			h:    &pathHandle1{},
+			err:  ErrInvalidInput,
+		},
+		{
+			name: "unknown tag option",
+			s:    unknownTagDirSet{Foo: "foo"},
+			h:    &pathHandle1{},
+			err:  ErrInvalidInput,
+		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
 			err := validPrepareInput(reflect.ValueOf(tc.s), reflect.ValueOf(tc.h))
@@ -175,3 +200,124 @@ type invalidPathHandle struct {
 	Foo afero.Fs
 	Bar int
 }
+
+type nestedDataSet struct {
+	Cache string `pathset:",mode=0700"`
+	Blobs string `pathset:"blobs"`
+}
+
+type nestedDirSet struct {
+	Config string        `pathset:",mode=0750"`
+	Data   nestedDataSet `pathset:"data,mode=0755"`
+}
+
+type nestedPathHandle struct {
+	Config afero.Fs
+	Data   struct {
+		Cache afero.Fs
+		Blobs afero.Fs
+	}
+}
+
+type invalidNestedPathHandle struct {
+	Config afero.Fs
+	Data   afero.Fs
+}
+
+type taggedDirSet struct {
+	Foo string `pathset:",mode=0999"`
+}
+
+type unknownTagDirSet struct {
+	Foo string `pathset:",owner=root"`
+}
+
+func TestPrepareHandle_Nested(t *testing.T) {
+	base := afero.NewMemMapFs()
+	type contents struct {
+		Config fs.FS
+		Data   struct {
+			Cache fs.FS
+			Blobs fs.FS
+		}
+	}
+	var c contents
+	c.Data.Blobs = fstest.MapFS{"foo": &fstest.MapFile{Data: []byte("foo"), Mode: 0o644}}
+
+	handle, err := PrepareHandle[nestedDirSet, nestedPathHandle](
+		base,
+		nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}},
+		c,
+	)
+	assert.NilError(t, err)
+
+	for path, perm := range map[string]fs.FileMode{
+		"config":     0o750,
+		"data":       0o755,
+		"data/cache": 0o700,
+		"data/blobs": 0o777,
+	} {
+		info, err := base.Stat(path)
+		assert.NilError(t, err)
+		assert.Assert(t, info.IsDir())
+		assert.Equal(t, perm, info.Mode().Perm(), "path = %s", path)
+	}
+
+	bin, err := afero.ReadFile(handle.Data.Blobs, "foo")
+	assert.NilError(t, err)
+	assert.Equal(t, "foo", string(bin))
+	_, err = base.Stat("data/blobs/foo")
+	assert.NilError(t, err)
+}
+
+func TestPrepareHandle_ReadOnly(t *testing.T) {
+	type readOnlyHandle struct {
+		Config fs.FS
+		Data   struct {
+			Cache afero.Fs
+			Blobs fs.ReadDirFS
+		}
+	}
+
+	base := afero.NewMemMapFs()
+	handle, err := PrepareHandle[nestedDirSet, readOnlyHandle](
+		base,
+		nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}},
+		struct {
+			Config fs.FS
+			Data   struct {
+				Cache fs.FS
+				Blobs fs.FS
+			}
+		}{Config: fstest.MapFS{"app.yaml": &fstest.MapFile{Data: []byte("app"), Mode: 0o644}}},
+	)
+	assert.NilError(t, err)
+
+	bin, err := fs.ReadFile(handle.Config, "app.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, "app", string(bin))
+	// the read-only view can not be written even through the underlying afero.Fs.
+	err = afero.WriteFile(handle.Config.(afero.IOFS).Fs, "app.yaml", []byte("overwritten"), 0o644)
+	assert.Assert(t, err != nil)
+	assert.NilError(t, afero.WriteFile(handle.Data.Cache, "foo", []byte("foo"), 0o644))
+	dirents, err := handle.Data.Blobs.ReadDir(".")
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(dirents))
+
+	writable, err := PrepareHandle[nestedDirSet, nestedPathHandle](
+		base,
+		nestedDirSet{Config: "config", Data: nestedDataSet{Cache: "cache"}},
+		nil,
+	)
+	assert.NilError(t, err)
+	view, err := ReadOnlyHandle[readOnlyHandle](writable)
+	assert.NilError(t, err)
+	bin, err = fs.ReadFile(view.Config, "app.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, "app", string(bin))
+	err = afero.WriteFile(view.Data.Cache, "foo", []byte("bar"), 0o644)
+	assert.Assert(t, err != nil)
+
+	_, err = ReadOnlyHandle[pathHandle1](writable)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
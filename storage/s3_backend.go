@@ -0,0 +1,490 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Credentials is a set of credentials used to sign requests by AWS Signature Version 4.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials. It may be empty.
+	SessionToken string
+}
+
+const (
+	// s3MinPartSize is the minimum size of parts except the last one, defined by S3.
+	s3MinPartSize = 5 * 1024 * 1024
+	// s3DefaultPartSize is the default size of parts.
+	s3DefaultPartSize = 8 * 1024 * 1024
+)
+
+// S3Backend is a Backend storing objects in a bucket of S3-compatible object storage.
+//
+// Since object storage has no rename, the atomic unit is the upload itself.
+// Put uploads content smaller than the part size by a single PutObject
+// and otherwise by a multipart upload, which becomes visible only on completion
+// and is aborted on failure.
+type S3Backend struct {
+	endpoint *url.URL
+	region   string
+	bucket   string
+	creds    S3Credentials
+	prefix   string
+	partSize int
+	client   *http.Client
+	now      func() time.Time
+}
+
+type S3BackendOption func(b *S3Backend)
+
+// S3BackendWithHTTPClient sets the client used to send requests. The default is http.DefaultClient.
+func S3BackendWithHTTPClient(client *http.Client) S3BackendOption {
+	return func(b *S3Backend) {
+		b.client = client
+	}
+}
+
+// S3BackendWithPrefix sets the prefix prepended to object keys, e.g. "chunks/".
+func S3BackendWithPrefix(prefix string) S3BackendOption {
+	return func(b *S3Backend) {
+		b.prefix = prefix
+	}
+}
+
+// S3BackendWithPartSize sets the size of parts of multipart uploads. The default is 8 MiB.
+// Put buffers up to partSize bytes in memory.
+// NewS3Backend fails if partSize is less than 5 MiB, the minimum S3 allows.
+func S3BackendWithPartSize(partSize int) S3BackendOption {
+	return func(b *S3Backend) {
+		b.partSize = partSize
+	}
+}
+
+// NewS3Backend returns a Backend storing objects in bucket at endpoint, e.g. "https://s3.us-east-1.amazonaws.com".
+// Requests are path-style, i.e. sent to endpoint/bucket/key, which are supported by most S3-compatible storage.
+//
+// It returns an error wrapping ErrInvalidInput if endpoint is not an absolute URL,
+// region or bucket is empty or options are misconfigured.
+func NewS3Backend(endpoint, region, bucket string, creds S3Credentials, opts ...S3BackendOption) (*S3Backend, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint must be an absolute URL, but is %q", ErrInvalidInput, endpoint)
+	}
+	if region == "" || bucket == "" {
+		return nil, fmt.Errorf("%w: region and bucket must not be empty", ErrInvalidInput)
+	}
+
+	b := &S3Backend{
+		endpoint: u,
+		region:   region,
+		bucket:   bucket,
+		creds:    creds,
+		partSize: s3DefaultPartSize,
+		client:   http.DefaultClient,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if b.partSize < s3MinPartSize {
+		return nil, fmt.Errorf("%w: part size must be at least %d, but is %d", ErrInvalidInput, s3MinPartSize, b.partSize)
+	}
+	return b, nil
+}
+
+var _ Backend = (*S3Backend)(nil)
+
+// key converts name into an object key.
+func (b *S3Backend) key(name string) string {
+	return b.prefix + strings.TrimPrefix(path.Clean(filepath.ToSlash(name)), "/")
+}
+
+// name converts an object key into a name.
+func (b *S3Backend) name(key string) string {
+	return filepath.FromSlash("/" + strings.TrimPrefix(key, b.prefix))
+}
+
+// S3Error is an error response returned from S3-compatible storage.
+type S3Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Key        string
+}
+
+func (e *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s, key = %q", e.StatusCode, e.Code, e.Message, e.Key)
+}
+
+// Unwrap returns fs.ErrNotExist for missing objects so that errors.Is works as it does for afero.Fs.
+func (e *S3Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey" {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+func readS3Error(resp *http.Response, key string) error {
+	bin, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	e := &S3Error{StatusCode: resp.StatusCode, Key: key}
+	var body struct {
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(bin, &body) == nil {
+		e.Code, e.Message = body.Code, body.Message
+	}
+	if e.Code == "" {
+		e.Code = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+// do sends a request for key, signed with the hash of body.
+// query is added to the URL. body may be nil.
+// The caller must close the body of the returned response.
+// Responses with status codes other than 2xx are converted into *S3Error.
+func (b *S3Backend) do(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	header http.Header,
+	body []byte,
+) (*http.Response, error) {
+	u := *b.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + b.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	b.sign(req, body)
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, readS3Error(resp, key)
+	}
+	return resp, nil
+}
+
+func (b *S3Backend) doAndClose(
+	ctx context.Context,
+	method, key string,
+	query url.Values,
+	header http.Header,
+	body []byte,
+) (*http.Response, error) {
+	resp, err := b.do(ctx, method, key, query, header, body)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	return resp, nil
+}
+
+// Put implements Backend. perm is ignored.
+func (b *S3Backend) Put(ctx context.Context, name string, _ fs.FileMode, r io.Reader) error {
+	key := b.key(name)
+
+	first := make([]byte, b.partSize)
+	n, err := io.ReadFull(r, first)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	if n < b.partSize {
+		_, err := b.doAndClose(ctx, http.MethodPut, key, nil, nil, first[:n])
+		return err
+	}
+	return b.putMultipart(ctx, key, first, r)
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+func (b *S3Backend) putMultipart(ctx context.Context, key string, first []byte, r io.Reader) (err error) {
+	resp, err := b.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("s3: decoding CreateMultipartUpload response: %w", err)
+	}
+	uploadID := initiated.UploadID
+
+	defer func() {
+		if err != nil {
+			// Abort with a fresh context so that cancellation of ctx does not leave the upload behind.
+			_, _ = b.doAndClose(context.Background(), http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+		}
+	}()
+
+	var parts []s3CompletedPart
+	buf := first
+	for num := 1; ; num++ {
+		resp, err := b.doAndClose(
+			ctx,
+			http.MethodPut,
+			key,
+			url.Values{"partNumber": {strconv.Itoa(num)}, "uploadId": {uploadID}},
+			nil,
+			buf,
+		)
+		if err != nil {
+			return err
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: num, ETag: resp.Header.Get("ETag")})
+
+		buf = first[:b.partSize]
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		buf = buf[:n]
+	}
+
+	completion, _ := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	resp, err = b.do(
+		ctx,
+		http.MethodPost,
+		key,
+		url.Values{"uploadId": {uploadID}},
+		http.Header{"Content-Type": {"application/xml"}},
+		completion,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// CompleteMultipartUpload may fail after responding 200 OK.
+	bin, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var result struct {
+		XMLName xml.Name
+		Code    string
+		Message string
+	}
+	if xml.Unmarshal(bin, &result) == nil && result.XMLName.Local == "Error" {
+		return &S3Error{StatusCode: resp.StatusCode, Code: result.Code, Message: result.Message, Key: key}
+	}
+	return nil
+}
+
+// Get implements Backend.
+func (b *S3Backend) Get(ctx context.Context, name string) (io.ReadCloser, error) {
+	resp, err := b.do(ctx, http.MethodGet, b.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Stat implements Backend.
+func (b *S3Backend) Stat(ctx context.Context, name string) (BackendObject, error) {
+	resp, err := b.doAndClose(ctx, http.MethodHead, b.key(name), nil, nil, nil)
+	if err != nil {
+		return BackendObject{}, err
+	}
+	return BackendObject{Name: filepath.Clean(name), Size: resp.ContentLength}, nil
+}
+
+// Delete implements Backend.
+// S3 does not report missing objects on deletion, thus Delete returns nil for them.
+func (b *S3Backend) Delete(ctx context.Context, name string) error {
+	_, err := b.doAndClose(ctx, http.MethodDelete, b.key(name), nil, nil, nil)
+	return err
+}
+
+// List implements Backend by ListObjectsV2, following continuation tokens.
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]BackendObject, error) {
+	keyPrefix := b.prefix
+	if prefix != "" {
+		keyPrefix += strings.TrimPrefix(filepath.ToSlash(prefix), "/")
+	}
+
+	var (
+		out   []BackendObject
+		token string
+	)
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {keyPrefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := b.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			IsTruncated           bool
+			NextContinuationToken string
+			Contents              []struct {
+				Key  string
+				Size int64
+			}
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3: decoding ListObjectsV2 response: %w", err)
+		}
+		for _, c := range result.Contents {
+			out = append(out, BackendObject{Name: b.name(c.Key), Size: c.Size})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+// sign signs req by AWS Signature Version 4.
+// All headers set to req, in addition to Host, are signed.
+func (b *S3Backend) sign(req *http.Request, body []byte) {
+	now := b.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if b.creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + b.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + b.creds.SecretAccessKey)
+	for _, s := range []string{date, b.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set(
+		"Authorization",
+		"AWS4-HMAC-SHA256 Credential="+b.creds.AccessKeyID+"/"+scope+
+			", SignedHeaders="+signedHeaders+
+			", Signature="+signature,
+	)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// s3Escape escapes s as SigV4 requires, leaving only unreserved characters.
+func s3Escape(s string, keepSlash bool) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~',
+			keepSlash && c == '/':
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func s3EscapePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	return s3Escape(p, true)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
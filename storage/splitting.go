@@ -2,7 +2,9 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"crypto"
+	_ "crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -12,9 +14,10 @@ import (
 	"io/fs"
 	"path/filepath"
 	"strings"
-	"sync/atomic"
+	"sync"
 
 	"github.com/ngicks/musicbox/fsutil"
+	"github.com/ngicks/musicbox/stream"
 	"github.com/spf13/afero"
 )
 
@@ -48,6 +51,30 @@ func (s *SafeWriter) WriteFs(
 	return s.option.SafeWriteFs(s.fsys, dir, perm, src, postProcesses...)
 }
 
+// WriteContext is same as Write but stops once ctx is cancelled.
+// The temporary file is removed and path is left untouched in that case, and the returned error wraps ctx.Err().
+func (s *SafeWriter) WriteContext(
+	ctx context.Context,
+	path string,
+	perm fs.FileMode,
+	r io.Reader,
+	postProcesses ...fsutil.SafeWritePostProcessCtx,
+) error {
+	return s.option.SafeWriteCtx(ctx, s.fsys, path, perm, r, postProcesses...)
+}
+
+// WriteFsContext is same as WriteFs but stops copying src once ctx is cancelled.
+// The temporary directory is removed and dir is left untouched in that case, and the returned error wraps ctx.Err().
+func (s *SafeWriter) WriteFsContext(
+	ctx context.Context,
+	dir string,
+	perm fs.FileMode,
+	src fs.FS,
+	postProcesses ...fsutil.SafeWritePostProcessCtx,
+) error {
+	return s.option.SafeWriteFsCtx(ctx, s.fsys, dir, perm, src, postProcesses...)
+}
+
 func (s *SafeWriter) CleanTmp() error {
 	return s.option.CleanTmp(s.fsys)
 }
@@ -158,24 +185,57 @@ func WriteSplitting(
 	pathModifier func(path string, i int) string,
 	trapper func(path string, r io.Reader) io.Reader,
 ) ([]string, error) {
-	splitter := SplitReader(r, size)
+	return WriteSplittingWithSplitter(fsys, opt, path, perm, SplitReader(r, size), pathModifier, trapper)
+}
 
+// WriteSplittingWithSplitter is same as WriteSplitting but splits content by splitter,
+// e.g. one returned from SplitReaderCDC.
+func WriteSplittingWithSplitter(
+	fsys afero.Fs,
+	opt fsutil.SafeWriteOption,
+	path string,
+	perm fs.FileMode,
+	splitter ReaderSplitter,
+	pathModifier func(path string, i int) string,
+	trapper func(path string, r io.Reader) io.Reader,
+) ([]string, error) {
 	if pathModifier == nil {
 		pathModifier = PathModifierAppendIndex
 	}
+	return writeSplitting(
+		func(name string, r io.Reader) error { return opt.SafeWrite(fsys, name, perm, r) },
+		splitter,
+		func(i int, r io.Reader) (string, io.Reader, error) {
+			name := pathModifier(path, i)
+			return name, r, validChunkName(name)
+		},
+		trapper,
+	)
+}
 
+// writeSplitting writes each chunk returned from splitter by put.
+// name returns the name of i-th chunk and the reader of its content, which may replace r.
+func writeSplitting(
+	put func(name string, r io.Reader) error,
+	splitter ReaderSplitter,
+	name func(i int, r io.Reader) (string, io.Reader, error),
+	trapper func(path string, r io.Reader) io.Reader,
+) ([]string, error) {
 	var out []string
 	seen := map[string]bool{}
-	var i int
-	for {
+	for i := 0; ; i++ {
 		r, ok := splitter.Next()
 		if !ok {
 			break
 		}
 
-		nextPath := filepath.Clean(pathModifier(path, i))
+		nextPath, r, err := name(i, r)
+		if err != nil {
+			return out, err
+		}
+		nextPath = filepath.Clean(nextPath)
 		if seen[nextPath] {
-			return out, fmt.Errorf("duplicate name: %s", nextPath)
+			return out, fmt.Errorf("%w: duplicate name: %s", ErrInvalidInput, nextPath)
 		}
 		seen[nextPath] = true
 
@@ -183,9 +243,7 @@ func WriteSplitting(
 			r = trapper(nextPath, r)
 		}
 
-		i++
-
-		err := opt.SafeWrite(fsys, nextPath, perm, r)
+		err = put(nextPath, r)
 		if err != nil {
 			return out, err
 		}
@@ -197,130 +255,293 @@ func WriteSplitting(
 }
 
 type SplittingStorage struct {
-	fileFsys     *SafeWriter
-	metadataFsys *SafeWriter
+	fileFsys     Backend
+	metadataFsys Backend
 	hashAlgo     crypto.Hash
 	splitSize    uint
-	pathModifier func(s string, i int) string
+	namer        ChunkNamer
+	progress     func(p Progress)
+	resumable    bool
+	workers      int
+	codec        ChunkCodec
+	cipher       ChunkCipher
+	keys         KeyProvider
+
+	contentAddressed bool
+	// casMu serializes Delete, which write-locks it, against writes of content addressed storage,
+	// which read-lock it, so that a chunk reused by a write is not deleted before its metadata is written.
+	casMu       sync.RWMutex
+	newSplitter func(r io.Reader) ReaderSplitter
+	migrations  []MetadataMigration
+}
+
+type SplittingStorageOption func(s *SplittingStorage)
+
+// SplittingStorageWithHash sets the hash algorithm used to compute checksums of files and chunks.
+// The default is crypto.SHA256.
+// NewSplittingStorage fails If the algorithm is not linked into the binary.
+func SplittingStorageWithHash(algo crypto.Hash) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.hashAlgo = algo
+	}
+}
+
+// SplittingStorageWithPathModifier sets pathModifier naming chunks.
+// It is same as SplittingStorageWithChunkNamer(ChunkNamerFunc(pathModifier)).
+// If nil, PathModifierAppendIndex is used.
+func SplittingStorageWithPathModifier(pathModifier func(s string, i int) string) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.namer = nil
+		if pathModifier != nil {
+			s.namer = ChunkNamerFunc(pathModifier)
+		}
+	}
+}
+
+// SplittingStorageWithResumable makes Write resumable.
+//
+// Write persists progress next to the metadata after each chunk is written.
+// If a previous Write for a same path has failed, the next Write reads r from the start again
+// but skips writing chunks which still have hash sums recorded in the progress,
+// continuing from the first missing or invalid chunk.
+// It fails with ErrInvalidInput if r has different content from the previous attempt for those chunks,
+// removing the progress so that the next Write starts over.
+func SplittingStorageWithResumable(resumable bool) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.resumable = resumable
+	}
+}
+
+// SplittingStorageWithSplitter makes SplittingStorage split content by splitters returned from newSplitter,
+// instead of fixed size splitting at splitSize.
+// For example, combined with SplittingStorageWithContentAddressed,
+// splitters returned from SplitReaderCDC deduplicate chunks even if contents are partially shifted.
+//
+// WriteAt writes chunks sequentially if newSplitter is set.
+func SplittingStorageWithSplitter(newSplitter func(r io.Reader) ReaderSplitter) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.newSplitter = newSplitter
+	}
 }
 
+func (s *SplittingStorage) split(r io.Reader) ReaderSplitter {
+	if s.newSplitter != nil {
+		return s.newSplitter(r)
+	}
+	return SplitReader(r, s.splitSize)
+}
+
+// NewSplittingStorage returns a SplittingStorage storing chunks of files, each up to splitSize, in fileFsys
+// and their metadata in metadataFsys.
+// Both are usually *SafeWriter, but any Backend, e.g. *S3Backend, can be used.
+//
+// It returns an error wrapping ErrInvalidInput if splitSize is 0, the hash algorithm is not available
+// or options are misconfigured.
 func NewSplittingStorage(
-	fileFsys *SafeWriter,
-	metadataFsys *SafeWriter,
+	fileFsys Backend,
+	metadataFsys Backend,
 	splitSize uint,
-	pathModifier func(s string, i int) string,
-	safeWriteOption fsutil.SafeWriteOption,
-) *SplittingStorage {
-	return &SplittingStorage{
+	opts ...SplittingStorageOption,
+) (*SplittingStorage, error) {
+	s := &SplittingStorage{
 		fileFsys:     fileFsys,
 		metadataFsys: metadataFsys,
+		hashAlgo:     crypto.SHA256,
 		splitSize:    splitSize,
-		pathModifier: pathModifier,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.namer == nil {
+		s.namer = ChunkNamerFunc(PathModifierAppendIndex)
+	}
+
+	if splitSize == 0 {
+		return nil, fmt.Errorf("%w: splitSize is 0", ErrInvalidInput)
+	}
+	if !s.hashAlgo.Available() {
+		return nil, fmt.Errorf("%w: hash algorithm %s is not available", ErrInvalidInput, s.hashAlgo)
+	}
+	if err := s.validateEncryption(); err != nil {
+		return nil, err
+	}
+	if s.contentAddressed && s.cipher != "" {
+		return nil, fmt.Errorf("%w: content addressed storage can not be encrypted", ErrInvalidInput)
+	}
+	return s, nil
 }
 
 type SplittedFileMetadata struct {
+	// Version is the version of the metadata format. See MetadataVersion.
+	Version  int
 	Total    SplittedFileHash
 	Splitted []SplittedFileHash
 }
 
 type SplittedFileHash struct {
-	Path     string
-	Size     int
-	HashSum  string
+	Path string
+	// Size is the size of content. For compressed chunks, it is the uncompressed size.
+	Size    int
+	HashSum string
+	// HashAlgo is the name of the hash algorithm computed HashSum, as returned by crypto.Hash.String.
 	HashAlgo string
+	// Codec is the name of ChunkCodec the chunk is compressed with. It is empty if not compressed.
+	Codec string `json:",omitempty"`
+	// CompressedSize is the size of the chunk after compression, before encryption, if Codec is non empty.
+	CompressedSize int `json:",omitempty"`
+	// Encryption is the name of ChunkCipher the chunk is encrypted with. It is empty if not encrypted.
+	Encryption string `json:",omitempty"`
+	// KeyID identifies the key passed to KeyProvider.Key for decryption.
+	KeyID string `json:",omitempty"`
+	// Nonce is the hex encoded nonce used to encrypt the chunk.
+	Nonce string `json:",omitempty"`
+}
+
+// Hash returns the crypto.Hash named by h.HashAlgo.
+// It returns an error wrapping ErrInvalidInput if the name is unknown or the algorithm is not available.
+func (h SplittedFileHash) Hash() (crypto.Hash, error) {
+	for algo := crypto.MD4; algo <= crypto.BLAKE2b_512; algo++ {
+		if algo.String() != h.HashAlgo {
+			continue
+		}
+		if !algo.Available() {
+			return 0, fmt.Errorf("%w: hash algorithm %s is not available", ErrInvalidInput, h.HashAlgo)
+		}
+		return algo, nil
+	}
+	return 0, fmt.Errorf("%w: unknown hash algorithm %q", ErrInvalidInput, h.HashAlgo)
 }
 
 const (
 	metaSuffix = ".meta.json"
 )
 
-type readSizeCounter struct {
-	R io.Reader
-	N atomic.Int64
-}
-
-func (r *readSizeCounter) Read(p []byte) (int, error) {
-	n, err := r.R.Read(p)
-	r.N.Add(int64(n))
-	return n, err
-}
-
 type splittedDataSet struct {
-	H    hash.Hash
-	C    *readSizeCounter
-	Path string
+	H        hash.Hash
+	C        *stream.CountingReader
+	Path     string
+	Encoding chunkEncoding
 }
 
+// Write splits content read from r into chunks and stores them with metadata at path.
+// It returns paths of chunks in fileFsys.
+//
+// Chunks are first written under a staging directory in fileFsys,
+// then moved to their paths and committed together with the metadata after r is fully read.
+// On failure, neither of chunks nor metadata are left in place of them
+// and the returned paths is nil.
+// Resumable and content addressed writes are exceptions, which write chunks in place
+// since kept chunks are the whole point of them.
+//
+// Write fails with an error wrapping ErrAlreadyExists if path is already stored
+// or if a chunk already exists at a name given by ChunkNamer.
+// The latter is not checked for resumable writes, since chunks of the previous attempt are expected there.
 func (s *SplittingStorage) Write(path string, perm fs.FileMode, r io.Reader) ([]string, error) {
+	return s.write(path, perm, r, -1)
+}
+
+// write implements Write. total is the size of r reported as Progress.Total, or -1 if unknown.
+func (s *SplittingStorage) write(path string, perm fs.FileMode, r io.Reader, total int64) ([]string, error) {
 	path = filepath.Clean(path)
 
-	f, err := s.metadataFsys.fsys.Open(path + metaSuffix)
-	if err == nil {
-		var meta SplittedFileMetadata
-		err := json.NewDecoder(f).Decode(&meta)
-		_ = f.Close()
-		if err != nil {
-			return nil, err
-		}
-		var paths []string
-		for _, s := range meta.Splitted {
-			paths = append(paths, s.Path)
-		}
-		return paths, nil
-	} else {
-		_ = f.Close()
+	if err := s.checkNotExist(path); err != nil {
+		return nil, err
+	}
+
+	if s.contentAddressed {
+		s.casMu.RLock()
+		defer s.casMu.RUnlock()
+		return s.writeContentAddressed(path, perm, r, total)
+	}
+	if s.resumable {
+		return s.writeResumable(path, perm, r, total)
+	}
+
+	st, err := s.newStaging()
+	if err != nil {
+		return nil, err
 	}
 
 	hTotal := s.hashAlgo.New()
-	cTotal := &readSizeCounter{R: io.TeeReader(r, hTotal)}
+	countTotal, cTotal := stream.CountingStage()
+	src := stream.NewPipeline(r, stream.TeeStage(hTotal), countTotal)
 
+	progress := s.newProgress(path, total)
 	sets := make([]splittedDataSet, 0)
-	paths, err := WriteSplitting(
-		s.fileFsys.fsys,
-		s.fileFsys.option,
-		path,
-		perm,
-		cTotal,
-		s.splitSize,
-		s.pathModifier,
+	staged, err := writeSplitting(
+		func(name string, r io.Reader) error {
+			if err := s.fileFsys.Put(context.Background(), name, perm, r); err != nil {
+				return err
+			}
+			progress.done(len(sets)-1, sets[len(sets)-1].C.Count())
+			return nil
+		},
+		s.split(src),
+		func(i int, r io.Reader) (string, io.Reader, error) {
+			name, r, err := s.nameChunk(path, i, 0, r)
+			if err != nil {
+				return "", nil, err
+			}
+			if err := s.checkChunkCollision(name); err != nil {
+				return "", nil, err
+			}
+			return st.stage(name), r, nil
+		},
 		func(path string, r io.Reader) io.Reader {
+			final := st.finalPath(path)
 			h := s.hashAlgo.New()
-			r = io.TeeReader(r, h)
-			sizeCounted := &readSizeCounter{R: r}
+			counting, sizeCounted := stream.CountingStage()
+			var encoding chunkEncoding
+			encoded := stream.NewPipeline(
+				r,
+				stream.TeeStage(h),
+				counting,
+				func(r io.Reader) io.Reader {
+					var encoded io.Reader
+					encoded, encoding = s.encodeChunk(final, r)
+					return encoded
+				},
+			)
 			sets = append(sets, splittedDataSet{
-				H:    h,
-				C:    sizeCounted,
-				Path: filepath.Clean(path),
+				H:        h,
+				C:        sizeCounted,
+				Path:     final,
+				Encoding: encoding,
 			})
-			return sizeCounted
+			return encoded
 		},
 	)
 	if err != nil {
-		return paths, err
+		st.discard()
+		return nil, err
 	}
 
 	meta := SplittedFileMetadata{
 		Total: SplittedFileHash{
 			Path:     path,
-			Size:     int(cTotal.N.Load()),
+			Size:     int(cTotal.Count()),
 			HashSum:  hex.EncodeToString(hTotal.Sum(nil)),
 			HashAlgo: s.hashAlgo.String(),
 		},
 		Splitted: mapToSplittedFileHash(sets, s.hashAlgo),
 	}
 
+	out, err := st.commit(path, staged, meta)
+	if err == nil {
+		progress.finish()
+	}
+	return out, err
+}
+
+func (s *SplittingStorage) writeMetadata(name string, meta SplittedFileMetadata) error {
+	meta.Version = MetadataVersion
 	bin, _ := json.Marshal(meta)
-	err = s.metadataFsys.Write(
-		path+metaSuffix,
+	return s.metadataFsys.Put(
+		context.Background(),
+		name,
 		fs.ModePerm,
 		bytes.NewReader(bin),
 	)
-	if err != nil {
-		return paths, err
-	}
-
-	return paths, nil
 }
 
 func mapToSplittedFileHash(sets []splittedDataSet, algo crypto.Hash) []SplittedFileHash {
@@ -328,59 +549,78 @@ func mapToSplittedFileHash(sets []splittedDataSet, algo crypto.Hash) []SplittedF
 	for i, set := range sets {
 		out[i] = SplittedFileHash{
 			Path:     set.Path,
-			Size:     int(set.C.N.Load()),
+			Size:     int(set.C.Count()),
 			HashSum:  hex.EncodeToString(set.H.Sum(nil)),
 			HashAlgo: algo.String(),
 		}
+		set.Encoding.apply(&out[i])
 	}
 	return out
 }
 
-type closable struct {
-	io.Reader
-	closer []io.Closer
-}
-
-func (c *closable) Close() error {
-	var lastErr error
-	for _, c := range c.closer {
-		err := c.Close()
-		if err != nil {
-			lastErr = err
-		}
-	}
-	return lastErr
-}
-
-func (s *SplittingStorage) Read(path string) (r io.ReadCloser, size int, err error) {
-	f, err := s.metadataFsys.fsys.Open(filepath.Clean(path) + metaSuffix)
+func (s *SplittingStorage) readMetadata(path string) (SplittedFileMetadata, error) {
+	f, err := s.metadataFsys.Get(context.Background(), filepath.Clean(path)+metaSuffix)
 	if err != nil {
-		return nil, 0, err
+		return SplittedFileMetadata{}, err
 	}
 	defer func() { _ = f.Close() }()
 
-	var meta SplittedFileMetadata
-	dec := json.NewDecoder(f)
-	err = dec.Decode(&meta)
-	_ = f.Close()
+	meta, err := decodeMetadata(f)
 	if err != nil {
+		return SplittedFileMetadata{}, err
+	}
+	if _, err := migrateMetadata(&meta, s.migrations); err != nil {
+		return SplittedFileMetadata{}, err
+	}
+	return meta, nil
+}
 
+// Read opens the file stored at path and returns it and its size.
+//
+// Since chunk sizes are recorded in the metadata, the returned reader also implements io.Seeker and io.ReaderAt,
+// which are suitable for serving range requests.
+// Chunks are opened lazily as stream.NewLazyMultiReadAtSeekCloser does,
+// so errors of opening chunks, e.g. missing ones, are returned from reads rather than from Read.
+// If the backend returns readers not implementing io.ReaderAt, e.g. *S3Backend,
+// reading backward on a chunk reopens it.
+// It fails with an error wrapping stream.ErrInvalidSize or io.ErrUnexpectedEOF on reading a chunk
+// whose actual size differs from the metadata.
+func (s *SplittingStorage) Read(path string) (r stream.ReadAtReadSeekCloser, size int, err error) {
+	meta, err := s.readMetadata(path)
+	if err != nil {
 		return nil, 0, err
 	}
 
-	closable := &closable{}
-	var readers []io.Reader
+	sources := make([]stream.LazySizedReaderAt, 0, len(meta.Splitted))
 	for _, p := range meta.Splitted {
-		f, err := s.fileFsys.fsys.Open(p.Path)
-		if err != nil {
-			_ = closable.Close()
-			return nil, 0, err
+		chunk := p
+		open := func() (io.ReaderAt, error) { return s.openChunkReaderAt(chunk) }
+		if chunk.Codec != "" || chunk.Encryption != "" {
+			if err := s.checkDecodable(chunk); err != nil {
+				return nil, 0, err
+			}
+			open = func() (io.ReaderAt, error) {
+				return &decodingReaderAt{open: func() (io.ReadCloser, error) { return s.openChunk(chunk) }}, nil
+			}
 		}
-		readers = append(readers, f)
-		closable.closer = append(closable.closer, f)
+		sources = append(sources, stream.LazySizedReaderAt{Open: open, Size: int64(chunk.Size)})
 	}
 
-	closable.Reader = io.MultiReader(readers...)
+	return stream.NewLazyMultiReadAtSeekCloser(sources), meta.Total.Size, nil
+}
 
-	return closable, meta.Total.Size, nil
+// openChunkReaderAt opens the plain chunk, which is neither compressed nor encrypted, as io.ReaderAt.
+// The returned reader always implements io.Closer.
+func (s *SplittingStorage) openChunkReaderAt(chunk SplittedFileHash) (io.ReaderAt, error) {
+	f, err := s.fileFsys.Get(context.Background(), chunk.Path)
+	if err != nil {
+		return nil, err
+	}
+	if ra, ok := f.(io.ReaderAt); ok {
+		return ra, nil
+	}
+	return &decodingReaderAt{
+		open: func() (io.ReadCloser, error) { return s.fileFsys.Get(context.Background(), chunk.Path) },
+		r:    f,
+	}, nil
 }
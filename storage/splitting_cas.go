@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/ngicks/musicbox/stream"
+)
+
+// SplittingStorageWithContentAddressed makes SplittingStorage store chunks content-addressed.
+//
+// Each chunk is stored at a path derived from its hash sum, sharded by first 2 bytes of the hex encoded sum,
+// e.g. "/ab/cd/abcd...". If a codec is set, its name is appended as an extension.
+// Chunks already stored, possibly by other files, are not written again.
+// Delete removes chunks only when no other metadata refers to them and GC works as usual.
+// The path modifier and SplittingStorageWithResumable have no effect,
+// since chunks written by a failed Write are reused by the next one anyway.
+// WriteAt writes chunks sequentially.
+//
+// Each chunk is buffered in memory to compute its address before writing.
+// It can not be combined with SplittingStorageWithEncryption,
+// since random nonces make encrypted content of identical chunks differ.
+func SplittingStorageWithContentAddressed(contentAddressed bool) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.contentAddressed = contentAddressed
+	}
+}
+
+func (s *SplittingStorage) contentAddress(sum string) string {
+	p := filepath.Join(string(filepath.Separator), sum[:2], sum[2:4], sum)
+	if codec := s.codecName(); codec != "" {
+		p += "." + codec
+	}
+	return p
+}
+
+func (s *SplittingStorage) writeContentAddressed(path string, perm fs.FileMode, r io.Reader, total int64) ([]string, error) {
+	hTotal := s.hashAlgo.New()
+	cTotal := stream.NewCountingReader(io.TeeReader(r, hTotal))
+	splitter := s.split(cTotal)
+	progress := s.newProgress(path, total)
+
+	var (
+		out    []string
+		chunks []SplittedFileHash
+		buf    bytes.Buffer
+	)
+	for {
+		r, ok := splitter.Next()
+		if !ok {
+			break
+		}
+
+		buf.Reset()
+		h := s.hashAlgo.New()
+		if _, err := io.Copy(io.MultiWriter(&buf, h), r); err != nil {
+			return out, err
+		}
+		sum := hex.EncodeToString(h.Sum(nil))
+		chunk := SplittedFileHash{
+			Path:     s.contentAddress(sum),
+			Size:     buf.Len(),
+			HashSum:  sum,
+			HashAlgo: s.hashAlgo.String(),
+		}
+
+		obj, err := s.fileFsys.Stat(context.Background(), chunk.Path)
+		switch {
+		case err == nil:
+			if codec := s.codecName(); codec != "" {
+				chunk.Codec, chunk.CompressedSize = codec, int(obj.Size)
+			}
+		case errors.Is(err, fs.ErrNotExist):
+			encoded, encoding := s.encodeChunk(chunk.Path, &buf)
+			if err := s.fileFsys.Put(context.Background(), chunk.Path, perm, encoded); err != nil {
+				return out, err
+			}
+			encoding.apply(&chunk)
+		default:
+			return out, err
+		}
+
+		out = append(out, chunk.Path)
+		chunks = append(chunks, chunk)
+		progress.done(len(chunks)-1, int64(chunk.Size))
+	}
+
+	meta := SplittedFileMetadata{
+		Total: SplittedFileHash{
+			Path:     path,
+			Size:     int(cTotal.Count()),
+			HashSum:  hex.EncodeToString(hTotal.Sum(nil)),
+			HashAlgo: s.hashAlgo.String(),
+		},
+		Splitted: chunks,
+	}
+	if err := s.writeMetadata(path+metaSuffix, meta); err != nil {
+		return out, err
+	}
+	progress.finish()
+	return out, nil
+}
+
+// chunkRefs counts references to each chunk from all metadata.
+func (s *SplittingStorage) chunkRefs() (map[string]int, error) {
+	refs := map[string]int{}
+	err := s.walkMetadata(func(path string) error {
+		meta, err := s.readMetadata(path)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range meta.Splitted {
+			refs[filepath.Clean(chunk.Path)]++
+		}
+		return nil
+	})
+	return refs, err
+}
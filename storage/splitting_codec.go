@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ChunkCodec compresses and decompresses chunks of SplittingStorage.
+type ChunkCodec interface {
+	// Name identifies the codec. It is recorded in SplittedFileHash.Codec.
+	Name() string
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+// GzipCodec returns a ChunkCodec named "gzip" compressing with compress/gzip at level.
+// The level is one of levels accepted by gzip.NewWriterLevel.
+func GzipCodec(level int) ChunkCodec {
+	return gzipCodec{level: level}
+}
+
+type gzipCodec struct {
+	level int
+}
+
+func (gzipCodec) Name() string { return "gzip" }
+
+func (c gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.level)
+}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// ZstdCodec returns a ChunkCodec named "zstd" compressing with github.com/klauspost/compress/zstd.
+func ZstdCodec() ChunkCodec {
+	return zstdCodec{}
+}
+
+type zstdCodec struct{}
+
+func (zstdCodec) Name() string { return "zstd" }
+
+func (zstdCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w)
+}
+
+func (zstdCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
+
+// SplittingStorageWithCodec makes SplittingStorage compress each chunk with codec on writing.
+// Compressed chunks are decompressed transparently on reading, regardless of the current codec,
+// as long as the codec recorded in the metadata is gzip, zstd or codec itself.
+// Sizes and hash sums in the metadata are those of uncompressed content.
+//
+// Each chunk is compressed in memory, so memory usage grows up to splitSize per concurrent write.
+// Read on compressed chunks is still seekable, but seeking backwards decompresses the chunk from its head again.
+func SplittingStorageWithCodec(codec ChunkCodec) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.codec = codec
+	}
+}
+
+func (s *SplittingStorage) lookupCodec(name string) (ChunkCodec, error) {
+	if s.codec != nil && s.codec.Name() == name {
+		return s.codec, nil
+	}
+	switch name {
+	case "gzip":
+		return GzipCodec(gzip.DefaultCompression), nil
+	case "zstd":
+		return ZstdCodec(), nil
+	}
+	return nil, fmt.Errorf("%w: unknown codec %q", ErrInvalidInput, name)
+}
+
+func (s *SplittingStorage) codecName() string {
+	if s.codec == nil {
+		return ""
+	}
+	return s.codec.Name()
+}
+
+// chunkEncoding describes how a chunk file is encoded from its content.
+type chunkEncoding struct {
+	codec      string
+	compressed int64
+	cipher     ChunkCipher
+	keyID      string
+	nonce      string
+}
+
+func encodingOf(h SplittedFileHash) chunkEncoding {
+	return chunkEncoding{
+		codec:      h.Codec,
+		compressed: int64(h.CompressedSize),
+		cipher:     ChunkCipher(h.Encryption),
+		keyID:      h.KeyID,
+		nonce:      h.Nonce,
+	}
+}
+
+func (e chunkEncoding) apply(h *SplittedFileHash) {
+	if e.codec != "" {
+		h.Codec, h.CompressedSize = e.codec, int(e.compressed)
+	}
+	if e.cipher != "" {
+		h.Encryption, h.KeyID, h.Nonce = string(e.cipher), e.keyID, e.nonce
+	}
+}
+
+// encodeChunk compresses r with the codec and then encrypts it, returning a reader of the encoded content.
+// If neither is set, r is returned as is.
+// path is authenticated as additional data of encryption.
+// Errors are returned from the returned reader.
+func (s *SplittingStorage) encodeChunk(path string, r io.Reader) (io.Reader, chunkEncoding) {
+	if s.codec == nil && s.cipher == "" {
+		return r, chunkEncoding{}
+	}
+
+	var enc chunkEncoding
+	var buf bytes.Buffer
+	if s.codec != nil {
+		w, err := s.codec.NewWriter(&buf)
+		if err != nil {
+			return &errReader{err: err}, chunkEncoding{}
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			_ = w.Close()
+			return &errReader{err: err}, chunkEncoding{}
+		}
+		if err := w.Close(); err != nil {
+			return &errReader{err: err}, chunkEncoding{}
+		}
+		enc.codec, enc.compressed = s.codec.Name(), int64(buf.Len())
+	} else if _, err := io.Copy(&buf, r); err != nil {
+		return &errReader{err: err}, chunkEncoding{}
+	}
+
+	if s.cipher == "" {
+		return bytes.NewReader(buf.Bytes()), enc
+	}
+	sealed, keyID, nonce, err := s.seal(path, buf.Bytes())
+	if err != nil {
+		return &errReader{err: err}, chunkEncoding{}
+	}
+	enc.cipher, enc.keyID, enc.nonce = s.cipher, keyID, nonce
+	return bytes.NewReader(sealed), enc
+}
+
+// checkDecodable returns an error if the codec or the cipher of chunk is not known.
+func (s *SplittingStorage) checkDecodable(chunk SplittedFileHash) error {
+	if chunk.Codec != "" {
+		if _, err := s.lookupCodec(chunk.Codec); err != nil {
+			return err
+		}
+	}
+	if chunk.Encryption != "" {
+		if s.keys == nil {
+			return fmt.Errorf("%w: chunk %s is encrypted but no KeyProvider is set", ErrInvalidInput, chunk.Path)
+		}
+		if !ChunkCipher(chunk.Encryption).valid() {
+			return fmt.Errorf("%w: unknown cipher %q", ErrInvalidInput, chunk.Encryption)
+		}
+	}
+	return nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+// openChunk opens chunk and returns a reader of uncompressed content.
+func (s *SplittingStorage) openChunk(chunk SplittedFileHash) (io.ReadCloser, error) {
+	if err := s.checkDecodable(chunk); err != nil {
+		return nil, err
+	}
+
+	f, err := s.fileFsys.Get(context.Background(), chunk.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw io.ReadCloser = f
+	if chunk.Encryption != "" {
+		sealed, err := io.ReadAll(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, err
+		}
+		plain, err := s.open(chunk, sealed)
+		if err != nil {
+			return nil, err
+		}
+		raw = io.NopCloser(bytes.NewReader(plain))
+	}
+
+	if chunk.Codec == "" {
+		return raw, nil
+	}
+	codec, err := s.lookupCodec(chunk.Codec)
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+	r, err := codec.NewReader(raw)
+	if err != nil {
+		_ = raw.Close()
+		return nil, err
+	}
+	return &decodedChunk{ReadCloser: r, f: raw}, nil
+}
+
+type decodedChunk struct {
+	io.ReadCloser
+	f io.Closer
+}
+
+func (c *decodedChunk) Close() error {
+	err := c.ReadCloser.Close()
+	if fErr := c.f.Close(); err == nil {
+		err = fErr
+	}
+	return err
+}
+
+// hashChunk reads uncompressed content of chunk writing it to h and others.
+// It returns read size and hex encoded sum of h.
+func (s *SplittingStorage) hashChunk(chunk SplittedFileHash, h hash.Hash, others ...io.Writer) (int64, string, error) {
+	r, err := s.openChunk(chunk)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = r.Close() }()
+	return hashReader(r, h, others...)
+}
+
+// decodingReaderAt implements io.ReaderAt over a compressed chunk by decompressing it sequentially.
+// Reading at an offset before the current position reopens the chunk.
+type decodingReaderAt struct {
+	mu   sync.Mutex
+	open func() (io.ReadCloser, error)
+	r    io.ReadCloser
+	pos  int64
+}
+
+func (d *decodingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.r == nil || off < d.pos {
+		if d.r != nil {
+			_ = d.r.Close()
+			d.r = nil
+		}
+		r, err := d.open()
+		if err != nil {
+			return 0, err
+		}
+		d.r, d.pos = r, 0
+	}
+	if off > d.pos {
+		n, err := io.CopyN(io.Discard, d.r, off-d.pos)
+		d.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := io.ReadFull(d.r, p)
+	d.pos += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (d *decodingReaderAt) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.r == nil {
+		return nil
+	}
+	err := d.r.Close()
+	d.r = nil
+	return err
+}
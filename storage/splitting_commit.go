@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sync"
+
+	"github.com/ngicks/musicbox/fsutil"
+)
+
+// ErrAlreadyExists is returned when writing a file already stored in SplittingStorage.
+var ErrAlreadyExists = errors.New("already exists")
+
+// stagingDir is the directory in the file fsys under which chunks are staged until commit.
+const stagingDir = ".staging"
+
+func (s *SplittingStorage) checkNotExist(path string) error {
+	_, err := s.metadataFsys.Stat(context.Background(), path+metaSuffix)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: %s", ErrAlreadyExists, path)
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	default:
+		return err
+	}
+}
+
+// staging holds chunks of a single write until they are committed with the metadata.
+//
+// If the file backend implements renamingBackend, chunks are staged under a unique directory
+// and moved on commit. Otherwise, e.g. for object storage, chunks are written in place
+// and removed if the write fails.
+type staging struct {
+	s   *SplittingStorage
+	dir string
+	// renaming is non nil if chunks are staged under dir.
+	renaming renamingBackend
+
+	mu sync.Mutex
+	// final maps staged paths to final paths.
+	final map[string]string
+}
+
+func (s *SplittingStorage) newStaging() (*staging, error) {
+	st := &staging{
+		s:     s,
+		final: map[string]string{},
+	}
+	if rb, ok := s.fileFsys.(renamingBackend); ok {
+		name, err := fsutil.RandomNameCryptoHex(8)()
+		if err != nil {
+			return nil, err
+		}
+		st.dir = filepath.Join(string(filepath.Separator), stagingDir, name)
+		st.renaming = rb
+	}
+	return st, nil
+}
+
+// stage returns the path a chunk whose final path is final is staged at.
+func (st *staging) stage(final string) string {
+	final = filepath.Clean(final)
+	staged := final
+	if st.renaming != nil {
+		staged = filepath.Join(st.dir, final)
+	}
+	st.mu.Lock()
+	st.final[staged] = final
+	st.mu.Unlock()
+	return staged
+}
+
+func (st *staging) finalPath(staged string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.final[filepath.Clean(staged)]
+}
+
+// commit moves staged chunks to their final paths and then writes meta for path.
+// If any step fails, chunks already moved are removed so that neither of chunks nor metadata are left.
+//
+// Renaming chunks is cheap compared to writing them,
+// but a crash during commit may still leave moved chunks without metadata, which GC removes.
+func (st *staging) commit(path string, staged []string, meta SplittedFileMetadata) ([]string, error) {
+	if err := st.s.checkNotExist(path); err != nil {
+		st.discard()
+		return nil, err
+	}
+
+	out := make([]string, len(staged))
+	for i, p := range staged {
+		out[i] = st.finalPath(p)
+	}
+
+	var moved []string
+	err := func() error {
+		if st.renaming != nil {
+			for _, p := range out {
+				// Another write may have committed a chunk with the same name after it was checked.
+				if err := st.s.checkChunkCollision(p); err != nil {
+					return err
+				}
+			}
+			for i, p := range staged {
+				if err := st.renaming.Rename(context.Background(), p, out[i]); err != nil {
+					return err
+				}
+				moved = append(moved, out[i])
+			}
+		}
+		return st.s.writeMetadata(path+metaSuffix, meta)
+	}()
+	if err != nil {
+		for _, p := range moved {
+			_ = st.s.fileFsys.Delete(context.Background(), p)
+		}
+		st.discard()
+		return nil, err
+	}
+	if st.renaming != nil {
+		st.discard()
+	}
+	return out, nil
+}
+
+// discard removes staged chunks.
+func (st *staging) discard() {
+	if st.renaming != nil {
+		_ = st.renaming.RemoveAll(context.Background(), st.dir)
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for staged := range st.final {
+		_ = st.s.fileFsys.Delete(context.Background(), staged)
+	}
+}
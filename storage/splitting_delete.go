@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// walkMetadata calls fn with the path of each stored file whose metadata is under metadataFsys.
+func (s *SplittingStorage) walkMetadata(fn func(path string) error) error {
+	return s.walkMetadataSuffix(metaSuffix, fn)
+}
+
+func (s *SplittingStorage) walkMetadataSuffix(suffix string, fn func(path string) error) error {
+	objects, err := s.metadataFsys.List(context.Background(), "")
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		if !strings.HasSuffix(obj.Name, suffix) {
+			continue
+		}
+		if err := fn(strings.TrimSuffix(obj.Name, suffix)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes the file stored at path.
+//
+// The metadata is removed first so that the file becomes invisible to Read at once.
+// If Delete fails after that, remaining chunks are left as orphans and GC removes them later.
+// Missing chunks are ignored.
+//
+// For content addressed storage, chunks referred by other metadata are kept.
+// Delete walks all metadata to count references in that case, thus use DeleteMany to delete many files.
+// It waits for writes in progress on s before that, and blocks new ones until it returns.
+// Writes through other SplittingStorage instances sharing the backends are not serialized.
+func (s *SplittingStorage) Delete(path string) error {
+	return s.DeleteMany([]string{path})
+}
+
+// DeleteMany is Delete for multiple files.
+// For content addressed storage, metadata are walked only once for all of paths.
+// Files which fail to be deleted do not stop the rest; errors are joined.
+func (s *SplittingStorage) DeleteMany(paths []string) error {
+	if s.contentAddressed {
+		s.casMu.Lock()
+		defer s.casMu.Unlock()
+	}
+
+	var (
+		errs  []error
+		metas []SplittedFileMetadata
+	)
+	for _, path := range paths {
+		meta, err := s.readMetadata(path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		err = s.metadataFsys.Delete(context.Background(), filepath.Clean(path)+metaSuffix)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		metas = append(metas, meta)
+	}
+
+	var refs map[string]int
+	if s.contentAddressed && len(metas) > 0 {
+		var err error
+		refs, err = s.chunkRefs()
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+
+	for _, meta := range metas {
+		for _, chunk := range meta.Splitted {
+			if refs[filepath.Clean(chunk.Path)] > 0 {
+				continue
+			}
+			// a chunk shared among paths is already deleted for the later ones.
+			err := s.fileFsys.Delete(context.Background(), chunk.Path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// GC removes files under fileFsys which are not referenced by any metadata, e.g. chunks left by crashed writes,
+// and returns their paths in lexical order.
+// If dryRun is true, GC only reports them.
+//
+// Chunks recorded in progress of resumable writes are not removed.
+// Metadata and progress files are never treated as orphans, so fileFsys and metadataFsys may share a backend.
+// Chunks of a Write in progress have no metadata yet. GC must not run concurrently with Write.
+func (s *SplittingStorage) GC(dryRun bool) (orphans []string, err error) {
+	referenced, err := s.chunkRefs()
+	if err != nil {
+		return nil, err
+	}
+	err = s.walkMetadataSuffix(progressSuffix, func(path string) error {
+		progress, err := s.readProgress(path)
+		if err != nil {
+			return err
+		}
+		for _, chunk := range progress {
+			referenced[filepath.Clean(chunk.Path)]++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := s.fileFsys.List(context.Background(), "")
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if strings.HasSuffix(obj.Name, metaSuffix) || strings.HasSuffix(obj.Name, progressSuffix) {
+			continue
+		}
+		if referenced[filepath.Clean(obj.Name)] == 0 {
+			orphans = append(orphans, obj.Name)
+		}
+	}
+	sort.Strings(orphans)
+
+	if dryRun {
+		return orphans, nil
+	}
+	for i, p := range orphans {
+		if err := s.fileFsys.Delete(context.Background(), p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return orphans[:i], err
+		}
+	}
+	return orphans, nil
+}
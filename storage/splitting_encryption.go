@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ChunkCipher is an AEAD algorithm chunks are encrypted with.
+type ChunkCipher string
+
+const (
+	// ChunkCipherAESGCM is AES-GCM with 12 bytes random nonces. Keys must be 16, 24 or 32 bytes long.
+	ChunkCipherAESGCM ChunkCipher = "aes-gcm"
+	// ChunkCipherXChaCha20Poly1305 is XChaCha20-Poly1305 with 24 bytes random nonces. Keys must be 32 bytes long.
+	ChunkCipherXChaCha20Poly1305 ChunkCipher = "xchacha20-poly1305"
+)
+
+func (c ChunkCipher) valid() bool {
+	return c == ChunkCipherAESGCM || c == ChunkCipherXChaCha20Poly1305
+}
+
+func (c ChunkCipher) newAEAD(key []byte) (cipher.AEAD, error) {
+	switch c {
+	case ChunkCipherAESGCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ChunkCipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(key)
+	}
+	return nil, fmt.Errorf("%w: unknown cipher %q", ErrInvalidInput, string(c))
+}
+
+// KeyProvider provides keys for chunk encryption.
+// Implementations must be goroutine safe.
+type KeyProvider interface {
+	// CurrentKey returns the key used to encrypt new chunks and its ID recorded in SplittedFileHash.KeyID.
+	CurrentKey() (keyID string, key []byte, err error)
+	// Key returns the key identified by keyID to decrypt chunks.
+	// Keeping old keys available allows key rotation without re-encrypting stored chunks.
+	Key(keyID string) ([]byte, error)
+}
+
+// StaticKey returns a KeyProvider which only knows key identified by keyID.
+func StaticKey(keyID string, key []byte) KeyProvider {
+	return staticKey{keyID: keyID, key: key}
+}
+
+type staticKey struct {
+	keyID string
+	key   []byte
+}
+
+func (k staticKey) CurrentKey() (string, []byte, error) {
+	return k.keyID, k.key, nil
+}
+
+func (k staticKey) Key(keyID string) ([]byte, error) {
+	if keyID != k.keyID {
+		return nil, fmt.Errorf("%w: unknown key id %q", ErrInvalidInput, keyID)
+	}
+	return k.key, nil
+}
+
+// SplittingStorageWithEncryption makes SplittingStorage encrypt each chunk with c using keys.
+// Chunks are encrypted after compression with a random nonce which is stored in the metadata.
+// The chunk path is authenticated as additional data, so chunks can not be swapped or renamed.
+// Encrypted chunks are decrypted transparently on reading.
+//
+// Sizes and hash sums in the metadata are still those of plain content,
+// which reveals them to anyone able to read the metadata.
+// As is the case with SplittingStorageWithCodec, each chunk is encrypted in memory.
+func SplittingStorageWithEncryption(c ChunkCipher, keys KeyProvider) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.cipher = c
+		s.keys = keys
+	}
+}
+
+func (s *SplittingStorage) validateEncryption() error {
+	if s.cipher == "" {
+		return nil
+	}
+	if s.keys == nil {
+		return fmt.Errorf("%w: KeyProvider is nil", ErrInvalidInput)
+	}
+	_, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return fmt.Errorf("%w: retrieving current key: %w", ErrInvalidInput, err)
+	}
+	if _, err := s.cipher.newAEAD(key); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidInput, err)
+	}
+	return nil
+}
+
+func (s *SplittingStorage) seal(path string, plain []byte) (sealed []byte, keyID string, nonce string, err error) {
+	keyID, key, err := s.keys.CurrentKey()
+	if err != nil {
+		return nil, "", "", err
+	}
+	aead, err := s.cipher.newAEAD(key)
+	if err != nil {
+		return nil, "", "", err
+	}
+	n := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(n); err != nil {
+		return nil, "", "", err
+	}
+	return aead.Seal(nil, n, plain, []byte(path)), keyID, hex.EncodeToString(n), nil
+}
+
+func (s *SplittingStorage) open(chunk SplittedFileHash, sealed []byte) ([]byte, error) {
+	key, err := s.keys.Key(chunk.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := ChunkCipher(chunk.Encryption).newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(chunk.Nonce)
+	if err != nil || len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce for chunk %s", ErrInvalidInput, chunk.Path)
+	}
+	plain, err := aead.Open(nil, nonce, sealed, []byte(chunk.Path))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting chunk %s: %w", chunk.Path, err)
+	}
+	return plain, nil
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/ngicks/musicbox/stream"
+)
+
+// Manifest lists metadata of all files stored in a SplittingStorage.
+// It is exported by ExportManifest and consumed by ImportFrom to replicate files to another storage.
+type Manifest struct {
+	// Version is MetadataVersion of the exporting storage.
+	Version int
+	Files   []SplittedFileMetadata
+}
+
+// ExportManifest writes Manifest of all files stored in s to w as JSON.
+// Metadata older than MetadataVersion are migrated before being exported.
+func (s *SplittingStorage) ExportManifest(w io.Writer) error {
+	manifest := Manifest{Version: MetadataVersion, Files: []SplittedFileMetadata{}}
+	err := s.walkMetadata(func(path string) error {
+		meta, err := s.readMetadata(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		manifest.Files = append(manifest.Files, meta)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(manifest)
+}
+
+// ReadManifest reads Manifest written by ExportManifest from r.
+// It fails with an error wrapping ErrUnsupportedMetadataVersion if the manifest is newer than MetadataVersion.
+func ReadManifest(r io.Reader) (Manifest, error) {
+	var manifest Manifest
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return Manifest{}, fmt.Errorf("decoding manifest: %w", err)
+	}
+	if manifest.Version > MetadataVersion {
+		return Manifest{}, fmt.Errorf("%w: manifest version %d", ErrUnsupportedMetadataVersion, manifest.Version)
+	}
+	return manifest, nil
+}
+
+// ImportReport summarizes ImportFrom.
+type ImportReport struct {
+	// Imported is paths of files whose metadata are written to the destination.
+	Imported []string
+	// Skipped is paths of files already stored in the destination with same content.
+	Skipped []string
+	// CopiedChunks and CopiedBytes count chunks copied from the source, in their stored, possibly encoded, size.
+	CopiedChunks int
+	CopiedBytes  int64
+	// ReusedChunks counts chunks which the destination already has with same hash sums.
+	ReusedChunks int
+}
+
+// ImportFrom copies files listed in manifest from src to s.
+//
+// Chunks are copied as stored in src, keeping their paths, encodings and encryption,
+// thus s must have codecs and keys to decode them.
+// A chunk is not copied if s already has it with the size and the hash sum recorded in the manifest,
+// which is common for content addressed storages or for a repeated import after a failure.
+// Each copied chunk is read back and verified. Metadata of a file is written after all its chunks are copied.
+//
+// Files already stored in s with same content are skipped.
+// ImportFrom fails with an error wrapping ErrAlreadyExists if s already has a file at a same path with different content,
+// or a chunk at a same path with different content, which is likely to belong to another file.
+// It stops at the first error and the returned report covers files processed until then.
+func (s *SplittingStorage) ImportFrom(src *SplittingStorage, manifest Manifest) (ImportReport, error) {
+	var report ImportReport
+	for _, meta := range manifest.Files {
+		path := meta.Total.Path
+		if _, err := migrateMetadata(&meta, s.migrations); err != nil {
+			return report, fmt.Errorf("%s: %w", path, err)
+		}
+
+		existing, err := s.readMetadata(path)
+		switch {
+		case err == nil:
+			if existing.Total.HashSum != meta.Total.HashSum || existing.Total.HashAlgo != meta.Total.HashAlgo {
+				return report, fmt.Errorf("%w: %s", ErrAlreadyExists, path)
+			}
+			report.Skipped = append(report.Skipped, path)
+			continue
+		case !errors.Is(err, fs.ErrNotExist):
+			return report, err
+		}
+
+		for i, chunk := range meta.Splitted {
+			copied, size, err := s.importChunk(src, chunk)
+			if err != nil {
+				return report, fmt.Errorf("%s: chunk %d: %w", path, i, err)
+			}
+			if copied {
+				report.CopiedChunks++
+				report.CopiedBytes += size
+			} else {
+				report.ReusedChunks++
+			}
+		}
+
+		if err := s.writeMetadata(path+metaSuffix, meta); err != nil {
+			return report, err
+		}
+		report.Imported = append(report.Imported, path)
+	}
+	return report, nil
+}
+
+// importChunk copies chunk from src unless s has it already.
+// It reports whether the chunk is copied and the copied size.
+func (s *SplittingStorage) importChunk(src *SplittingStorage, chunk SplittedFileHash) (bool, int64, error) {
+	algo, err := chunk.Hash()
+	if err != nil {
+		return false, 0, err
+	}
+	matches := func() (bool, error) {
+		size, sum, err := s.hashChunk(chunk, algo.New())
+		if err != nil {
+			return false, err
+		}
+		return size == int64(chunk.Size) && sum == chunk.HashSum, nil
+	}
+
+	ok, err := matches()
+	switch {
+	case err == nil && ok:
+		return false, 0, nil
+	case err == nil:
+		return false, 0, fmt.Errorf("%w: %s has different content", ErrAlreadyExists, chunk.Path)
+	case !errors.Is(err, fs.ErrNotExist):
+		return false, 0, err
+	}
+
+	f, err := src.fileFsys.Get(context.Background(), chunk.Path)
+	if err != nil {
+		return false, 0, err
+	}
+	counter := stream.NewCountingReader(f)
+	err = s.fileFsys.Put(context.Background(), chunk.Path, fs.ModePerm, counter)
+	_ = f.Close()
+	if err != nil {
+		return false, 0, err
+	}
+
+	ok, err = matches()
+	if err == nil && !ok {
+		err = fmt.Errorf("%w: copied chunk %s does not match its hash sum", ErrInvalidInput, chunk.Path)
+	}
+	if err != nil {
+		_ = s.fileFsys.Delete(context.Background(), chunk.Path)
+		return false, 0, err
+	}
+	return true, counter.Count(), nil
+}
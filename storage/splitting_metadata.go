@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MetadataVersion is the version of SplittedFileMetadata written by this package.
+//
+// Metadata written before versioning was introduced has no Version field and is treated as version 0,
+// which has the same layout as version 1.
+// Adding optional fields does not bump the version since decoders skip unknown fields.
+const MetadataVersion = 1
+
+// ErrUnsupportedMetadataVersion is returned when metadata is written with a version newer than MetadataVersion.
+var ErrUnsupportedMetadataVersion = errors.New("unsupported metadata version")
+
+// MetadataMigration upgrades meta decoded from metadata written with an older version.
+// meta.Version is the version the metadata is written with.
+// Migrations are applied in order, then meta.Version is set to MetadataVersion.
+type MetadataMigration func(meta *SplittedFileMetadata) error
+
+// SplittingStorageWithMetadataMigration adds migrations applied to metadata older than MetadataVersion on read.
+// Migrated metadata is not written back; use MigrateMetadata to persist it.
+func SplittingStorageWithMetadataMigration(migrations ...MetadataMigration) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.migrations = append(s.migrations, migrations...)
+	}
+}
+
+// decodeMetadata decodes SplittedFileMetadata from r, one field and one chunk at a time,
+// so that it does not need to hold raw JSON of metadata for large files.
+// Unknown fields are skipped for forward compatibility.
+// An error for a chunk is annotated with its index.
+func decodeMetadata(r io.Reader) (SplittedFileMetadata, error) {
+	dec := json.NewDecoder(r)
+
+	var meta SplittedFileMetadata
+	if err := expectDelim(dec, '{'); err != nil {
+		return meta, err
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return meta, err
+		}
+		key, _ := tok.(string)
+		switch key {
+		case "Version":
+			err = dec.Decode(&meta.Version)
+		case "Total":
+			err = dec.Decode(&meta.Total)
+		case "Splitted":
+			err = decodeSplitted(dec, &meta)
+		default:
+			var skipped json.RawMessage
+			err = dec.Decode(&skipped)
+		}
+		if err != nil {
+			return meta, fmt.Errorf("decoding metadata field %q: %w", key, err)
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return meta, err
+	}
+
+	if meta.Version > MetadataVersion {
+		return meta, fmt.Errorf("%w: %d, supported up to %d", ErrUnsupportedMetadataVersion, meta.Version, MetadataVersion)
+	}
+	return meta, nil
+}
+
+func decodeSplitted(dec *json.Decoder, meta *SplittedFileMetadata) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok == nil {
+		// null
+		return nil
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return fmt.Errorf("expected array, got %v", tok)
+	}
+	for i := 0; dec.More(); i++ {
+		var h SplittedFileHash
+		if err := dec.Decode(&h); err != nil {
+			return fmt.Errorf("chunk %d: %w", i, err)
+		}
+		meta.Splitted = append(meta.Splitted, h)
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("decoding metadata: expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+// migrateMetadata upgrades meta to MetadataVersion. It reports whether meta has been changed.
+func migrateMetadata(meta *SplittedFileMetadata, migrations []MetadataMigration) (bool, error) {
+	if meta.Version == MetadataVersion {
+		return false, nil
+	}
+	for _, m := range migrations {
+		if err := m(meta); err != nil {
+			return false, fmt.Errorf("migrating metadata from version %d: %w", meta.Version, err)
+		}
+	}
+	meta.Version = MetadataVersion
+	return true, nil
+}
+
+// MigrateMetadata rewrites all metadata stored in metadataFsys older than MetadataVersion,
+// applying migrations in order.
+// It returns paths of stored files whose metadata are rewritten.
+//
+// MigrateMetadata stops at the first error. Since each metadata is rewritten by SafeWrite,
+// calling it again after fixing the cause continues the migration.
+func MigrateMetadata(metadataFsys Backend, migrations ...MetadataMigration) ([]string, error) {
+	s := &SplittingStorage{metadataFsys: metadataFsys}
+
+	var migrated []string
+	err := s.walkMetadata(func(path string) error {
+		f, err := metadataFsys.Get(context.Background(), path+metaSuffix)
+		if err != nil {
+			return err
+		}
+		meta, err := decodeMetadata(f)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		changed, err := migrateMetadata(&meta, migrations)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if !changed {
+			return nil
+		}
+		if err := s.writeMetadata(path+metaSuffix, meta); err != nil {
+			return err
+		}
+		migrated = append(migrated, path)
+		return nil
+	})
+	return migrated, err
+}
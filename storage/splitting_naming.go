@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ChunkInfo describes a chunk to be named by ChunkNamer.
+type ChunkInfo struct {
+	// Path is the path of the stored file.
+	Path string
+	// Index is the index of the chunk, starting from 0.
+	Index int
+	// Count is the number of chunks of the file if it is known in advance, e.g. for WriteAt. Otherwise it is 0.
+	Count int
+	// HashSum is the hex encoded hash sum of the chunk content.
+	// It is set only if the ChunkNamer returns true from NeedsHashSum.
+	HashSum string
+}
+
+// ChunkNamer names chunks of files stored in SplittingStorage.
+//
+// Names are validated before any chunk is written:
+// they must be unique across chunks of the file, must not escape the root
+// and must not collide with existing chunks, including ones of other files.
+type ChunkNamer interface {
+	// ChunkName returns the path of the chunk.
+	ChunkName(info ChunkInfo) string
+	// NeedsHashSum reports whether ChunkName uses ChunkInfo.HashSum.
+	// If true, SplittingStorage buffers each chunk in memory to compute its hash sum before naming it.
+	NeedsHashSum() bool
+}
+
+// ChunkNamerFunc adapts a path modifier, e.g. PathModifierAppendIndex, to ChunkNamer.
+type ChunkNamerFunc func(path string, i int) string
+
+func (f ChunkNamerFunc) ChunkName(info ChunkInfo) string {
+	return f(info.Path, info.Index)
+}
+
+func (f ChunkNamerFunc) NeedsHashSum() bool {
+	return false
+}
+
+type indexNamer struct {
+	minWidth   int
+	hashSuffix int
+}
+
+// ChunkNamerIndex returns ChunkNamer appending "_" + index to the path.
+// The index is zero-padded to the number of digits of the last index if the number of chunks is known in advance
+// and to minWidth otherwise, so that names sort in the order of chunks.
+// If the number of chunks is not known, indices longer than minWidth are not padded and do not sort.
+func ChunkNamerIndex(minWidth int) ChunkNamer {
+	return indexNamer{minWidth: minWidth}
+}
+
+// ChunkNamerHashSuffix is same as ChunkNamerIndex(3) but also appends "_" + first n hex digits of the hash sum,
+// or the whole sum if n is zero or larger than it.
+// Since names change with contents, a stale chunk never has a name of a fresh chunk.
+func ChunkNamerHashSuffix(n int) ChunkNamer {
+	if n == 0 {
+		n = -1
+	}
+	return indexNamer{minWidth: 3, hashSuffix: n}
+}
+
+func (n indexNamer) ChunkName(info ChunkInfo) string {
+	width := n.minWidth
+	if info.Count > 0 {
+		if w := len(strconv.Itoa(info.Count - 1)); w > width {
+			width = w
+		}
+	}
+	path, _ := strings.CutSuffix(info.Path, string(filepath.Separator))
+	name := fmt.Sprintf("%s_%0*d", path, width, info.Index)
+	if n.hashSuffix != 0 {
+		sum := info.HashSum
+		if n.hashSuffix > 0 && n.hashSuffix < len(sum) {
+			sum = sum[:n.hashSuffix]
+		}
+		name += "_" + sum
+	}
+	return name
+}
+
+func (n indexNamer) NeedsHashSum() bool {
+	return n.hashSuffix != 0
+}
+
+// SplittingStorageWithChunkNamer sets ChunkNamer naming chunks.
+// The default is ChunkNamerFunc(PathModifierAppendIndex).
+// It is ignored for content addressed storage.
+func SplittingStorageWithChunkNamer(namer ChunkNamer) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.namer = namer
+	}
+}
+
+// validChunkName returns an error wrapping ErrInvalidInput if name points to the root or outside of it.
+func validChunkName(name string) error {
+	trimmed := strings.TrimPrefix(filepath.Clean(name), string(filepath.Separator))
+	if trimmed == "" || trimmed == "." || !filepath.IsLocal(trimmed) {
+		return fmt.Errorf("%w: unsafe chunk name %q", ErrInvalidInput, name)
+	}
+	return nil
+}
+
+// nameChunk names i-th chunk of path. r is the content of the chunk, which may be nil if it is not available yet.
+// If the namer needs the hash sum, r is read into memory and replaced with the buffer.
+// The returned name is validated but not checked for collisions.
+func (s *SplittingStorage) nameChunk(path string, i, count int, r io.Reader) (string, io.Reader, error) {
+	info := ChunkInfo{Path: path, Index: i, Count: count}
+	if s.namer.NeedsHashSum() && r != nil {
+		var buf bytes.Buffer
+		h := s.hashAlgo.New()
+		if _, err := io.Copy(io.MultiWriter(&buf, h), r); err != nil {
+			return "", nil, err
+		}
+		info.HashSum = hex.EncodeToString(h.Sum(nil))
+		r = &buf
+	}
+
+	name := filepath.Clean(s.namer.ChunkName(info))
+	if err := validChunkName(name); err != nil {
+		return "", nil, err
+	}
+	if strings.HasPrefix(strings.TrimPrefix(name, string(filepath.Separator)), stagingDir+string(filepath.Separator)) {
+		return "", nil, fmt.Errorf("%w: chunk name %q is in the staging directory", ErrInvalidInput, name)
+	}
+	return name, r, nil
+}
+
+// checkChunkCollision returns an error wrapping ErrAlreadyExists if a chunk already exists at name.
+// Such chunks may belong to another file or may be left by a crashed write, which GC removes.
+func (s *SplittingStorage) checkChunkCollision(name string) error {
+	_, err := s.fileFsys.Stat(context.Background(), name)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: chunk %s", ErrAlreadyExists, name)
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	default:
+		return err
+	}
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/ngicks/musicbox/stream"
+	"github.com/spf13/afero"
+)
+
+// WriteSplittingAt is a parallel version of WriteSplitting.
+// It reads size bytes from r and writes them splitting at chunkSize, each into its own file by opt.SafeWrite.
+// Up to workers chunks are written simultaneously. If workers is zero or negative, runtime.GOMAXPROCS(0) is used.
+//
+// Chunk names are same as WriteSplitting would generate.
+// trapper, if non nil, is called concurrently and thus must be goroutine safe.
+//
+// Once writing any chunk fails, no further chunks are started.
+// Returned paths are those successfully written, in the order of chunks, possibly with gaps.
+// It panics if chunkSize is 0.
+func WriteSplittingAt(
+	fsys afero.Fs,
+	opt fsutil.SafeWriteOption,
+	path string,
+	perm fs.FileMode,
+	r io.ReaderAt,
+	size int64,
+	chunkSize uint,
+	workers int,
+	pathModifier func(path string, i int) string,
+	trapper func(path string, r io.Reader) io.Reader,
+) ([]string, error) {
+	if chunkSize == 0 {
+		panic("0 chunkSize in WriteSplittingAt")
+	}
+	if pathModifier == nil {
+		pathModifier = PathModifierAppendIndex
+	}
+	names := make([]string, chunkCount(size, chunkSize))
+	for i := range names {
+		names[i] = pathModifier(path, i)
+		if err := validChunkName(names[i]); err != nil {
+			return nil, err
+		}
+	}
+	return writeSplittingAt(
+		func(name string, r io.Reader) error { return opt.SafeWrite(fsys, name, perm, r) },
+		r,
+		size,
+		chunkSize,
+		workers,
+		names,
+		trapper,
+	)
+}
+
+func chunkCount(size int64, chunkSize uint) int {
+	return int((size + int64(chunkSize) - 1) / int64(chunkSize))
+}
+
+// writeSplittingAt writes each chunk of r by put concurrently, naming i-th chunk names[i].
+// names are checked for duplicates before any write.
+func writeSplittingAt(
+	put func(name string, r io.Reader) error,
+	r io.ReaderAt,
+	size int64,
+	chunkSize uint,
+	workers int,
+	names []string,
+	trapper func(path string, r io.Reader) io.Reader,
+) ([]string, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	num := len(names)
+	paths := make([]string, num)
+	seen := map[string]bool{}
+	for i := range paths {
+		paths[i] = filepath.Clean(names[i])
+		if seen[paths[i]] {
+			return nil, fmt.Errorf("%w: duplicate name: %s", ErrInvalidInput, paths[i])
+		}
+		seen[paths[i]] = true
+	}
+
+	var (
+		next    atomic.Int64
+		failed  atomic.Bool
+		written = make([]bool, num)
+		errs    = make([]error, num)
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < workers && w < num; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !failed.Load() {
+				i := int(next.Add(1) - 1)
+				if i >= num {
+					return
+				}
+				off := int64(i) * int64(chunkSize)
+				var chunk io.Reader = io.NewSectionReader(r, off, min64(int64(chunkSize), size-off))
+				if trapper != nil {
+					chunk = trapper(paths[i], chunk)
+				}
+				if err := put(paths[i], chunk); err != nil {
+					errs[i] = err
+					failed.Store(true)
+					return
+				}
+				written[i] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	var out []string
+	for i, p := range paths {
+		if written[i] {
+			out = append(out, p)
+		}
+	}
+	return out, errors.Join(errs...)
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// SplittingStorageWithWorkers sets number of chunks WriteAt writes simultaneously.
+// If workers is zero or negative, which is the default, runtime.GOMAXPROCS(0) is used.
+func SplittingStorageWithWorkers(workers int) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.workers = workers
+	}
+}
+
+// WriteAt is same as Write but reads size bytes from r and writes chunks in parallel by WriteSplittingAt.
+// The hash sum of the whole file is computed by reading r sequentially alongside.
+//
+// The resulting metadata is same as Write would produce for the same content,
+// and chunks are committed with it as Write does.
+// SplittingStorageWithResumable has no effect on WriteAt.
+func (s *SplittingStorage) WriteAt(path string, perm fs.FileMode, r io.ReaderAt, size int64) ([]string, error) {
+	path = filepath.Clean(path)
+
+	if s.contentAddressed || s.newSplitter != nil || s.namer.NeedsHashSum() {
+		return s.write(path, perm, io.NewSectionReader(r, 0, size), size)
+	}
+
+	if err := s.checkNotExist(path); err != nil {
+		return nil, err
+	}
+
+	st, err := s.newStaging()
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	sets := map[string]splittedDataSet{}
+	names := make([]string, chunkCount(size, s.splitSize))
+	indices := make(map[string]int, len(names))
+	for i := range names {
+		name, _, err := s.nameChunk(path, i, len(names), nil)
+		if err == nil {
+			err = s.checkChunkCollision(name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		names[i] = st.stage(name)
+		indices[names[i]] = i
+	}
+
+	// started after the checks above so that r is not read after early returns.
+	var (
+		totalSum string
+		totalErr error
+		wg       sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		h := s.hashAlgo.New()
+		_, totalErr = io.Copy(h, io.NewSectionReader(r, 0, size))
+		totalSum = hex.EncodeToString(h.Sum(nil))
+	}()
+
+	progress := s.newProgress(path, size)
+	staged, err := writeSplittingAt(
+		func(name string, r io.Reader) error {
+			if err := s.fileFsys.Put(context.Background(), name, perm, r); err != nil {
+				return err
+			}
+			mu.Lock()
+			n := sets[name].C.Count()
+			mu.Unlock()
+			progress.done(indices[name], n)
+			return nil
+		},
+		r,
+		size,
+		s.splitSize,
+		s.workers,
+		names,
+		func(path string, r io.Reader) io.Reader {
+			final := st.finalPath(path)
+			h := s.hashAlgo.New()
+			sizeCounted := stream.NewCountingReader(io.TeeReader(r, h))
+			encoded, encoding := s.encodeChunk(final, sizeCounted)
+			mu.Lock()
+			sets[path] = splittedDataSet{H: h, C: sizeCounted, Path: final, Encoding: encoding}
+			mu.Unlock()
+			return encoded
+		},
+	)
+	wg.Wait()
+	if err == nil {
+		err = totalErr
+	}
+	if err != nil {
+		st.discard()
+		return nil, err
+	}
+
+	ordered := make([]splittedDataSet, len(staged))
+	for i, p := range staged {
+		ordered[i] = sets[p]
+	}
+	meta := SplittedFileMetadata{
+		Total: SplittedFileHash{
+			Path:     path,
+			Size:     int(size),
+			HashSum:  totalSum,
+			HashAlgo: s.hashAlgo.String(),
+		},
+		Splitted: mapToSplittedFileHash(ordered, s.hashAlgo),
+	}
+	out, err := st.commit(path, staged, meta)
+	if err == nil {
+		progress.finish()
+	}
+	return out, err
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ngicks/musicbox/stream"
+)
+
+// Progress is reported by SplittingStorage after each chunk is written.
+//
+// Embedded stream.Progress counts bytes of chunks before encoding.
+// Its Done is set only for an extra report made once the file is committed,
+// whose Index is -1 and ChunkBytes is 0.
+type Progress struct {
+	stream.Progress
+	// Path is the path of the file being written.
+	Path string
+	// Index is the index of the chunk just written.
+	Index int
+	// ChunkBytes is the size of the chunk before encoding.
+	ChunkBytes int64
+	// Total is the size of the whole file if known in advance, e.g. for WriteAt. Otherwise it is -1.
+	Total int64
+}
+
+// SplittingStorageWithProgress sets fn which is called after each chunk is written by Write or WriteAt,
+// and once more after the file is committed.
+// Calls are serialized but, for parallel WriteAt, chunks are reported in the order of completion, not of indices.
+// Chunks kept by resumable or content addressed writes are reported as well.
+// fn is called synchronously and blocks the write, thus it should return quickly.
+func SplittingStorageWithProgress(fn func(p Progress)) SplittingStorageOption {
+	return func(s *SplittingStorage) {
+		s.progress = fn
+	}
+}
+
+type progressReporter struct {
+	fn    func(p Progress)
+	path  string
+	total int64
+	start time.Time
+
+	mu      sync.Mutex
+	written int64
+}
+
+// newProgress returns a reporter for a write of path, which is nil if no progress callback is set.
+// total is -1 if unknown.
+func (s *SplittingStorage) newProgress(path string, total int64) *progressReporter {
+	if s.progress == nil {
+		return nil
+	}
+	return &progressReporter{fn: s.progress, path: path, total: total, start: time.Now()}
+}
+
+// done reports that i-th chunk, whose size is n, has been written. It is a no-op for nil receiver.
+func (p *progressReporter) done(i int, n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.written += n
+	p.report(i, n, false)
+}
+
+// finish reports that the file has been committed. It is a no-op for nil receiver.
+func (p *progressReporter) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.report(-1, 0, true)
+}
+
+func (p *progressReporter) report(i int, n int64, done bool) {
+	p.fn(Progress{
+		Progress: stream.Progress{
+			N:       p.written,
+			Elapsed: time.Since(p.start),
+			Done:    done,
+		},
+		Path:       p.path,
+		Index:      i,
+		ChunkBytes: n,
+		Total:      p.total,
+	})
+}
@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/ngicks/musicbox/stream"
+)
+
+const progressSuffix = ".progress.json"
+
+// readProgress reads chunks recorded by a previous failed Write for path.
+// It returns nil without an error if there is no progress.
+func (s *SplittingStorage) readProgress(path string) ([]SplittedFileHash, error) {
+	f, err := s.metadataFsys.Get(context.Background(), path+progressSuffix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var progress SplittedFileMetadata
+	if err := json.NewDecoder(f).Decode(&progress); err != nil {
+		return nil, err
+	}
+	return progress.Splitted, nil
+}
+
+// isValidChunk reports whether the chunk file still has the size and the hash sum recorded in chunk.
+func (s *SplittingStorage) isValidChunk(chunk SplittedFileHash) bool {
+	if chunk.HashAlgo != s.hashAlgo.String() || chunk.Codec != s.codecName() || chunk.Encryption != string(s.cipher) {
+		return false
+	}
+	size, sum, err := s.hashChunk(chunk, s.hashAlgo.New())
+	return err == nil && size == int64(chunk.Size) && sum == chunk.HashSum
+}
+
+func (s *SplittingStorage) writeResumable(path string, perm fs.FileMode, r io.Reader, total int64) ([]string, error) {
+	progress, err := s.readProgress(path)
+	if err != nil {
+		return nil, err
+	}
+
+	hTotal := s.hashAlgo.New()
+	cTotal := stream.NewCountingReader(io.TeeReader(r, hTotal))
+	splitter := s.split(cTotal)
+	reporter := s.newProgress(path, total)
+
+	var (
+		out    []string
+		chunks []SplittedFileHash
+	)
+	seen := map[string]bool{}
+	for i := 0; ; i++ {
+		r, ok := splitter.Next()
+		if !ok {
+			break
+		}
+
+		nextPath, r, err := s.nameChunk(path, i, 0, r)
+		if err != nil {
+			return out, err
+		}
+		if seen[nextPath] {
+			return out, fmt.Errorf("%w: duplicate name: %s", ErrInvalidInput, nextPath)
+		}
+		seen[nextPath] = true
+
+		h := s.hashAlgo.New()
+		counted := stream.NewCountingReader(io.TeeReader(r, h))
+		var encoding chunkEncoding
+
+		skip := i < len(progress) && progress[i].Path == nextPath && s.isValidChunk(progress[i])
+		if skip {
+			if _, err := io.Copy(io.Discard, counted); err != nil {
+				return out, err
+			}
+		} else {
+			// chunks after an invalid one are no longer trusted.
+			progress = nil
+			encoded, e := s.encodeChunk(nextPath, counted)
+			if err := s.fileFsys.Put(context.Background(), nextPath, perm, encoded); err != nil {
+				return out, err
+			}
+			encoding = e
+		}
+
+		chunk := SplittedFileHash{
+			Path:     nextPath,
+			Size:     int(counted.Count()),
+			HashSum:  hex.EncodeToString(h.Sum(nil)),
+			HashAlgo: s.hashAlgo.String(),
+		}
+		if skip {
+			encoding = encodingOf(progress[i])
+		}
+		encoding.apply(&chunk)
+		if skip && chunk.HashSum != progress[i].HashSum {
+			_ = s.metadataFsys.Delete(context.Background(), path+progressSuffix)
+			return out, fmt.Errorf("%w: content of chunk %d differs from the previous attempt", ErrInvalidInput, i)
+		}
+
+		out = append(out, nextPath)
+		chunks = append(chunks, chunk)
+		if !skip {
+			err := s.writeMetadata(path+progressSuffix, SplittedFileMetadata{Splitted: chunks})
+			if err != nil {
+				return out, err
+			}
+		}
+		reporter.done(i, counted.Count())
+	}
+
+	meta := SplittedFileMetadata{
+		Total: SplittedFileHash{
+			Path:     path,
+			Size:     int(cTotal.Count()),
+			HashSum:  hex.EncodeToString(hTotal.Sum(nil)),
+			HashAlgo: s.hashAlgo.String(),
+		},
+		Splitted: chunks,
+	}
+	if err := s.writeMetadata(path+metaSuffix, meta); err != nil {
+		return out, err
+	}
+	if err := s.metadataFsys.Delete(context.Background(), path+progressSuffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return out, err
+	}
+	reporter.finish()
+	return out, nil
+}
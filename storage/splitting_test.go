@@ -2,12 +2,27 @@ package storage
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
 	"crypto/rand"
+	"crypto/sha256"
 	_ "embed"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/spf13/afero"
 	"gotest.tools/v3/assert"
 )
 
@@ -81,3 +96,914 @@ func (r *eofReader) Read(p []byte) (int, error) {
 	}
 	return n, nil
 }
+
+func newTestSplittingStorage(t *testing.T, opts ...SplittingStorageOption) (*SplittingStorage, afero.Fs, afero.Fs) {
+	t.Helper()
+	fileFsys, metaFsys := afero.NewMemMapFs(), afero.NewMemMapFs()
+	option := *fsutil.NewSafeWriteOption()
+	s, err := NewSplittingStorage(
+		NewSafeWriter(fileFsys, option),
+		NewSafeWriter(metaFsys, option),
+		7*1024,
+		opts...,
+	)
+	assert.NilError(t, err)
+	return s, fileFsys, metaFsys
+}
+
+func readMeta(t *testing.T, fsys afero.Fs, path string) SplittedFileMetadata {
+	t.Helper()
+	bin, err := afero.ReadFile(fsys, path+metaSuffix)
+	assert.NilError(t, err)
+	var meta SplittedFileMetadata
+	assert.NilError(t, json.Unmarshal(bin, &meta))
+	return meta
+}
+
+func TestSplittingStorage(t *testing.T) {
+	s, _, metaFsys := newTestSplittingStorage(t)
+
+	paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Equal(t, 5, len(paths))
+
+	meta := readMeta(t, metaFsys, "/foo")
+	assert.Equal(t, "SHA-256", meta.Total.HashAlgo)
+	algo, err := meta.Total.Hash()
+	assert.NilError(t, err)
+	assert.Equal(t, crypto.SHA256, algo)
+	sum := sha256.Sum256(randomBytes)
+	assert.Equal(t, hex.EncodeToString(sum[:]), meta.Total.HashSum)
+
+	r, size, err := s.Read("/foo")
+	assert.NilError(t, err)
+	defer func() { _ = r.Close() }()
+	assert.Equal(t, len(randomBytes), size)
+	bin, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes, bin))
+
+	// across a chunk boundary.
+	off := int64(7*1024 - 10)
+	_, err = r.Seek(off, io.SeekStart)
+	assert.NilError(t, err)
+	buf := make([]byte, 20)
+	_, err = io.ReadFull(r, buf)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes[off:off+20], buf))
+	_, err = r.ReadAt(buf, 3*7*1024+5)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes[3*7*1024+5:3*7*1024+25], buf))
+}
+
+func TestNewSplittingStorage_Validation(t *testing.T) {
+	w := NewSafeWriter(afero.NewMemMapFs(), *fsutil.NewSafeWriteOption())
+	_, err := NewSplittingStorage(w, w, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewSplittingStorage(w, w, 1024, SplittingStorageWithHash(crypto.MD4))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	_, err = SplittedFileHash{HashAlgo: "unknown"}.Hash()
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSplittingStorage_Verify(t *testing.T) {
+	s, fileFsys, _ := newTestSplittingStorage(t)
+
+	paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	_, err = s.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes[:100]))
+	assert.NilError(t, err)
+
+	report, err := s.Verify("/foo")
+	assert.NilError(t, err)
+	assert.Assert(t, report.Ok())
+
+	corrupted := bytes.Clone(randomBytes[7*1024 : 2*7*1024])
+	corrupted[0]++
+	assert.NilError(t, afero.WriteFile(fileFsys, paths[1], corrupted, fs.ModePerm))
+	assert.NilError(t, afero.WriteFile(fileFsys, paths[2], []byte("short"), fs.ModePerm))
+
+	report, err = s.Verify("/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, 3, len(report.Problems))
+	assert.Equal(t, VerifyProblemCorrupted, report.Problems[0].Kind)
+	assert.Equal(t, 1, report.Problems[0].Index)
+	assert.Equal(t, VerifyProblemSizeMismatch, report.Problems[1].Kind)
+	assert.Equal(t, "5", report.Problems[1].Actual)
+	assert.Equal(t, -1, report.Problems[2].Index)
+
+	assert.NilError(t, fileFsys.Remove(paths[3]))
+	reports, err := s.VerifyAll()
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(reports))
+	assert.Equal(t, "/bar", reports[0].Path)
+	assert.Assert(t, reports[0].Ok())
+	assert.Equal(t, "/foo", reports[1].Path)
+	assert.Equal(t, 3, len(reports[1].Problems)) // the whole file is not checked.
+	assert.Equal(t, VerifyProblemMissing, reports[1].Problems[2].Kind)
+
+	_, err = s.Verify("/baz")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSplittingStorage_DeleteAndGC(t *testing.T) {
+	s, fileFsys, metaFsys := newTestSplittingStorage(t)
+
+	fooPaths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	barPaths, err := s.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes[:100]))
+	assert.NilError(t, err)
+	// left by a crashed write.
+	assert.NilError(t, afero.WriteFile(fileFsys, "/baz_000", []byte("baz"), fs.ModePerm))
+
+	orphans, err := s.GC(true)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/baz_000"}, orphans)
+	_, err = fileFsys.Stat("/baz_000")
+	assert.NilError(t, err)
+
+	orphans, err = s.GC(false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/baz_000"}, orphans)
+	_, err = fileFsys.Stat("/baz_000")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NilError(t, s.Delete("/foo"))
+	for _, p := range fooPaths {
+		_, err := fileFsys.Stat(p)
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	}
+	_, err = metaFsys.Stat("/foo" + metaSuffix)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, _, err = s.Read("/foo")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.ErrorIs(t, s.Delete("/foo"), fs.ErrNotExist)
+
+	_, err = fileFsys.Stat(barPaths[0])
+	assert.NilError(t, err)
+	orphans, err = s.GC(false)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(orphans))
+}
+
+func TestSplittingStorage_GC_sharedBackend(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	w := NewSafeWriter(fsys, *fsutil.NewSafeWriteOption())
+	s, err := NewSplittingStorage(w, w, 7*1024, SplittingStorageWithResumable(true))
+	assert.NilError(t, err)
+
+	paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	// an interrupted resumable write leaves its progress.
+	_, err = s.Write("/bar", fs.ModePerm, &failingReader{r: bytes.NewReader(randomBytes), n: 7*1024 + 10, err: errors.New("boom")})
+	assert.Assert(t, err != nil)
+	_, err = fsys.Stat("/bar" + progressSuffix)
+	assert.NilError(t, err)
+	assert.NilError(t, afero.WriteFile(fsys, "/baz_000", []byte("baz"), fs.ModePerm))
+
+	orphans, err := s.GC(false)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/baz_000"}, orphans)
+
+	_, err = fsys.Stat("/foo" + metaSuffix)
+	assert.NilError(t, err)
+	_, err = fsys.Stat("/bar" + progressSuffix)
+	assert.NilError(t, err)
+	for _, p := range paths {
+		_, err := fsys.Stat(p)
+		assert.NilError(t, err)
+	}
+	r, _, err := s.Read("/foo")
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+}
+
+// failingReader returns err after reading n bytes from r.
+type failingReader struct {
+	r   io.Reader
+	n   int
+	err error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, r.err
+	}
+	if len(p) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= n
+	return n, err
+}
+
+func TestSplittingStorage_Resumable(t *testing.T) {
+	s, fileFsys, metaFsys := newTestSplittingStorage(t, SplittingStorageWithResumable(true))
+
+	sentinel := errors.New("sentinel")
+	_, err := s.Write("/foo", fs.ModePerm, &failingReader{r: bytes.NewReader(randomBytes), n: 3*7*1024 + 10, err: sentinel})
+	assert.ErrorIs(t, err, sentinel)
+	_, err = metaFsys.Stat("/foo" + progressSuffix)
+	assert.NilError(t, err)
+
+	orphans, err := s.GC(true)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(orphans))
+
+	// corrupt the second chunk. It and following ones are rewritten.
+	assert.NilError(t, afero.WriteFile(fileFsys, "/foo_001", []byte("corrupted"), fs.ModePerm))
+	first, err := fileFsys.Stat("/foo_000")
+	assert.NilError(t, err)
+	mtime := first.ModTime().Add(-time.Hour)
+	assert.NilError(t, fileFsys.Chtimes("/foo_000", mtime, mtime))
+
+	paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Equal(t, 5, len(paths))
+
+	first, err = fileFsys.Stat("/foo_000")
+	assert.NilError(t, err)
+	assert.Assert(t, first.ModTime().Equal(mtime)) // skipped
+	_, err = metaFsys.Stat("/foo" + progressSuffix)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	report, err := s.Verify("/foo")
+	assert.NilError(t, err)
+	assert.Assert(t, report.Ok(), "%#v", report)
+
+	// source changed between attempts.
+	_, err = s.Write("/bar", fs.ModePerm, &failingReader{r: bytes.NewReader(randomBytes), n: 7*1024 + 10, err: sentinel})
+	assert.ErrorIs(t, err, sentinel)
+	_, err = s.Write("/bar", fs.ModePerm, bytes.NewReader(make([]byte, len(randomBytes))))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = metaFsys.Stat("/bar" + progressSuffix)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestSplittingStorage_ReadLazy(t *testing.T) {
+	s, fileFsys, _ := newTestSplittingStorage(t)
+
+	paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.NilError(t, fileFsys.Remove(paths[len(paths)-1]))
+
+	// chunks are not opened until they are read.
+	r, size, err := s.Read("/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, len(randomBytes), size)
+
+	buf := make([]byte, 2*7*1024)
+	_, err = r.ReadAt(buf, 0)
+	assert.NilError(t, err)
+	assert.Assert(t, bytes.Equal(randomBytes[:len(buf)], buf))
+
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.NilError(t, r.Close())
+}
+
+func TestWriteSplittingAt(t *testing.T) {
+	sequential, _, seqMetaFsys := newTestSplittingStorage(t)
+	_, err := sequential.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+
+	for _, workers := range []int{0, 1, 3} {
+		s, fileFsys, metaFsys := newTestSplittingStorage(t, SplittingStorageWithWorkers(workers))
+		paths, err := s.WriteAt("/foo", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+		assert.NilError(t, err)
+		assert.DeepEqual(t, []string{"/foo_000", "/foo_001", "/foo_002", "/foo_003", "/foo_004"}, paths)
+		assert.DeepEqual(t, readMeta(t, seqMetaFsys, "/foo"), readMeta(t, metaFsys, "/foo"))
+
+		var buf bytes.Buffer
+		for _, p := range paths {
+			bin, err := afero.ReadFile(fileFsys, p)
+			assert.NilError(t, err)
+			buf.Write(bin)
+		}
+		assert.Assert(t, bytes.Equal(randomBytes, buf.Bytes()))
+	}
+
+	_, err = WriteSplittingAt(
+		afero.NewMemMapFs(), *fsutil.NewSafeWriteOption(), "/foo", fs.ModePerm,
+		bytes.NewReader(randomBytes), int64(len(randomBytes)), 1024, 2,
+		func(path string, i int) string { return path }, nil,
+	)
+	assert.ErrorContains(t, err, "duplicate name")
+}
+
+func TestSplittingStorage_ReadVerified(t *testing.T) {
+	s, fileFsys, _ := newTestSplittingStorage(t)
+
+	paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+
+	r, size, err := s.ReadVerified("/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, len(randomBytes), size)
+	bin, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+	assert.Assert(t, bytes.Equal(randomBytes, bin))
+
+	corrupted := bytes.Clone(randomBytes[2*7*1024 : 3*7*1024])
+	corrupted[10]++
+	assert.NilError(t, afero.WriteFile(fileFsys, paths[2], corrupted, fs.ModePerm))
+
+	r, _, err = s.ReadVerified("/foo")
+	assert.NilError(t, err)
+	defer func() { _ = r.Close() }()
+	bin, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, fsutil.ErrHashSumMismatch)
+	var chunkErr *ChunkError
+	assert.Assert(t, errors.As(err, &chunkErr))
+	assert.Equal(t, 2, chunkErr.Index)
+	assert.Equal(t, paths[2], chunkErr.Path)
+	// no corrupted byte is served.
+	assert.Assert(t, bytes.Equal(randomBytes[:2*7*1024], bin))
+}
+
+func TestSplittingStorage_Codec(t *testing.T) {
+	// compressible content.
+	content := bytes.Repeat([]byte("foobarbaz"), 4000)
+
+	for _, codec := range []ChunkCodec{GzipCodec(gzip.BestSpeed), ZstdCodec()} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			s, fileFsys, metaFsys := newTestSplittingStorage(t, SplittingStorageWithCodec(codec))
+
+			paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(content))
+			assert.NilError(t, err)
+			_, err = s.WriteAt("/bar", fs.ModePerm, bytes.NewReader(content), int64(len(content)))
+			assert.NilError(t, err)
+
+			meta := readMeta(t, metaFsys, "/foo")
+			for i, chunk := range meta.Splitted {
+				assert.Equal(t, codec.Name(), chunk.Codec)
+				s, err := fileFsys.Stat(paths[i])
+				assert.NilError(t, err)
+				assert.Equal(t, int64(chunk.CompressedSize), s.Size())
+				assert.Assert(t, chunk.CompressedSize < chunk.Size)
+			}
+
+			r, size, err := s.Read("/foo")
+			assert.NilError(t, err)
+			defer func() { _ = r.Close() }()
+			assert.Equal(t, len(content), size)
+			bin, err := io.ReadAll(r)
+			assert.NilError(t, err)
+			assert.Assert(t, bytes.Equal(content, bin))
+
+			buf := make([]byte, 30)
+			_, err = r.ReadAt(buf, 7*1024-15)
+			assert.NilError(t, err)
+			assert.Assert(t, bytes.Equal(content[7*1024-15:7*1024+15], buf))
+			_, err = r.ReadAt(buf, 10)
+			assert.NilError(t, err)
+			assert.Assert(t, bytes.Equal(content[10:40], buf))
+
+			report, err := s.Verify("/foo")
+			assert.NilError(t, err)
+			assert.Assert(t, report.Ok(), "%#v", report)
+
+			vr, _, err := s.ReadVerified("/bar")
+			assert.NilError(t, err)
+			bin, err = io.ReadAll(vr)
+			assert.NilError(t, err)
+			assert.NilError(t, vr.Close())
+			assert.Assert(t, bytes.Equal(content, bin))
+
+			// readable without the codec option.
+			plain := &SplittingStorage{fileFsys: s.fileFsys, metadataFsys: s.metadataFsys, hashAlgo: s.hashAlgo, splitSize: s.splitSize}
+			r2, _, err := plain.Read("/foo")
+			assert.NilError(t, err)
+			bin, err = io.ReadAll(r2)
+			assert.NilError(t, err)
+			assert.NilError(t, r2.Close())
+			assert.Assert(t, bytes.Equal(content, bin))
+		})
+	}
+}
+
+func TestSplittingStorage_Encryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	for _, c := range []ChunkCipher{ChunkCipherAESGCM, ChunkCipherXChaCha20Poly1305} {
+		t.Run(string(c), func(t *testing.T) {
+			s, fileFsys, metaFsys := newTestSplittingStorage(
+				t,
+				SplittingStorageWithEncryption(c, StaticKey("k1", key)),
+				SplittingStorageWithCodec(ZstdCodec()),
+			)
+
+			paths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+			assert.NilError(t, err)
+
+			meta := readMeta(t, metaFsys, "/foo")
+			nonces := map[string]bool{}
+			for _, chunk := range meta.Splitted {
+				assert.Equal(t, string(c), chunk.Encryption)
+				assert.Equal(t, "k1", chunk.KeyID)
+				nonces[chunk.Nonce] = true
+			}
+			assert.Equal(t, len(meta.Splitted), len(nonces))
+			stored, err := afero.ReadFile(fileFsys, paths[0])
+			assert.NilError(t, err)
+			assert.Assert(t, !bytes.Contains(stored, randomBytes[:64]))
+
+			r, _, err := s.Read("/foo")
+			assert.NilError(t, err)
+			bin, err := io.ReadAll(r)
+			assert.NilError(t, err)
+			assert.NilError(t, r.Close())
+			assert.Assert(t, bytes.Equal(randomBytes, bin))
+
+			report, err := s.Verify("/foo")
+			assert.NilError(t, err)
+			assert.Assert(t, report.Ok())
+
+			// swapped chunks fail to be authenticated.
+			second, err := afero.ReadFile(fileFsys, paths[1])
+			assert.NilError(t, err)
+			assert.NilError(t, afero.WriteFile(fileFsys, paths[0], second, fs.ModePerm))
+			vr, _, err := s.ReadVerified("/foo")
+			assert.NilError(t, err)
+			_, err = io.ReadAll(vr)
+			assert.ErrorContains(t, err, "decrypting chunk")
+			_ = vr.Close()
+
+			wrongKey, err := NewSplittingStorage(s.fileFsys, s.metadataFsys, s.splitSize, SplittingStorageWithEncryption(c, StaticKey("k2", key)))
+			assert.NilError(t, err)
+			_, _, err = wrongKey.Read("/foo")
+			assert.NilError(t, err) // keys are resolved lazily.
+			_, err = wrongKey.Verify("/foo")
+			assert.ErrorIs(t, err, ErrInvalidInput)
+		})
+	}
+
+	w := NewSafeWriter(afero.NewMemMapFs(), *fsutil.NewSafeWriteOption())
+	_, err := NewSplittingStorage(w, w, 1024, SplittingStorageWithEncryption(ChunkCipherAESGCM, StaticKey("k", []byte("short"))))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+	_, err = NewSplittingStorage(w, w, 1024, SplittingStorageWithEncryption("rot13", StaticKey("k", key)))
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSplittingStorage_ContentAddressed(t *testing.T) {
+	s, fileFsys, _ := newTestSplittingStorage(t, SplittingStorageWithContentAddressed(true), SplittingStorageWithCodec(GzipCodec(gzip.BestSpeed)))
+
+	fooPaths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	// shares the first 2 chunks with foo.
+	bar := append(bytes.Clone(randomBytes[:2*7*1024]), []byte("bar")...)
+	barPaths, err := s.WriteAt("/bar", fs.ModePerm, bytes.NewReader(bar), int64(len(bar)))
+	assert.NilError(t, err)
+
+	sum := sha256.Sum256(randomBytes[:7*1024])
+	hexSum := hex.EncodeToString(sum[:])
+	assert.Equal(t, "/"+hexSum[:2]+"/"+hexSum[2:4]+"/"+hexSum+".gzip", fooPaths[0])
+	assert.DeepEqual(t, fooPaths[:2], barPaths[:2])
+
+	orphans, err := s.GC(true)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(orphans))
+
+	r, _, err := s.Read("/bar")
+	assert.NilError(t, err)
+	bin, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+	assert.Assert(t, bytes.Equal(bar, bin))
+
+	assert.NilError(t, s.Delete("/foo"))
+	for i, p := range fooPaths {
+		_, err := fileFsys.Stat(p)
+		if i < 2 {
+			assert.NilError(t, err) // still referred by bar.
+		} else {
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		}
+	}
+	report, err := s.Verify("/bar")
+	assert.NilError(t, err)
+	assert.Assert(t, report.Ok())
+
+	w := NewSafeWriter(afero.NewMemMapFs(), *fsutil.NewSafeWriteOption())
+	_, err = NewSplittingStorage(
+		w, w, 1024,
+		SplittingStorageWithContentAddressed(true),
+		SplittingStorageWithEncryption(ChunkCipherAESGCM, StaticKey("k", bytes.Repeat([]byte{1}, 32))),
+	)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSplittingStorage_ContentAddressed_DeleteMany(t *testing.T) {
+	s, fileFsys, _ := newTestSplittingStorage(t, SplittingStorageWithContentAddressed(true))
+
+	shared := randomBytes[:2*7*1024]
+	var paths [][]string
+	for _, name := range []string{"/foo", "/bar", "/baz"} {
+		p, err := s.Write(name, fs.ModePerm, bytes.NewReader(append(bytes.Clone(shared), name...)))
+		assert.NilError(t, err)
+		paths = append(paths, p)
+	}
+
+	err := s.DeleteMany([]string{"/foo", "/missing", "/bar"})
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	for i, p := range paths {
+		_, err := fileFsys.Stat(p[2])
+		if i < 2 {
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		} else {
+			assert.NilError(t, err)
+		}
+	}
+	report, err := s.Verify("/baz")
+	assert.NilError(t, err)
+	assert.Assert(t, report.Ok())
+
+	// Delete and Write sharing chunks run concurrently.
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("/concurrent_%d", i)
+		done := make(chan error)
+		go func() {
+			_, err := s.Write(name, fs.ModePerm, bytes.NewReader(shared))
+			done <- err
+		}()
+		assert.NilError(t, s.Delete("/baz"))
+		assert.NilError(t, <-done)
+		report, err := s.Verify(name)
+		assert.NilError(t, err)
+		assert.Assert(t, report.Ok())
+
+		_, err = s.Write("/baz", fs.ModePerm, bytes.NewReader(shared))
+		assert.NilError(t, err)
+		assert.NilError(t, s.Delete(name))
+	}
+}
+
+func TestSplittingStorage_CDC(t *testing.T) {
+	s, _, _ := newTestSplittingStorage(
+		t,
+		SplittingStorageWithContentAddressed(true),
+		SplittingStorageWithSplitter(func(r io.Reader) ReaderSplitter { return SplitReaderCDC(r, 512, 2048, 8192) }),
+	)
+
+	fooPaths, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	shifted := append([]byte("prefix"), randomBytes...)
+	barPaths, err := s.WriteAt("/bar", fs.ModePerm, bytes.NewReader(shifted), int64(len(shifted)))
+	assert.NilError(t, err)
+
+	foo := map[string]bool{}
+	for _, p := range fooPaths {
+		foo[p] = true
+	}
+	var shared int
+	for _, p := range barPaths {
+		if foo[p] {
+			shared++
+		}
+	}
+	assert.Assert(t, shared >= len(barPaths)-2, "shared = %d, total = %d", shared, len(barPaths))
+
+	r, _, err := s.Read("/bar")
+	assert.NilError(t, err)
+	bin, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+	assert.Assert(t, bytes.Equal(shifted, bin))
+}
+
+func TestSplittingStorage_MetadataVersion(t *testing.T) {
+	s, _, metaFsys := newTestSplittingStorage(t)
+
+	_, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	meta := readMeta(t, metaFsys, "/foo")
+	assert.Equal(t, MetadataVersion, meta.Version)
+
+	// legacy metadata without Version and with unknown fields.
+	legacy := meta
+	legacy.Version = 0
+	bin, _ := json.Marshal(legacy)
+	var raw map[string]any
+	assert.NilError(t, json.Unmarshal(bin, &raw))
+	delete(raw, "Version")
+	raw["FutureField"] = map[string]any{"nested": []int{1, 2}}
+	bin, _ = json.Marshal(raw)
+	assert.NilError(t, afero.WriteFile(metaFsys, "/bar"+metaSuffix, bin, fs.ModePerm))
+
+	var migratedFrom []int
+	s.migrations = []MetadataMigration{func(meta *SplittedFileMetadata) error {
+		migratedFrom = append(migratedFrom, meta.Version)
+		return nil
+	}}
+	r, size, err := s.Read("/bar")
+	assert.NilError(t, err)
+	assert.Equal(t, len(randomBytes), size)
+	read, err := io.ReadAll(r)
+	assert.NilError(t, err)
+	assert.NilError(t, r.Close())
+	assert.Assert(t, bytes.Equal(randomBytes, read))
+	assert.DeepEqual(t, []int{0}, migratedFrom)
+
+	migrated, err := MigrateMetadata(s.metadataFsys)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/bar"}, migrated)
+	assert.DeepEqual(t, meta, readMeta(t, metaFsys, "/bar"))
+
+	migrated, err = MigrateMetadata(s.metadataFsys)
+	assert.NilError(t, err)
+	assert.Equal(t, 0, len(migrated))
+
+	newer := meta
+	newer.Version = MetadataVersion + 1
+	bin, _ = json.Marshal(newer)
+	assert.NilError(t, afero.WriteFile(metaFsys, "/baz"+metaSuffix, bin, fs.ModePerm))
+	_, _, err = s.Read("/baz")
+	assert.ErrorIs(t, err, ErrUnsupportedMetadataVersion)
+
+	bin, _ = json.Marshal(map[string]any{"Splitted": []any{map[string]any{"Size": "wrong"}}})
+	assert.NilError(t, afero.WriteFile(metaFsys, "/qux"+metaSuffix, bin, fs.ModePerm))
+	_, _, err = s.Read("/qux")
+	assert.ErrorContains(t, err, "chunk 0")
+}
+
+func countFiles(t *testing.T, fsys afero.Fs) int {
+	t.Helper()
+	var n int
+	assert.NilError(t, afero.Walk(fsys, "/", func(_ string, info fs.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			n++
+		}
+		return err
+	}))
+	return n
+}
+
+func TestSplittingStorage_AtomicCommit(t *testing.T) {
+	s, fileFsys, metaFsys := newTestSplittingStorage(t)
+
+	sentinel := errors.New("sentinel")
+	paths, err := s.Write("/foo", fs.ModePerm, &failingReader{r: bytes.NewReader(randomBytes), n: 3*7*1024 + 10, err: sentinel})
+	assert.ErrorIs(t, err, sentinel)
+	assert.Equal(t, 0, len(paths))
+	assert.Equal(t, 0, countFiles(t, fileFsys))
+	assert.Equal(t, 0, countFiles(t, metaFsys))
+
+	paths, err = s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Equal(t, 5, len(paths))
+	assert.Equal(t, 5, countFiles(t, fileFsys))
+	for _, p := range paths {
+		_, err := fileFsys.Stat(p)
+		assert.NilError(t, err)
+	}
+
+	_, err = s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	_, err = s.WriteAt("/foo", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	// failing to write metadata rolls back committed chunks.
+	readOnlyMeta, err := NewSplittingStorage(s.fileFsys, NewSafeWriter(afero.NewReadOnlyFs(metaFsys), *fsutil.NewSafeWriteOption()), 7*1024)
+	assert.NilError(t, err)
+	_, err = readOnlyMeta.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.Assert(t, err != nil)
+	_, err = readOnlyMeta.WriteAt("/bar", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+	assert.Assert(t, err != nil)
+	assert.Equal(t, 5, countFiles(t, fileFsys))
+}
+
+func TestSplittingStorage_ChunkNamer(t *testing.T) {
+	t.Run("index width", func(t *testing.T) {
+		fileFsys, metaFsys := afero.NewMemMapFs(), afero.NewMemMapFs()
+		option := *fsutil.NewSafeWriteOption()
+		s, err := NewSplittingStorage(
+			NewSafeWriter(fileFsys, option),
+			NewSafeWriter(metaFsys, option),
+			16,
+			SplittingStorageWithChunkNamer(ChunkNamerIndex(3)),
+		)
+		assert.NilError(t, err)
+
+		paths, err := s.WriteAt("/foo", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+		assert.NilError(t, err)
+		assert.Assert(t, len(paths) > 1000)
+		assert.Equal(t, "/foo_0000", paths[0])
+		assert.Equal(t, fmt.Sprintf("/foo_%04d", len(paths)-1), paths[len(paths)-1])
+		assert.Assert(t, sort.StringsAreSorted(paths))
+
+		// the number of chunks is not known to Write.
+		paths, err = s.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes))
+		assert.NilError(t, err)
+		assert.Equal(t, "/bar_000", paths[0])
+		assert.Equal(t, "/bar_1000", paths[1000])
+	})
+
+	t.Run("hash suffix", func(t *testing.T) {
+		s, _, _ := newTestSplittingStorage(t, SplittingStorageWithChunkNamer(ChunkNamerHashSuffix(8)))
+		paths, err := s.WriteAt("/foo", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+		assert.NilError(t, err)
+		assert.Equal(t, 5, len(paths))
+		for i, p := range paths {
+			sum := sha256.Sum256(randomBytes[i*7*1024 : min64(int64((i+1)*7*1024), int64(len(randomBytes)))])
+			assert.Equal(t, fmt.Sprintf("/foo_%03d_%s", i, hex.EncodeToString(sum[:4])), p)
+		}
+
+		r, size, err := s.Read("/foo")
+		assert.NilError(t, err)
+		assert.Equal(t, len(randomBytes), size)
+		got, err := io.ReadAll(r)
+		assert.NilError(t, err)
+		assert.NilError(t, r.Close())
+		assert.Assert(t, bytes.Equal(randomBytes, got))
+	})
+
+	t.Run("collision", func(t *testing.T) {
+		// every file is named as "/shared_<index>".
+		s, fileFsys, metaFsys := newTestSplittingStorage(t, SplittingStorageWithPathModifier(func(_ string, i int) string {
+			return fmt.Sprintf("/shared_%d", i)
+		}))
+		_, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+		assert.NilError(t, err)
+		_, err = s.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes))
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		ra := &countingReaderAt{r: bytes.NewReader(randomBytes)}
+		_, err = s.WriteAt("/bar", fs.ModePerm, ra, int64(len(randomBytes)))
+		assert.ErrorIs(t, err, ErrAlreadyExists)
+		// r is not read once WriteAt returned.
+		time.Sleep(10 * time.Millisecond)
+		assert.Equal(t, int64(0), ra.n.Load())
+		assert.Equal(t, 5, countFiles(t, fileFsys))
+		assert.Equal(t, 1, countFiles(t, metaFsys))
+	})
+
+	t.Run("invalid names", func(t *testing.T) {
+		for name, pm := range map[string]func(string, int) string{
+			"parent":    func(_ string, i int) string { return fmt.Sprintf("../x_%d", i) },
+			"root":      func(_ string, _ int) string { return "/" },
+			"staging":   func(_ string, i int) string { return fmt.Sprintf("/.staging/x_%d", i) },
+			"duplicate": func(_ string, _ int) string { return "/x" },
+		} {
+			s, fileFsys, _ := newTestSplittingStorage(t, SplittingStorageWithPathModifier(pm))
+			_, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+			assert.ErrorIs(t, err, ErrInvalidInput, name)
+			_, err = s.WriteAt("/foo", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+			assert.ErrorIs(t, err, ErrInvalidInput, name)
+			assert.Equal(t, 0, countFiles(t, fileFsys), name)
+		}
+
+		_, err := WriteSplitting(afero.NewMemMapFs(), *fsutil.NewSafeWriteOption(), "/foo", fs.ModePerm, bytes.NewReader(randomBytes), 7*1024, func(_ string, i int) string {
+			return fmt.Sprintf("../x_%d", i)
+		}, nil)
+		assert.ErrorIs(t, err, ErrInvalidInput)
+	})
+}
+
+type countingReaderAt struct {
+	r io.ReaderAt
+	n atomic.Int64
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.n.Add(1)
+	return r.r.ReadAt(p, off)
+}
+
+func TestSplittingStorage_Progress(t *testing.T) {
+	var reports []Progress
+	s, _, _ := newTestSplittingStorage(t, SplittingStorageWithProgress(func(p Progress) { reports = append(reports, p) }))
+
+	_, err := s.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	assert.Equal(t, 6, len(reports))
+	var written int64
+	for i, p := range reports[:5] {
+		written += p.ChunkBytes
+		assert.Equal(t, "/foo", p.Path)
+		assert.Equal(t, i, p.Index)
+		assert.Equal(t, written, p.N)
+		assert.Equal(t, int64(-1), p.Total)
+		assert.Assert(t, p.Elapsed > 0)
+		assert.Assert(t, !p.Done)
+	}
+	assert.Equal(t, int64(len(randomBytes)), written)
+	last := reports[5]
+	assert.Assert(t, last.Done)
+	assert.Equal(t, -1, last.Index)
+	assert.Equal(t, written, last.N)
+	assert.Assert(t, last.Rate() > 0)
+
+	reports = nil
+	_, err = s.WriteAt("/bar", fs.ModePerm, bytes.NewReader(randomBytes), int64(len(randomBytes)))
+	assert.NilError(t, err)
+	assert.Equal(t, 6, len(reports))
+	var indices []int
+	for _, p := range reports[:5] {
+		indices = append(indices, p.Index)
+		assert.Equal(t, int64(len(randomBytes)), p.Total)
+	}
+	sort.Ints(indices)
+	assert.DeepEqual(t, []int{0, 1, 2, 3, 4}, indices)
+	assert.Equal(t, int64(len(randomBytes)), reports[4].N)
+	assert.Assert(t, reports[5].Done)
+
+	// no report is made for a failed commit.
+	reports = nil
+	_, err = s.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+	assert.Equal(t, 0, len(reports))
+}
+
+func TestSplittingStorage_Manifest(t *testing.T) {
+	src, _, _ := newTestSplittingStorage(t, SplittingStorageWithCodec(GzipCodec(-1)))
+	_, err := src.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes))
+	assert.NilError(t, err)
+	_, err = src.Write("/bar", fs.ModePerm, bytes.NewReader(randomBytes[:20*1024]))
+	assert.NilError(t, err)
+
+	var buf bytes.Buffer
+	assert.NilError(t, src.ExportManifest(&buf))
+	manifest, err := ReadManifest(bytes.NewReader(buf.Bytes()))
+	assert.NilError(t, err)
+	assert.Equal(t, 2, len(manifest.Files))
+
+	dst, dstFiles, _ := newTestSplittingStorage(t, SplittingStorageWithCodec(GzipCodec(-1)))
+	report, err := dst.ImportFrom(src, manifest)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/bar", "/foo"}, report.Imported)
+	assert.Equal(t, 8, report.CopiedChunks)
+	assert.Equal(t, 0, report.ReusedChunks)
+	assert.Equal(t, 8, countFiles(t, dstFiles))
+
+	for path, content := range map[string][]byte{"/foo": randomBytes, "/bar": randomBytes[:20*1024]} {
+		r, _, err := dst.Read(path)
+		assert.NilError(t, err)
+		got, err := io.ReadAll(r)
+		assert.NilError(t, err)
+		assert.NilError(t, r.Close())
+		assert.Assert(t, bytes.Equal(content, got), path)
+	}
+
+	// chunks already in dst are not copied again.
+	assert.NilError(t, dst.metadataFsys.Delete(context.Background(), "/bar"+metaSuffix))
+	report, err = dst.ImportFrom(src, manifest)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, []string{"/bar"}, report.Imported)
+	assert.DeepEqual(t, []string{"/foo"}, report.Skipped)
+	assert.Equal(t, 0, report.CopiedChunks)
+	assert.Equal(t, 3, report.ReusedChunks)
+
+	other, _, _ := newTestSplittingStorage(t)
+	_, err = other.Write("/foo", fs.ModePerm, bytes.NewReader(randomBytes[:100]))
+	assert.NilError(t, err)
+	_, err = other.ImportFrom(src, manifest)
+	assert.ErrorIs(t, err, ErrAlreadyExists)
+
+	_, err = ReadManifest(strings.NewReader(`{"Version":100,"Files":[]}`))
+	assert.ErrorIs(t, err, ErrUnsupportedMetadataVersion)
+}
+
+type cancellingReader struct {
+	r      io.Reader
+	cancel context.CancelFunc
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return r.r.Read(p)
+}
+
+func TestSafeWriter_Context(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	w := NewSafeWriter(fsys, *fsutil.NewSafeWriteOption())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := w.WriteContext(ctx, "/foo", fs.ModePerm, &cancellingReader{r: bytes.NewReader(randomBytes), cancel: cancel})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, countFiles(t, fsys))
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = w.WriteFsContext(ctx, "/dir", fs.ModePerm, fstest.MapFS{"a": {Data: []byte("a")}})
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = fsys.Stat("/dir")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	assert.Equal(t, 0, countFiles(t, fsys))
+
+	var seen string
+	err = w.WriteContext(
+		context.Background(),
+		"/foo",
+		fs.ModePerm,
+		strings.NewReader("foo"),
+		func(_ context.Context, _ afero.Fs, _, dstName string, _ afero.File) error {
+			seen = dstName
+			return nil
+		},
+	)
+	assert.NilError(t, err)
+	assert.Equal(t, "/foo", seen)
+	bin, err := afero.ReadFile(fsys, "/foo")
+	assert.NilError(t, err)
+	assert.Equal(t, "foo", string(bin))
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/ngicks/musicbox/fsutil"
+	"github.com/ngicks/musicbox/stream"
+)
+
+// ChunkError is an error occurred while reading a chunk of a stored file.
+type ChunkError struct {
+	// Index is the index of the chunk in SplittedFileMetadata.Splitted.
+	Index int
+	Path  string
+	Err   error
+}
+
+func (e *ChunkError) Error() string {
+	return fmt.Sprintf("chunk %d (%s): %s", e.Index, e.Path, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// ReadVerified is same as Read but verifies each chunk against the metadata before serving any of its bytes.
+// If a chunk has a different size or hash sum, Read of the returned reader fails with *ChunkError
+// wrapping fsutil.ErrHashSumMismatch; bytes of preceding chunks are already served at that point.
+//
+// Each chunk is read twice, once for verification and once for serving.
+// Unlike Read, the returned reader is not seekable.
+func (s *SplittingStorage) ReadVerified(path string) (r io.ReadCloser, size int, err error) {
+	meta, err := s.readMetadata(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &verifiedReader{s: s, chunks: meta.Splitted}, meta.Total.Size, nil
+}
+
+type verifiedReader struct {
+	s      *SplittingStorage
+	chunks []SplittedFileHash
+	idx    int
+	cur    io.ReadCloser
+	err    error
+}
+
+func (r *verifiedReader) Read(p []byte) (int, error) {
+	for r.err == nil {
+		if r.cur == nil {
+			if r.idx >= len(r.chunks) {
+				return 0, io.EOF
+			}
+			if err := r.open(); err != nil {
+				r.err = err
+				break
+			}
+		}
+
+		n, err := r.cur.Read(p)
+		if err == io.EOF {
+			_ = r.cur.Close()
+			r.cur = nil
+			r.idx++
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		if err != nil {
+			r.err = &ChunkError{Index: r.idx, Path: r.chunks[r.idx].Path, Err: err}
+		}
+		return n, err
+	}
+	return 0, r.err
+}
+
+// open opens the current chunk and checks its size and hash sum.
+func (r *verifiedReader) open() error {
+	chunk := r.chunks[r.idx]
+	wrap := func(err error) error {
+		return &ChunkError{Index: r.idx, Path: chunk.Path, Err: err}
+	}
+
+	algo, err := chunk.Hash()
+	if err != nil {
+		return wrap(err)
+	}
+
+	expected, err := hex.DecodeString(chunk.HashSum)
+	if err != nil {
+		return wrap(fmt.Errorf("%w: malformed hash sum %q", ErrInvalidInput, chunk.HashSum))
+	}
+	f, err := r.s.openChunk(chunk)
+	if err != nil {
+		return wrap(err)
+	}
+	n, err := io.Copy(io.Discard, stream.NewVerifiedReader(f, algo.New(), expected))
+	_ = f.Close()
+	if err != nil {
+		return wrap(err)
+	}
+	if n != int64(chunk.Size) {
+		return wrap(fmt.Errorf(
+			"%w: expected size = %d, actual size = %d",
+			fsutil.ErrHashSumMismatch, chunk.Size, n,
+		))
+	}
+
+	f, err = r.s.openChunk(chunk)
+	if err != nil {
+		return wrap(err)
+	}
+
+	r.cur = f
+	return nil
+}
+
+func (r *verifiedReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
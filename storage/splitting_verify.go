@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"sort"
+)
+
+type VerifyProblemKind string
+
+const (
+	// VerifyProblemMissing is reported when a chunk file does not exist.
+	VerifyProblemMissing VerifyProblemKind = "missing"
+	// VerifyProblemSizeMismatch is reported when size of a chunk differs from the metadata.
+	VerifyProblemSizeMismatch VerifyProblemKind = "size_mismatch"
+	// VerifyProblemCorrupted is reported when a chunk has an expected size but a different hash sum.
+	VerifyProblemCorrupted VerifyProblemKind = "corrupted"
+)
+
+// VerifyProblem is a problem found by Verify.
+type VerifyProblem struct {
+	// Index is the index of the chunk in SplittedFileMetadata.Splitted.
+	// It is -1 if the problem is found in the whole file, described by SplittedFileMetadata.Total.
+	Index int
+	// Path is the path of the chunk, or the stored file if Index is -1.
+	Path string
+	Kind VerifyProblemKind
+	// Expected and Actual are sizes for VerifyProblemSizeMismatch and hex encoded hash sums for VerifyProblemCorrupted.
+	// Both are empty for VerifyProblemMissing.
+	Expected, Actual string
+}
+
+// VerifyReport is a result of Verify.
+type VerifyReport struct {
+	// Path is the path of the stored file.
+	Path     string
+	Problems []VerifyProblem
+}
+
+// Ok reports whether no problem is found.
+func (r VerifyReport) Ok() bool {
+	return len(r.Problems) == 0
+}
+
+// Verify re-reads each chunk of the file stored at path and checks its size and hash sum against the metadata.
+// Data corruption is reported in the returned VerifyReport
+// while errors, including absence of the metadata, are returned as an error.
+//
+// The whole file is checked only if all chunks exist.
+func (s *SplittingStorage) Verify(path string) (VerifyReport, error) {
+	meta, err := s.readMetadata(path)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	report := VerifyReport{Path: meta.Total.Path}
+
+	totalAlgo, err := meta.Total.Hash()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	hTotal := totalAlgo.New()
+	var totalSize int64
+	missing := false
+
+	for i, chunk := range meta.Splitted {
+		algo, err := chunk.Hash()
+		if err != nil {
+			return VerifyReport{}, err
+		}
+		size, sum, err := s.hashChunk(chunk, algo.New(), hTotal)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				missing = true
+				report.Problems = append(report.Problems, VerifyProblem{Index: i, Path: chunk.Path, Kind: VerifyProblemMissing})
+				continue
+			}
+			return VerifyReport{}, err
+		}
+		totalSize += size
+		if problem, ok := compareChunk(i, chunk, size, sum); !ok {
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	if !missing {
+		if problem, ok := compareChunk(-1, meta.Total, totalSize, hex.EncodeToString(hTotal.Sum(nil))); !ok {
+			report.Problems = append(report.Problems, problem)
+		}
+	}
+
+	return report, nil
+}
+
+func compareChunk(i int, expected SplittedFileHash, size int64, sum string) (VerifyProblem, bool) {
+	switch {
+	case int64(expected.Size) != size:
+		return VerifyProblem{
+			Index:    i,
+			Path:     expected.Path,
+			Kind:     VerifyProblemSizeMismatch,
+			Expected: fmt.Sprintf("%d", expected.Size),
+			Actual:   fmt.Sprintf("%d", size),
+		}, false
+	case expected.HashSum != sum:
+		return VerifyProblem{
+			Index:    i,
+			Path:     expected.Path,
+			Kind:     VerifyProblemCorrupted,
+			Expected: expected.HashSum,
+			Actual:   sum,
+		}, false
+	}
+	return VerifyProblem{}, true
+}
+
+// hashReader reads r writing its content to h and others.
+// It returns read size and hex encoded sum of h.
+func hashReader(r io.Reader, h hash.Hash, others ...io.Writer) (int64, string, error) {
+	n, err := io.Copy(io.MultiWriter(append([]io.Writer{h}, others...)...), r)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyAll verifies every file whose metadata is under metadataFsys.
+// Reports are sorted by path.
+func (s *SplittingStorage) VerifyAll() ([]VerifyReport, error) {
+	var reports []VerifyReport
+	err := s.walkMetadata(func(path string) error {
+		report, err := s.Verify(path)
+		if err != nil {
+			return fmt.Errorf("verifying %s: %w", path, err)
+		}
+		reports = append(reports, report)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(reports, func(i, j int) bool { return reports[i].Path < reports[j].Path })
+	return reports, nil
+}
@@ -0,0 +1,51 @@
+package stream
+
+// Range is a span of a reader concatenated by MultiReadAtSeekCloser,
+// expressed in offsets of the concatenated stream.
+type Range struct {
+	// Start is the offset of the first byte, inclusive.
+	Start int64
+	// End is the offset past the last byte, exclusive.
+	End int64
+	// Index is the index of the reader in readers passed to the constructor.
+	Index int
+}
+
+// Size returns the number of bytes in the range.
+func (r Range) Size() int64 {
+	return r.End - r.Start
+}
+
+// Contains reports whether off is in the range.
+func (r Range) Contains(off int64) bool {
+	return r.Start <= off && off < r.End
+}
+
+// BoundaryReporter exposes how a concatenated stream is made of readers.
+// Readers returned from NewMultiReadAtSeekCloser and NewLazyMultiReadAtSeekCloser implement it,
+// so that callers can map an offset back to the originating reader,
+// e.g. for reporting corruption at a specific chunk.
+type BoundaryReporter interface {
+	// Boundaries returns ranges of all readers in order, including zero sized ones.
+	Boundaries() []Range
+	// ReaderIndexAt returns the index of the reader which has the byte at off.
+	// It returns -1 if off is out of the stream.
+	ReaderIndexAt(off int64) int
+}
+
+var _ BoundaryReporter = (*multiReadAtSeekCloser)(nil)
+
+func (r *multiReadAtSeekCloser) Boundaries() []Range {
+	ranges := make([]Range, len(r.r))
+	for i, rr := range r.r {
+		ranges[i] = Range{Start: rr.accum, End: rr.accum + rr.Size, Index: i}
+	}
+	return ranges
+}
+
+func (r *multiReadAtSeekCloser) ReaderIndexAt(off int64) int {
+	if off < 0 || off >= r.upperLimit {
+		return -1
+	}
+	return search(off, r.r)
+}
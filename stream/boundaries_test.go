@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMultiReadAtSeekCloser_Boundaries(t *testing.T) {
+	var readers []SizedReaderAt
+	for _, size := range []int{10, 0, 25, 5} {
+		readers = append(readers, SizedReaderAt{R: bytes.NewReader(make([]byte, size)), Size: int64(size)})
+	}
+	r := NewMultiReadAtSeekCloser(readers).(BoundaryReporter)
+
+	expected := []Range{
+		{Start: 0, End: 10, Index: 0},
+		{Start: 10, End: 10, Index: 1},
+		{Start: 10, End: 35, Index: 2},
+		{Start: 35, End: 40, Index: 3},
+	}
+	boundaries := r.Boundaries()
+	assertEq(t, len(expected), len(boundaries))
+	for i := range expected {
+		assertEq(t, expected[i], boundaries[i])
+	}
+	assertEq(t, int64(25), boundaries[2].Size())
+	assertBool(t, !boundaries[1].Contains(10), "zero sized range contains offset")
+
+	for _, tc := range []struct {
+		off int64
+		idx int
+	}{
+		{0, 0}, {9, 0}, {10, 2}, {34, 2}, {35, 3}, {39, 3}, {40, -1}, {-1, -1},
+	} {
+		assertEq(t, tc.idx, r.ReaderIndexAt(tc.off))
+	}
+
+	// many readers go through binary search.
+	readers = readers[:0]
+	for i := 0; i < 100; i++ {
+		readers = append(readers, SizedReaderAt{R: bytes.NewReader(make([]byte, 3)), Size: 3})
+	}
+	r = NewMultiReadAtSeekCloser(readers).(BoundaryReporter)
+	assertEq(t, 66, r.ReaderIndexAt(200))
+
+	lazy := NewLazyMultiReadAtSeekCloser(nil)
+	_, ok := lazy.(BoundaryReporter)
+	assertBool(t, ok, "lazy reader does not implement BoundaryReporter")
+}
@@ -0,0 +1,117 @@
+package stream
+
+import (
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type cachedBlock struct {
+	idx int64
+	b   []byte
+	// eof is true if the block is the last one, shorter than the block size or not.
+	eof bool
+}
+
+type cachingReaderAt struct {
+	r         io.ReaderAt
+	blockSize int
+	maxBlocks int
+
+	mu     sync.Mutex
+	blocks map[int64]*list.Element
+	// lru holds *cachedBlock, the most recently used at front.
+	lru *list.List
+}
+
+// NewCachingReaderAt returns io.ReaderAt which reads r by blocks of blockSize bytes
+// and keeps up to maxBlocks recently read blocks in memory, evicting the least recently used one.
+// It speeds up repeated small reads near each other, e.g. parsing tags of media files stored in chunks.
+// If blockSize or maxBlocks is zero or negative, 64KiB and 16 are used respectively.
+//
+// Content of r must not change while it is cached. Errors other than io.EOF are not cached.
+//
+// The returned ReaderAt also implements io.Closer, which drops the cache and closes r if r implements it.
+// It is goroutine safe as long as r is.
+// Concurrent reads of a same uncached block may read r for each of them.
+func NewCachingReaderAt(r io.ReaderAt, blockSize, maxBlocks int) io.ReaderAt {
+	if blockSize <= 0 {
+		blockSize = 64 * 1024
+	}
+	if maxBlocks <= 0 {
+		maxBlocks = 16
+	}
+	return &cachingReaderAt{
+		r:         r,
+		blockSize: blockSize,
+		maxBlocks: maxBlocks,
+		blocks:    map[int64]*list.Element{},
+		lru:       list.New(),
+	}
+}
+
+func (c *cachingReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("CachingReaderAt.ReadAt: %w: negative", ErrOffset)
+	}
+	for n < len(p) {
+		cur := off + int64(n)
+		block, err := c.block(cur / int64(c.blockSize))
+		if err != nil {
+			return n, err
+		}
+		inBlock := int(cur - block.idx*int64(c.blockSize))
+		if inBlock >= len(block.b) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], block.b[inBlock:])
+		if block.eof && n < len(p) {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+func (c *cachingReaderAt) block(idx int64) (*cachedBlock, error) {
+	c.mu.Lock()
+	if elem, ok := c.blocks[idx]; ok {
+		c.lru.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*cachedBlock), nil
+	}
+	c.mu.Unlock()
+
+	buf := make([]byte, c.blockSize)
+	n, err := c.r.ReadAt(buf, idx*int64(c.blockSize))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	block := &cachedBlock{idx: idx, b: buf[:n], eof: err == io.EOF || n < c.blockSize}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.blocks[idx]; ok {
+		// read concurrently.
+		c.lru.MoveToFront(elem)
+		return elem.Value.(*cachedBlock), nil
+	}
+	c.blocks[idx] = c.lru.PushFront(block)
+	for c.lru.Len() > c.maxBlocks {
+		back := c.lru.Back()
+		delete(c.blocks, back.Value.(*cachedBlock).idx)
+		c.lru.Remove(back)
+	}
+	return block, nil
+}
+
+func (c *cachingReaderAt) Close() error {
+	c.mu.Lock()
+	c.blocks = map[int64]*list.Element{}
+	c.lru.Init()
+	c.mu.Unlock()
+	if closer, ok := c.r.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+type countingReaderAt struct {
+	r     io.ReaderAt
+	reads atomic.Int64
+}
+
+func (r *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.reads.Add(1)
+	return r.r.ReadAt(p, off)
+}
+
+func TestCachingReaderAt(t *testing.T) {
+	src := &countingReaderAt{r: bytes.NewReader(randomBytes)}
+	r := NewCachingReaderAt(src, 1024, 4)
+
+	buf := make([]byte, 10)
+	for i := 0; i < 10; i++ {
+		off := int64(i * 100)
+		n, err := r.ReadAt(buf, off)
+		assertErrorsIs(t, err, nil)
+		assertEq(t, 10, n)
+		assertBool(t, bytes.Equal(randomBytes[off:off+10], buf), "bytes.Equal returned false")
+	}
+	assertEq(t, int64(1), src.reads.Load())
+
+	// spanning blocks.
+	large := make([]byte, 3000)
+	n, err := r.ReadAt(large, 1000)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 3000, n)
+	assertBool(t, bytes.Equal(randomBytes[1000:4000], large), "bytes.Equal returned false")
+	assertEq(t, int64(4), src.reads.Load())
+
+	// block 0 is evicted by block 4.
+	_, err = r.ReadAt(buf, 4096)
+	assertErrorsIs(t, err, nil)
+	_, err = r.ReadAt(buf, 0)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(6), src.reads.Load())
+
+	// reading over the end.
+	n, err = r.ReadAt(large, int64(len(randomBytes)-100))
+	assertErrorsIs(t, err, io.EOF)
+	assertEq(t, 100, n)
+	assertBool(t, bytes.Equal(randomBytes[len(randomBytes)-100:], large[:n]), "bytes.Equal returned false")
+	n, err = r.ReadAt(buf, int64(len(randomBytes)))
+	assertErrorsIs(t, err, io.EOF)
+	assertEq(t, 0, n)
+
+	_, err = r.ReadAt(buf, -1)
+	assertErrorsIs(t, err, ErrOffset)
+
+	bin, err := io.ReadAll(io.NewSectionReader(r, 0, int64(len(randomBytes))))
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+	assertErrorsIs(t, r.(io.Closer).Close(), nil)
+}
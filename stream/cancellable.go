@@ -3,6 +3,8 @@ package stream
 import (
 	"context"
 	"io"
+	"sync"
+	"time"
 )
 
 type cancellable struct {
@@ -21,8 +23,7 @@ type cancellable struct {
 // However that does not mean that it would unblock already blocking Read calls (e.g. reading sockets, terminals, etc.)
 // If r is possible to block long and you wish to unblock it in that case,
 // r itself must be cancellable by its own mean.
-// For files, you can combine os.Pipe and platform specific poll functions,
-// for example, epoll for Linux, kqueue for Mac OS.
+// NewCancellableWithCloser and NewCancellableDeadliner are variants which do that on ctx cancellation.
 //
 // The returned Reader is not goroutine safe.
 // Calling Read multiple times simultaneously may cause undefined behaviors.
@@ -47,3 +48,82 @@ func (c *cancellable) Read(p []byte) (n int, err error) {
 	}
 	return n, err
 }
+
+type cancellableWithCloser struct {
+	cancellable
+	closer   io.Closer
+	stop     chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewCancellableWithCloser is same as NewCancellable but also calls onCancel once ctx is done,
+// so that it can unblock in-flight Read by e.g. closing r or setting a deadline on it.
+// onCancel is called from another goroutine, at most once.
+//
+// After ctx is done, Read returns ctx.Err() instead of an error caused by onCancel,
+// for example os.ErrDeadlineExceeded or os.ErrClosed.
+//
+// Close stops watching ctx, waiting for onCancel to return if it is running,
+// and then closes r if r implements io.Closer.
+// Callers must call Close to release the goroutine watching ctx.
+func NewCancellableWithCloser(ctx context.Context, r io.Reader, onCancel func()) io.ReadCloser {
+	c := &cancellableWithCloser{
+		cancellable: cancellable{ctx: ctx, r: r},
+		stop:        make(chan struct{}),
+	}
+	if closer, ok := r.(io.Closer); ok {
+		c.closer = closer
+	}
+	if done := ctx.Done(); done != nil && onCancel != nil {
+		c.wg.Add(1)
+		go func() {
+			defer c.wg.Done()
+			select {
+			case <-done:
+				onCancel()
+			case <-c.stop:
+			}
+		}()
+	}
+	return c
+}
+
+func (c *cancellableWithCloser) Read(p []byte) (n int, err error) {
+	n, err = c.cancellable.Read(p)
+	if err != nil && c.ctx.Err() != nil {
+		c.err = c.ctx.Err()
+		return n, c.err
+	}
+	return n, err
+}
+
+func (c *cancellableWithCloser) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	c.wg.Wait()
+	if c.closer != nil {
+		return c.closer.Close()
+	}
+	return nil
+}
+
+// ReadDeadliner is a reader whose blocking Read can be interrupted by a deadline.
+// *os.File and net.Conn implement it.
+type ReadDeadliner interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+}
+
+// NewCancellableDeadliner is NewCancellableWithCloser that unblocks in-flight Read of r on ctx cancellation
+// by setting a read deadline in the past.
+// If r does not support deadlines, e.g. *os.File opened for a regular file, and r implements io.Closer,
+// r is closed instead.
+func NewCancellableDeadliner(ctx context.Context, r ReadDeadliner) io.ReadCloser {
+	return NewCancellableWithCloser(ctx, r, func() {
+		if err := r.SetReadDeadline(time.Unix(1, 0)); err != nil {
+			if closer, ok := r.(io.Closer); ok {
+				_ = closer.Close()
+			}
+		}
+	})
+}
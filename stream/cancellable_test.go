@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"io"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestCancellable(t *testing.T) {
@@ -34,3 +36,47 @@ func TestCancellable(t *testing.T) {
 		}
 	})
 }
+
+func TestCancellableWithCloser(t *testing.T) {
+	t.Run("pipe", func(t *testing.T) {
+		pr, pw, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = pw.Close() }()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r := NewCancellableDeadliner(ctx, pr)
+		errCh := make(chan error)
+		go func() {
+			_, err := r.Read(make([]byte, 1024))
+			errCh <- err
+		}()
+
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		select {
+		case err := <-errCh:
+			assertErrorsIs(t, err, context.Canceled)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Read is not unblocked")
+		}
+		_, err = r.Read(make([]byte, 1024))
+		assertErrorsIs(t, err, context.Canceled)
+		assertErrorsIs(t, r.Close(), nil)
+	})
+
+	t.Run("close_stops_watching", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var called bool
+		r := NewCancellableWithCloser(ctx, bytes.NewReader(randomBytes), func() { called = true })
+		bin, err := io.ReadAll(r)
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+		assertErrorsIs(t, r.Close(), nil)
+		cancel()
+		time.Sleep(time.Millisecond)
+		assertBool(t, !called, "onCancel is called after Close")
+	})
+}
@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type countingThreshold struct {
+	at    int64
+	fn    func(n int64)
+	fired atomic.Bool
+}
+
+type countingOption struct {
+	thresholds []*countingThreshold
+}
+
+type CountingOption func(o *countingOption)
+
+// CountingWithThreshold registers fn to be called once the count reaches or exceeds n.
+// fn receives the count right after the Read or Write that crossed the threshold
+// and is called synchronously from it. Reset re-arms thresholds.
+// The option can be passed multiple times to register multiple thresholds.
+func CountingWithThreshold(n int64, fn func(n int64)) CountingOption {
+	return func(o *countingOption) {
+		o.thresholds = append(o.thresholds, &countingThreshold{at: n, fn: fn})
+	}
+}
+
+// counter is a goroutine safe byte counter shared by CountingReader and CountingWriter.
+type counter struct {
+	n          atomic.Int64
+	thresholds []*countingThreshold
+	// mu serializes Reset against firing thresholds.
+	mu sync.RWMutex
+}
+
+func (c *counter) init(opts []CountingOption) {
+	var opt countingOption
+	for _, o := range opts {
+		o(&opt)
+	}
+	c.thresholds = opt.thresholds
+}
+
+func (c *counter) add(n int) {
+	if len(c.thresholds) == 0 {
+		c.n.Add(int64(n))
+		return
+	}
+	c.mu.RLock()
+	cur := c.n.Add(int64(n))
+	var fire []*countingThreshold
+	for _, t := range c.thresholds {
+		if cur >= t.at && t.fired.CompareAndSwap(false, true) {
+			fire = append(fire, t)
+		}
+	}
+	c.mu.RUnlock()
+	for _, t := range fire {
+		t.fn(cur)
+	}
+}
+
+func (c *counter) reset() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range c.thresholds {
+		t.fired.Store(false)
+	}
+	return c.n.Swap(0)
+}
+
+// CountingReader counts bytes read from the underlying reader.
+// Count and Reset are safe to call concurrently with Read.
+type CountingReader struct {
+	r io.Reader
+	c counter
+}
+
+// NewCountingReader returns a reader which reads from r and counts bytes read.
+func NewCountingReader(r io.Reader, opts ...CountingOption) *CountingReader {
+	c := &CountingReader{r: r}
+	c.c.init(opts)
+	return c
+}
+
+func (r *CountingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.c.add(n)
+	return n, err
+}
+
+// Count returns the number of bytes read so far.
+func (r *CountingReader) Count() int64 {
+	return r.c.n.Load()
+}
+
+// Reset sets the count to zero, re-arms thresholds and returns the count before resetting.
+func (r *CountingReader) Reset() int64 {
+	return r.c.reset()
+}
+
+// CountingWriter counts bytes written to the underlying writer.
+// Count and Reset are safe to call concurrently with Write.
+type CountingWriter struct {
+	w io.Writer
+	c counter
+}
+
+// NewCountingWriter returns a writer which writes to w and counts bytes written.
+func NewCountingWriter(w io.Writer, opts ...CountingOption) *CountingWriter {
+	c := &CountingWriter{w: w}
+	c.c.init(opts)
+	return c
+}
+
+func (w *CountingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.c.add(n)
+	return n, err
+}
+
+// Count returns the number of bytes written so far.
+func (w *CountingWriter) Count() int64 {
+	return w.c.n.Load()
+}
+
+// Reset sets the count to zero, re-arms thresholds and returns the count before resetting.
+func (w *CountingWriter) Reset() int64 {
+	return w.c.reset()
+}
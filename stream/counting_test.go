@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestCountingReader(t *testing.T) {
+	var fired []int64
+	r := NewCountingReader(
+		bytes.NewReader(randomBytes),
+		CountingWithThreshold(100, func(n int64) { fired = append(fired, n) }),
+		CountingWithThreshold(int64(len(randomBytes)), func(n int64) { fired = append(fired, -n) }),
+	)
+
+	buf := make([]byte, 64)
+	_, err := io.ReadFull(r, buf)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(64), r.Count())
+	assertEq(t, 0, len(fired))
+
+	_, err = io.ReadFull(r, buf)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(128), r.Count())
+	assertEq(t, 1, len(fired))
+	assertEq(t, int64(128), fired[0])
+
+	_, err = io.Copy(io.Discard, r)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(len(randomBytes)), r.Count())
+	assertEq(t, 2, len(fired))
+	assertEq(t, -int64(len(randomBytes)), fired[1])
+
+	assertEq(t, int64(len(randomBytes)), r.Reset())
+	assertEq(t, int64(0), r.Count())
+
+	// thresholds are re-armed.
+	r.r = bytes.NewReader(randomBytes)
+	_, err = io.ReadFull(r, buf[:50])
+	assertErrorsIs(t, err, nil)
+	_, err = io.ReadFull(r, buf[:50])
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 3, len(fired))
+	assertEq(t, int64(100), fired[2])
+}
+
+func TestCountingWriter(t *testing.T) {
+	var fired int
+	var buf bytes.Buffer
+	w := NewCountingWriter(&buf, CountingWithThreshold(10, func(n int64) { fired++ }))
+
+	_, err := w.Write([]byte("foo"))
+	assertErrorsIs(t, err, nil)
+	_, err = w.Write([]byte("barbazqux"))
+	assertErrorsIs(t, err, nil)
+	_, err = w.Write([]byte("quux"))
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(16), w.Count())
+	assertEq(t, 1, fired)
+	assertEq(t, "foobarbazquxquux", buf.String())
+}
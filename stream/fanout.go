@@ -0,0 +1,155 @@
+package stream
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+)
+
+type fanoutOption struct {
+	bufSize int
+}
+
+type FanoutOption func(o *fanoutOption)
+
+// FanoutWithBufferSize sets the maximum number of bytes buffered for the slowest consumer.
+// The default is 64KiB. Zero or negative size is ignored.
+func FanoutWithBufferSize(size int) FanoutOption {
+	return func(o *fanoutOption) {
+		if size > 0 {
+			o.bufSize = size
+		}
+	}
+}
+
+type fanout struct {
+	r       io.Reader
+	bufSize int
+	scratch []byte
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// buf holds bytes at offsets from base to base+len(buf) of the stream,
+	// which are not yet read by at least one of open consumers.
+	buf     []byte
+	base    int64
+	filling bool
+	err     error
+	readers []*fanoutReader
+}
+
+type fanoutReader struct {
+	f      *fanout
+	pos    int64
+	closed bool
+}
+
+// NewFanoutReader returns n readers each of which reads the full content of r.
+//
+// r is read by a reader which needs bytes that are not yet buffered, one Read at a time.
+// Bytes are buffered until all of open readers read them, up to the size set by FanoutWithBufferSize.
+// Once the buffer is full, readers ahead wait for the slowest one, giving backpressure to r.
+// Therefore readers must be read concurrently, e.g. each in its own goroutine;
+// reading only one of them blocks forever after the buffer is filled.
+// Closing a reader detaches it so that others no longer wait for it.
+//
+// An error returned from r, including io.EOF, is returned from each reader after it reads all bytes preceding the error.
+// Closing readers does not close r.
+func NewFanoutReader(r io.Reader, n int, opts ...FanoutOption) []io.ReadCloser {
+	opt := fanoutOption{bufSize: 64 * 1024}
+	for _, o := range opts {
+		o(&opt)
+	}
+	f := &fanout{r: r, bufSize: opt.bufSize, scratch: make([]byte, opt.bufSize)}
+	f.cond = sync.NewCond(&f.mu)
+
+	out := make([]io.ReadCloser, n)
+	for i := range out {
+		fr := &fanoutReader{f: f}
+		f.readers = append(f.readers, fr)
+		out[i] = fr
+	}
+	return out
+}
+
+// minPos returns the smallest position of open readers. f.mu must be held.
+func (f *fanout) minPos() int64 {
+	pos := f.base + int64(len(f.buf))
+	for _, r := range f.readers {
+		if !r.closed && r.pos < pos {
+			pos = r.pos
+		}
+	}
+	return pos
+}
+
+// trim drops bytes read by all open readers. f.mu must be held.
+func (f *fanout) trim() {
+	if drop := f.minPos() - f.base; drop > 0 {
+		f.buf = f.buf[drop:]
+		f.base += drop
+		f.cond.Broadcast()
+	}
+}
+
+// fill reads r once into the buffer. f.mu must be held and is released while reading.
+func (f *fanout) fill(space int) {
+	f.filling = true
+	f.mu.Unlock()
+	n, err := f.r.Read(f.scratch[:space])
+	f.mu.Lock()
+	f.filling = false
+
+	f.buf = append(f.buf, f.scratch[:n]...)
+	if err != nil {
+		f.err = err
+	}
+	f.cond.Broadcast()
+}
+
+func (r *fanoutReader) Read(p []byte) (int, error) {
+	f := r.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.closed {
+		return 0, fs.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for {
+		tail := f.base + int64(len(f.buf))
+		if r.pos < tail {
+			n := copy(p, f.buf[r.pos-f.base:])
+			r.pos += int64(n)
+			f.trim()
+			return n, nil
+		}
+		if f.err != nil {
+			return 0, f.err
+		}
+		if space := f.bufSize - int(tail-f.minPos()); !f.filling && space > 0 {
+			f.fill(space)
+			continue
+		}
+		f.cond.Wait()
+		if r.closed {
+			return 0, fs.ErrClosed
+		}
+	}
+}
+
+func (r *fanoutReader) Close() error {
+	f := r.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !r.closed {
+		r.closed = true
+		f.trim()
+		f.cond.Broadcast()
+	}
+	return nil
+}
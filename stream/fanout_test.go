@@ -0,0 +1,82 @@
+package stream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+func TestFanoutReader(t *testing.T) {
+	readers := NewFanoutReader(iotest.HalfReader(bytes.NewReader(randomBytes)), 3, FanoutWithBufferSize(1024))
+	assertEq(t, 3, len(readers))
+
+	results := make([][]byte, len(readers))
+	var wg sync.WaitGroup
+	for i, r := range readers {
+		wg.Add(1)
+		go func(i int, r io.Reader) {
+			defer wg.Done()
+			if i == 0 {
+				// slow consumer.
+				r = iotest.OneByteReader(r)
+			}
+			bin, err := io.ReadAll(r)
+			assertErrorsIs(t, err, nil)
+			results[i] = bin
+		}(i, r)
+	}
+	wg.Wait()
+
+	for i, bin := range results {
+		assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false for reader %d", i)
+	}
+	for _, r := range readers {
+		assertErrorsIs(t, r.Close(), nil)
+	}
+}
+
+func TestFanoutReader_close(t *testing.T) {
+	readers := NewFanoutReader(bytes.NewReader(randomBytes), 2, FanoutWithBufferSize(1024))
+
+	// readers[0] reads only a few bytes and then is closed; readers[1] must not be blocked by it.
+	_, err := readers[0].Read(make([]byte, 10))
+	assertErrorsIs(t, err, nil)
+
+	done := make(chan []byte)
+	go func() {
+		h := sha256.New()
+		_, err := io.Copy(h, readers[1])
+		assertErrorsIs(t, err, nil)
+		done <- h.Sum(nil)
+	}()
+	assertErrorsIs(t, readers[0].Close(), nil)
+
+	sum := sha256.Sum256(randomBytes)
+	assertBool(t, bytes.Equal(sum[:], <-done), "wrong hash sum")
+
+	_, err = readers[0].Read(make([]byte, 10))
+	assertErrorsIs(t, err, fs.ErrClosed)
+}
+
+func TestFanoutReader_error(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	src := io.MultiReader(bytes.NewReader(randomBytes[:5000]), iotest.ErrReader(sentinel))
+	readers := NewFanoutReader(src, 2)
+
+	var wg sync.WaitGroup
+	for _, r := range readers {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			bin, err := io.ReadAll(r)
+			assertErrorsIs(t, err, sentinel)
+			assertBool(t, bytes.Equal(randomBytes[:5000], bin), "bytes.Equal returned false")
+		}(r)
+	}
+	wg.Wait()
+}
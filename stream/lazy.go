@@ -0,0 +1,157 @@
+package stream
+
+import (
+	"container/list"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// LazySizedReaderAt is a source of NewLazyMultiReadAtSeekCloser.
+// Size must be known in advance, e.g. from metadata, since readers are not opened until they are read.
+type LazySizedReaderAt struct {
+	// Open opens the source. If the returned reader implements io.Closer, it is closed when no longer needed.
+	Open func() (io.ReaderAt, error)
+	Size int64
+}
+
+// MultiReadAtSeekCloserWithMaxOpen sets the number of sources kept open by NewLazyMultiReadAtSeekCloser. The default is 4.
+// Sources being read are never closed, thus concurrent ReadAt calls may exceed the limit temporarily.
+// It has no effect on NewMultiReadAtSeekCloser.
+func MultiReadAtSeekCloserWithMaxOpen(maxOpen int) MultiReadAtSeekCloserOption {
+	return func(o *multiReadAtSeekCloserOption) {
+		o.maxOpen = maxOpen
+	}
+}
+
+// NewLazyMultiReadAtSeekCloser is same as NewMultiReadAtSeekCloser but opens each source only when it is first read.
+//
+// A source is closed as soon as the offset of Read, Seek or WriteTo moves past it,
+// or it is the least recently used one when more than the limit set by MultiReadAtSeekCloserWithMaxOpen are open.
+// A closed source is opened again if it is read again.
+// Thus a file assembled from a lot of chunk files can be read without holding all of them open.
+//
+// An error from Open is returned from the read and the source is opened again on the next read.
+// Errors from closing sources are returned from Close of the returned reader.
+// Reading after Close fails with an error wrapping fs.ErrClosed.
+func NewLazyMultiReadAtSeekCloser(sources []LazySizedReaderAt, opts ...MultiReadAtSeekCloserOption) ReadAtReadSeekCloser {
+	opt := newMultiReadAtSeekCloserOption(opts)
+	if opt.maxOpen <= 0 {
+		opt.maxOpen = 1
+	}
+	g := &lazyGroup{maxOpen: opt.maxOpen, lru: list.New()}
+
+	lazies := make([]*lazyReaderAt, len(sources))
+	readers := make([]SizedReaderAt, len(sources))
+	for i, src := range sources {
+		lazies[i] = &lazyReaderAt{g: g, open: src.Open}
+		readers[i] = SizedReaderAt{R: lazies[i], Size: src.Size}
+	}
+	r := newMultiReadAtSeekCloser(readers, opt)
+	r.passed = func(i int) { g.passed(lazies[i]) }
+	r.closer = g.close
+	return r
+}
+
+// lazyGroup limits open readers among lazyReaderAt sharing it.
+type lazyGroup struct {
+	mu      sync.Mutex
+	maxOpen int
+	// lru holds open *lazyReaderAt, the most recently used at front.
+	lru    *list.List
+	closed bool
+	errs   []error
+}
+
+type lazyReaderAt struct {
+	g    *lazyGroup
+	open func() (io.ReaderAt, error)
+
+	// fields below are guarded by g.mu.
+	r    io.ReaderAt
+	elem *list.Element
+	refs int
+}
+
+func (l *lazyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r, err := l.g.acquire(l)
+	if err != nil {
+		return 0, err
+	}
+	defer l.g.release(l)
+	return r.ReadAt(p, off)
+}
+
+func (g *lazyGroup) acquire(l *lazyReaderAt) (io.ReaderAt, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.closed {
+		return nil, fs.ErrClosed
+	}
+	if l.r == nil {
+		r, err := l.open()
+		if err != nil {
+			return nil, err
+		}
+		l.r = r
+		l.elem = g.lru.PushFront(l)
+	} else {
+		g.lru.MoveToFront(l.elem)
+	}
+	l.refs++
+	g.evict()
+	return l.r, nil
+}
+
+func (g *lazyGroup) release(l *lazyReaderAt) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	l.refs--
+	g.evict()
+}
+
+// passed closes l unless it is being read.
+func (g *lazyGroup) passed(l *lazyReaderAt) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if l.r != nil && l.refs == 0 {
+		g.closeReader(l)
+	}
+}
+
+// evict closes least recently used readers not being read until the limit is met. g.mu must be held.
+func (g *lazyGroup) evict() {
+	for elem := g.lru.Back(); elem != nil && g.lru.Len() > g.maxOpen; {
+		prev := elem.Prev()
+		if l := elem.Value.(*lazyReaderAt); l.refs == 0 {
+			g.closeReader(l)
+		}
+		elem = prev
+	}
+}
+
+// closeReader closes l. g.mu must be held.
+func (g *lazyGroup) closeReader(l *lazyReaderAt) {
+	if c, ok := l.r.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			g.errs = append(g.errs, err)
+		}
+	}
+	g.lru.Remove(l.elem)
+	l.r, l.elem = nil, nil
+}
+
+func (g *lazyGroup) close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	for elem := g.lru.Front(); elem != nil; {
+		next := elem.Next()
+		g.closeReader(elem.Value.(*lazyReaderAt))
+		elem = next
+	}
+	errs := g.errs
+	g.errs = nil
+	return NewMultiError(errs)
+}
@@ -0,0 +1,124 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+)
+
+type openCounter struct {
+	mu      sync.Mutex
+	open    int
+	maxOpen int
+	opened  int
+}
+
+type countedReaderAt struct {
+	*bytes.Reader
+	c *openCounter
+}
+
+func (r *countedReaderAt) Close() error {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	r.c.open--
+	return nil
+}
+
+func (c *openCounter) sources(b []byte, size int) []LazySizedReaderAt {
+	var sources []LazySizedReaderAt
+	for off := 0; off < len(b); off += size {
+		chunk := b[off:min(off+size, len(b))]
+		sources = append(sources, LazySizedReaderAt{
+			Open: func() (io.ReaderAt, error) {
+				c.mu.Lock()
+				defer c.mu.Unlock()
+				c.open++
+				c.opened++
+				c.maxOpen = max(c.maxOpen, c.open)
+				return &countedReaderAt{Reader: bytes.NewReader(chunk), c: c}, nil
+			},
+			Size: int64(len(chunk)),
+		})
+	}
+	return sources
+}
+
+func max(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func TestLazyMultiReadAtSeekCloser(t *testing.T) {
+	t.Run("Read", func(t *testing.T) {
+		c := &openCounter{}
+		sources := c.sources(randomBytes, 100)
+		r := NewLazyMultiReadAtSeekCloser(sources)
+		assertEq(t, 0, c.opened)
+
+		bin, err := io.ReadAll(r)
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+		// closed once the offset moves past.
+		assertEq(t, 1, c.maxOpen)
+		assertEq(t, len(sources), c.opened)
+
+		assertErrorsIs(t, r.Close(), nil)
+		assertEq(t, 0, c.open)
+		_, err = r.ReadAt(make([]byte, 10), 0)
+		assertErrorsIs(t, err, fs.ErrClosed)
+	})
+
+	t.Run("WriteTo", func(t *testing.T) {
+		c := &openCounter{}
+		r := NewLazyMultiReadAtSeekCloser(c.sources(randomBytes, 100))
+		var buf bytes.Buffer
+		_, err := io.Copy(&buf, r)
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes, buf.Bytes()), "bytes.Equal returned false")
+		assertEq(t, 1, c.maxOpen)
+		assertErrorsIs(t, r.Close(), nil)
+		assertEq(t, 0, c.open)
+	})
+
+	t.Run("ReadAt", func(t *testing.T) {
+		c := &openCounter{}
+		r := NewLazyMultiReadAtSeekCloser(c.sources(randomBytes, 100), MultiReadAtSeekCloserWithMaxOpen(3))
+		buf := make([]byte, 150)
+		for _, off := range []int64{0, 1000, 2000, 3000, 0, 5000} {
+			n, err := r.ReadAt(buf, off)
+			assertErrorsIs(t, err, nil)
+			assertBool(t, bytes.Equal(randomBytes[off:off+int64(n)], buf[:n]), "bytes.Equal returned false")
+			assertBool(t, c.open <= 3, "too many open: %d", c.open)
+		}
+		// reading at 0 second time reopens evicted sources.
+		assertEq(t, 12, c.opened)
+		assertErrorsIs(t, r.Close(), nil)
+		assertEq(t, 0, c.open)
+	})
+
+	t.Run("open error", func(t *testing.T) {
+		sentinel := errors.New("sentinel")
+		fail := true
+		r := NewLazyMultiReadAtSeekCloser([]LazySizedReaderAt{{
+			Open: func() (io.ReaderAt, error) {
+				if fail {
+					return nil, sentinel
+				}
+				return bytes.NewReader([]byte("foo")), nil
+			},
+			Size: 3,
+		}})
+		_, err := r.Read(make([]byte, 3))
+		assertErrorsIs(t, err, sentinel)
+		fail = false
+		bin, err := io.ReadAll(r)
+		assertErrorsIs(t, err, nil)
+		assertEq(t, "foo", string(bin))
+	})
+}
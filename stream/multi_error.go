@@ -30,19 +30,69 @@ func putBuf(b *bytes.Buffer) {
 var _ error = multiError{}
 var _ fmt.Formatter = multiError{}
 
-type multiError []error
+type multiError struct {
+	errs []error
+	// omitted is the number of errors dropped by MultiErrorWithLimit.
+	omitted int
+}
+
+type multiErrorOption struct {
+	limit int
+	dedup bool
+}
+
+type MultiErrorOption func(o *multiErrorOption)
+
+// MultiErrorWithLimit caps the number of errors retained by NewMultiError to n.
+// Errors exceeding the limit are dropped and summarized as "and N more" in the message.
+// Dropped errors can not be examined by errors.Is and errors.As.
+// Zero or negative n means unlimited, which is the default.
+func MultiErrorWithLimit(n int) MultiErrorOption {
+	return func(o *multiErrorOption) {
+		o.limit = n
+	}
+}
+
+// MultiErrorWithDedup makes NewMultiError drop errors whose messages are identical to preceding ones.
+// Deduplication is done before the limit of MultiErrorWithLimit is applied.
+func MultiErrorWithDedup(dedup bool) MultiErrorOption {
+	return func(o *multiErrorOption) {
+		o.dedup = dedup
+	}
+}
 
 // NewMultiError wraps errors into single error ignoring nil error in errs.
 // If all errors are nil or len(errs) == 0, NewMultiError returns nil.
-func NewMultiError(errs []error) error {
+func NewMultiError(errs []error, opts ...MultiErrorOption) error {
+	var opt multiErrorOption
+	for _, o := range opts {
+		o(&opt)
+	}
+
 	var multiErr multiError
+	var seen map[string]struct{}
+	if opt.dedup {
+		seen = map[string]struct{}{}
+	}
 	for _, err := range errs {
-		if err != nil {
-			multiErr = append(multiErr, err)
+		if err == nil {
+			continue
+		}
+		if seen != nil {
+			msg := err.Error()
+			if _, ok := seen[msg]; ok {
+				continue
+			}
+			seen[msg] = struct{}{}
+		}
+		if opt.limit > 0 && len(multiErr.errs) >= opt.limit {
+			multiErr.omitted++
+			continue
 		}
+		multiErr.errs = append(multiErr.errs, err)
 	}
 
-	if len(multiErr) == 0 {
+	if len(multiErr.errs) == 0 {
 		return nil
 	}
 
@@ -53,11 +103,37 @@ func NewMultiError(errs []error) error {
 // As suffix "unchecked" implies it does not do any filtering for errs.
 // The returned error is always non nil even if all errors are nil or len(errs) == 0.
 func NewMultiErrorUnchecked(errs []error) error {
-	return multiError(errs)
+	return multiError{errs: errs}
+}
+
+// FromJoin converts err produced by errors.Join into an error same as NewMultiError returns,
+// so that it is formatted consistently with other errors of this package. opts are passed to NewMultiError.
+//
+// err is considered to be produced by errors.Join if it implements Unwrap() []error and
+// its message is messages of unwrapped errors joined by newlines.
+// Other errors, including ones returned from NewMultiError and fmt.Errorf with multiple %w verbs,
+// are returned as is.
+func FromJoin(err error, opts ...MultiErrorOption) error {
+	if _, ok := err.(multiError); ok {
+		return err
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return err
+	}
+	errs := joined.Unwrap()
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	if err.Error() != strings.Join(msgs, "\n") {
+		return err
+	}
+	return NewMultiError(errs, opts...)
 }
 
 func (me multiError) str(verb string) string {
-	if len(me) == 0 {
+	if len(me.errs) == 0 && me.omitted == 0 {
 		return "MultiError: "
 	}
 
@@ -66,10 +142,13 @@ func (me multiError) str(verb string) string {
 
 	_, _ = buf.WriteString("MultiError: ")
 
-	for _, e := range me {
+	for _, e := range me.errs {
 		_, _ = fmt.Fprintf(buf, verb, e)
 		_, _ = buf.WriteString(", ")
 	}
+	if me.omitted > 0 {
+		_, _ = fmt.Fprintf(buf, "and %d more, ", me.omitted)
+	}
 
 	buf.Truncate(buf.Len() - 2)
 
@@ -81,7 +160,7 @@ func (me multiError) Error() string {
 }
 
 func (me multiError) Unwrap() []error {
-	return me
+	return me.errs
 }
 
 // Format implements fmt.Formatter.
@@ -77,3 +77,61 @@ func (e *exampleErr) Error() string {
 	}
 	return fmt.Sprintf("exampleErr: Foo=%s Bar=%s Baz=%s", e.Foo, e.Bar, e.Baz)
 }
+
+func TestMultiError_options(t *testing.T) {
+	errs := []error{
+		errors.New("foo"),
+		nil,
+		errors.New("foo"),
+		errors.New("bar"),
+		fs.ErrClosed,
+		errExample,
+	}
+
+	limited := NewMultiError(errs, MultiErrorWithLimit(2))
+	assertEq(t, "MultiError: foo, foo, and 3 more", limited.Error())
+	assertEq(t, "MultiError: foo, foo, and 3 more", fmt.Sprintf("%+v", limited))
+	assertNotErrorsIs(t, limited, fs.ErrClosed)
+
+	deduped := NewMultiError(errs, MultiErrorWithDedup(true))
+	assertEq(t, "MultiError: foo, bar, file already closed, example", deduped.Error())
+	assertErrorsIs(t, deduped, fs.ErrClosed)
+
+	both := NewMultiError(errs, MultiErrorWithDedup(true), MultiErrorWithLimit(3))
+	assertEq(t, "MultiError: foo, bar, file already closed, and 1 more", both.Error())
+
+	wrapped := NewMultiError([]error{fmt.Errorf("wrapped: %w", errExample), &exampleErr{"foo", "bar", "baz"}})
+	assertErrorsIs(t, wrapped, errExample)
+	assertErrorsAs[*exampleErr](t, wrapped)
+	assertNotErrorsIs(t, wrapped, errExampleUnknown)
+
+	// errors.As finds errors in the same depth-first order as for errors.Join.
+	first, second := &exampleErr{Foo: "first"}, &exampleErr{Foo: "second"}
+	for _, err := range []error{
+		NewMultiError([]error{fmt.Errorf("x: %w", first), second}),
+		errors.Join(fmt.Errorf("x: %w", first), second),
+	} {
+		var target *exampleErr
+		assertBool(t, errors.As(err, &target), "not errors.As(err, &target)")
+		assertBool(t, target == first, "target != first")
+	}
+}
+
+func TestFromJoin(t *testing.T) {
+	assertNilInterface(t, FromJoin(nil))
+
+	joined := errors.Join(errors.New("foo"), errExample)
+	converted := FromJoin(joined)
+	assertEq(t, "MultiError: foo, example", converted.Error())
+	assertEq(t, "stream.multiError", fmt.Sprintf("%T", converted))
+	assertErrorsIs(t, converted, errExample)
+
+	assertEq(t, "MultiError: foo, and 1 more", FromJoin(joined, MultiErrorWithLimit(1)).Error())
+
+	// not produced by errors.Join.
+	wrapped := fmt.Errorf("%w: %w", errExample, fs.ErrClosed)
+	assertBool(t, FromJoin(wrapped) == wrapped, "converted non-joined error")
+	assertBool(t, FromJoin(errExample) == errExample, "converted non-joined error")
+	me := NewMultiError([]error{errExample})
+	assertEq(t, me.Error(), FromJoin(me).Error())
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/fs"
 	"sort"
+	"sync"
 )
 
 var (
@@ -98,16 +99,61 @@ type ReadAtReadSeekCloser interface {
 	io.ReadSeekCloser
 }
 
-var _ ReadAtReadSeekCloser = (*multiReadAtSeekCloser)(nil)
+var (
+	_ ReadAtReadSeekCloser = (*multiReadAtSeekCloser)(nil)
+	_ io.WriterTo          = (*multiReadAtSeekCloser)(nil)
+)
 
 type multiReadAtSeekCloser struct {
+	// mu guards idx and off if non nil.
+	mu         *sync.Mutex
 	idx        int   // idx of current sizedReaderAt which is pointed by off.
 	off        int64 // current offset
 	upperLimit int64 // precomputed upper limit
 	r          []sizedReaderAt
+	// passed, if non nil, is called with the index of a reader which the offset has moved past.
+	passed func(i int)
+	// closer, if non nil, replaces closing each reader.
+	closer func() error
+}
+
+type multiReadAtSeekCloserOption struct {
+	lock    bool
+	maxOpen int
+}
+
+type MultiReadAtSeekCloserOption func(o *multiReadAtSeekCloserOption)
+
+// MultiReadAtSeekCloserWithLock makes Read and Seek of the returned reader guarded by a mutex
+// so that they can be called from multiple goroutines.
+// Note that concurrent Read calls still share and advance a single offset.
+func MultiReadAtSeekCloserWithLock(lock bool) MultiReadAtSeekCloserOption {
+	return func(o *multiReadAtSeekCloserOption) {
+		o.lock = lock
+	}
+}
+
+func newMultiReadAtSeekCloserOption(opts []MultiReadAtSeekCloserOption) multiReadAtSeekCloserOption {
+	opt := multiReadAtSeekCloserOption{maxOpen: 4}
+	for _, o := range opts {
+		o(&opt)
+	}
+	return opt
+}
+
+// NewMultiReadAtSeekCloser returns ReadAtReadSeekCloser which virtually concatenates readers.
+//
+// ReadAt does not touch the offset shared by Read and Seek,
+// thus it is safe for concurrent callers as long as all readers are,
+// e.g. serving parallel HTTP range requests from a single instance.
+// Read and Seek are not goroutine safe unless MultiReadAtSeekCloserWithLock is set.
+//
+// The returned reader also implements BoundaryReporter.
+func NewMultiReadAtSeekCloser(readers []SizedReaderAt, opts ...MultiReadAtSeekCloserOption) ReadAtReadSeekCloser {
+	return newMultiReadAtSeekCloser(readers, newMultiReadAtSeekCloserOption(opts))
 }
 
-func NewMultiReadAtSeekCloser(readers []SizedReaderAt) ReadAtReadSeekCloser {
+func newMultiReadAtSeekCloser(readers []SizedReaderAt, opt multiReadAtSeekCloserOption) *multiReadAtSeekCloser {
 	translated := make([]sizedReaderAt, len(readers))
 	var accum = int64(0)
 	for i, rr := range readers {
@@ -117,25 +163,40 @@ func NewMultiReadAtSeekCloser(readers []SizedReaderAt) ReadAtReadSeekCloser {
 		}
 		accum += rr.Size
 	}
-	return &multiReadAtSeekCloser{
+	r := &multiReadAtSeekCloser{
 		upperLimit: accum,
 		r:          translated,
 	}
+	if opt.lock {
+		r.mu = new(sync.Mutex)
+	}
+	return r
+}
+
+func (r *multiReadAtSeekCloser) lock() func() {
+	if r.mu == nil {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
 }
 
 func (r *multiReadAtSeekCloser) Read(p []byte) (int, error) {
+	defer r.lock()()
+
 	if r.off >= r.upperLimit {
 		return 0, io.EOF
 	}
 
 	i := search(r.off, r.r[r.idx:])
 	rr := r.r[r.idx:][i]
+	// moved first so that passed readers are released before the next one is read.
+	r.moveIdx(r.idx + i)
 
 	readerOff := r.off - rr.accum
 	n, err := rr.R.ReadAt(p, readerOff)
 
 	if n > 0 || err == io.EOF {
-		r.idx += i
 		r.off += int64(n)
 	}
 
@@ -155,12 +216,61 @@ func (r *multiReadAtSeekCloser) Read(p []byte) (int, error) {
 	return n, err
 }
 
+// WriteTo implements io.WriterTo.
+// It writes from the current offset to the end, advancing the offset as Read does.
+// Each reader is streamed as a section, by w.ReadFrom if w implements io.ReaderFrom,
+// or with a single buffer shared across readers otherwise.
+func (r *multiReadAtSeekCloser) WriteTo(w io.Writer) (n int64, err error) {
+	defer r.lock()()
+
+	if r.off >= r.upperLimit {
+		return 0, nil
+	}
+
+	rf, hasReadFrom := w.(io.ReaderFrom)
+	var buf []byte
+	for i := search(r.off, r.r); i >= 0 && i < len(r.r); i++ {
+		rr := r.r[i]
+		readerOff := r.off - rr.accum
+		rem := rr.Size - readerOff
+		// A byte past the size is also requested to detect readers larger than their sizes, as Read does.
+		section := io.NewSectionReader(rr.R, readerOff, rem+1)
+		r.moveIdx(i)
+
+		var nn int64
+		if hasReadFrom {
+			nn, err = rf.ReadFrom(section)
+		} else {
+			if buf == nil {
+				buf = make([]byte, 32*1024)
+			}
+			nn, err = io.CopyBuffer(w, section, buf)
+		}
+		n += nn
+		r.off += nn
+		if err != nil {
+			return n, err
+		}
+		// Errors are reported as Read does, since WriteTo takes place of Read in io.Copy.
+		switch {
+		case nn > rem:
+			return n, fmt.Errorf("MultiReadAtSeekCloser.Read: %w", ErrInvalidSize)
+		case nn < rem:
+			return n, fmt.Errorf("MultiReadAtSeekCloser.Read: %w", io.ErrUnexpectedEOF)
+		}
+	}
+	r.moveIdx(len(r.r))
+	return n, nil
+}
+
 var (
 	ErrWhence = errors.New("unknown whence")
 	ErrOffset = errors.New("invalid offset")
 )
 
 func (r *multiReadAtSeekCloser) Seek(offset int64, whence int) (int64, error) {
+	defer r.lock()()
+
 	switch whence {
 	default:
 		return 0, fmt.Errorf("Seek: %w = %d", ErrWhence, whence)
@@ -177,16 +287,30 @@ func (r *multiReadAtSeekCloser) Seek(offset int64, whence int) (int64, error) {
 	r.off = offset
 
 	if r.off >= r.upperLimit {
-		r.idx = len(r.r)
+		r.moveIdx(len(r.r))
 		return r.off, nil
 	}
 
-	r.idx = search(r.off, r.r)
+	r.moveIdx(search(r.off, r.r))
 
 	return r.off, nil
 }
 
-// ReadAt implements io.ReaderAt.
+// moveIdx sets idx, notifying passed of the reader the offset has left.
+func (r *multiReadAtSeekCloser) moveIdx(idx int) {
+	if r.passed != nil && idx != r.idx && r.idx < len(r.r) {
+		if idx > r.idx {
+			for i := r.idx; i < idx && i < len(r.r); i++ {
+				r.passed(i)
+			}
+		} else {
+			r.passed(r.idx)
+		}
+	}
+	r.idx = idx
+}
+
+// ReadAt implements io.ReaderAt. It is safe to call concurrently with any method other than Close.
 func (r *multiReadAtSeekCloser) ReadAt(p []byte, off int64) (n int, err error) {
 	if off < 0 || off >= r.upperLimit {
 		return 0, io.EOF
@@ -241,6 +365,9 @@ func (r *multiReadAtSeekCloser) readAt(p []byte, off int64) (n int, err error) {
 }
 
 func (r *multiReadAtSeekCloser) Close() error {
+	if r.closer != nil {
+		return r.closer()
+	}
 	var errs []error
 	for _, rr := range r.r {
 		if c, ok := rr.R.(io.Closer); ok {
@@ -3,7 +3,9 @@ package stream
 import (
 	"bytes"
 	"crypto/rand"
+	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
 	"testing"
 )
@@ -279,3 +281,105 @@ func TestMultiReadAtSeekCloser_wrong_size(t *testing.T) {
 		})
 	}
 }
+
+func TestMultiReadAtSeekCloser_concurrent(t *testing.T) {
+	var sizedReaders []SizedReaderAt
+	for _, r := range prepareSplittedReader(randomBytes, []int{1024, 511, 3000}) {
+		sizedReaders = append(sizedReaders, SizedReaderAt{R: r, Size: r.R.Size()})
+	}
+
+	t.Run("ReadAt", func(t *testing.T) {
+		r := NewMultiReadAtSeekCloser(sizedReaders)
+		var wg sync.WaitGroup
+		errs := make([]error, 16)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				buf := make([]byte, 777)
+				for off := int64(i); off < int64(len(randomBytes)); off += 997 {
+					n, err := r.ReadAt(buf, off)
+					if err != nil && err != io.EOF {
+						errs[i] = err
+						return
+					}
+					if !bytes.Equal(randomBytes[off:off+int64(n)], buf[:n]) {
+						errs[i] = fmt.Errorf("content mismatch at %d", off)
+						return
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			assertErrorsIs(t, err, nil)
+		}
+	})
+
+	t.Run("Read with lock", func(t *testing.T) {
+		r := NewMultiReadAtSeekCloser(sizedReaders, MultiReadAtSeekCloserWithLock(true))
+		var (
+			wg    sync.WaitGroup
+			total atomic.Int64
+		)
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				buf := make([]byte, 100)
+				for {
+					n, err := r.Read(buf)
+					total.Add(int64(n))
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		assertEq(t, int64(len(randomBytes)), total.Load())
+
+		_, err := r.Seek(0, io.SeekStart)
+		assertErrorsIs(t, err, nil)
+		bin, err := io.ReadAll(r)
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+	})
+}
+
+// writerOnly hides io.ReaderFrom of the underlying writer.
+type writerOnly struct {
+	io.Writer
+}
+
+func TestMultiReadAtSeekCloser_WriteTo(t *testing.T) {
+	for _, lens := range [][]int{{1024}, {1024, 511, 3000}, {len(randomBytes)}} {
+		for _, readFrom := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%v_%t", lens, readFrom), func(t *testing.T) {
+				r := NewMultiReadAtSeekCloser(prepareSizedReader(randomBytes, lens, false))
+				_, err := r.Seek(700, io.SeekStart)
+				assertErrorsIs(t, err, nil)
+
+				var buf bytes.Buffer
+				var w io.Writer = &buf
+				if !readFrom {
+					w = writerOnly{&buf}
+				}
+				n, err := r.(io.WriterTo).WriteTo(w)
+				assertErrorsIs(t, err, nil)
+				assertEq(t, int64(len(randomBytes)-700), n)
+				assertBool(t, bytes.Equal(randomBytes[700:], buf.Bytes()), "bytes.Equal returned false")
+
+				off, err := r.Seek(0, io.SeekCurrent)
+				assertErrorsIs(t, err, nil)
+				assertEq(t, int64(len(randomBytes)), off)
+				n, err = r.(io.WriterTo).WriteTo(w)
+				assertErrorsIs(t, err, nil)
+				assertEq(t, int64(0), n)
+				nn, err := r.Read(make([]byte, 10))
+				assertErrorsIs(t, err, io.EOF)
+				assertEq(t, 0, nn)
+			})
+		}
+	}
+}
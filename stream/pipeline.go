@@ -0,0 +1,126 @@
+package stream
+
+import (
+	"io"
+	"sync"
+)
+
+// Stage is a step of Pipeline which transforms or observes bytes read from r.
+// If the returned reader implements io.Closer, Pipeline closes it on Close.
+type Stage func(r io.Reader) io.Reader
+
+// Pipeline chains a source reader and stages so that reading from Pipeline
+// reads from the source through every stage in order.
+//
+// Pipeline is not goroutine safe.
+type Pipeline struct {
+	r       io.Reader
+	closers []io.Closer
+	once    sync.Once
+	err     error
+}
+
+// NewPipeline returns a Pipeline reading from src through stages.
+// src is not closed by Pipeline.
+func NewPipeline(src io.Reader, stages ...Stage) *Pipeline {
+	return (&Pipeline{r: src}).Then(stages...)
+}
+
+// Then appends stages to the end of p and returns p.
+// It must be called before reading from p.
+func (p *Pipeline) Then(stages ...Stage) *Pipeline {
+	for _, stage := range stages {
+		p.r = stage(p.r)
+		if c, ok := p.r.(io.Closer); ok {
+			p.closers = append(p.closers, c)
+		}
+	}
+	return p
+}
+
+func (p *Pipeline) Read(b []byte) (int, error) {
+	return p.r.Read(b)
+}
+
+// Close closes outputs of stages implementing io.Closer, the last stage first.
+// Errors are combined by NewMultiError. Calling Close multiple times returns the same error.
+func (p *Pipeline) Close() error {
+	p.once.Do(func() {
+		var errs []error
+		for i := len(p.closers) - 1; i >= 0; i-- {
+			errs = append(errs, p.closers[i].Close())
+		}
+		p.err = NewMultiError(errs)
+	})
+	return p.err
+}
+
+// Sink copies everything read from p to w, then closes p.
+// Returned error combines an error occurred while copying and one returned from Close.
+func (p *Pipeline) Sink(w io.Writer) (int64, error) {
+	n, err := io.Copy(w, p.r)
+	return n, NewMultiError([]error{err, p.Close()})
+}
+
+// TeeStage returns a Stage which writes bytes read through it to w, e.g. a hash.Hash.
+func TeeStage(w io.Writer) Stage {
+	return func(r io.Reader) io.Reader {
+		return io.TeeReader(r, w)
+	}
+}
+
+// CountingStage returns a Stage which counts bytes read through it
+// and the CountingReader that the Stage returns once the Stage is applied.
+// The Stage must be applied at most once.
+func CountingStage(opts ...CountingOption) (Stage, *CountingReader) {
+	c := NewCountingReader(nil, opts...)
+	return func(r io.Reader) io.Reader {
+		c.r = r
+		return c
+	}, c
+}
+
+// WriterStage returns a Stage which transforms bytes through a writer made by newWriter,
+// e.g. a compressing writer.
+// Bytes read through the Stage are written to the writer in a separate goroutine
+// and bytes written out from it are served to the next stage.
+// The writer is closed once the upstream reaches EOF, flushing remaining bytes.
+//
+// The returned reader implements io.Closer, which stops the goroutine.
+func WriterStage(newWriter func(w io.Writer) (io.WriteCloser, error)) Stage {
+	return func(r io.Reader) io.Reader {
+		pr, pw := io.Pipe()
+		ws := &writerStage{pr: pr, done: make(chan struct{})}
+		go func() {
+			defer close(ws.done)
+			w, err := newWriter(pw)
+			if err != nil {
+				_ = pw.CloseWithError(err)
+				return
+			}
+			_, err = io.Copy(w, r)
+			if cErr := w.Close(); err == nil {
+				err = cErr
+			}
+			_ = pw.CloseWithError(err)
+		}()
+		return ws
+	}
+}
+
+type writerStage struct {
+	pr   *io.PipeReader
+	done chan struct{}
+}
+
+func (s *writerStage) Read(p []byte) (int, error) {
+	return s.pr.Read(p)
+}
+
+// Close closes the read side of the pipe so that the goroutine stops writing, and waits for it to return.
+// It returns once an in-flight Read of the upstream, if any, returns.
+func (s *writerStage) Close() error {
+	err := s.pr.Close()
+	<-s.done
+	return err
+}
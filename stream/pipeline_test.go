@@ -0,0 +1,87 @@
+package stream
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type closeRecorder struct {
+	io.Reader
+	name   string
+	closed *[]string
+	err    error
+}
+
+func (c *closeRecorder) Close() error {
+	*c.closed = append(*c.closed, c.name)
+	return c.err
+}
+
+func TestPipeline(t *testing.T) {
+	h := sha256.New()
+	counting, counter := CountingStage()
+	var compressed bytes.Buffer
+	p := NewPipeline(
+		bytes.NewReader(randomBytes),
+		TeeStage(h),
+		counting,
+		WriterStage(func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }),
+	)
+	n, err := p.Sink(&compressed)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(compressed.Len()), n)
+	assertEq(t, int64(len(randomBytes)), counter.Count())
+	sum := sha256.Sum256(randomBytes)
+	assertBool(t, bytes.Equal(sum[:], h.Sum(nil)), "wrong hash sum")
+
+	gr, err := gzip.NewReader(&compressed)
+	assertErrorsIs(t, err, nil)
+	bin, err := io.ReadAll(gr)
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+}
+
+func TestPipeline_Close(t *testing.T) {
+	var closed []string
+	sentinel1, sentinel2 := errors.New("sentinel1"), errors.New("sentinel2")
+	stage := func(name string, err error) Stage {
+		return func(r io.Reader) io.Reader {
+			return &closeRecorder{Reader: r, name: name, closed: &closed, err: err}
+		}
+	}
+	p := NewPipeline(bytes.NewReader(randomBytes), stage("a", sentinel1), TeeStage(io.Discard)).
+		Then(stage("b", nil), stage("c", sentinel2))
+
+	_, err := io.ReadAll(p)
+	assertErrorsIs(t, err, nil)
+	err = p.Close()
+	assertErrorsIs(t, err, sentinel1)
+	assertErrorsIs(t, err, sentinel2)
+	assertEq(t, "c,b,a", strings.Join(closed, ","))
+	assertErrorsIs(t, p.Close(), sentinel1)
+	assertEq(t, 3, len(closed))
+}
+
+func TestPipeline_WriterStage_error(t *testing.T) {
+	sentinel := errors.New("sentinel")
+	p := NewPipeline(
+		bytes.NewReader(randomBytes),
+		WriterStage(func(w io.Writer) (io.WriteCloser, error) { return nil, sentinel }),
+	)
+	_, err := p.Sink(io.Discard)
+	assertErrorsIs(t, err, sentinel)
+
+	// closing in the middle stops the goroutine.
+	p = NewPipeline(
+		bytes.NewReader(randomBytes),
+		WriterStage(func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil }),
+	)
+	_, err = p.Read(make([]byte, 10))
+	assertErrorsIs(t, err, nil)
+	assertErrorsIs(t, p.Close(), nil)
+}
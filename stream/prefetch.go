@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"io"
+	"io/fs"
+	"sync"
+)
+
+type prefetchChunk struct {
+	buf []byte
+	// b is the unread part of buf.
+	b   []byte
+	err error
+}
+
+type prefetchReader struct {
+	r      io.Reader
+	free   chan []byte
+	filled chan prefetchChunk
+	done   chan struct{}
+	wg     sync.WaitGroup
+	once   sync.Once
+
+	cur    prefetchChunk
+	err    error
+	closed bool
+}
+
+// NewPrefetchReader returns a reader which reads ahead from r in a background goroutine
+// into depth buffers of bufSize bytes, smoothing out latency of slow sources,
+// e.g. MultiReadAtSeekCloser over chunk files read by an encoder.
+// If bufSize or depth is zero or negative, 32KiB and 2 are used respectively.
+//
+// The first error from r, including io.EOF, is returned after all data read before it is consumed.
+//
+// Close stops prefetching and waits for the background goroutine to return from r.Read being called, if any.
+// Then it closes r if r implements io.Closer.
+// Close must be called to release the goroutine unless the reader is read until an error.
+//
+// The returned reader is not goroutine safe.
+func NewPrefetchReader(r io.Reader, bufSize, depth int) io.ReadCloser {
+	if bufSize <= 0 {
+		bufSize = 32 * 1024
+	}
+	if depth <= 0 {
+		depth = 2
+	}
+	p := &prefetchReader{
+		r:      r,
+		free:   make(chan []byte, depth),
+		filled: make(chan prefetchChunk, depth),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < depth; i++ {
+		p.free <- make([]byte, bufSize)
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+func (p *prefetchReader) run() {
+	defer p.wg.Done()
+	for {
+		var buf []byte
+		select {
+		case <-p.done:
+			return
+		case buf = <-p.free:
+		}
+
+		n, err := p.r.Read(buf)
+		select {
+		case <-p.done:
+			return
+		case p.filled <- prefetchChunk{buf: buf, b: buf[:n], err: err}:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (p *prefetchReader) Read(b []byte) (int, error) {
+	if p.closed {
+		return 0, fs.ErrClosed
+	}
+	for len(p.cur.b) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		if p.cur.buf != nil {
+			p.free <- p.cur.buf
+		}
+		p.cur = <-p.filled
+		p.err = p.cur.err
+	}
+	n := copy(b, p.cur.b)
+	p.cur.b = p.cur.b[n:]
+	return n, nil
+}
+
+func (p *prefetchReader) Close() error {
+	var err error
+	p.once.Do(func() {
+		p.closed = true
+		close(p.done)
+		p.wg.Wait()
+		if c, ok := p.r.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+	return err
+}
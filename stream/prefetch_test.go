@@ -0,0 +1,78 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type countingReader struct {
+	r      io.Reader
+	reads  atomic.Int64
+	closed atomic.Bool
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads.Add(1)
+	return r.r.Read(p)
+}
+
+func (r *countingReader) Close() error {
+	r.closed.Store(true)
+	return nil
+}
+
+func TestPrefetchReader(t *testing.T) {
+	for _, bufSize := range []int{1, 100, 1024, 64 * 1024} {
+		r := NewPrefetchReader(bytes.NewReader(randomBytes), bufSize, 3)
+		bin, err := io.ReadAll(r)
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false, bufSize = %d", bufSize)
+		assertErrorsIs(t, r.Close(), nil)
+	}
+
+	t.Run("reads ahead", func(t *testing.T) {
+		src := &countingReader{r: bytes.NewReader(randomBytes)}
+		r := NewPrefetchReader(src, 1024, 3)
+		deadline := time.Now().Add(5 * time.Second)
+		for src.reads.Load() < 3 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(20 * time.Millisecond)
+		// blocked until a buffer is consumed.
+		assertEq(t, int64(3), src.reads.Load())
+
+		buf := make([]byte, 1024)
+		_, err := io.ReadFull(r, buf)
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes[:1024], buf), "bytes.Equal returned false")
+
+		assertErrorsIs(t, r.Close(), nil)
+		assertBool(t, src.closed.Load(), "underlying reader is not closed")
+		_, err = r.Read(buf)
+		assertErrorsIs(t, err, fs.ErrClosed)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		sentinel := errors.New("sentinel")
+		src := io.MultiReader(bytes.NewReader(randomBytes[:5000]), &alwaysErrReader{err: sentinel})
+		r := NewPrefetchReader(src, 1024, 2)
+		bin, err := io.ReadAll(r)
+		assertErrorsIs(t, err, sentinel)
+		assertBool(t, bytes.Equal(randomBytes[:5000], bin), "bytes.Equal returned false")
+		_, err = r.Read(make([]byte, 10))
+		assertErrorsIs(t, err, sentinel)
+	})
+}
+
+type alwaysErrReader struct {
+	err error
+}
+
+func (r *alwaysErrReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
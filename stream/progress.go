@@ -0,0 +1,148 @@
+package stream
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Progress is a snapshot of bytes transferred through ProgressReader or ProgressWriter.
+type Progress struct {
+	// N is the number of bytes transferred so far.
+	N int64
+	// Elapsed is the time elapsed since the wrapper was created.
+	Elapsed time.Duration
+	// Done is true for the last report, which is made once the transfer ends.
+	Done bool
+}
+
+// Rate returns the average throughput in bytes per second.
+func (p Progress) Rate() float64 {
+	if p.Elapsed <= 0 {
+		return 0
+	}
+	return float64(p.N) / p.Elapsed.Seconds()
+}
+
+type progressOption struct {
+	interval time.Duration
+	now      func() time.Time
+}
+
+type ProgressOption func(o *progressOption)
+
+// ProgressWithInterval sets minimum interval between reports. The default is 1 second.
+// If interval is zero or negative, progress is reported on every Read or Write.
+func ProgressWithInterval(interval time.Duration) ProgressOption {
+	return func(o *progressOption) {
+		o.interval = interval
+	}
+}
+
+// progressTracker counts bytes and calls fn at most once per interval.
+type progressTracker struct {
+	fn  func(p Progress)
+	opt progressOption
+
+	mu    sync.Mutex
+	start time.Time
+	last  time.Time
+	n     int64
+	done  bool
+}
+
+func newProgressTracker(fn func(p Progress), opts []ProgressOption) *progressTracker {
+	opt := progressOption{interval: time.Second, now: time.Now}
+	for _, o := range opts {
+		o(&opt)
+	}
+	now := opt.now()
+	return &progressTracker{fn: fn, opt: opt, start: now, last: now}
+}
+
+func (t *progressTracker) add(n int, finish bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.n += int64(n)
+	if t.done || (!finish && n == 0) {
+		return
+	}
+	now := t.opt.now()
+	if !finish && now.Sub(t.last) < t.opt.interval {
+		return
+	}
+	t.last = now
+	t.done = finish
+	if t.fn != nil {
+		t.fn(Progress{N: t.n, Elapsed: now.Sub(t.start), Done: finish})
+	}
+}
+
+func (t *progressTracker) progress() Progress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Progress{N: t.n, Elapsed: t.opt.now().Sub(t.start), Done: t.done}
+}
+
+// ProgressReader reads from an underlying io.Reader and reports bytes read by a callback.
+type ProgressReader struct {
+	r io.Reader
+	t *progressTracker
+}
+
+// NewProgressReader returns ProgressReader reading from r.
+// fn is called at most once per interval set by ProgressWithInterval,
+// and once more with Progress.Done set when r returns an error, including io.EOF.
+// fn is called synchronously from Read, thus it should return quickly.
+//
+// ProgressReader is goroutine safe as long as r is.
+func NewProgressReader(r io.Reader, fn func(p Progress), opts ...ProgressOption) *ProgressReader {
+	return &ProgressReader{r: r, t: newProgressTracker(fn, opts)}
+}
+
+func (r *ProgressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.t.add(n, err != nil)
+	return n, err
+}
+
+// Progress returns the current progress.
+func (r *ProgressReader) Progress() Progress {
+	return r.t.progress()
+}
+
+// ProgressWriter writes to an underlying io.Writer and reports bytes written by a callback.
+// Wrapping io.Discard, it can be used as a counter shared among other readers
+// by io.TeeReader.
+type ProgressWriter struct {
+	w io.Writer
+	t *progressTracker
+}
+
+// NewProgressWriter returns ProgressWriter writing to w.
+// fn is called at most once per interval set by ProgressWithInterval,
+// and once more with Progress.Done set when w returns an error or Finish is called.
+// fn is called synchronously from Write, thus it should return quickly.
+//
+// ProgressWriter is goroutine safe as long as w is.
+func NewProgressWriter(w io.Writer, fn func(p Progress), opts ...ProgressOption) *ProgressWriter {
+	return &ProgressWriter{w: w, t: newProgressTracker(fn, opts)}
+}
+
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.t.add(n, err != nil)
+	return n, err
+}
+
+// Finish reports the final progress with Progress.Done set, unless it is already reported.
+// It does not close the underlying writer. Bytes written after Finish are counted but never reported.
+func (w *ProgressWriter) Finish() {
+	w.t.add(0, true)
+}
+
+// Progress returns the current progress.
+func (w *ProgressWriter) Progress() Progress {
+	return w.t.progress()
+}
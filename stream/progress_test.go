@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func progressWithClock(c *fakeClock) ProgressOption {
+	return func(o *progressOption) {
+		o.now = c.Now
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var reports []Progress
+	r := NewProgressReader(
+		bytes.NewReader(randomBytes),
+		func(p Progress) { reports = append(reports, p) },
+		ProgressWithInterval(time.Second),
+		progressWithClock(clock),
+	)
+
+	buf := make([]byte, 1024)
+	for i := 0; i < 4; i++ {
+		clock.now = clock.now.Add(400 * time.Millisecond)
+		_, err := io.ReadFull(r, buf)
+		assertErrorsIs(t, err, nil)
+	}
+	// reported only once in 1.6s.
+	assertEq(t, 1, len(reports))
+	assertEq(t, Progress{N: 3 * 1024, Elapsed: 1200 * time.Millisecond}, reports[0])
+	assertEq(t, float64(3*1024)/1.2, reports[0].Rate())
+
+	clock.now = clock.now.Add(time.Second)
+	rest, err := io.ReadAll(r)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, len(randomBytes), 4*1024+len(rest))
+
+	last := reports[len(reports)-1]
+	assertEq(t, Progress{N: int64(len(randomBytes)), Elapsed: 2600 * time.Millisecond, Done: true}, last)
+	assertEq(t, int64(len(randomBytes)), r.Progress().N)
+}
+
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestProgressWriter(t *testing.T) {
+	var reports []Progress
+	var buf bytes.Buffer
+	w := NewProgressWriter(&buf, func(p Progress) { reports = append(reports, p) }, ProgressWithInterval(0))
+
+	_, err := io.Copy(w, bytes.NewReader(randomBytes))
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes, buf.Bytes()), "bytes.Equal returned false")
+	assertBool(t, len(reports) > 0, "no report")
+	assertEq(t, int64(len(randomBytes)), reports[len(reports)-1].N)
+	assertBool(t, !reports[len(reports)-1].Done, "done before Finish")
+
+	w.Finish()
+	w.Finish()
+	assertBool(t, reports[len(reports)-1].Done, "not done after Finish")
+	assertEq(t, 1, func() (c int) {
+		for _, p := range reports {
+			if p.Done {
+				c++
+			}
+		}
+		return c
+	}())
+
+	sentinel := errors.New("sentinel")
+	reports = nil
+	w = NewProgressWriter(errWriter{sentinel}, func(p Progress) { reports = append(reports, p) })
+	_, err = w.Write([]byte("foo"))
+	assertErrorsIs(t, err, sentinel)
+	assertEq(t, 1, len(reports))
+	assertEq(t, true, reports[0].Done)
+}
@@ -0,0 +1,171 @@
+package stream
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+type rateLimitOption struct {
+	ctx   context.Context
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+type RateLimitOption func(o *rateLimitOption)
+
+// RateLimitWithContext sets ctx which unblocks Read or Write waiting for the limit.
+// Once ctx is cancelled, Read and Write return ctx.Err() without reading or writing the underlying one.
+func RateLimitWithContext(ctx context.Context) RateLimitOption {
+	return func(o *rateLimitOption) {
+		o.ctx = ctx
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tokenBucket holds up to burst tokens, each of which allows a byte to be transferred,
+// and refills them at rate per second.
+type tokenBucket struct {
+	rate  float64
+	burst int
+	opt   rateLimitOption
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(bytesPerSec float64, burst int, opts []RateLimitOption) *tokenBucket {
+	opt := rateLimitOption{ctx: context.Background(), now: time.Now, sleep: sleepContext}
+	for _, o := range opts {
+		o(&opt)
+	}
+	if burst <= 0 {
+		burst = int(bytesPerSec)
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	return &tokenBucket{rate: bytesPerSec, burst: burst, opt: opt, tokens: float64(burst), last: opt.now()}
+}
+
+func (b *tokenBucket) unlimited() bool {
+	return b.rate <= 0
+}
+
+// wait takes n tokens, which must not be more than burst, blocking until they are available.
+func (b *tokenBucket) wait(n int) error {
+	if err := b.opt.ctx.Err(); err != nil {
+		return err
+	}
+	if b.unlimited() || n <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	now := b.opt.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+	// Tokens are reserved even if not yet available so that concurrent callers queue up.
+	b.tokens -= float64(n)
+	deficit := -b.tokens
+	b.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+	return b.opt.sleep(b.opt.ctx, time.Duration(deficit/b.rate*float64(time.Second)))
+}
+
+func (b *tokenBucket) chunk(p []byte) []byte {
+	if !b.unlimited() && len(p) > b.burst {
+		return p[:b.burst]
+	}
+	return p
+}
+
+type rateLimitedReader struct {
+	r io.Reader
+	b *tokenBucket
+}
+
+// NewRateLimitedReader returns a reader which reads from r no faster than bytesPerSec on average,
+// allowing bursts up to burst bytes. It is a token bucket limiter.
+// If burst is zero or negative, it defaults to bytesPerSec.
+// If bytesPerSec is zero or negative, reads are not limited.
+//
+// A single Read reads at most burst bytes and then blocks until the read bytes are allowed,
+// oversleeping the limit at most by a single Read.
+// Wrap a reader passed to e.g. SafeWrite or SplittingStorage to keep backups from saturating disks or networks.
+//
+// The returned reader is goroutine safe as long as r is.
+func NewRateLimitedReader(r io.Reader, bytesPerSec float64, burst int, opts ...RateLimitOption) io.Reader {
+	return &rateLimitedReader{r: r, b: newTokenBucket(bytesPerSec, burst, opts)}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if err := r.b.opt.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(r.b.chunk(p))
+	if wErr := r.b.wait(n); wErr != nil && err == nil {
+		err = wErr
+	}
+	return n, err
+}
+
+type rateLimitedWriter struct {
+	w io.Writer
+	b *tokenBucket
+}
+
+// NewRateLimitedWriter returns a writer which writes to w no faster than bytesPerSec on average,
+// allowing bursts up to burst bytes.
+// Parameters are interpreted as NewRateLimitedReader does.
+//
+// Write splits p into burst sized pieces and blocks before writing each piece until it is allowed.
+//
+// The returned writer is goroutine safe as long as w is.
+func NewRateLimitedWriter(w io.Writer, bytesPerSec float64, burst int, opts ...RateLimitOption) io.Writer {
+	return &rateLimitedWriter{w: w, b: newTokenBucket(bytesPerSec, burst, opts)}
+}
+
+func (w *rateLimitedWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		if err := w.b.opt.ctx.Err(); err != nil {
+			return 0, err
+		}
+		return w.w.Write(p)
+	}
+	var written int
+	for len(p) > 0 {
+		chunk := w.b.chunk(p)
+		if err := w.b.wait(len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n < len(chunk) {
+			return written, io.ErrShortWrite
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
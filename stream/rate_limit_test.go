@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// fakeSleeper advances clock instead of sleeping.
+type fakeSleeper struct {
+	clock *fakeClock
+	slept time.Duration
+}
+
+func (s *fakeSleeper) sleep(ctx context.Context, d time.Duration) error {
+	s.slept += d
+	s.clock.now = s.clock.now.Add(d)
+	return ctx.Err()
+}
+
+func rateLimitWithFakeTime(s *fakeSleeper) RateLimitOption {
+	return func(o *rateLimitOption) {
+		o.now = s.clock.Now
+		o.sleep = s.sleep
+	}
+}
+
+func TestRateLimitedReader(t *testing.T) {
+	s := &fakeSleeper{clock: &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	r := NewRateLimitedReader(bytes.NewReader(randomBytes[:10*1024]), 1024, 2048, rateLimitWithFakeTime(s))
+
+	buf := make([]byte, 4096)
+	n, err := r.Read(buf)
+	assertErrorsIs(t, err, nil)
+	// reads up to burst, which is available at once.
+	assertEq(t, 2048, n)
+	assertEq(t, time.Duration(0), s.slept)
+
+	bin, err := io.ReadAll(r)
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes[2048:10*1024], bin), "bytes.Equal returned false")
+	// the rest 8KiB takes 8 seconds at 1KiB/s.
+	assertEq(t, 8*time.Second, s.slept)
+}
+
+func TestRateLimitedWriter(t *testing.T) {
+	s := &fakeSleeper{clock: &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	var buf bytes.Buffer
+	w := NewRateLimitedWriter(&buf, 1024, 0, rateLimitWithFakeTime(s))
+
+	n, err := w.Write(randomBytes[:4096])
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 4096, n)
+	assertBool(t, bytes.Equal(randomBytes[:4096], buf.Bytes()), "bytes.Equal returned false")
+	// the first 1KiB is the burst.
+	assertEq(t, 3*time.Second, s.slept)
+
+	// tokens are refilled while idle, up to burst.
+	s.clock.now = s.clock.now.Add(time.Hour)
+	s.slept = 0
+	_, err = w.Write(randomBytes[:1024])
+	assertErrorsIs(t, err, nil)
+	assertEq(t, time.Duration(0), s.slept)
+
+	unlimited := NewRateLimitedWriter(io.Discard, 0, 0, rateLimitWithFakeTime(s))
+	_, err = unlimited.Write(randomBytes)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, time.Duration(0), s.slept)
+}
+
+func TestRateLimited_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewRateLimitedReader(bytes.NewReader(randomBytes), 1, 1, RateLimitWithContext(ctx))
+
+	done := make(chan error)
+	go func() {
+		// the second byte is allowed after a second.
+		_, err := io.ReadAll(r)
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		assertErrorsIs(t, err, context.Canceled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Read is not unblocked by the cancellation")
+	}
+
+	w := NewRateLimitedWriter(io.Discard, 1024, 0, RateLimitWithContext(ctx))
+	n, err := w.Write([]byte("foo"))
+	assertErrorsIs(t, err, context.Canceled)
+	assertEq(t, 0, n)
+}
@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// RetryPolicy configures NewRetryReaderAt.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first one,
+	// made without any progress. If zero or negative, 3 is used.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry. If zero or negative, 100ms is used.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait. If zero or negative, the wait is not capped.
+	MaxBackoff time.Duration
+	// Multiplier multiplies the wait after each retry. If less than 1, 2 is used.
+	Multiplier float64
+	// Retryable reports whether err is transient and the read should be retried.
+	// If nil, IsTimeout is used.
+	// io.EOF is never retried regardless of Retryable.
+	Retryable func(err error) bool
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.Retryable == nil {
+		p.Retryable = IsTimeout
+	}
+	return p
+}
+
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := float64(p.InitialBackoff)
+	for i := 0; i < retry; i++ {
+		d *= p.Multiplier
+		if p.MaxBackoff > 0 && d >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(d)
+}
+
+// IsTimeout reports whether err, or any error it wraps, has Timeout method returning true,
+// as net.Error and os.ErrDeadlineExceeded do.
+func IsTimeout(err error) bool {
+	var timeout interface{ Timeout() bool }
+	return errors.As(err, &timeout) && timeout.Timeout()
+}
+
+var _ io.ReaderAt = (*retryReaderAt)(nil)
+
+type retryReaderAt struct {
+	r      io.ReaderAt
+	policy RetryPolicy
+	sleep  func(d time.Duration)
+}
+
+// NewRetryReaderAt returns io.ReaderAt which reads from r, retrying transient errors with exponential backoff
+// as configured by policy.
+// It is meant for network backed ReaderAts, e.g. readers passed to NewMultiReadAtSeekCloser,
+// that occasionally fail with timeouts.
+//
+// If r returns some bytes alongside an error, they are kept and the rest is retried at the following offset.
+// Attempts are counted until the read makes progress.
+// When attempts are exhausted or the error is not retryable, ReadAt returns the last error wrapped.
+//
+// The returned ReaderAt also implements io.Closer, which closes r if r implements it.
+// It is goroutine safe as long as r is.
+func NewRetryReaderAt(r io.ReaderAt, policy RetryPolicy) io.ReaderAt {
+	return &retryReaderAt{r: r, policy: policy.withDefaults(), sleep: time.Sleep}
+}
+
+func (r *retryReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	for attempt := 1; ; attempt++ {
+		nn, err := r.r.ReadAt(p[n:], off+int64(n))
+		n += nn
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if n == len(p) {
+			return n, nil
+		}
+		if nn > 0 {
+			attempt = 0
+		}
+		if !r.policy.Retryable(err) {
+			return n, err
+		}
+		if attempt >= r.policy.MaxAttempts {
+			return n, fmt.Errorf("RetryReaderAt: giving up after %d attempts: %w", attempt, err)
+		}
+		r.sleep(r.policy.backoff(attempt - 1))
+	}
+}
+
+func (r *retryReaderAt) Close() error {
+	if c, ok := r.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// flakyReaderAt fails with errs in order, reading up to partial bytes alongside each error.
+type flakyReaderAt struct {
+	r       io.ReaderAt
+	errs    []error
+	partial int
+	calls   int
+}
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	f.calls++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		n, _ := f.r.ReadAt(p[:min(len(p), f.partial)], off)
+		return n, err
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func newTestRetryReaderAt(r io.ReaderAt, policy RetryPolicy) (io.ReaderAt, *[]time.Duration) {
+	var slept []time.Duration
+	rr := NewRetryReaderAt(r, policy)
+	rr.(*retryReaderAt).sleep = func(d time.Duration) { slept = append(slept, d) }
+	return rr, &slept
+}
+
+func TestRetryReaderAt(t *testing.T) {
+	buf := make([]byte, 1024)
+
+	t.Run("retried", func(t *testing.T) {
+		flaky := &flakyReaderAt{r: bytes.NewReader(randomBytes), errs: []error{os.ErrDeadlineExceeded, os.ErrDeadlineExceeded}}
+		r, slept := newTestRetryReaderAt(flaky, RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second, Multiplier: 4})
+		n, err := r.ReadAt(buf, 100)
+		assertErrorsIs(t, err, nil)
+		assertEq(t, 1024, n)
+		assertBool(t, bytes.Equal(randomBytes[100:1124], buf), "bytes.Equal returned false")
+		assertEq(t, 3, flaky.calls)
+		assertEq(t, 2, len(*slept))
+		assertEq(t, time.Second, (*slept)[0])
+		assertEq(t, 3*time.Second, (*slept)[1])
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		errs := []error{os.ErrDeadlineExceeded, os.ErrDeadlineExceeded, os.ErrDeadlineExceeded, os.ErrDeadlineExceeded}
+		flaky := &flakyReaderAt{r: bytes.NewReader(randomBytes), errs: errs, partial: 100}
+		// attempts are reset by progress.
+		r, _ := newTestRetryReaderAt(flaky, RetryPolicy{MaxAttempts: 2})
+		n, err := r.ReadAt(buf, 0)
+		assertErrorsIs(t, err, nil)
+		assertEq(t, 1024, n)
+		assertBool(t, bytes.Equal(randomBytes[:1024], buf), "bytes.Equal returned false")
+	})
+
+	t.Run("exhausted", func(t *testing.T) {
+		flaky := &flakyReaderAt{r: bytes.NewReader(randomBytes), errs: []error{os.ErrDeadlineExceeded, os.ErrDeadlineExceeded, os.ErrDeadlineExceeded}}
+		r, slept := newTestRetryReaderAt(flaky, RetryPolicy{MaxAttempts: 2})
+		_, err := r.ReadAt(buf, 0)
+		assertErrorsIs(t, err, os.ErrDeadlineExceeded)
+		assertErrorContains(t, err, "2 attempts")
+		assertEq(t, 2, flaky.calls)
+		assertEq(t, 1, len(*slept))
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		sentinel := errors.New("sentinel")
+		flaky := &flakyReaderAt{r: bytes.NewReader(randomBytes), errs: []error{sentinel}}
+		r, _ := newTestRetryReaderAt(flaky, RetryPolicy{})
+		_, err := r.ReadAt(buf, 0)
+		assertErrorsIs(t, err, sentinel)
+		assertEq(t, 1, flaky.calls)
+
+		flaky = &flakyReaderAt{r: bytes.NewReader(randomBytes), errs: []error{sentinel}}
+		r, _ = newTestRetryReaderAt(flaky, RetryPolicy{Retryable: func(err error) bool { return errors.Is(err, sentinel) }})
+		_, err = r.ReadAt(buf, 0)
+		assertErrorsIs(t, err, nil)
+		assertEq(t, 2, flaky.calls)
+
+		n, err := r.ReadAt(buf, int64(len(randomBytes)-10))
+		assertErrorsIs(t, err, io.EOF)
+		assertEq(t, 10, n)
+	})
+
+	t.Run("multi", func(t *testing.T) {
+		half := len(randomBytes) / 2
+		readers := []SizedReaderAt{
+			{R: NewRetryReaderAt(&flakyReaderAt{r: bytes.NewReader(randomBytes[:half]), errs: []error{os.ErrDeadlineExceeded}}, RetryPolicy{InitialBackoff: time.Nanosecond}), Size: int64(half)},
+			{R: NewRetryReaderAt(&flakyReaderAt{r: bytes.NewReader(randomBytes[half:]), errs: []error{os.ErrDeadlineExceeded}}, RetryPolicy{InitialBackoff: time.Nanosecond}), Size: int64(len(randomBytes) - half)},
+		}
+		bin, err := io.ReadAll(NewMultiReadAtSeekCloser(readers))
+		assertErrorsIs(t, err, nil)
+		assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+	})
+}
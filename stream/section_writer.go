@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrOverflow is returned when a write exceeds the limit of SectionWriter or LimitedWriter.
+var ErrOverflow = errors.New("write exceeds limit")
+
+var (
+	_ io.Writer      = (*SectionWriter)(nil)
+	_ io.WriterAt    = (*SectionWriter)(nil)
+	_ io.WriteSeeker = (*SectionWriter)(nil)
+)
+
+// SectionWriter implements Write, WriteAt and Seek on a section of an underlying io.WriterAt,
+// complementing io.SectionReader.
+// It is useful to write chunks into a preallocated file in parallel, giving each writer its own section.
+//
+// Writes exceeding the section write bytes fitting in it and then fail with an error wrapping ErrOverflow.
+type SectionWriter struct {
+	w     io.WriterAt
+	base  int64
+	off   int64
+	limit int64
+}
+
+// NewSectionWriter returns SectionWriter writing to w starting at offset off and stopping after n bytes.
+func NewSectionWriter(w io.WriterAt, off int64, n int64) *SectionWriter {
+	if n < 0 {
+		n = 0
+	}
+	return &SectionWriter{w: w, base: off, off: off, limit: off + n}
+}
+
+func (s *SectionWriter) Write(p []byte) (n int, err error) {
+	n, err = s.WriteAt(p, s.off-s.base)
+	s.off += int64(n)
+	return n, err
+}
+
+// WriteAt writes p at off relative to the start of the section. It does not move the offset of Write.
+func (s *SectionWriter) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("SectionWriter.WriteAt: %w: negative", ErrOffset)
+	}
+	off += s.base
+	if off >= s.limit {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("SectionWriter.WriteAt: %w", ErrOverflow)
+	}
+	overflow := false
+	if max := s.limit - off; int64(len(p)) > max {
+		p = p[:max]
+		overflow = true
+	}
+	n, err = s.w.WriteAt(p, off)
+	if err == nil && overflow {
+		err = fmt.Errorf("SectionWriter.WriteAt: %w", ErrOverflow)
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker. Seeking beyond the section is allowed but following writes fail.
+func (s *SectionWriter) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	default:
+		return 0, fmt.Errorf("Seek: %w = %d", ErrWhence, whence)
+	case io.SeekStart:
+		offset += s.base
+	case io.SeekCurrent:
+		offset += s.off
+	case io.SeekEnd:
+		offset += s.limit
+	}
+	if offset < s.base {
+		return 0, fmt.Errorf("Seek: %w: negative", ErrOffset)
+	}
+	s.off = offset
+	return offset - s.base, nil
+}
+
+// Size returns the size of the section in bytes.
+func (s *SectionWriter) Size() int64 {
+	return s.limit - s.base
+}
+
+type limitedWriter struct {
+	w io.Writer
+	n int64
+}
+
+// NewLimitedWriter returns a writer writing at most n bytes to w.
+// Writes exceeding the limit write bytes fitting in it and then fail with an error wrapping ErrOverflow.
+func NewLimitedWriter(w io.Writer, n int64) io.Writer {
+	if n < 0 {
+		n = 0
+	}
+	return &limitedWriter{w: w, n: n}
+}
+
+func (l *limitedWriter) Write(p []byte) (n int, err error) {
+	overflow := false
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+		overflow = true
+	}
+	n, err = l.w.Write(p)
+	l.n -= int64(n)
+	if err == nil && overflow {
+		err = fmt.Errorf("LimitedWriter.Write: %w", ErrOverflow)
+	}
+	return n, err
+}
@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// bufWriterAt is an in-memory io.WriterAt.
+type bufWriterAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (b *bufWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if end := int(off) + len(p); end > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, end-len(b.buf))...)
+	}
+	return copy(b.buf[off:], p), nil
+}
+
+func TestSectionWriter(t *testing.T) {
+	dst := &bufWriterAt{}
+	w := NewSectionWriter(dst, 100, 50)
+	assertEq(t, int64(50), w.Size())
+
+	n, err := w.Write([]byte("foo"))
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 3, n)
+	n, err = w.WriteAt([]byte("bar"), 10)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 3, n)
+	assertEq(t, "foo", string(dst.buf[100:103]))
+	assertEq(t, "bar", string(dst.buf[110:113]))
+
+	off, err := w.Seek(-2, io.SeekEnd)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(48), off)
+	n, err = w.Write([]byte("bazqux"))
+	assertErrorsIs(t, err, ErrOverflow)
+	assertEq(t, 2, n)
+	assertEq(t, 150, len(dst.buf))
+	assertEq(t, "ba", string(dst.buf[148:150]))
+
+	n, err = w.Write([]byte("x"))
+	assertErrorsIs(t, err, ErrOverflow)
+	assertEq(t, 0, n)
+	_, err = w.Seek(-1, io.SeekStart)
+	assertErrorsIs(t, err, ErrOffset)
+	_, err = w.WriteAt([]byte("x"), -1)
+	assertErrorsIs(t, err, ErrOffset)
+}
+
+func TestSectionWriter_parallel(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "file"))
+	assertErrorsIs(t, err, nil)
+	defer func() { _ = f.Close() }()
+	assertErrorsIs(t, f.Truncate(int64(len(randomBytes))), nil)
+
+	const chunkSize = 1000
+	var wg sync.WaitGroup
+	errs := make([]error, (len(randomBytes)+chunkSize-1)/chunkSize)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			off := i * chunkSize
+			end := min(off+chunkSize, len(randomBytes))
+			_, errs[i] = io.Copy(NewSectionWriter(f, int64(off), int64(end-off)), bytes.NewReader(randomBytes[off:end]))
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assertErrorsIs(t, err, nil)
+	}
+
+	bin, err := os.ReadFile(f.Name())
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+}
+
+func TestLimitedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewLimitedWriter(&buf, 5)
+	n, err := w.Write([]byte("foo"))
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 3, n)
+	n, err = w.Write([]byte("barbaz"))
+	assertErrorsIs(t, err, ErrOverflow)
+	assertEq(t, 2, n)
+	assertEq(t, "fooba", buf.String())
+	_, err = w.Write(nil)
+	assertErrorsIs(t, err, nil)
+}
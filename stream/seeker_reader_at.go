@@ -0,0 +1,69 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+type seekerReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+// NewReaderAtFromSeeker returns io.ReaderAt which reads rs by Seek followed by Read.
+// It is for seekable streams lacking usable ReadAt,
+// e.g. afero.File of backends returning errors from ReadAt,
+// so that they can be passed to NewMultiReadAtSeekCloser as SizedReaderAt.
+//
+// ReadAt calls are serialized by a mutex, thus the returned ReaderAt is goroutine safe
+// but concurrent reads do not run in parallel.
+// The offset of rs is changed by ReadAt; rs must not be used by others meanwhile.
+//
+// The returned ReaderAt also implements io.Closer, which closes rs if rs implements it.
+func NewReaderAtFromSeeker(rs io.ReadSeeker) io.ReaderAt {
+	return &seekerReaderAt{rs: rs}
+}
+
+func (s *seekerReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, fmt.Errorf("ReaderAtFromSeeker.ReadAt: %w: negative", ErrOffset)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	// ReadAt must not return n < len(p) without an error, unlike Read.
+	n, err = io.ReadFull(s.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *seekerReaderAt) Close() error {
+	if closer, ok := s.rs.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SizedReadersFromSeeker constructs []SizedReaderAt from io.ReadSeeker using NewReaderAtFromSeeker.
+// Sizes are obtained by seeking to the end of each seeker.
+func SizedReadersFromSeeker[T io.ReadSeeker](seekers []T) ([]SizedReaderAt, error) {
+	sizedReaders := make([]SizedReaderAt, len(seekers))
+	for i, rs := range seekers {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, err
+		}
+		sizedReaders[i] = SizedReaderAt{
+			R:    NewReaderAtFromSeeker(rs),
+			Size: size,
+		}
+	}
+	return sizedReaders, nil
+}
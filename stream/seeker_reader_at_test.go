@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+// seekOnly hides ReadAt of *bytes.Reader.
+type seekOnly struct {
+	io.ReadSeeker
+}
+
+func TestReaderAtFromSeeker(t *testing.T) {
+	r := NewReaderAtFromSeeker(seekOnly{bytes.NewReader(randomBytes)})
+
+	buf := make([]byte, 100)
+	n, err := r.ReadAt(buf, 1000)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 100, n)
+	assertBool(t, bytes.Equal(randomBytes[1000:1100], buf), "bytes.Equal returned false")
+
+	n, err = r.ReadAt(buf, int64(len(randomBytes)-10))
+	assertErrorsIs(t, err, io.EOF)
+	assertEq(t, 10, n)
+
+	_, err = r.ReadAt(buf, -1)
+	assertErrorsIs(t, err, ErrOffset)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			buf := make([]byte, 512)
+			_, err := r.ReadAt(buf, off)
+			assertErrorsIs(t, err, nil)
+			assertBool(t, bytes.Equal(randomBytes[off:off+512], buf), "bytes.Equal returned false at %d", off)
+		}(int64(i * 1024))
+	}
+	wg.Wait()
+}
+
+func TestSizedReadersFromSeeker(t *testing.T) {
+	seekers := []seekOnly{
+		{bytes.NewReader(randomBytes[:1000])},
+		{bytes.NewReader(randomBytes[1000:5000])},
+		{bytes.NewReader(randomBytes[5000:])},
+	}
+	sized, err := SizedReadersFromSeeker(seekers)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, int64(4000), sized[1].Size)
+
+	r := NewMultiReadAtSeekCloser(sized)
+	bin, err := io.ReadAll(r)
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+}
@@ -0,0 +1,76 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// ErrHashSumMismatch is wrapped by HashSumMismatchError.
+var ErrHashSumMismatch = errors.New("hash sum mismatch")
+
+// HashSumMismatchError is returned when a digest of read content differs from the expected one.
+// It wraps ErrHashSumMismatch.
+type HashSumMismatchError struct {
+	Expected []byte
+	Actual   []byte
+}
+
+func (e *HashSumMismatchError) Error() string {
+	return fmt.Sprintf(
+		"%s: expected = %s, actual = %s",
+		ErrHashSumMismatch, hex.EncodeToString(e.Expected), hex.EncodeToString(e.Actual),
+	)
+}
+
+func (e *HashSumMismatchError) Unwrap() error {
+	return ErrHashSumMismatch
+}
+
+// CompareHashSum returns *HashSumMismatchError if the sum of h differs from expected, nil otherwise.
+func CompareHashSum(h hash.Hash, expected []byte) error {
+	actual := h.Sum(nil)
+	if bytes.Equal(expected, actual) {
+		return nil
+	}
+	return &HashSumMismatchError{Expected: expected, Actual: actual}
+}
+
+type verifiedReader struct {
+	r        io.Reader
+	h        hash.Hash
+	expected []byte
+	err      error
+}
+
+// NewVerifiedReader returns a reader which reads from r writing read bytes to h.
+// When r returns io.EOF, it compares the sum of h with expected and
+// returns *HashSumMismatchError instead of io.EOF if they differ.
+//
+// The returned reader stores a first error and returns it for subsequent Read calls as NewCancellable does.
+// h must be reset, or newly created, before being passed.
+func NewVerifiedReader(r io.Reader, h hash.Hash, expected []byte) io.Reader {
+	return &verifiedReader{r: r, h: h, expected: expected}
+}
+
+func (v *verifiedReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+	n, err := v.r.Read(p)
+	if n > 0 {
+		_, _ = v.h.Write(p[:n])
+	}
+	if err == io.EOF {
+		if mismatch := CompareHashSum(v.h, v.expected); mismatch != nil {
+			err = mismatch
+		}
+	}
+	if err != nil {
+		v.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,32 @@
+package stream
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestVerifiedReader(t *testing.T) {
+	sum := sha256.Sum256(randomBytes)
+
+	r := NewVerifiedReader(bytes.NewReader(randomBytes), sha256.New(), sum[:])
+	bin, err := io.ReadAll(r)
+	assertErrorsIs(t, err, nil)
+	assertBool(t, bytes.Equal(randomBytes, bin), "bytes.Equal returned false")
+
+	r = NewVerifiedReader(bytes.NewReader(randomBytes[1:]), sha256.New(), sum[:])
+	_, err = io.ReadAll(r)
+	assertErrorsIs(t, err, ErrHashSumMismatch)
+	var mismatch *HashSumMismatchError
+	assertBool(t, errors.As(err, &mismatch), "not *HashSumMismatchError: %#v", err)
+	assertBool(t, bytes.Equal(sum[:], mismatch.Expected), "wrong Expected")
+	actual := sha256.Sum256(randomBytes[1:])
+	assertBool(t, bytes.Equal(actual[:], mismatch.Actual), "wrong Actual")
+	assertErrorContains(t, err, "hash sum mismatch: expected = ")
+
+	// the error is sticky.
+	_, err = r.Read(make([]byte, 10))
+	assertErrorsIs(t, err, ErrHashSumMismatch)
+}
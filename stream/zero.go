@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+type zeroReaderAt int64
+
+func (z zeroReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("ZeroReaderAt.ReadAt: %w: negative", ErrOffset)
+	}
+	if off >= int64(z) {
+		return 0, io.EOF
+	}
+	var err error
+	if rem := int64(z) - off; int64(len(p)) > rem {
+		p, err = p[:rem], io.EOF
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), err
+}
+
+// ZeroReaderAt returns SizedReaderAt of size bytes which reads as zeroes.
+// It can be used as a hole in readers passed to NewMultiReadAtSeekCloser.
+func ZeroReaderAt(size int64) SizedReaderAt {
+	return SizedReaderAt{R: zeroReaderAt(size), Size: size}
+}
+
+// PlacedReaderAt is SizedReaderAt placed at Off of a sparse stream.
+type PlacedReaderAt struct {
+	Off int64
+	SizedReaderAt
+}
+
+// SizedReadersWithGaps constructs []SizedReaderAt of total bytes from readers placed at their offsets,
+// filling gaps between them with ZeroReaderAt.
+// It is useful for reconstructing partially available files whose layout is known,
+// e.g. a file with some chunks missing.
+//
+// readers may be in any order. It returns an error wrapping ErrOffset
+// if readers overlap or any of them is placed at negative offset or beyond total.
+func SizedReadersWithGaps(total int64, readers []PlacedReaderAt) ([]SizedReaderAt, error) {
+	sorted := make([]PlacedReaderAt, len(readers))
+	copy(sorted, readers)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Off < sorted[j].Off })
+
+	var out []SizedReaderAt
+	var off int64
+	for _, r := range sorted {
+		if r.Off < off {
+			return nil, fmt.Errorf("SizedReadersWithGaps: %w: reader at %d overlaps with preceding one ending at %d", ErrOffset, r.Off, off)
+		}
+		if r.Off+r.Size > total {
+			return nil, fmt.Errorf("SizedReadersWithGaps: %w: reader at %d of size %d exceeds total %d", ErrOffset, r.Off, r.Size, total)
+		}
+		if r.Off > off {
+			out = append(out, ZeroReaderAt(r.Off-off))
+		}
+		out = append(out, r.SizedReaderAt)
+		off = r.Off + r.Size
+	}
+	if total > off {
+		out = append(out, ZeroReaderAt(total-off))
+	}
+	return out, nil
+}
@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestZeroReaderAt(t *testing.T) {
+	z := ZeroReaderAt(10)
+	assertEq(t, int64(10), z.Size)
+
+	buf := bytes.Repeat([]byte{0xff}, 8)
+	n, err := z.R.ReadAt(buf, 5)
+	assertErrorsIs(t, err, io.EOF)
+	assertEq(t, 5, n)
+	assertBool(t, bytes.Equal(make([]byte, 5), buf[:5]), "not zeroed")
+	assertEq(t, byte(0xff), buf[5])
+
+	_, err = z.R.ReadAt(buf, 10)
+	assertErrorsIs(t, err, io.EOF)
+	_, err = z.R.ReadAt(buf, -1)
+	assertErrorsIs(t, err, ErrOffset)
+}
+
+func TestSizedReadersWithGaps(t *testing.T) {
+	placed := []PlacedReaderAt{
+		{Off: 3000, SizedReaderAt: SizedReaderAt{R: bytes.NewReader(randomBytes[3000:4000]), Size: 1000}},
+		{Off: 0, SizedReaderAt: SizedReaderAt{R: bytes.NewReader(randomBytes[:1000]), Size: 1000}},
+		{Off: 4000, SizedReaderAt: SizedReaderAt{R: bytes.NewReader(randomBytes[4000:5000]), Size: 1000}},
+	}
+	readers, err := SizedReadersWithGaps(6000, placed)
+	assertErrorsIs(t, err, nil)
+	assertEq(t, 5, len(readers))
+
+	bin, err := io.ReadAll(NewMultiReadAtSeekCloser(readers))
+	assertErrorsIs(t, err, nil)
+	expected := make([]byte, 6000)
+	copy(expected, randomBytes[:1000])
+	copy(expected[3000:], randomBytes[3000:5000])
+	assertBool(t, bytes.Equal(expected, bin), "bytes.Equal returned false")
+
+	_, err = SizedReadersWithGaps(4500, placed)
+	assertErrorsIs(t, err, ErrOffset)
+	_, err = SizedReadersWithGaps(6000, append(placed, PlacedReaderAt{Off: 3500, SizedReaderAt: ZeroReaderAt(10)}))
+	assertErrorsIs(t, err, ErrOffset)
+}